@@ -1,9 +1,13 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
@@ -18,13 +22,29 @@ import (
 var (
 	port                        = flag.Uint("port", 8080, "The port to listen on.  Default 8080.")
 	address                     = flag.String("address", "127.0.0.1", "The address on the local server to listen to. Default 127.0.0.1")
-	apiPrefix                   = flag.String("api_prefix", "/api/v1beta1", "The prefix for API requests on the server. Default '/api/v1beta1'")
+	apiPrefix                   = flag.String("api_prefix", "/api", "The prefix for API requests on the server; each API version is served beneath it. Default '/api'")
+	tlsCertFile                 = flag.String("tls_cert_file", "", "File containing the certificate to serve HTTPS with. Requires -tls_private_key_file.")
+	tlsPrivateKeyFile           = flag.String("tls_private_key_file", "", "File containing the private key matching -tls_cert_file.")
+	clientCAFile                = flag.String("client_ca_file", "", "If set, clients presenting a certificate signed by one of the CAs in this file are authenticated as the certificate's common name. Requires TLS.")
+	basicAuthFile               = flag.String("basic_auth_file", "", "If set, an htpasswd file ({SHA} or $apr1$ hashes) used to authenticate basic auth requests.")
+	authorizationPolicyFile     = flag.String("authorization_policy_file", "", "If set, a file of JSON policy rules, one per line; only requests matching a rule are allowed.")
+	tokenAuthFile               = flag.String("token_auth_file", "", "If set, a CSV file of token,user[,group...] lines used to authenticate bearer token requests.")
+	auditLogFile                = flag.String("audit_log_file", "", "If set, every create, update and delete is recorded in this file as a line of JSON.")
+	auditLogMaxSize             = flag.Int64("audit_log_max_size", 100, "The size in megabytes the audit log may reach before it is rotated.")
+	auditLogBackups             = flag.Int("audit_log_backups", 5, "How many rotated audit logs to keep.")
+	auditLogBodies              = flag.Bool("audit_log_bodies", false, "If true, include request bodies in the audit log.")
+	admissionMinHostPort        = flag.Int("admission_min_host_port", 0, "If set, refuse containers asking for a host port below this one, e.g. 1024.")
+	admissionMaxReplicas        = flag.Int("admission_max_replicas", 0, "If set, refuse replication controllers asking for more replicas than this.")
 	etcdServerList, machineList util.StringList
+	admissionImagePrefixes      util.StringList
+	admissionRequiredLabels     util.StringList
 )
 
 func init() {
 	flag.Var(&etcdServerList, "etcd_servers", "Servers for the etcd (http://ip:port), comma separated")
 	flag.Var(&machineList, "machines", "List of machines to schedule onto, comma separated.")
+	flag.Var(&admissionImagePrefixes, "admission_image_prefixes", "If set, only allow container images starting with one of these prefixes, comma separated.")
+	flag.Var(&admissionRequiredLabels, "admission_required_labels", "Label keys every task, and every replication controller's task template, must carry, comma separated.")
 }
 
 func main() {
@@ -38,6 +58,7 @@ func main() {
 		taskRegistry       registry.TaskRegistry
 		controllerRegistry registry.ControllerRegistry
 		serviceRegistry    registry.ServiceRegistry
+		quotaRegistry      registry.QuotaRegistry
 	)
 
 	if len(etcdServerList) > 0 {
@@ -46,10 +67,23 @@ func main() {
 		taskRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
 		controllerRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
 		serviceRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
+		quotaRegistry = registry.MakeEtcdRegistry(etcdClient, machineList)
+		// Objects stored before namespaces are hidden until they're moved into one.
+		go func() {
+			for {
+				err := registry.MakeEtcdRegistry(etcdClient, machineList).MigrateToNamespaces()
+				if err == nil {
+					return
+				}
+				log.Printf("Unable to move objects into namespaces, retrying: %v", err)
+				time.Sleep(time.Second * 10)
+			}
+		}()
 	} else {
 		taskRegistry = registry.MakeMemoryRegistry()
 		controllerRegistry = registry.MakeMemoryRegistry()
 		serviceRegistry = registry.MakeMemoryRegistry()
+		quotaRegistry = registry.MakeMemoryRegistry()
 	}
 
 	containerInfo := &kube_client.HTTPContainerInfo{
@@ -57,21 +91,113 @@ func main() {
 		Port:   10250,
 	}
 
+	quota := registry.MakeQuotaTracker(quotaRegistry, taskRegistry, controllerRegistry, serviceRegistry)
 	storage := map[string]apiserver.RESTStorage{
-		"tasks":                  registry.MakeTaskRegistryStorage(taskRegistry, containerInfo, registry.MakeFirstFitScheduler(machineList, taskRegistry)),
-		"replicationControllers": registry.MakeControllerRegistryStorage(controllerRegistry),
-		"services":               registry.MakeServiceRegistryStorage(serviceRegistry),
+		"tasks":                  registry.MakeTaskRegistryStorage(taskRegistry, containerInfo, registry.MakeFirstFitScheduler(machineList, taskRegistry), quota),
+		"replicationControllers": registry.MakeControllerRegistryStorage(controllerRegistry, quota),
+		"services":               registry.MakeServiceRegistryStorage(serviceRegistry, quota),
+		"quotas":                 registry.MakeQuotaRegistryStorage(quotaRegistry, quota),
 	}
 
 	endpoints := registry.MakeEndpointController(serviceRegistry, taskRegistry)
 	go util.Forever(func() { endpoints.SyncServiceEndpoints() }, time.Second*10)
 
+	config := apiserver.Config{}
+	if len(*authorizationPolicyFile) > 0 {
+		authorizer, err := apiserver.NewPolicyFileAuthorizer(*authorizationPolicyFile)
+		if err != nil {
+			log.Fatalf("Unable to load the authorization policy: %v", err)
+		}
+		config.Authorizer = authorizer
+	}
+	if admission := makeAdmissionControllers(); len(admission) > 0 {
+		config.Admission = apiserver.NewAdmissionChain(admission...)
+	}
+
+	if len(*auditLogFile) > 0 {
+		file, err := util.NewRotatingFile(*auditLogFile, *auditLogMaxSize<<20, *auditLogBackups)
+		if err != nil {
+			log.Fatalf("Unable to open the audit log: %v", err)
+		}
+		config.Auditor = apiserver.NewAuditLog(file, *auditLogBodies)
+	}
+
+	handler := apiserver.NewVersioned(storage, *apiPrefix, config)
+	authenticators := makeAuthenticators()
+	if len(authenticators) > 0 {
+		handler = apiserver.WithAuthentication(handler, apiserver.NewUnionAuthenticator(authenticators...))
+	} else if ip := net.ParseIP(*address); ip == nil || !ip.IsLoopback() {
+		log.Printf("WARNING: serving on %s without authentication", *address)
+	}
+
 	s := &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", *address, *port),
-		Handler:        apiserver.New(storage, *apiPrefix),
+		Handler:        handler,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	log.Fatal(s.ListenAndServe())
+	if len(*tlsCertFile) == 0 && len(*tlsPrivateKeyFile) == 0 {
+		if len(*clientCAFile) > 0 {
+			log.Fatal("-client_ca_file requires -tls_cert_file and -tls_private_key_file")
+		}
+		log.Fatal(s.ListenAndServe())
+	}
+	s.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(*clientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(*clientCAFile)
+		if err != nil {
+			log.Fatalf("Unable to read client CAs: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s", *clientCAFile)
+		}
+		s.TLSConfig.ClientCAs = pool
+		// Clients may still use a password or token instead.
+		s.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	log.Fatal(s.ListenAndServeTLS(*tlsCertFile, *tlsPrivateKeyFile))
+}
+
+// makeAuthenticators returns an authenticator for every kind of credential enabled by
+// flags.
+func makeAuthenticators() []apiserver.Authenticator {
+	authenticators := []apiserver.Authenticator{}
+	if len(*clientCAFile) > 0 {
+		authenticators = append(authenticators, apiserver.NewClientCertAuthenticator())
+	}
+	if len(*basicAuthFile) > 0 {
+		authenticator, err := apiserver.NewPasswordFileAuthenticator(*basicAuthFile)
+		if err != nil {
+			log.Fatalf("Unable to load the basic auth file: %v", err)
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if len(*tokenAuthFile) > 0 {
+		authenticator, err := apiserver.NewTokenFileAuthenticator(*tokenAuthFile)
+		if err != nil {
+			log.Fatalf("Unable to load the token auth file: %v", err)
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	return authenticators
+}
+
+// makeAdmissionControllers returns the admission controllers enabled by flags.
+func makeAdmissionControllers() []apiserver.AdmissionController {
+	admission := []apiserver.AdmissionController{}
+	if len(admissionImagePrefixes) > 0 {
+		admission = append(admission, apiserver.NewImagePrefixAdmission(admissionImagePrefixes))
+	}
+	if *admissionMinHostPort > 0 {
+		admission = append(admission, apiserver.NewHostPortAdmission(*admissionMinHostPort))
+	}
+	if len(admissionRequiredLabels) > 0 {
+		admission = append(admission, apiserver.NewRequiredLabelsAdmission(admissionRequiredLabels))
+	}
+	if *admissionMaxReplicas > 0 {
+		admission = append(admission, apiserver.NewMaxReplicasAdmission(*admissionMaxReplicas))
+	}
+	return admission
 }
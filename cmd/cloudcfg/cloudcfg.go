@@ -3,14 +3,24 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"k8s-firstcommit/pkg/api"
 	kube_client "k8s-firstcommit/pkg/client"
 	"k8s-firstcommit/pkg/cloudcfg"
+	"k8s-firstcommit/pkg/fields"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/stream"
 )
 
 const APP_VERSION = "0.1"
@@ -19,14 +29,27 @@ const APP_VERSION = "0.1"
 var versionFlag *bool = flag.Bool("v", false, "Print the version number.")
 var httpServer *string = flag.String("h", "", "The host to connect to.")
 var config *string = flag.String("c", "", "Path to the config file.")
-var labelQuery *string = flag.String("l", "", "Label query to use for listing")
+var labelQuery *string = flag.String("l", "", "Label selector to use for listing, e.g. 'name=frontend,tier in (web,cache),!canary'")
+var fieldQuery *string = flag.String("fields", "", "Field selector to use for listing, e.g. 'currentState.host=machine1,desiredState.replicas>0'")
+var limit *int = flag.Int("limit", 0, "If positive, list at most this many objects; the output carries a token for -continue to read the rest")
+var continueToken *string = flag.String("continue", "", "The continue token of a list cut short by -limit, to read its next page")
+var patchType *string = flag.String("patch_type", "strategic", "The kind of patch read from -c by 'patch': 'json' (RFC 6902), 'merge' (RFC 7386) or 'strategic'")
+var dryRun *bool = flag.Bool("dry_run", false, "Have the server check a create, update, patch, label or delete without making it, and print the object it would store")
+var taskContainer *string = flag.String("container", "", "The container of a task which 'logs', 'exec' and 'port-forward' are for, needed for tasks with several containers")
+var follow *bool = flag.Bool("follow", false, "Have 'logs' keep printing the container's output as it is written")
+var tail *int = flag.Int("tail", -1, "If not negative, have 'logs' print only this many lines from the end of the output")
+var timestamps *bool = flag.Bool("timestamps", false, "Have 'logs' prefix every line with the time it was written")
+var execStdin *bool = flag.Bool("stdin", false, "Have 'exec' send stdin to the command")
+var execTTY *bool = flag.Bool("tty", false, "Have 'exec' run the command in a terminal, which stdin's terminal is put in raw mode for")
 var updatePeriod *time.Duration = flag.Duration("u", 60*time.Second, "Update interarrival in seconds")
 var portSpec *string = flag.String("p", "", "The port spec, comma-separated list of <external>:<internal>,...")
 var servicePort *int = flag.Int("s", -1, "If positive, create and run a corresponding service on this port, only used with 'run'")
+var namespace *string = flag.String("n", "", "The namespace to work in, the server's default namespace if empty")
+var yamlOutput *bool = flag.Bool("yaml", false, "Ask the server for YAML instead of JSON output")
 var authConfig *string = flag.String("auth", os.Getenv("HOME")+"/.kubernetes_auth", "Path to the auth info file.  If missing, prompt the user")
 
 func usage() {
-	log.Fatal("Usage: cloudcfg -h <host> [-c config/file.json] [-p <hostPort>:<containerPort>,..., <hostPort-n>:<containerPort-n> <method> <path>")
+	log.Fatal("Usage: cloudcfg -h <host> [-c config/file.json|config/file.yaml] [-n <namespace>] [-limit <n>] [-continue <token>] [-patch_type json|merge|strategic] [-dry_run] [-container <name>] [-stdin] [-tty] [-follow] [-tail <n>] [-timestamps] [-yaml] [-p <hostPort>:<containerPort>,..., <hostPort-n>:<containerPort-n> <method> <path>")
 }
 
 // CloudCfg command line tool.
@@ -42,7 +65,11 @@ func main() {
 		usage()
 	}
 	method := flag.Arg(0)
-	url := *httpServer + "/api/v1beta1" + flag.Arg(1)
+	prefix := *httpServer + "/api/v1beta1"
+	if *namespace != "" {
+		prefix = *httpServer + "/api/v1beta1/namespaces/" + *namespace
+	}
+	url := prefix + flag.Arg(1)
 	var request *http.Request
 	var err error
 
@@ -51,9 +78,36 @@ func main() {
 		log.Fatalf("Error loading auth: %#v", err)
 	}
 
+	switch method {
+	case "create", "update", "patch", "label", "delete":
+		if *dryRun {
+			url = url + "?dryRun=true"
+		}
+	}
 	if method == "get" || method == "list" {
+		query := neturl.Values{}
 		if len(*labelQuery) > 0 && method == "list" {
-			url = url + "?labels=" + *labelQuery
+			selector, err := labels.Parse(*labelQuery)
+			if err != nil {
+				log.Fatalf("Error parsing -l: %v", err)
+			}
+			query.Set("labels", selector.String())
+		}
+		if len(*fieldQuery) > 0 && method == "list" {
+			selector, err := fields.Parse(*fieldQuery)
+			if err != nil {
+				log.Fatalf("Error parsing -fields: %v", err)
+			}
+			query.Set("fields", selector.String())
+		}
+		if *limit > 0 && method == "list" {
+			query.Set("limit", strconv.Itoa(*limit))
+		}
+		if len(*continueToken) > 0 && method == "list" {
+			query.Set("continue", *continueToken)
+		}
+		if len(query) > 0 {
+			url = url + "?" + query.Encode()
 		}
 		request, err = http.NewRequest("GET", url, nil)
 	} else if method == "delete" {
@@ -62,10 +116,123 @@ func main() {
 		request, err = cloudcfg.RequestWithBody(*config, url, "POST")
 	} else if method == "update" {
 		request, err = cloudcfg.RequestWithBody(*config, url, "PUT")
+	} else if method == "patch" {
+		types := map[string]api.PatchType{
+			"json":      api.JSONPatchType,
+			"merge":     api.MergePatchType,
+			"strategic": api.StrategicMergePatchType,
+		}
+		contentType, ok := types[*patchType]
+		if !ok {
+			log.Fatalf("Unknown -patch_type %q", *patchType)
+		}
+		request, err = cloudcfg.RequestWithBody(*config, url, "PATCH")
+		if err == nil {
+			request.Header.Set("Content-Type", string(contentType))
+		}
+	} else if method == "label" {
+		if len(flag.Args()) < 3 {
+			log.Fatal("usage: cloudcfg -h <host> label <path> <key>=<value>|<key>- ...")
+		}
+		var patch []byte
+		patch, err = cloudcfg.LabelPatch(flag.Args()[2:])
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		request, err = cloudcfg.RequestWithBodyData(patch, url, "PATCH")
+		if err == nil {
+			request.Header.Set("Content-Type", string(api.MergePatchType))
+		}
+	} else if method == "logs" {
+		query := neturl.Values{}
+		if len(*taskContainer) > 0 {
+			query.Set("container", *taskContainer)
+		}
+		if *follow {
+			query.Set("follow", "true")
+		}
+		if *tail >= 0 {
+			query.Set("tail", strconv.Itoa(*tail))
+		}
+		if *timestamps {
+			query.Set("timestamps", "true")
+		}
+		url = prefix + "/tasks/" + neturl.PathEscape(flag.Arg(1)) + "/log"
+		if len(query) > 0 {
+			url = url + "?" + query.Encode()
+		}
+		request, err = http.NewRequest("GET", url, nil)
+		if err != nil {
+			log.Fatalf("Error: %#v", err)
+		}
+		err = cloudcfg.StreamRequest(request, auth.User, auth.Password, os.Stdout)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	} else if method == "exec" {
+		if len(flag.Args()) < 3 {
+			log.Fatal("usage: cloudcfg -h <host> [-container <name>] [-stdin] [-tty] exec <task> <command> [<arg>...]")
+		}
+		query := neturl.Values{"command": flag.Args()[2:]}
+		if len(*taskContainer) > 0 {
+			query.Set("container", *taskContainer)
+		}
+		if *execStdin {
+			query.Set("stdin", "true")
+		}
+		if *execTTY {
+			query.Set("tty", "true")
+		}
+		conn, err := cloudcfg.DialStream(prefix+"/tasks/"+neturl.PathEscape(flag.Arg(1))+"/exec?"+query.Encode(), auth.User, auth.Password)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		var stdin io.Reader
+		if *execStdin {
+			stdin = os.Stdin
+		}
+		restore := func() {}
+		if *execTTY {
+			restore, err = cloudcfg.RawTerminal()
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			forwardResizes(conn)
+		}
+		code, err := cloudcfg.Exec(conn, stdin, os.Stdout, os.Stderr)
+		restore()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		os.Exit(code)
+	} else if method == "port-forward" {
+		if len(flag.Args()) != 3 {
+			log.Fatal("usage: cloudcfg -h <host> [-container <name>] port-forward <task> [<localPort>:]<port>")
+		}
+		localPort, port := flag.Arg(2), flag.Arg(2)
+		if parts := strings.SplitN(flag.Arg(2), ":", 2); len(parts) == 2 {
+			localPort, port = parts[0], parts[1]
+		}
+		query := neturl.Values{"port": {port}}
+		if len(*taskContainer) > 0 {
+			query.Set("container", *taskContainer)
+		}
+		url = prefix + "/tasks/" + neturl.PathEscape(flag.Arg(1)) + "/portforward?" + query.Encode()
+		listener, err := net.Listen("tcp", net.JoinHostPort("localhost", localPort))
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		log.Printf("Forwarding %s to port %s of %s", listener.Addr(), port, flag.Arg(1))
+		err = cloudcfg.ForwardPort(listener, func() (*stream.Conn, error) {
+			return cloudcfg.DialStream(url, auth.User, auth.Password)
+		})
+		log.Fatalf("Error: %v", err)
 	} else if method == "rollingupdate" {
 		client := &kube_client.Client{
-			Host: *httpServer,
-			Auth: &auth,
+			Host:      *httpServer,
+			Namespace: *namespace,
+			Auth:      &auth,
 		}
 		cloudcfg.Update(flag.Arg(1), client, *updatePeriod)
 	} else if method == "run" {
@@ -79,19 +246,32 @@ func main() {
 		if err != nil {
 			log.Fatalf("Error parsing replicas: %#v", err)
 		}
-		err = cloudcfg.RunController(image, name, replicas, kube_client.Client{Host: *httpServer, Auth: &auth}, *portSpec, *servicePort)
+		err = cloudcfg.RunController(image, name, replicas, kube_client.Client{Host: *httpServer, Namespace: *namespace, Auth: &auth}, *portSpec, *servicePort)
+		if err != nil {
+			log.Fatalf("Error: %#v", err)
+		}
+		return
+	} else if method == "resize" {
+		if len(flag.Args()) != 3 {
+			log.Fatal("usage: cloudcfg -h <host> resize <name> <replicas>")
+		}
+		replicas, err := strconv.Atoi(flag.Arg(2))
+		if err != nil {
+			log.Fatalf("Error parsing replicas: %#v", err)
+		}
+		err = cloudcfg.ResizeController(flag.Arg(1), replicas, kube_client.Client{Host: *httpServer, Namespace: *namespace, Auth: &auth})
 		if err != nil {
 			log.Fatalf("Error: %#v", err)
 		}
 		return
 	} else if method == "stop" {
-		err = cloudcfg.StopController(flag.Arg(1), kube_client.Client{Host: *httpServer, Auth: &auth})
+		err = cloudcfg.StopController(flag.Arg(1), kube_client.Client{Host: *httpServer, Namespace: *namespace, Auth: &auth})
 		if err != nil {
 			log.Fatalf("Error: %#v", err)
 		}
 		return
 	} else if method == "rm" {
-		err = cloudcfg.DeleteController(flag.Arg(1), kube_client.Client{Host: *httpServer, Auth: &auth})
+		err = cloudcfg.DeleteController(flag.Arg(1), kube_client.Client{Host: *httpServer, Namespace: *namespace, Auth: &auth})
 		if err != nil {
 			log.Fatalf("Error: %#v", err)
 		}
@@ -102,6 +282,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error: %#v", err)
 	}
+	if *yamlOutput {
+		request.Header.Set("Accept", "application/yaml")
+	}
 	var body string
 	body, err = cloudcfg.DoRequest(request, auth.User, auth.Password)
 	if err != nil {
@@ -109,3 +292,18 @@ func main() {
 	}
 	fmt.Println(body)
 }
+
+// forwardResizes sends the size of stdin's terminal down conn, now and whenever it
+// changes.
+func forwardResizes(conn *stream.Conn) {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	go func() {
+		for {
+			if size, err := cloudcfg.TerminalSize(); err == nil {
+				conn.WriteJSON(stream.Resize, size)
+			}
+			<-resized
+		}
+	}()
+}
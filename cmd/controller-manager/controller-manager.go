@@ -2,9 +2,13 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-etcd/etcd"
@@ -15,7 +19,9 @@ import (
 
 var (
 	etcd_servers = flag.String("etcd_servers", "", "Servers for the etcd (http://ip:port).")
-	master       = flag.String("master", "", "The address of the Kubernetes API server")
+	master       = flag.String("master", "", "The address of the Kubernetes API server, http:// unless it names a scheme")
+	authConfig   = flag.String("auth", "", "Path to a JSON file with the credentials to send to the API server, either a User and Password or a BearerToken. Needed when the API server authenticates its clients.")
+	pageSize     = flag.Int("page_size", 500, "The most objects to read from the API server per request when listing, 0 for no limit")
 )
 
 func main() {
@@ -28,12 +34,40 @@ func main() {
 	// Set up logger for etcd client
 	etcd.SetLogger(log.New(os.Stderr, "etcd ", log.LstdFlags))
 
-	controllerManager := registry.MakeReplicationManager(etcd.NewClient([]string{*etcd_servers}),
-		kube_client.Client{
-			Host: "http://" + *master,
-		})
+	client := kube_client.Client{
+		Host:     *master,
+		PageSize: *pageSize,
+	}
+	if !strings.Contains(client.Host, "://") {
+		client.Host = "http://" + client.Host
+	}
+	if len(*authConfig) > 0 {
+		auth, err := loadAuthInfo(*authConfig)
+		if err != nil {
+			log.Fatalf("Error loading auth: %v", err)
+		}
+		client.Auth = &auth
+	}
+	controllerManager := registry.MakeReplicationManager(etcd.NewClient([]string{*etcd_servers}), client)
 
 	go util.Forever(func() { controllerManager.Synchronize() }, 20*time.Second)
 	go util.Forever(func() { controllerManager.WatchControllers() }, 20*time.Second)
 	select {}
 }
+
+// loadAuthInfo reads the credentials in the file at path. Unlike cloudcfg, which asks
+// for missing credentials, the controller manager runs unattended and fails instead.
+func loadAuthInfo(path string) (kube_client.AuthInfo, error) {
+	var auth kube_client.AuthInfo
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return auth, err
+	}
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return auth, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(auth.BearerToken) == 0 && len(auth.User) == 0 {
+		return auth, fmt.Errorf("%s: expected a User and Password or a BearerToken", path)
+	}
+	return auth, nil
+}
@@ -3,7 +3,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/http/httptest"
@@ -26,10 +25,10 @@ func main() {
 
 	reg := registry.MakeEtcdRegistry(etcdClient, machineList)
 
-	apiserver := apiserver.New(map[string]apiserver.RESTStorage{
-		"tasks":                  registry.MakeTaskRegistryStorage(reg, &kube_client.FakeContainerInfo{}, registry.MakeRoundRobinScheduler(machineList)),
-		"replicationControllers": registry.MakeControllerRegistryStorage(reg),
-	}, "/api/v1beta1")
+	apiserver := apiserver.NewVersioned(map[string]apiserver.RESTStorage{
+		"tasks":                  registry.MakeTaskRegistryStorage(reg, &kube_client.FakeContainerInfo{}, registry.MakeRoundRobinScheduler(machineList), nil),
+		"replicationControllers": registry.MakeControllerRegistryStorage(reg, nil),
+	}, "/api", apiserver.Config{})
 	server := httptest.NewServer(apiserver)
 
 	controllerManager := registry.MakeReplicationManager(etcd.NewClient(servers),
@@ -53,7 +52,7 @@ func main() {
 		log.Fatalf("Unexpected error: %#v", err)
 	}
 	var controllerRequest api.ReplicationController
-	if err = json.Unmarshal(data, &controllerRequest); err != nil {
+	if err = api.DecodeInto(data, &controllerRequest); err != nil {
 		log.Fatalf("Unexpected error: %#v", err)
 	}
 
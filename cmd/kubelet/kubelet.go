@@ -1,7 +1,7 @@
 // The kubelet binary is responsible for maintaining a set of containers on a particular host VM.
 // It sync's data from both configuration file as well as from a quorum of etcd servers.
-// It then queries Docker to see what is currently running.  It synchronizes the configuration data,
-// with the running set of containers by starting or stopping Docker containers.
+// It then queries its container runtime, Docker or plain processes, to see what is currently running.
+// It synchronizes the configuration data, with the running set of containers by starting or stopping containers.
 package main
 
 import (
@@ -25,6 +25,10 @@ var (
 	manifest_url       = flag.String("manifest_url", "", "URL for accessing the container manifest")
 	address            = flag.String("address", "127.0.0.1", "The address for the info server to serve on")
 	port               = flag.Uint("port", 10250, "The port for the info server to serve on")
+	runtime            = flag.String("runtime", "docker", "The container runtime: docker, or process to run containers as processes without Docker")
+	imageRoot          = flag.String("image_root", "/var/lib/kubelet/images", "The directory holding the root filesystem of every image, for the process runtime")
+	logRoot            = flag.String("log_root", "/var/lib/kubelet/logs", "The directory to write the output of containers to, for the process runtime")
+	registryAuth       = flag.String("registry_credentials", "", "Path to a file of registry credentials to pull images with, in the format of .dockercfg, for the docker runtime")
 )
 
 const dockerBinary = "/usr/bin/docker"
@@ -36,14 +40,30 @@ func main() {
 	// Set up logger for etcd client
 	etcd.SetLogger(log.New(os.Stderr, "etcd ", log.LstdFlags))
 
-	endpoint := "unix:///var/run/docker.sock"
-	dockerClient, err := docker.NewClient(endpoint)
-	if err != nil {
-		log.Fatal("Couldn't connnect to docker.")
+	var containerRuntime kubelet.ContainerRuntime
+	switch *runtime {
+	case "docker":
+		endpoint := "unix:///var/run/docker.sock"
+		dockerClient, err := docker.NewClient(endpoint)
+		if err != nil {
+			log.Fatal("Couldn't connnect to docker.")
+		}
+		dockerRuntime := kubelet.NewDockerRuntime(dockerClient)
+		if len(*registryAuth) > 0 {
+			dockerRuntime.Credentials, err = docker.NewAuthConfigurationsFromFile(*registryAuth)
+			if err != nil {
+				log.Fatalf("Couldn't read registry credentials: %v", err)
+			}
+		}
+		containerRuntime = dockerRuntime
+	case "process":
+		containerRuntime = kubelet.NewProcessRuntime(*imageRoot, *logRoot)
+	default:
+		log.Fatalf("Unknown container runtime %q.", *runtime)
 	}
 
 	my_kubelet := kubelet.Kubelet{
-		DockerClient:       dockerClient,
+		Runtime:            containerRuntime,
 		FileCheckFrequency: *fileCheckFrequency,
 		SyncFrequency:      *syncFrequency,
 		HTTPCheckFrequency: *httpCheckFrequency,
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"k8s-firstcommit/pkg/conversion"
+)
+
+// commandLineFromWords splits words, a command line as v1beta1 has it, into a
+// CommandLine.
+func commandLineFromWords(words string) CommandLine {
+	fields := strings.Fields(words)
+	if len(fields) == 0 {
+		return nil
+	}
+	return CommandLine(fields)
+}
+
+// convertCommandLineToWords joins in into the string v1beta1 has. v1beta1 can't express
+// arguments which contain spaces; they are split when read back.
+func convertCommandLineToWords(in *CommandLine, out *string, s conversion.Scope) error {
+	*out = strings.Join(*in, " ")
+	return nil
+}
+
+// convertWordsToCommandLine splits the string v1beta1 has into a CommandLine.
+func convertWordsToCommandLine(in *string, out *CommandLine, s conversion.Scope) error {
+	*out = commandLineFromWords(*in)
+	return nil
+}
+
+// UnmarshalJSON reads a CommandLine from either a list or a string of words.
+func (c *CommandLine) UnmarshalJSON(data []byte) error {
+	var words string
+	if err := json.Unmarshal(data, &words); err == nil {
+		*c = commandLineFromWords(words)
+		return nil
+	}
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// UnmarshalYAML reads a CommandLine from either a list or a string of words.
+func (c *CommandLine) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var words string
+	if err := unmarshal(&words); err == nil {
+		*c = commandLineFromWords(words)
+		return nil
+	}
+	var args []string
+	if err := unmarshal(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCommandLineRoundTrip(t *testing.T) {
+	data := []byte(`{"kind": "Task", "apiVersion": "v1beta1", "id": "foo", "desiredState": {"manifest": {"containers": [
+		{"name": "redis", "command": "redis-server  --port 6380"},
+		{"name": "web"}
+	]}}}`)
+	var task Task
+	if err := DecodeInto(data, &task); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	containers := task.DesiredState.Manifest.Containers
+	if !reflect.DeepEqual(containers[0].Command, CommandLine{"redis-server", "--port", "6380"}) || containers[1].Command != nil {
+		t.Errorf("Unexpected containers: %#v", containers)
+	}
+
+	encoded, err := Encode(task)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"command":"redis-server --port 6380"`) {
+		t.Errorf("Expected the command as one string: %s", encoded)
+	}
+	var decoded Task
+	if err := DecodeInto(encoded, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.DesiredState.Manifest.Containers, containers) {
+		t.Errorf("Expected %#v, got %#v", containers, decoded.DesiredState.Manifest.Containers)
+	}
+}
+
+func TestCommandLineUnmarshal(t *testing.T) {
+	expected := CommandLine{"sh", "-c", "echo hello"}
+	var container Container
+	if err := json.Unmarshal([]byte(`{"command": ["sh", "-c", "echo hello"]}`), &container); err != nil || !reflect.DeepEqual(container.Command, expected) {
+		t.Errorf("Unexpected command %#v: %v", container.Command, err)
+	}
+	// Tasks stored before commands were split have a string.
+	container = Container{}
+	if err := json.Unmarshal([]byte(`{"command": "sh -c true"}`), &container); err != nil || !reflect.DeepEqual(container.Command, CommandLine{"sh", "-c", "true"}) {
+		t.Errorf("Unexpected command %#v: %v", container.Command, err)
+	}
+	container = Container{}
+	if err := yaml.Unmarshal([]byte("command: [sh, -c, echo hello]\n"), &container); err != nil || !reflect.DeepEqual(container.Command, expected) {
+		t.Errorf("Unexpected command %#v: %v", container.Command, err)
+	}
+	container = Container{}
+	if err := yaml.Unmarshal([]byte("command: sh -c true\n"), &container); err != nil || !reflect.DeepEqual(container.Command, CommandLine{"sh", "-c", "true"}) {
+		t.Errorf("Unexpected command %#v: %v", container.Command, err)
+	}
+	if err := json.Unmarshal([]byte(`{"command": 1}`), &container); err == nil {
+		t.Errorf("Expected an error for a number")
+	}
+}
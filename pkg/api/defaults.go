@@ -0,0 +1,62 @@
+package api
+
+// ManifestVersion is the manifest version assumed when a manifest doesn't name one.
+const ManifestVersion = "v1beta1"
+
+// ProtocolTCP is the protocol of ports which don't specify one.
+const ProtocolTCP = "TCP"
+
+const (
+	// NamespaceDefault is the namespace of objects created without naming one.
+	NamespaceDefault = "default"
+	// NamespaceAll, passed where a namespace is expected, means every namespace.
+	NamespaceAll = ""
+)
+
+// NamespaceOrDefault returns namespace, or NamespaceDefault if it is empty. Objects
+// written before namespaces existed don't carry one.
+func NamespaceOrDefault(namespace string) string {
+	if len(namespace) == 0 {
+		return NamespaceDefault
+	}
+	return namespace
+}
+
+// DefaultManifest fills in the fields of a manifest which users may leave out.
+func DefaultManifest(manifest *ContainerManifest) {
+	if len(manifest.Version) == 0 {
+		manifest.Version = ManifestVersion
+	}
+	for i := range manifest.Containers {
+		ports := manifest.Containers[i].Ports
+		for j := range ports {
+			if len(ports[j].Protocol) == 0 {
+				ports[j].Protocol = ProtocolTCP
+			}
+			// Most containers listen on the same port they are exposed on.
+			if ports[j].ContainerPort == 0 {
+				ports[j].ContainerPort = ports[j].HostPort
+			}
+		}
+	}
+}
+
+// DefaultTask fills in the defaults of a task's desired manifest.
+func DefaultTask(task *Task) {
+	DefaultManifest(&task.DesiredState.Manifest)
+}
+
+// DefaultReplicationController fills in the defaults of a controller's task template. A
+// controller without ReplicasInSet counts the tasks that carry its template's labels,
+// which is almost always what was meant.
+func DefaultReplicationController(controller *ReplicationController) {
+	template := &controller.DesiredState.TaskTemplate
+	DefaultManifest(&template.DesiredState.Manifest)
+	if len(controller.DesiredState.ReplicasInSet) == 0 && len(template.Labels) > 0 {
+		replicasInSet := map[string]string{}
+		for key, value := range template.Labels {
+			replicasInSet[key] = value
+		}
+		controller.DesiredState.ReplicasInSet = replicasInSet
+	}
+}
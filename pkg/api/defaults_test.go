@@ -0,0 +1,45 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultManifest(t *testing.T) {
+	manifest := ContainerManifest{
+		Containers: []Container{
+			{Ports: []Port{{HostPort: 8080}, {HostPort: 8081, ContainerPort: 81, Protocol: "UDP"}}},
+		},
+	}
+	DefaultManifest(&manifest)
+	if manifest.Version != ManifestVersion {
+		t.Errorf("Unexpected version: %s", manifest.Version)
+	}
+	expected := []Port{
+		{HostPort: 8080, ContainerPort: 8080, Protocol: ProtocolTCP},
+		{HostPort: 8081, ContainerPort: 81, Protocol: "UDP"},
+	}
+	if !reflect.DeepEqual(manifest.Containers[0].Ports, expected) {
+		t.Errorf("Unexpected ports: %#v", manifest.Containers[0].Ports)
+	}
+}
+
+func TestDefaultReplicationController(t *testing.T) {
+	controller := ReplicationController{
+		DesiredState: ReplicationControllerState{
+			TaskTemplate: TaskTemplate{
+				Labels: map[string]string{"name": "nginx"},
+			},
+		},
+	}
+	DefaultReplicationController(&controller)
+	if !reflect.DeepEqual(controller.DesiredState.ReplicasInSet, map[string]string{"name": "nginx"}) {
+		t.Errorf("Unexpected replicasInSet: %#v", controller.DesiredState.ReplicasInSet)
+	}
+
+	controller.DesiredState.ReplicasInSet = map[string]string{"app": "web"}
+	DefaultReplicationController(&controller)
+	if !reflect.DeepEqual(controller.DesiredState.ReplicasInSet, map[string]string{"app": "web"}) {
+		t.Errorf("Expected replicasInSet to be kept: %#v", controller.DesiredState.ReplicasInSet)
+	}
+}
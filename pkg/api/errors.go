@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StatusError is an error which carries a Status object. Registries return these so the
+// API server can pick the right HTTP status code, and the client decodes failed responses
+// back into them so callers can tell the difference between, for example, a missing task
+// and an unreachable etcd.
+type StatusError struct {
+	ErrStatus Status
+}
+
+func (e *StatusError) Error() string {
+	return e.ErrStatus.Message
+}
+
+// Status returns the Status object carried by this error.
+func (e *StatusError) Status() Status {
+	return e.ErrStatus
+}
+
+func newStatusError(code int, reason StatusReason, kind, id, message string) *StatusError {
+	return &StatusError{Status{
+		JSONBase: JSONBase{Kind: "Status"},
+		Status:   StatusFailure,
+		Code:     code,
+		Reason:   reason,
+		Message:  message,
+		Details: &StatusDetails{
+			ID:   id,
+			Kind: kind,
+		},
+	}}
+}
+
+// NewNotFoundErr returns an error indicating that the object 'kind' named 'id' does not exist.
+func NewNotFoundErr(kind, id string) error {
+	return newStatusError(http.StatusNotFound, StatusReasonNotFound, kind, id, fmt.Sprintf("%s %q not found", kind, id))
+}
+
+// NewAlreadyExistsErr returns an error indicating that the object 'kind' named 'id' already exists.
+func NewAlreadyExistsErr(kind, id string) error {
+	return newStatusError(http.StatusConflict, StatusReasonAlreadyExists, kind, id, fmt.Sprintf("%s %q already exists", kind, id))
+}
+
+// NewConflictErr returns an error indicating that the object 'kind' named 'id' could not be
+// changed because of the state it is currently in.
+func NewConflictErr(kind, id string, err error) error {
+	return newStatusError(http.StatusConflict, StatusReasonConflict, kind, id, fmt.Sprintf("%s %q cannot be updated: %v", kind, id, err))
+}
+
+// NewInvalidErr returns an error indicating that the object 'kind' named 'id' failed
+// validation. Each entry in 'causes' describes one offending field.
+func NewInvalidErr(kind, id string, causes []StatusCause) error {
+	messages := make([]string, 0, len(causes))
+	for _, cause := range causes {
+		messages = append(messages, cause.Field+": "+cause.Message)
+	}
+	e := newStatusError(http.StatusUnprocessableEntity, StatusReasonInvalid, kind, id, fmt.Sprintf("%s %q is invalid: %s", kind, id, strings.Join(messages, ", ")))
+	e.ErrStatus.Details.Causes = causes
+	return e
+}
+
+// NewBadRequestErr returns an error indicating that the request could not be understood.
+func NewBadRequestErr(message string) error {
+	e := newStatusError(http.StatusBadRequest, StatusReasonBadRequest, "", "", message)
+	e.ErrStatus.Details = nil
+	return e
+}
+
+// NewUnauthorizedErr returns an error indicating that the client could not be authenticated.
+func NewUnauthorizedErr(message string) error {
+	e := newStatusError(http.StatusUnauthorized, StatusReasonUnauthorized, "", "", message)
+	e.ErrStatus.Details = nil
+	return e
+}
+
+// NewForbiddenErr returns an error indicating that the request for the object 'kind'
+// named 'id' was refused by the server's policy.
+func NewForbiddenErr(kind, id string, err error) error {
+	return newStatusError(http.StatusForbidden, StatusReasonForbidden, kind, id, fmt.Sprintf("Forbidden: %v", err))
+}
+
+// NewInternalErr wraps an arbitrary error as a server side failure.
+func NewInternalErr(err error) error {
+	e := newStatusError(http.StatusInternalServerError, StatusReasonInternalError, "", "", fmt.Sprintf("Internal error: %v", err))
+	e.ErrStatus.Details = nil
+	return e
+}
+
+// NewExpiredErr returns an error indicating that a list can't be continued because its
+// snapshot is gone.
+func NewExpiredErr(message string) error {
+	e := newStatusError(http.StatusGone, StatusReasonExpired, "", "", message)
+	e.ErrStatus.Details = nil
+	return e
+}
+
+// ReasonForError returns the StatusReason carried by err, or StatusReasonUnknown if err
+// is not a *StatusError.
+func ReasonForError(err error) StatusReason {
+	switch t := err.(type) {
+	case *StatusError:
+		return t.ErrStatus.Reason
+	}
+	return StatusReasonUnknown
+}
+
+// IsNotFound returns true if err indicates that an object does not exist.
+func IsNotFound(err error) bool {
+	return ReasonForError(err) == StatusReasonNotFound
+}
+
+// IsAlreadyExists returns true if err indicates that an object already exists.
+func IsAlreadyExists(err error) bool {
+	return ReasonForError(err) == StatusReasonAlreadyExists
+}
+
+// IsConflict returns true if err indicates that an update lost a race with another writer.
+func IsConflict(err error) bool {
+	return ReasonForError(err) == StatusReasonConflict
+}
+
+// IsInvalid returns true if err indicates that a submitted object failed validation.
+func IsInvalid(err error) bool {
+	return ReasonForError(err) == StatusReasonInvalid
+}
+
+// IsBadRequest returns true if err indicates that a request could not be understood.
+func IsBadRequest(err error) bool {
+	return ReasonForError(err) == StatusReasonBadRequest
+}
+
+// IsUnauthorized returns true if err indicates that the client could not be authenticated.
+func IsUnauthorized(err error) bool {
+	return ReasonForError(err) == StatusReasonUnauthorized
+}
+
+// IsForbidden returns true if err indicates that the request was refused by policy.
+func IsForbidden(err error) bool {
+	return ReasonForError(err) == StatusReasonForbidden
+}
+
+// IsExpired returns true if err indicates that a continue token is no longer valid.
+func IsExpired(err error) bool {
+	return ReasonForError(err) == StatusReasonExpired
+}
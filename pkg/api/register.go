@@ -0,0 +1,87 @@
+package api
+
+import (
+	"k8s-firstcommit/pkg/api/v1beta1"
+	"k8s-firstcommit/pkg/conversion"
+)
+
+// LatestVersion is the newest version of the API clients can speak.
+const LatestVersion = "v1beta1"
+
+// Versions lists every external version of the API, oldest first. The API server serves
+// all of them.
+var Versions = []string{"v1beta1"}
+
+// Scheme knows the internal types in this package, every external version, and how to
+// convert between them. Data which doesn't say which version it is, such as the JSON
+// files written before versions existed, is read as v1beta1.
+var Scheme = conversion.NewScheme("", "v1beta1")
+
+func init() {
+	Scheme.AddKnownTypes("",
+		Task{},
+		TaskList{},
+		ReplicationController{},
+		ReplicationControllerList{},
+		Service{},
+		ServiceList{},
+		ResourceQuota{},
+		ResourceQuotaList{},
+		Status{},
+	)
+	Scheme.AddKnownTypes("v1beta1",
+		v1beta1.Task{},
+		v1beta1.TaskList{},
+		v1beta1.ReplicationController{},
+		v1beta1.ReplicationControllerList{},
+		v1beta1.Service{},
+		v1beta1.ServiceList{},
+		v1beta1.ResourceQuota{},
+		v1beta1.ResourceQuotaList{},
+		v1beta1.Status{},
+	)
+	err := Scheme.AddConversionFuncs(
+		convertCommandLineToWords,
+		convertWordsToCommandLine,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Encode returns the JSON for obj in the latest API version.
+func Encode(obj interface{}) ([]byte, error) {
+	return Scheme.EncodeToVersion(obj, LatestVersion)
+}
+
+// EncodeToVersion returns the JSON for obj in the given API version.
+func EncodeToVersion(obj interface{}, version string) ([]byte, error) {
+	return Scheme.EncodeToVersion(obj, version)
+}
+
+// Decode reads an object of any version and returns a pointer to its internal form.
+// The data must name its kind.
+func Decode(data []byte) (interface{}, error) {
+	return Scheme.Decode(data)
+}
+
+// DecodeInto reads an object of any version into obj, a pointer to an internal type.
+func DecodeInto(data []byte, obj interface{}) error {
+	return Scheme.DecodeInto(data, obj)
+}
+
+// Codec encodes objects into a single version of the API.
+type Codec interface {
+	Encode(obj interface{}) ([]byte, error)
+}
+
+type versionCodec string
+
+func (version versionCodec) Encode(obj interface{}) ([]byte, error) {
+	return Scheme.EncodeToVersion(obj, string(version))
+}
+
+// CodecForVersion returns a Codec which encodes objects into version.
+func CodecForVersion(version string) Codec {
+	return versionCodec(version)
+}
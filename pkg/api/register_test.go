@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeExamples(t *testing.T) {
+	table := map[string]interface{}{
+		"../../api/examples/task.json":                         &Task{},
+		"../../api/examples/task-list.json":                    &TaskList{},
+		"../../api/examples/controller.json":                   &ReplicationController{},
+		"../../api/examples/service.json":                      &Service{},
+		"../../examples/guestbook/frontend-controller.json":    &ReplicationController{},
+		"../../examples/guestbook/redis-master.json":           &Task{},
+		"../../examples/guestbook/redis-master-service.json":   &Service{},
+		"../../examples/guestbook/redis-slave-controller.json": &ReplicationController{},
+		"../../examples/guestbook/redis-slave-service.json":    &Service{},
+	}
+	for file, obj := range table {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", file, err)
+		}
+		// The examples predate versioning, so they must be read as v1beta1.
+		if err := DecodeInto(data, obj); err != nil {
+			t.Errorf("Unexpected error decoding %s: %v", file, err)
+			continue
+		}
+		var plain interface{}
+		json.Unmarshal(data, &plain)
+		encoded, err := Encode(obj)
+		if err != nil {
+			t.Errorf("Unexpected error encoding %s: %v", file, err)
+			continue
+		}
+		var roundTripped map[string]interface{}
+		json.Unmarshal(encoded, &roundTripped)
+		if roundTripped["apiVersion"] != LatestVersion {
+			t.Errorf("Expected %s to be encoded as %s: %s", file, LatestVersion, encoded)
+		}
+		delete(roundTripped, "apiVersion")
+		delete(roundTripped, "kind")
+		if !reflect.DeepEqual(jsonSubset(plain, roundTripped), plain) {
+			t.Errorf("%s changed in a round trip:\n%s", file, encoded)
+		}
+	}
+}
+
+// jsonSubset returns the parts of full which are also present in want, so that fields
+// the encoder always writes (such as empty lists) don't count as differences.
+func jsonSubset(want, full interface{}) interface{} {
+	wantMap, ok := want.(map[string]interface{})
+	fullMap, ok2 := full.(map[string]interface{})
+	if ok && ok2 {
+		result := map[string]interface{}{}
+		for key, value := range wantMap {
+			if fullValue, ok := fullMap[key]; ok {
+				result[key] = jsonSubset(value, fullValue)
+			}
+		}
+		return result
+	}
+	wantList, ok := want.([]interface{})
+	fullList, ok2 := full.([]interface{})
+	if ok && ok2 && len(wantList) == len(fullList) {
+		result := make([]interface{}, len(wantList))
+		for i := range wantList {
+			result[i] = jsonSubset(wantList[i], fullList[i])
+		}
+		return result
+	}
+	return full
+}
+
+func TestDecode(t *testing.T) {
+	obj, err := Decode([]byte(`{"kind": "Service", "apiVersion": "v1beta1", "id": "foo", "port": 80}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &Service{JSONBase: JSONBase{ID: "foo"}, Port: 80}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Unexpected object: %#v", obj)
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	var task Task
+	if err := DecodeInto([]byte(`{"apiVersion": "v0", "id": "foo"}`), &task); err == nil {
+		t.Error("Expected an error decoding an unknown version")
+	}
+}
@@ -10,8 +10,24 @@ type ContainerManifest struct {
 	Volumes    []Volume    `yaml:"volumes" json:"volumes"`
 	Containers []Container `yaml:"containers" json:"containers"`
 	Id         string      `yaml:"id,omitempty" json:"id,omitempty"`
+	// RestartPolicy says which stopped containers the kubelet runs again. It defaults
+	// to RestartAlways.
+	RestartPolicy RestartPolicy `yaml:"restartPolicy,omitempty" json:"restartPolicy,omitempty"`
 }
 
+// RestartPolicy says when the kubelet runs a stopped container again. Containers which
+// failed to start are retried whatever the policy. Restarts back off exponentially.
+type RestartPolicy string
+
+const (
+	// RestartAlways runs every stopped container again.
+	RestartAlways RestartPolicy = "Always"
+	// RestartOnFailure runs containers again which exited with a non-zero code.
+	RestartOnFailure RestartPolicy = "OnFailure"
+	// RestartNever leaves stopped containers stopped.
+	RestartNever RestartPolicy = "Never"
+)
+
 type Volume struct {
 	Name string `yaml:"name" json:"name"`
 }
@@ -34,17 +50,75 @@ type EnvVar struct {
 	Value string `yaml:"value,omitempty" json:"value,omitempty"`
 }
 
+// PullPolicy says when the kubelet pulls the image of a container.
+type PullPolicy string
+
+const (
+	// PullAlways pulls the image every time a container is started.
+	PullAlways PullPolicy = "Always"
+	// PullIfNotPresent only pulls the image if it isn't on the host yet.
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	// PullNever never pulls the image, which has to be on the host already.
+	PullNever PullPolicy = "Never"
+)
+
+// HTTPGetAction probes a container with an HTTP GET of Path on its Port, which
+// succeeds with a status from 200 to 399.
+type HTTPGetAction struct {
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	Port int    `yaml:"port,omitempty" json:"port,omitempty"`
+}
+
+// TCPSocketAction probes a container by connecting to its Port.
+type TCPSocketAction struct {
+	Port int `yaml:"port,omitempty" json:"port,omitempty"`
+}
+
+// ExecAction probes a container by running Command in it, which succeeds if it exits 0.
+type ExecAction struct {
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// Probe is a check the kubelet runs against a container every PeriodSeconds, once
+// InitialDelaySeconds have passed since it started. Exactly one of HTTPGet, TCPSocket
+// and Exec is set. A check which takes longer than TimeoutSeconds fails, and the probe
+// fails after FailureThreshold checks in a row fail. Zero periods, timeouts and
+// thresholds take the defaults: 10 seconds, 1 second and 3 checks.
+type Probe struct {
+	HTTPGet             *HTTPGetAction   `yaml:"httpGet,omitempty" json:"httpGet,omitempty"`
+	TCPSocket           *TCPSocketAction `yaml:"tcpSocket,omitempty" json:"tcpSocket,omitempty"`
+	Exec                *ExecAction      `yaml:"exec,omitempty" json:"exec,omitempty"`
+	InitialDelaySeconds int              `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int              `yaml:"periodSeconds,omitempty" json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int              `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int              `yaml:"failureThreshold,omitempty" json:"failureThreshold,omitempty"`
+}
+
+// CommandLine is a command and its arguments, one per item. v1beta1 has it as one string
+// of words separated by spaces (see conversion.go). It's also read from that form in the
+// JSON and YAML written before it was split, such as the tasks in etcd and the kubelet's
+// manifest files.
+type CommandLine []string
+
 // Container represents a single container that is expected to be run on the host.
 type Container struct {
-	Name         string        `yaml:"name,omitempty" json:"name,omitempty"`
-	Image        string        `yaml:"image,omitempty" json:"image,omitempty"`
-	Command      string        `yaml:"command,omitempty" json:"command,omitempty"`
-	WorkingDir   string        `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
-	Ports        []Port        `yaml:"ports,omitempty" json:"ports,omitempty"`
-	Env          []EnvVar      `yaml:"env,omitempty" json:"env,omitempty"`
-	Memory       int           `yaml:"memory,omitempty" json:"memory,omitempty"`
-	CPU          int           `yaml:"cpu,omitempty" json:"cpu,omitempty"`
-	VolumeMounts []VolumeMount `yaml:"volumeMounts,omitempty" json:"volumeMounts,omitempty"`
+	Name       string      `yaml:"name,omitempty" json:"name,omitempty"`
+	Image      string      `yaml:"image,omitempty" json:"image,omitempty"`
+	Command    CommandLine `yaml:"command,omitempty" json:"command,omitempty"`
+	WorkingDir string      `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
+	// ImagePullPolicy defaults to PullAlways for images tagged latest, or not tagged
+	// at all, and to PullIfNotPresent for the others.
+	ImagePullPolicy PullPolicy    `yaml:"imagePullPolicy,omitempty" json:"imagePullPolicy,omitempty"`
+	Ports           []Port        `yaml:"ports,omitempty" json:"ports,omitempty"`
+	Env             []EnvVar      `yaml:"env,omitempty" json:"env,omitempty"`
+	Memory          int           `yaml:"memory,omitempty" json:"memory,omitempty"`
+	CPU             int           `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+	VolumeMounts    []VolumeMount `yaml:"volumeMounts,omitempty" json:"volumeMounts,omitempty"`
+	// LivenessProbe, if set, restarts the container when it fails.
+	LivenessProbe *Probe `yaml:"livenessProbe,omitempty" json:"livenessProbe,omitempty"`
+	// ReadinessProbe, if set, keeps the task from being ready until it succeeds, and
+	// makes it unready again when it fails.
+	ReadinessProbe *Probe `yaml:"readinessProbe,omitempty" json:"readinessProbe,omitempty"`
 }
 
 // Event is the representation of an event logged to etcd backends
@@ -52,17 +126,28 @@ type Event struct {
 	Event     string             `json:"event,omitempty"`
 	Manifest  *ContainerManifest `json:"manifest,omitempty"`
 	Container *Container         `json:"container,omitempty"`
-	Timestamp int64              `json:"timestamp"`
+	// Message says more about the event, such as why it failed.
+	Message   string `json:"message,omitempty"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 // The below types are used by kube_client and api_server.
 
 // JSONBase is shared by all objects sent to, or returned from the client
 type JSONBase struct {
-	Kind              string `json:"kind,omitempty" yaml:"kind,omitempty"`
-	ID                string `json:"id,omitempty" yaml:"id,omitempty"`
+	Kind       string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty" yaml:"apiVersion,omitempty"`
+	ID         string `json:"id,omitempty" yaml:"id,omitempty"`
+	// Namespace scopes ID: objects in different namespaces may share an ID. Objects are
+	// in the namespace they were created in, which is "default" unless the request
+	// named another.
+	Namespace         string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 	CreationTimestamp string `json:"creationTimestamp,omitempty" yaml:"creationTimestamp,omitempty"`
 	SelfLink          string `json:"selfLink,omitempty" yaml:"selfLink,omitempty"`
+	// ResourceVersion changes every time the object is written. Sending it back with an
+	// update makes the update fail with a Conflict if someone else wrote the object in
+	// the meantime. Zero means "don't care".
+	ResourceVersion uint64 `json:"resourceVersion,omitempty" yaml:"resourceVersion,omitempty"`
 }
 
 // TaskState is the state of a task, used as either input (desired state) or output (current state)
@@ -72,11 +157,38 @@ type TaskState struct {
 	Host     string            `json:"host,omitempty" yaml:"host,omitempty"`
 	HostIP   string            `json:"hostIP,omitempty" yaml:"hostIP,omitempty"`
 	Info     interface{}       `json:"info,omitempty" yaml:"info,omitempty"`
+	// Ready is set by the kubelet once every container of the task is running and
+	// passes its readiness probe. Services only send traffic to ready tasks.
+	Ready bool `json:"ready,omitempty" yaml:"ready,omitempty"`
+	// ContainerStatuses are set by the kubelet, for the containers it has run.
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty" yaml:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is what the kubelet knows of the runs of a container of a task.
+type ContainerStatus struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// RestartCount counts the times the container was run again after it stopped or
+	// failed to start.
+	RestartCount int `json:"restartCount" yaml:"restartCount"`
+	// LastTermination is how the container last stopped, if it has.
+	LastTermination *ContainerTermination `json:"lastTermination,omitempty" yaml:"lastTermination,omitempty"`
+}
+
+// ContainerTermination is how a container stopped.
+type ContainerTermination struct {
+	ExitCode int `json:"exitCode" yaml:"exitCode"`
+	// Reason is OOMKilled if the container ran out of memory, Error if it exited with a
+	// non-zero code otherwise, or Completed.
+	Reason     string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty" yaml:"finishedAt,omitempty"`
 }
 
 type TaskList struct {
 	JSONBase
 	Items []Task `json:"items" yaml:"items,omitempty"`
+	// Continue is set when the list was cut short by a limit. Sending it back as the
+	// "continue" parameter returns the next page of the same snapshot.
+	Continue string `json:"continue,omitempty" yaml:"continue,omitempty"`
 }
 
 // Task is a single task, used as either input (create, update) or as output (list, get)
@@ -97,6 +209,9 @@ type ReplicationControllerState struct {
 type ReplicationControllerList struct {
 	JSONBase
 	Items []ReplicationController `json:"items,omitempty" yaml:"items,omitempty"`
+	// Continue is set when the list was cut short by a limit. Sending it back as the
+	// "continue" parameter returns the next page of the same snapshot.
+	Continue string `json:"continue,omitempty" yaml:"continue,omitempty"`
 }
 
 // ReplicationController represents the configuration of a replication controller
@@ -114,7 +229,11 @@ type TaskTemplate struct {
 
 // ServiceList holds a list of services
 type ServiceList struct {
+	JSONBase
 	Items []Service `json:"items" yaml:"items"`
+	// Continue is set when the list was cut short by a limit. Sending it back as the
+	// "continue" parameter returns the next page of the same snapshot.
+	Continue string `json:"continue,omitempty" yaml:"continue,omitempty"`
 }
 
 // Defines a service abstraction by a name (for example, mysql) consisting of local port
@@ -129,5 +248,125 @@ type Service struct {
 // Name: "mysql", Endpoints: ["10.10.1.1:1909", "10.10.2.2:8834"]
 type Endpoints struct {
 	Name      string
+	Namespace string `json:",omitempty"`
 	Endpoints []string
 }
+
+// Names of the resources a ResourceQuota can limit.
+const (
+	// ResourceTasks is the number of tasks.
+	ResourceTasks = "tasks"
+	// ResourceReplicationControllers is the number of replication controllers.
+	ResourceReplicationControllers = "replicationControllers"
+	// ResourceServices is the number of services.
+	ResourceServices = "services"
+	// ResourceMemory is the sum of the memory of every container of every task.
+	ResourceMemory = "memory"
+	// ResourceCPU is the sum of the CPU of every container of every task.
+	ResourceCPU = "cpu"
+)
+
+// ResourceList is an amount of each of a set of resources, keyed by resource name.
+type ResourceList map[string]int
+
+// ResourceQuotaList holds a list of resource quotas
+type ResourceQuotaList struct {
+	JSONBase
+	Items []ResourceQuota `json:"items" yaml:"items"`
+}
+
+// ResourceQuota limits how much of each resource the objects in its namespace may use.
+// If Selector is set only the objects carrying all of its labels count against, and
+// are limited by, the quota.
+type ResourceQuota struct {
+	JSONBase
+	Selector map[string]string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// Hard is the most of each resource which may be used. Resources it doesn't name
+	// are unlimited.
+	Hard ResourceList `json:"hard,omitempty" yaml:"hard,omitempty"`
+	// Used is how much of each resource in Hard is in use. It is filled in by the server.
+	Used ResourceList `json:"used,omitempty" yaml:"used,omitempty"`
+}
+
+// Status is a return value for calls that don't return other objects, and the body
+// of every failed API request.
+type Status struct {
+	JSONBase
+	// One of: "success", "failure"
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+	// The HTTP status code for this status, repeated here so clients that lose the
+	// transport status (or read the object back from a log) can still act on it.
+	Code int `json:"code,omitempty" yaml:"code,omitempty"`
+	// A machine readable description of why this operation failed.
+	Reason StatusReason `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// A human readable description of the status of this operation.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	// Extended data associated with the reason, may be nil.
+	Details *StatusDetails `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// StatusDetails identifies the object a failure refers to, and any field level causes.
+type StatusDetails struct {
+	ID     string        `json:"id,omitempty" yaml:"id,omitempty"`
+	Kind   string        `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Causes []StatusCause `json:"causes,omitempty" yaml:"causes,omitempty"`
+}
+
+// StatusCause describes a single problem with a submitted object, for example a
+// missing or malformed field.
+type StatusCause struct {
+	Field   string `json:"field,omitempty" yaml:"field,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Values of Status.Status
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// StatusReason is a machine readable explanation of why a request failed.
+type StatusReason string
+
+const (
+	// StatusReasonUnknown means the server did not say why the request failed.
+	StatusReasonUnknown StatusReason = ""
+	// StatusReasonNotFound means the requested object does not exist. Maps to 404.
+	StatusReasonNotFound StatusReason = "NotFound"
+	// StatusReasonAlreadyExists means an object with the same ID already exists. Maps to 409.
+	StatusReasonAlreadyExists StatusReason = "AlreadyExists"
+	// StatusReasonConflict means the request conflicts with the current state of the object. Maps to 409.
+	StatusReasonConflict StatusReason = "Conflict"
+	// StatusReasonInvalid means the submitted object failed validation. Maps to 422.
+	StatusReasonInvalid StatusReason = "Invalid"
+	// StatusReasonBadRequest means the request body could not be understood. Maps to 400.
+	StatusReasonBadRequest StatusReason = "BadRequest"
+	// StatusReasonUnauthorized means the request carried no credentials, or credentials the
+	// server did not accept. Maps to 401.
+	StatusReasonUnauthorized StatusReason = "Unauthorized"
+	// StatusReasonForbidden means the authenticated user is not allowed to make the
+	// request. Maps to 403.
+	StatusReasonForbidden StatusReason = "Forbidden"
+	// StatusReasonInternalError means the server failed for reasons unrelated to the request,
+	// for example because etcd could not be reached. Maps to 500.
+	StatusReasonInternalError StatusReason = "InternalError"
+	// StatusReasonExpired means the request named a snapshot of a list, through a continue
+	// token, which the server no longer keeps. The list has to be read again from the
+	// start. Maps to 410.
+	StatusReasonExpired StatusReason = "Expired"
+)
+
+// PatchType is the content type of a PATCH request, which says how its body changes the
+// object it is sent to.
+type PatchType string
+
+const (
+	// JSONPatchType is an RFC 6902 JSON patch: a list of operations on JSON pointers.
+	JSONPatchType PatchType = "application/json-patch+json"
+	// MergePatchType is an RFC 7386 JSON merge patch: an object whose fields replace
+	// those of the object patched, or remove them if they are null.
+	MergePatchType PatchType = "application/merge-patch+json"
+	// StrategicMergePatchType is a merge patch which merges lists of named objects, such
+	// as containers, ports and environment variables, by name instead of replacing them.
+	StrategicMergePatchType PatchType = "application/strategic-merge-patch+json"
+)
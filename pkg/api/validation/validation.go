@@ -0,0 +1,361 @@
+// Package validation checks that api objects submitted to the API server are well formed
+// before they are stored.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// ErrorType describes what is wrong with a field.
+type ErrorType string
+
+const (
+	ErrTypeRequired     ErrorType = "required"
+	ErrTypeInvalid      ErrorType = "invalid"
+	ErrTypeNotSupported ErrorType = "unsupported"
+	ErrTypeDuplicate    ErrorType = "duplicate"
+	ErrTypeNotFound     ErrorType = "not found"
+)
+
+// ValidationError is a problem with a single field of an object.
+type ValidationError struct {
+	Type     ErrorType
+	Field    string
+	BadValue interface{}
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s '%v'", v.Field, v.Type, v.BadValue)
+}
+
+// ErrorList is the set of problems found with an object. An empty list means the
+// object is valid.
+type ErrorList []ValidationError
+
+func (list ErrorList) Error() string {
+	messages := make([]string, 0, len(list))
+	for _, err := range list {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Prefix returns a copy of list with prefix prepended to every field name, so that
+// errors from nested objects are reported with their full path.
+func (list ErrorList) Prefix(prefix string) ErrorList {
+	result := make(ErrorList, 0, len(list))
+	for _, err := range list {
+		if strings.HasPrefix(err.Field, "[") {
+			err.Field = prefix + err.Field
+		} else {
+			err.Field = prefix + "." + err.Field
+		}
+		result = append(result, err)
+	}
+	return result
+}
+
+// Causes converts list into the field level causes of an Invalid status.
+func (list ErrorList) Causes() []api.StatusCause {
+	causes := make([]api.StatusCause, 0, len(list))
+	for _, err := range list {
+		causes = append(causes, api.StatusCause{
+			Field:   err.Field,
+			Message: fmt.Sprintf("%s '%v'", err.Type, err.BadValue),
+		})
+	}
+	return causes
+}
+
+func errRequired(field string, value interface{}) ValidationError {
+	return ValidationError{ErrTypeRequired, field, value}
+}
+
+func errInvalid(field string, value interface{}) ValidationError {
+	return ValidationError{ErrTypeInvalid, field, value}
+}
+
+func errNotSupported(field string, value interface{}) ValidationError {
+	return ValidationError{ErrTypeNotSupported, field, value}
+}
+
+func errDuplicate(field string, value interface{}) ValidationError {
+	return ValidationError{ErrTypeDuplicate, field, value}
+}
+
+func errNotFound(field string, value interface{}) ValidationError {
+	return ValidationError{ErrTypeNotFound, field, value}
+}
+
+const dnsLabelMaxLength = 63
+
+var dnsLabelRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+// IsDNSLabel returns true if value is a valid RFC 1123 label: at most 63 lower case
+// letters, digits and dashes, starting and ending with a letter or digit.
+func IsDNSLabel(value string) bool {
+	return len(value) <= dnsLabelMaxLength && dnsLabelRegexp.MatchString(value)
+}
+
+// validateJSONBase checks the ID and namespace of an object. An empty namespace is
+// allowed; it stands for api.NamespaceDefault.
+func validateJSONBase(base *api.JSONBase) ErrorList {
+	errs := ErrorList{}
+	if len(base.ID) == 0 {
+		errs = append(errs, errRequired("id", base.ID))
+	} else if !IsDNSLabel(base.ID) {
+		errs = append(errs, errInvalid("id", base.ID))
+	}
+	if len(base.Namespace) > 0 && !IsDNSLabel(base.Namespace) {
+		errs = append(errs, errInvalid("namespace", base.Namespace))
+	}
+	return errs
+}
+
+func isValidPort(port int) bool {
+	return port > 0 && port < 65536
+}
+
+var supportedManifestVersions = map[string]bool{"v1beta1": true}
+
+var supportedPortProtocols = map[string]bool{"TCP": true, "UDP": true}
+
+var supportedPullPolicies = map[api.PullPolicy]bool{api.PullAlways: true, api.PullIfNotPresent: true, api.PullNever: true}
+
+var supportedRestartPolicies = map[api.RestartPolicy]bool{api.RestartAlways: true, api.RestartOnFailure: true, api.RestartNever: true}
+
+// validateVolumes checks the declared volumes, and returns the set of names that mounts may refer to.
+func validateVolumes(volumes []api.Volume) (map[string]bool, ErrorList) {
+	errs := ErrorList{}
+	names := map[string]bool{}
+	for i, volume := range volumes {
+		field := fmt.Sprintf("[%d].name", i)
+		switch {
+		case len(volume.Name) == 0:
+			errs = append(errs, errRequired(field, volume.Name))
+		case !IsDNSLabel(volume.Name):
+			errs = append(errs, errInvalid(field, volume.Name))
+		case names[volume.Name]:
+			errs = append(errs, errDuplicate(field, volume.Name))
+		}
+		names[volume.Name] = true
+	}
+	return names, errs
+}
+
+func validatePorts(ports []api.Port) ErrorList {
+	errs := ErrorList{}
+	names := map[string]bool{}
+	for i, port := range ports {
+		field := fmt.Sprintf("[%d]", i)
+		if len(port.Name) > 0 {
+			if !IsDNSLabel(port.Name) {
+				errs = append(errs, errInvalid(field+".name", port.Name))
+			} else if names[port.Name] {
+				errs = append(errs, errDuplicate(field+".name", port.Name))
+			}
+			names[port.Name] = true
+		}
+		if !isValidPort(port.ContainerPort) {
+			errs = append(errs, errInvalid(field+".containerPort", port.ContainerPort))
+		}
+		// A host port of zero means the container port isn't exposed on the host.
+		if port.HostPort != 0 && !isValidPort(port.HostPort) {
+			errs = append(errs, errInvalid(field+".hostPort", port.HostPort))
+		}
+		if len(port.Protocol) > 0 && !supportedPortProtocols[strings.ToUpper(port.Protocol)] {
+			errs = append(errs, errNotSupported(field+".protocol", port.Protocol))
+		}
+	}
+	return errs
+}
+
+func validateVolumeMounts(mounts []api.VolumeMount, volumes map[string]bool) ErrorList {
+	errs := ErrorList{}
+	for i, mount := range mounts {
+		field := fmt.Sprintf("[%d]", i)
+		if len(mount.Name) == 0 {
+			errs = append(errs, errRequired(field+".name", mount.Name))
+		} else if !volumes[mount.Name] {
+			errs = append(errs, errNotFound(field+".name", mount.Name))
+		}
+		if len(mount.MountPath) == 0 {
+			errs = append(errs, errRequired(field+".mountPath", mount.MountPath))
+		}
+	}
+	return errs
+}
+
+func validateEnv(vars []api.EnvVar) ErrorList {
+	errs := ErrorList{}
+	for i, ev := range vars {
+		if len(ev.Name) == 0 {
+			errs = append(errs, errRequired(fmt.Sprintf("[%d].name", i), ev.Name))
+		}
+	}
+	return errs
+}
+
+// validateProbe checks a probe, which has exactly one action.
+func validateProbe(probe *api.Probe) ErrorList {
+	errs := ErrorList{}
+	actions := 0
+	if probe.HTTPGet != nil {
+		actions++
+		if !isValidPort(probe.HTTPGet.Port) {
+			errs = append(errs, errInvalid("httpGet.port", probe.HTTPGet.Port))
+		}
+	}
+	if probe.TCPSocket != nil {
+		actions++
+		if !isValidPort(probe.TCPSocket.Port) {
+			errs = append(errs, errInvalid("tcpSocket.port", probe.TCPSocket.Port))
+		}
+	}
+	if probe.Exec != nil {
+		actions++
+		if len(probe.Exec.Command) == 0 {
+			errs = append(errs, errRequired("exec.command", probe.Exec.Command))
+		}
+	}
+	switch {
+	case actions == 0:
+		errs = append(errs, errRequired("action", "one of httpGet, tcpSocket and exec"))
+	case actions > 1:
+		errs = append(errs, errInvalid("action", "more than one of httpGet, tcpSocket and exec"))
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"initialDelaySeconds", probe.InitialDelaySeconds},
+		{"periodSeconds", probe.PeriodSeconds},
+		{"timeoutSeconds", probe.TimeoutSeconds},
+		{"failureThreshold", probe.FailureThreshold},
+	} {
+		if field.value < 0 {
+			errs = append(errs, errInvalid(field.name, field.value))
+		}
+	}
+	return errs
+}
+
+// ValidateContainer checks a single container. 'volumes' is the set of volume names
+// declared by the enclosing manifest.
+func ValidateContainer(container *api.Container, volumes map[string]bool) ErrorList {
+	errs := ErrorList{}
+	if len(container.Name) > 0 && !IsDNSLabel(container.Name) {
+		errs = append(errs, errInvalid("name", container.Name))
+	}
+	if len(container.Image) == 0 {
+		errs = append(errs, errRequired("image", container.Image))
+	}
+	if len(container.ImagePullPolicy) > 0 && !supportedPullPolicies[container.ImagePullPolicy] {
+		errs = append(errs, errNotSupported("imagePullPolicy", container.ImagePullPolicy))
+	}
+	if container.Memory < 0 {
+		errs = append(errs, errInvalid("memory", container.Memory))
+	}
+	if container.CPU < 0 {
+		errs = append(errs, errInvalid("cpu", container.CPU))
+	}
+	errs = append(errs, validatePorts(container.Ports).Prefix("ports")...)
+	errs = append(errs, validateEnv(container.Env).Prefix("env")...)
+	errs = append(errs, validateVolumeMounts(container.VolumeMounts, volumes).Prefix("volumeMounts")...)
+	if container.LivenessProbe != nil {
+		errs = append(errs, validateProbe(container.LivenessProbe).Prefix("livenessProbe")...)
+	}
+	if container.ReadinessProbe != nil {
+		errs = append(errs, validateProbe(container.ReadinessProbe).Prefix("readinessProbe")...)
+	}
+	return errs
+}
+
+// ValidateManifest checks a container manifest and every container in it.
+func ValidateManifest(manifest *api.ContainerManifest) ErrorList {
+	errs := ErrorList{}
+	if len(manifest.Version) > 0 && !supportedManifestVersions[strings.ToLower(manifest.Version)] {
+		errs = append(errs, errNotSupported("version", manifest.Version))
+	}
+	if len(manifest.RestartPolicy) > 0 && !supportedRestartPolicies[manifest.RestartPolicy] {
+		errs = append(errs, errNotSupported("restartPolicy", manifest.RestartPolicy))
+	}
+	volumes, volumeErrs := validateVolumes(manifest.Volumes)
+	errs = append(errs, volumeErrs.Prefix("volumes")...)
+	if len(manifest.Containers) == 0 {
+		errs = append(errs, errRequired("containers", manifest.Containers))
+	}
+	names := map[string]bool{}
+	for i := range manifest.Containers {
+		container := &manifest.Containers[i]
+		field := fmt.Sprintf("containers[%d]", i)
+		// The kubelet tells containers apart by name, so even unnamed containers collide.
+		if names[container.Name] {
+			errs = append(errs, errDuplicate(field+".name", container.Name))
+		}
+		names[container.Name] = true
+		errs = append(errs, ValidateContainer(container, volumes).Prefix(field)...)
+	}
+	return errs
+}
+
+// ValidateTask checks a task submitted for creation or update.
+func ValidateTask(task *api.Task) ErrorList {
+	errs := validateJSONBase(&task.JSONBase)
+	errs = append(errs, ValidateManifest(&task.DesiredState.Manifest).Prefix("desiredState.manifest")...)
+	return errs
+}
+
+// ValidateReplicationController checks a replication controller and its task template.
+func ValidateReplicationController(controller *api.ReplicationController) ErrorList {
+	errs := validateJSONBase(&controller.JSONBase)
+	if controller.DesiredState.Replicas < 0 {
+		errs = append(errs, errInvalid("desiredState.replicas", controller.DesiredState.Replicas))
+	}
+	manifest := &controller.DesiredState.TaskTemplate.DesiredState.Manifest
+	errs = append(errs, ValidateManifest(manifest).Prefix("desiredState.taskTemplate.desiredState.manifest")...)
+	return errs
+}
+
+// ValidateService checks a service.
+func ValidateService(service *api.Service) ErrorList {
+	errs := validateJSONBase(&service.JSONBase)
+	if !isValidPort(service.Port) {
+		errs = append(errs, errInvalid("port", service.Port))
+	}
+	return errs
+}
+
+var supportedQuotaResources = map[string]bool{
+	api.ResourceTasks:                  true,
+	api.ResourceReplicationControllers: true,
+	api.ResourceServices:               true,
+	api.ResourceMemory:                 true,
+	api.ResourceCPU:                    true,
+}
+
+// ValidateResourceQuota checks a resource quota.
+func ValidateResourceQuota(quota *api.ResourceQuota) ErrorList {
+	errs := validateJSONBase(&quota.JSONBase)
+	// Sorted, so that errors are reported in a stable order.
+	resources := make([]string, 0, len(quota.Hard))
+	for resource := range quota.Hard {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		limit := quota.Hard[resource]
+		field := "hard." + resource
+		if !supportedQuotaResources[resource] {
+			errs = append(errs, errNotSupported(field, resource))
+		} else if limit < 0 {
+			errs = append(errs, errInvalid(field, limit))
+		}
+	}
+	return errs
+}
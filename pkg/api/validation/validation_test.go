@@ -0,0 +1,174 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func validManifest() api.ContainerManifest {
+	return api.ContainerManifest{
+		Version:       "v1beta1",
+		Volumes:       []api.Volume{{Name: "data"}},
+		RestartPolicy: api.RestartOnFailure,
+		Containers: []api.Container{
+			{
+				Name:  "web",
+				Image: "dockerfile/nginx",
+				Ports: []api.Port{{Name: "http", ContainerPort: 80, HostPort: 8080, Protocol: "TCP"}},
+				VolumeMounts: []api.VolumeMount{
+					{Name: "data", MountPath: "/data"},
+				},
+				LivenessProbe:  &api.Probe{HTTPGet: &api.HTTPGetAction{Path: "/healthz", Port: 80}, InitialDelaySeconds: 15},
+				ReadinessProbe: &api.Probe{TCPSocket: &api.TCPSocketAction{Port: 80}},
+			},
+			{
+				Name:            "redis",
+				Image:           "dockerfile/redis",
+				ImagePullPolicy: api.PullIfNotPresent,
+			},
+		},
+	}
+}
+
+func expectFields(t *testing.T, errs ErrorList, fields ...string) {
+	if len(errs) != len(fields) {
+		t.Errorf("Expected errors for %v, got %v", fields, errs)
+		return
+	}
+	for i, field := range fields {
+		if errs[i].Field != field {
+			t.Errorf("Expected an error for %s, got %v", field, errs[i])
+		}
+	}
+}
+
+func TestIsDNSLabel(t *testing.T) {
+	good := []string{"a", "ab", "a-b", "a1", "1a", "nginx-controller", strings.Repeat("a", 63)}
+	for _, value := range good {
+		if !IsDNSLabel(value) {
+			t.Errorf("Expected %q to be a DNS label", value)
+		}
+	}
+	bad := []string{"", "A", "-a", "a-", "a_b", "a.b", "nginxController", strings.Repeat("a", 64)}
+	for _, value := range bad {
+		if IsDNSLabel(value) {
+			t.Errorf("Expected %q not to be a DNS label", value)
+		}
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	manifest := validManifest()
+	expectFields(t, ValidateManifest(&manifest))
+}
+
+func TestValidateManifestErrors(t *testing.T) {
+	table := []struct {
+		mutate func(*api.ContainerManifest)
+		fields []string
+	}{
+		{func(m *api.ContainerManifest) { m.Version = "v2" }, []string{"version"}},
+		{func(m *api.ContainerManifest) { m.RestartPolicy = "Sometimes" }, []string{"restartPolicy"}},
+		{func(m *api.ContainerManifest) { m.Containers = nil }, []string{"containers"}},
+		{func(m *api.ContainerManifest) { m.Containers[1].Name = "web" }, []string{"containers[1].name"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].Name = "Web" }, []string{"containers[0].name"}},
+		{func(m *api.ContainerManifest) { m.Containers[1].Image = "" }, []string{"containers[1].image"}},
+		{func(m *api.ContainerManifest) { m.Containers[1].ImagePullPolicy = "Sometimes" }, []string{"containers[1].imagePullPolicy"}},
+		{func(m *api.ContainerManifest) { m.Volumes = append(m.Volumes, api.Volume{Name: "data"}) }, []string{"volumes[1].name"}},
+		{func(m *api.ContainerManifest) { m.Volumes = nil }, []string{"containers[0].volumeMounts[0].name"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].VolumeMounts[0].MountPath = "" }, []string{"containers[0].volumeMounts[0].mountPath"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].Ports[0].ContainerPort = 0 }, []string{"containers[0].ports[0].containerPort"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].Ports[0].HostPort = 65536 }, []string{"containers[0].ports[0].hostPort"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].Ports[0].Protocol = "SCTP" }, []string{"containers[0].ports[0].protocol"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].LivenessProbe.HTTPGet.Port = 0 }, []string{"containers[0].livenessProbe.httpGet.port"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].LivenessProbe.PeriodSeconds = -1 }, []string{"containers[0].livenessProbe.periodSeconds"}},
+		{func(m *api.ContainerManifest) { m.Containers[0].ReadinessProbe.TCPSocket = nil }, []string{"containers[0].readinessProbe.action"}},
+		{func(m *api.ContainerManifest) {
+			m.Containers[0].ReadinessProbe.Exec = &api.ExecAction{}
+		}, []string{"containers[0].readinessProbe.exec.command", "containers[0].readinessProbe.action"}},
+		{func(m *api.ContainerManifest) {
+			m.Containers[0].Ports = append(m.Containers[0].Ports, api.Port{Name: "http", ContainerPort: 81})
+		}, []string{"containers[0].ports[1].name"}},
+	}
+	for i, item := range table {
+		manifest := validManifest()
+		item.mutate(&manifest)
+		errs := ValidateManifest(&manifest)
+		if len(errs) != len(item.fields) {
+			t.Errorf("%d: expected errors for %v, got %v", i, item.fields, errs)
+			continue
+		}
+		for j, field := range item.fields {
+			if errs[j].Field != field {
+				t.Errorf("%d: expected an error for %s, got %v", i, field, errs[j])
+			}
+		}
+	}
+}
+
+func TestValidateTask(t *testing.T) {
+	task := api.Task{
+		JSONBase:     api.JSONBase{ID: "php"},
+		DesiredState: api.TaskState{Manifest: validManifest()},
+	}
+	expectFields(t, ValidateTask(&task))
+
+	task.ID = ""
+	task.DesiredState.Manifest.Containers[0].Image = ""
+	expectFields(t, ValidateTask(&task), "id", "desiredState.manifest.containers[0].image")
+}
+
+func TestValidateReplicationController(t *testing.T) {
+	controller := api.ReplicationController{
+		JSONBase: api.JSONBase{ID: "nginx-controller"},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: 0,
+			TaskTemplate: api.TaskTemplate{
+				DesiredState: api.TaskState{Manifest: validManifest()},
+			},
+		},
+	}
+	expectFields(t, ValidateReplicationController(&controller))
+
+	controller.ID = "nginxController"
+	controller.DesiredState.Replicas = -1
+	expectFields(t, ValidateReplicationController(&controller), "id", "desiredState.replicas")
+}
+
+func TestValidateService(t *testing.T) {
+	service := api.Service{
+		JSONBase: api.JSONBase{ID: "frontend"},
+		Port:     8080,
+	}
+	expectFields(t, ValidateService(&service))
+
+	service.Port = 0
+	expectFields(t, ValidateService(&service), "port")
+
+	service.Port = 8080
+	service.Namespace = "team-a"
+	expectFields(t, ValidateService(&service))
+	service.Namespace = "Team_A"
+	expectFields(t, ValidateService(&service), "namespace")
+}
+
+func TestValidateResourceQuota(t *testing.T) {
+	quota := api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "team-a", Namespace: "team-a"},
+		Hard:     api.ResourceList{api.ResourceTasks: 10, api.ResourceMemory: 0},
+	}
+	expectFields(t, ValidateResourceQuota(&quota))
+
+	quota.Hard = api.ResourceList{api.ResourceCPU: -1, "disks": 2}
+	expectFields(t, ValidateResourceQuota(&quota), "hard.cpu", "hard.disks")
+}
+
+func TestCauses(t *testing.T) {
+	errs := ErrorList{errRequired("id", "")}.Prefix("task")
+	causes := errs.Causes()
+	if len(causes) != 1 || causes[0].Field != "task.id" || causes[0].Message != "required ''" {
+		t.Errorf("Unexpected causes: %#v", causes)
+	}
+}
@@ -0,0 +1,49 @@
+package apiserver
+
+// AdmissionAttributes describe a change an AdmissionController is asked to admit.
+type AdmissionAttributes struct {
+	// User is who made the request, or nil if the server doesn't authenticate requests.
+	User *UserInfo
+	// Operation is one of "create", "update" or "delete".
+	Operation string
+	// Namespace is the namespace the object is in.
+	Namespace string
+	// Resource is the collection being changed, e.g. "tasks".
+	Resource string
+	// ID names the object; it may be empty on create.
+	ID string
+	// Object is the object about to be stored, as extracted from the request. It is nil
+	// for deletes. Controllers may replace it to change what gets stored.
+	Object interface{}
+}
+
+// AdmissionController gets the last word on every change before it reaches storage. It
+// may modify a.Object, or refuse the change by returning an error.
+type AdmissionController interface {
+	Admit(a *AdmissionAttributes) error
+}
+
+// AdmissionFunc lets an ordinary function be used as an AdmissionController.
+type AdmissionFunc func(a *AdmissionAttributes) error
+
+func (f AdmissionFunc) Admit(a *AdmissionAttributes) error {
+	return f(a)
+}
+
+type admissionChain []AdmissionController
+
+// NewAdmissionChain returns an AdmissionController which passes changes through each of
+// controllers in order. Each controller sees the changes made by the ones before it, and
+// the first refusal stops the chain.
+func NewAdmissionChain(controllers ...AdmissionController) AdmissionController {
+	return admissionChain(controllers)
+}
+
+func (chain admissionChain) Admit(a *AdmissionAttributes) error {
+	for _, controller := range chain {
+		if err := controller.Admit(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package apiserver
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// The admission controllers below only look at creates and updates, and at the objects
+// which describe containers: tasks, and the task templates of replication controllers.
+
+// containersOf returns the containers obj would run, and the labels of the tasks running
+// them. ok is false for objects which don't run containers.
+func containersOf(obj interface{}) (containers []api.Container, labels map[string]string, ok bool) {
+	switch typed := obj.(type) {
+	case api.Task:
+		return typed.DesiredState.Manifest.Containers, typed.Labels, true
+	case *api.Task:
+		return typed.DesiredState.Manifest.Containers, typed.Labels, true
+	case api.ReplicationController:
+		template := typed.DesiredState.TaskTemplate
+		return template.DesiredState.Manifest.Containers, template.Labels, true
+	case *api.ReplicationController:
+		template := typed.DesiredState.TaskTemplate
+		return template.DesiredState.Manifest.Containers, template.Labels, true
+	}
+	return nil, nil, false
+}
+
+func isWrite(a *AdmissionAttributes) bool {
+	return a.Operation == "create" || a.Operation == "update"
+}
+
+// NewImagePrefixAdmission refuses containers whose image doesn't start with one of
+// prefixes, such as "registry.example.com/".
+func NewImagePrefixAdmission(prefixes []string) AdmissionController {
+	return AdmissionFunc(func(a *AdmissionAttributes) error {
+		containers, _, ok := containersOf(a.Object)
+		if !isWrite(a) || !ok {
+			return nil
+		}
+		for _, container := range containers {
+			allowed := false
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(container.Image, prefix) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return fmt.Errorf("image %q is not from an allowed registry (%s)", container.Image, strings.Join(prefixes, ", "))
+			}
+		}
+		return nil
+	})
+}
+
+// NewHostPortAdmission refuses containers which ask for a host port below minPort; with
+// 1024, tasks can't take over privileged ports on their hosts.
+func NewHostPortAdmission(minPort int) AdmissionController {
+	return AdmissionFunc(func(a *AdmissionAttributes) error {
+		containers, _, ok := containersOf(a.Object)
+		if !isWrite(a) || !ok {
+			return nil
+		}
+		for _, container := range containers {
+			for _, port := range container.Ports {
+				if port.HostPort != 0 && port.HostPort < minPort {
+					return fmt.Errorf("container %q may not use host port %d, the lowest allowed is %d", container.Name, port.HostPort, minPort)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NewRequiredLabelsAdmission refuses tasks, and replication controllers whose tasks,
+// don't carry every one of keys as a label.
+func NewRequiredLabelsAdmission(keys []string) AdmissionController {
+	return AdmissionFunc(func(a *AdmissionAttributes) error {
+		_, labels, ok := containersOf(a.Object)
+		if !isWrite(a) || !ok {
+			return nil
+		}
+		for _, key := range keys {
+			if _, ok := labels[key]; !ok {
+				return fmt.Errorf("tasks must be labeled with %q", key)
+			}
+		}
+		return nil
+	})
+}
+
+// NewMaxReplicasAdmission refuses replication controllers which want more than max
+// replicas.
+func NewMaxReplicasAdmission(max int) AdmissionController {
+	return AdmissionFunc(func(a *AdmissionAttributes) error {
+		if !isWrite(a) {
+			return nil
+		}
+		var replicas int
+		switch typed := a.Object.(type) {
+		case api.ReplicationController:
+			replicas = typed.DesiredState.Replicas
+		case *api.ReplicationController:
+			replicas = typed.DesiredState.Replicas
+		default:
+			return nil
+		}
+		if replicas > max {
+			return fmt.Errorf("%d replicas requested, at most %d are allowed", replicas, max)
+		}
+		return nil
+	})
+}
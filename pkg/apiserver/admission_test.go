@@ -0,0 +1,139 @@
+package apiserver
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func TestAdmissionChain(t *testing.T) {
+	calls := []string{}
+	appendLabel := func(name string) AdmissionController {
+		return AdmissionFunc(func(a *AdmissionAttributes) error {
+			calls = append(calls, name)
+			a.Object = a.Object.(string) + name
+			return nil
+		})
+	}
+	refuse := AdmissionFunc(func(a *AdmissionAttributes) error {
+		calls = append(calls, "refuse")
+		return errors.New("no")
+	})
+
+	attributes := AdmissionAttributes{Operation: "create", Object: ""}
+	expectNoError(t, NewAdmissionChain(appendLabel("a"), appendLabel("b")).Admit(&attributes))
+	if attributes.Object != "ab" {
+		t.Errorf("Unexpected object: %#v", attributes.Object)
+	}
+
+	calls = []string{}
+	if err := NewAdmissionChain(refuse, appendLabel("a")).Admit(&attributes); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if len(calls) != 1 {
+		t.Errorf("Expected the chain to stop at the first refusal, got %v", calls)
+	}
+}
+
+func makeAdmissionTask(image string, hostPort int, labels map[string]string) api.Task {
+	return api.Task{
+		JSONBase: api.JSONBase{ID: "foo"},
+		Labels:   labels,
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{
+					Name:  "web",
+					Image: image,
+					Ports: []api.Port{{ContainerPort: 80, HostPort: hostPort}},
+				}},
+			},
+		},
+	}
+}
+
+func makeAdmissionController(task api.Task, replicas int) api.ReplicationController {
+	return api.ReplicationController{
+		JSONBase: api.JSONBase{ID: "foo"},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: replicas,
+			TaskTemplate: api.TaskTemplate{
+				DesiredState: task.DesiredState,
+				Labels:       task.Labels,
+			},
+		},
+	}
+}
+
+func TestAdmissionPlugins(t *testing.T) {
+	team := map[string]string{"team": "frontend"}
+	good := makeAdmissionTask("registry.example.com/nginx", 8080, team)
+	admission := NewAdmissionChain(
+		NewImagePrefixAdmission([]string{"registry.example.com/", "mirror.example.com/"}),
+		NewHostPortAdmission(1024),
+		NewRequiredLabelsAdmission([]string{"team"}),
+		NewMaxReplicasAdmission(10),
+	)
+	table := []struct {
+		operation string
+		object    interface{}
+		allowed   bool
+	}{
+		{"create", good, true},
+		{"update", &good, true},
+		{"create", makeAdmissionTask("mirror.example.com/nginx", 0, team), true},
+		{"create", makeAdmissionTask("nginx", 8080, team), false},
+		{"create", makeAdmissionTask("registry.example.com/nginx", 80, team), false},
+		{"update", makeAdmissionTask("registry.example.com/nginx", 8080, nil), false},
+		{"create", makeAdmissionController(good, 10), true},
+		{"create", makeAdmissionController(good, 11), false},
+		{"update", makeAdmissionController(makeAdmissionTask("nginx", 8080, team), 1), false},
+		{"create", makeAdmissionController(makeAdmissionTask("registry.example.com/nginx", 8080, nil), 1), false},
+		{"create", api.Service{JSONBase: api.JSONBase{ID: "foo"}, Port: 80}, true},
+		{"delete", nil, true},
+	}
+	for _, item := range table {
+		err := admission.Admit(&AdmissionAttributes{Operation: item.operation, Resource: "tasks", Object: item.object})
+		if (err == nil) != item.allowed {
+			t.Errorf("Unexpected result for %s %#v: %v", item.operation, item.object, err)
+		}
+	}
+}
+
+func TestAdmitRequests(t *testing.T) {
+	storage := &SimpleRESTStorage{}
+	server := New(map[string]RESTStorage{"simple": storage}, codec, "/prefix/version")
+	var seen []AdmissionAttributes
+	server.admission = AdmissionFunc(func(a *AdmissionAttributes) error {
+		seen = append(seen, *a)
+		if a.Operation == "delete" {
+			return errors.New("deletes are not allowed")
+		}
+		a.Object = Simple{Name: a.Object.(Simple).Name + "-admitted"}
+		return nil
+	})
+	handler := httptest.NewServer(server)
+	defer handler.Close()
+
+	req, _ := http.NewRequest("PUT", handler.URL+"/prefix/version/simple/foo", bytes.NewBufferString(`{"Name": "bar"}`))
+	resp, err := http.DefaultClient.Do(req)
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK || storage.updated.Name != "bar-admitted" {
+		t.Errorf("Unexpected response %d, stored %#v", resp.StatusCode, storage.updated)
+	}
+
+	req, _ = http.NewRequest("DELETE", handler.URL+"/prefix/version/simple/foo", nil)
+	resp, err = http.DefaultClient.Do(req)
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusForbidden, api.StatusReasonForbidden)
+	if storage.deleted != "" {
+		t.Errorf("Unexpected delete of %q", storage.deleted)
+	}
+
+	if len(seen) != 2 || seen[0].Operation != "update" || seen[0].Resource != "simple" || seen[1].ID != "foo" {
+		t.Errorf("Unexpected admission calls: %#v", seen)
+	}
+}
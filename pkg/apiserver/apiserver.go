@@ -1,52 +1,159 @@
 package apiserver
 
 import (
+	"bytes"
 	//"crypto/subtle"
 	//"debug/gosym"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/api/validation"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/stream"
+	"k8s-firstcommit/pkg/util"
+	"k8s-firstcommit/pkg/watch"
 )
 
+// RESTStorage holds the objects of one collection. Objects live in namespaces; List,
+// Get and Delete are told which one the request is for, and the objects passed to
+// Create and Update already carry it.
 type RESTStorage interface {
-	List(*url.URL) (interface{}, error)
-	Get(id string) (interface{}, error)
-	Delete(id string) error
+	List(namespace string, url *url.URL) (interface{}, error)
+	Get(namespace, id string) (interface{}, error)
+	Delete(namespace, id string) error
 	Extract(body string) (interface{}, error)
-	Create(interface{}) error
-	Update(interface{}) error
+	// Create and Update return the object as it was stored, including any fields the
+	// storage filled in.
+	Create(interface{}) (interface{}, error)
+	Update(interface{}) (interface{}, error)
+}
+
+// RecordGetter is an optional interface for RESTStorage objects whose Get adds to the
+// stored object what it learns elsewhere, e.g. from the kubelet. Authorization is
+// checked against the record alone, so that it doesn't depend on anything else being
+// reachable.
+type RecordGetter interface {
+	// GetRecord returns the object named id as it is stored.
+	GetRecord(namespace, id string) (interface{}, error)
+}
+
+// getRecord returns the object named id as storage stores it.
+func getRecord(storage RESTStorage, namespace, id string) (interface{}, error) {
+	if getter, ok := storage.(RecordGetter); ok {
+		return getter.GetRecord(namespace, id)
+	}
+	return storage.Get(namespace, id)
 }
 
-type Status struct {
-	success bool
+// ResourceWatcher is an optional interface for RESTStorage objects which can stream
+// changes to the objects they hold. Storage which implements it can be watched by
+// adding ?watch=true to a GET of either the collection or a single object.
+type ResourceWatcher interface {
+	// WatchAll returns a watch on every object in namespace matching the query in url.
+	WatchAll(namespace string, url *url.URL) (watch.Interface, error)
+	// WatchSingle returns a watch on the object named id.
+	WatchSingle(namespace, id string) (watch.Interface, error)
+}
+
+// LogStreamer is an optional interface for RESTStorage objects whose objects have logs.
+// Storage which implements it serves them as plain text at <collection>/<id>/log.
+type LogStreamer interface {
+	// StreamLog returns the log of the object named id. query holds the arguments of the
+	// request, for the storage to take its options from. The caller closes the stream.
+	StreamLog(namespace, id string, query url.Values) (io.ReadCloser, error)
+}
+
+// Connecter is an optional interface for RESTStorage objects whose objects can be
+// connected to. Storage which implements it serves streams (see pkg/stream) for POSTs
+// to <collection>/<id>/exec and <collection>/<id>/portforward.
+type Connecter interface {
+	// Connect opens the stream for action, "exec" or "portforward", on the object named
+	// id. query holds the arguments of the request.
+	Connect(namespace, id, action string, query url.Values) (*stream.Conn, error)
+}
+
+// connectActions are the actions a Connecter may be asked to connect to.
+var connectActions = map[string]bool{"exec": true, "portforward": true}
+
+// WatchEvent is the representation of a watch.Event on the wire. Watches are sent as a
+// stream of these, one JSON object per line.
+type WatchEvent struct {
+	Type   watch.EventType `json:"type" yaml:"type"`
+	Object interface{}     `json:"object" yaml:"object"`
 }
 
 // ApiServer is an HTTPHandler that delegates to RESTStorage objects.
 // It handles URLs of the form:
-// ${prefix}/${storage_key}[/${object_name}]
+// ${prefix}/namespaces/${namespace}/${storage_key}[/${object_name}]
 // Where 'prefix' is an arbitrary string, and 'storage_key' points to a RESTStorage object stored in storage.
+// URLs without a namespace, ${prefix}/${storage_key}[/${object_name}], are in the
+// default namespace.
+// Each ApiServer speaks a single version of the API; to serve several versions side by
+// side, mount one ApiServer per version (see NewVersioned).
 //
 // TODO: consider migrating this to go-restful which is a more full-featured version of the same thing.
 type ApiServer struct {
-	prefix  string
-	storage map[string]RESTStorage
+	prefix     string
+	storage    map[string]RESTStorage
+	codec      api.Codec
+	authorizer Authorizer
+	admission  AdmissionController
+	auditor    Auditor
+}
+
+// Config holds the optional policy an ApiServer enforces on top of serving storage.
+type Config struct {
+	// Authorizer, if set, is asked about every request; requests it refuses get a 403.
+	Authorizer Authorizer
+	// Admission, if set, may change or refuse every create, update and delete once it
+	// has been authorized. Refused changes get a 403.
+	Admission AdmissionController
+	// Auditor, if set, is told the outcome of every create, update and delete.
+	Auditor Auditor
 }
 
 // New creates a new ApiServer object.
 // 'storage' contains a map of handlers.
+// 'codec' encodes the objects returned by storage into the API version being served.
 // 'prefix' is the hosting path prefix.
-func New(storage map[string]RESTStorage, prefix string) *ApiServer {
+func New(storage map[string]RESTStorage, codec api.Codec, prefix string) *ApiServer {
 	return &ApiServer{
 		storage: storage,
+		codec:   codec,
 		prefix:  prefix,
 	}
 }
 
+// NewVersioned returns a handler which serves storage once for every version in
+// api.Versions, at ${prefix}/${version}. Requests for anything else, including the
+// index page, are answered by the latest version.
+func NewVersioned(storage map[string]RESTStorage, prefix string, config Config) http.Handler {
+	newServer := func(version, versionPrefix string) *ApiServer {
+		server := New(storage, api.CodecForVersion(version), versionPrefix)
+		server.authorizer = config.Authorizer
+		server.admission = config.Admission
+		server.auditor = config.Auditor
+		return server
+	}
+	mux := http.NewServeMux()
+	for _, version := range api.Versions {
+		versionPrefix := prefix + "/" + version
+		mux.Handle(versionPrefix+"/", newServer(version, versionPrefix))
+	}
+	mux.Handle("/", newServer(api.LatestVersion, prefix+"/"+api.LatestVersion))
+	return mux
+}
+
 func (server *ApiServer) handleIndex(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	// TODO: server this out of a file?
 	data := "<html><body>Welcome to Kubernetes</body></html>"
@@ -58,7 +165,7 @@ func (server *ApiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	log.Printf("%s %s", req.Method, req.RequestURI)
 	url, err := url.ParseRequestURI(req.RequestURI)
 	if err != nil {
-		server.error(err, w)
+		server.error(err, req, w)
 		return
 	}
 	if url.Path == "/index.html" || url.Path == "/" || url.Path == "" {
@@ -70,6 +177,15 @@ func (server *ApiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	requestParts := strings.Split(url.Path[len(server.prefix):], "/")[1:]
+	namespace, base := api.NamespaceDefault, server.prefix
+	if len(requestParts) > 0 && requestParts[0] == "namespaces" {
+		if len(requestParts) < 3 || !validation.IsDNSLabel(requestParts[1]) {
+			server.notFound(req, w)
+			return
+		}
+		namespace, base = requestParts[1], path.Join(server.prefix, "namespaces", requestParts[1])
+		requestParts = requestParts[2:]
+	}
 	if len(requestParts) < 1 {
 		server.notFound(req, w)
 		return
@@ -79,115 +195,493 @@ func (server *ApiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		server.notFound(req, w)
 		return
 	} else {
-		server.handleREST(requestParts, url, req, w, storage)
+		server.handleREST(resourceRequest{namespace, path.Join(base, requestParts[0])}, requestParts, url, req, w, storage)
 	}
 }
 
+// resourceRequest is what the path of a request says about the objects it is for.
+type resourceRequest struct {
+	namespace string
+	// collection is the path of the collection the request was made to, which self
+	// links are relative to.
+	collection string
+}
+
 func (server *ApiServer) notFound(req *http.Request, w http.ResponseWriter) {
-	w.WriteHeader(404)
-	fmt.Sprint(w, "Not Found: %#v", req)
+	server.writeStatus(api.Status{
+		JSONBase: api.JSONBase{Kind: "Status"},
+		Status:   api.StatusFailure,
+		Code:     http.StatusNotFound,
+		Reason:   api.StatusReasonNotFound,
+		Message:  fmt.Sprintf("Not Found: %s %s", req.Method, req.URL.Path),
+	}, req, w)
 }
 
-func (server *ApiServer) write(statusCode int, object interface{}, w http.ResponseWriter) {
-	w.WriteHeader(statusCode)
-	output, err := json.MarshalIndent(object, "", "    ")
+func (server *ApiServer) write(statusCode int, object interface{}, req *http.Request, w http.ResponseWriter) {
+	contentType := responseContentType(req)
+	output, err := server.encode(object, contentType)
 	if err != nil {
-		server.error(err, w)
+		server.error(err, req, w)
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
 	w.Write(output)
 }
 
-func (server *ApiServer) error(err error, w http.ResponseWriter) {
-	w.WriteHeader(500)
-	fmt.Fprintf(w, "Internal Error: %#v", err)
+// encode returns object, in the version this server speaks, as either indented JSON or
+// YAML depending on contentType.
+func (server *ApiServer) encode(object interface{}, contentType string) ([]byte, error) {
+	return encode(server.codec, object, contentType)
+}
+
+func encode(codec api.Codec, object interface{}, contentType string) ([]byte, error) {
+	data, err := codec.Encode(object)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == yamlContentType {
+		return util.JSONToYAML(data)
+	}
+	var output bytes.Buffer
+	if err := json.Indent(&output, data, "", "    "); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// error writes err as a Status object. Errors which already carry a status (see
+// api.StatusError) keep their code, anything else is reported as an internal error.
+func (server *ApiServer) error(err error, req *http.Request, w http.ResponseWriter) {
+	statusErr, ok := err.(*api.StatusError)
+	if !ok {
+		statusErr = api.NewInternalErr(err).(*api.StatusError)
+	}
+	server.writeStatus(statusErr.Status(), req, w)
+}
+
+// badRequest reports a body that couldn't be extracted into an object. Storage may
+// return a typed error of its own, which is passed through untouched.
+func (server *ApiServer) badRequest(err error, req *http.Request, w http.ResponseWriter) {
+	if _, ok := err.(*api.StatusError); !ok {
+		err = api.NewBadRequestErr(err.Error())
+	}
+	server.error(err, req, w)
 }
 
+func (server *ApiServer) writeStatus(status api.Status, req *http.Request, w http.ResponseWriter) {
+	writeStatus(server.codec, status, req, w)
+}
+
+// writeStatus writes status with codec, for handlers which sit in front of an ApiServer.
+func writeStatus(codec api.Codec, status api.Status, req *http.Request, w http.ResponseWriter) {
+	if status.Code == 0 {
+		status.Code = http.StatusInternalServerError
+	}
+	contentType := responseContentType(req)
+	output, err := encode(codec, status, contentType)
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Internal Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status.Code)
+	w.Write(output)
+}
+
+// readBody returns the request body as JSON, converting it first if it was sent as YAML.
 func (server *ApiServer) readBody(req *http.Request) (string, error) {
 	defer req.Body.Close()
 	body, err := ioutil.ReadAll(req.Body)
-	return string(body), err
+	if err != nil {
+		return "", err
+	}
+	if isYAML(req.Header.Get("Content-Type")) {
+		if body, err = util.YAMLToJSON(body); err != nil {
+			return "", api.NewBadRequestErr(fmt.Sprintf("invalid YAML: %v", err))
+		}
+	}
+	return string(body), nil
+}
+
+// auditedVerbs maps the methods which change objects to the verbs they are audited as.
+var auditedVerbs = map[string]string{
+	"POST":   "create",
+	"PUT":    "update",
+	"PATCH":  "patch",
+	"DELETE": "delete",
 }
 
-func (server *ApiServer) handleREST(parts []string, url *url.URL, req *http.Request, w http.ResponseWriter, storage RESTStorage) {
+func (server *ApiServer) handleREST(target resourceRequest, parts []string, url *url.URL, req *http.Request, w http.ResponseWriter, storage RESTStorage) {
+	namespace := target.namespace
+	var audit *AuditEvent
+	if verb, ok := auditedVerbs[req.Method]; ok && server.auditor != nil {
+		var recorder *auditResponseWriter
+		audit, recorder = server.startAudit(verb, namespace, parts, req, w)
+		defer server.finishAudit(audit, recorder)
+		w = recorder
+	}
+	if req.Method != "GET" && isDryRun(url) {
+		dryRunner, ok := storage.(DryRunner)
+		if !ok {
+			server.error(api.NewBadRequestErr(fmt.Sprintf("%s can't be changed in a dry run", parts[0])), req, w)
+			return
+		}
+		storage = dryRunStorage{storage, dryRunner}
+		if audit != nil {
+			audit.DryRun = true
+		}
+	}
 	switch req.Method {
 	case "GET":
+		if url.Query().Get("watch") == "true" {
+			server.handleWatch(target, parts, url, req, w, storage)
+			return
+		}
 		switch len(parts) {
 		case 1:
-			controllers, err := storage.List(url)
+			if !server.authorizeList("list", namespace, parts[0], url, req, w) {
+				return
+			}
+			controllers, err := storage.List(namespace, url)
 			if err != nil {
-				server.error(err, w)
+				server.error(err, req, w)
 				return
 			}
-			server.write(200, controllers, w)
+			server.write(200, setSelfLink(controllers, target.collection), req, w)
 		case 2:
-			task, err := storage.Get(parts[1])
+			// Users who may not get the object learn neither whether it exists nor
+			// anything the storage would look up elsewhere.
+			if !server.authorizeStored("get", namespace, parts[0], parts[1], storage, req, w) {
+				return
+			}
+			task, err := storage.Get(namespace, parts[1])
 			if err != nil {
-				server.error(err, w)
+				server.error(err, req, w)
 				return
 			}
 			if task == nil {
 				server.notFound(req, w)
 				return
 			}
-			server.write(200, task, w)
+			server.write(200, setSelfLink(task, target.collection), req, w)
+		case 3:
+			if parts[2] != "log" {
+				server.notFound(req, w)
+				return
+			}
+			server.handleLog(namespace, parts, url, req, w, storage)
 		default:
 			server.notFound(req, w)
 		}
 		return
 	case "POST":
+		if len(parts) == 3 {
+			server.handleConnect(namespace, parts, url, req, w, storage, audit)
+			return
+		}
 		if len(parts) != 1 {
 			server.notFound(req, w)
 			return
 		}
-		body, err := server.readBody(req)
-		if err != nil {
-			server.error(err, w)
+		obj, ok := server.extract(namespace, storage, req, w)
+		if !ok {
 			return
 		}
-		obj, err := storage.Extract(body)
+		if audit != nil {
+			audit.ID, _ = objectAttributes(obj)
+		}
+		if !server.authorizeObject("create", namespace, parts[0], "", obj, req, w) {
+			return
+		}
+		obj, ok = server.admit("create", namespace, parts[0], "", obj, req, w)
+		if !ok {
+			return
+		}
+		obj, err := storage.Create(obj)
 		if err != nil {
-			server.error(err, w)
+			server.error(err, req, w)
 			return
 		}
-		storage.Create(obj)
-		server.write(200, obj, w)
+		if audit != nil {
+			// The storage may have generated the ID.
+			audit.ID, _ = objectAttributes(obj)
+		}
+		server.write(200, setSelfLink(obj, target.collection), req, w)
 		return
 	case "DELETE":
 		if len(parts) != 2 {
 			server.notFound(req, w)
 			return
 		}
-		err := storage.Delete(parts[1])
+		if !server.authorizeStored("delete", namespace, parts[0], parts[1], storage, req, w) {
+			return
+		}
+		if _, ok := server.admit("delete", namespace, parts[0], parts[1], nil, req, w); !ok {
+			return
+		}
+		err := storage.Delete(namespace, parts[1])
 		if err != nil {
-			server.error(err, w)
+			server.error(err, req, w)
 			return
 		}
-		server.write(200, Status{true}, w)
+		server.write(200, api.Status{
+			JSONBase: api.JSONBase{Kind: "Status"},
+			Status:   api.StatusSuccess,
+			Code:     http.StatusOK,
+		}, req, w)
 		return
 	case "PUT":
 		if len(parts) != 2 {
 			server.notFound(req, w)
 			return
 		}
-		body, err := server.readBody(req)
-		if err != nil {
-			server.error(err, w)
+		obj, ok := server.extract(namespace, storage, req, w)
+		if !ok {
 			return
 		}
-		obj, err := storage.Extract(body)
-		if err != nil {
-			server.error(err, w)
+		// The user must be allowed to both change the object as it is stored, and to
+		// store the result.
+		id, _ := objectAttributes(obj)
+		if audit != nil && len(id) > 0 {
+			// The object stored under the ID in the body is the one which changes.
+			audit.ID = id
+		}
+		if !server.authorizeStored("update", namespace, parts[0], id, storage, req, w) || !server.authorizeObject("update", namespace, parts[0], id, obj, req, w) {
 			return
 		}
-		err = storage.Update(obj)
+		obj, ok = server.admit("update", namespace, parts[0], id, obj, req, w)
+		if !ok {
+			return
+		}
+		obj, err := storage.Update(obj)
 		if err != nil {
-			server.error(err, w)
+			server.error(err, req, w)
 			return
 		}
-		server.write(200, obj, w)
+		server.write(200, setSelfLink(obj, target.collection), req, w)
 		return
+	case "PATCH":
+		if len(parts) != 2 {
+			server.notFound(req, w)
+			return
+		}
+		server.handlePatch(target, parts, req, w, storage)
+		return
+	default:
+		server.notFound(req, w)
+	}
+}
+
+// extract reads the object in the body of req and places it in namespace. Bodies which
+// name a different namespace are refused with a 400.
+func (server *ApiServer) extract(namespace string, storage RESTStorage, req *http.Request, w http.ResponseWriter) (interface{}, bool) {
+	body, err := server.readBody(req)
+	if err != nil {
+		server.error(err, req, w)
+		return nil, false
+	}
+	obj, err := storage.Extract(body)
+	if err != nil {
+		server.badRequest(err, req, w)
+		return nil, false
+	}
+	obj, err = setNamespace(obj, namespace)
+	if err != nil {
+		server.badRequest(err, req, w)
+		return nil, false
+	}
+	return obj, true
+}
+
+// authorize asks the server's Authorizer whether the request may act on the described
+// object, and answers it with a 403 if not.
+func (server *ApiServer) authorize(verb, namespace, resource, id string, labels map[string]string, req *http.Request, w http.ResponseWriter) bool {
+	if server.authorizer == nil {
+		return true
+	}
+	user, _ := UserFrom(req)
+	err := server.authorizer.Authorize(Attributes{User: user, Verb: verb, Namespace: namespace, Resource: resource, ID: id, Labels: labels})
+	if err != nil {
+		server.error(api.NewForbiddenErr(resource, id, err), req, w)
+		return false
+	}
+	return true
+}
+
+// authorizeList is like authorize, for a list or watch of a whole collection. The labels
+// are those the request's label selector requires; a selector which doesn't parse is
+// answered with a 400.
+func (server *ApiServer) authorizeList(verb, namespace, resource string, url *url.URL, req *http.Request, w http.ResponseWriter) bool {
+	selector, err := labels.Parse(url.Query().Get("labels"))
+	if err != nil {
+		server.badRequest(err, req, w)
+		return false
+	}
+	return server.authorize(verb, namespace, resource, "", selector.RequiredValues(), req, w)
+}
+
+// authorizeObject is like authorize, but takes the labels from obj. id is used if the
+// object doesn't carry one.
+func (server *ApiServer) authorizeObject(verb, namespace, resource, id string, obj interface{}, req *http.Request, w http.ResponseWriter) bool {
+	objID, labels := objectAttributes(obj)
+	if len(objID) == 0 {
+		objID = id
+	}
+	return server.authorize(verb, namespace, resource, objID, labels, req, w)
+}
+
+// authorizeStored is like authorizeObject for the object currently stored as id, as
+// getRecord returns it. Objects which don't exist are authorized by ID alone, and
+// reported missing by the storage later.
+func (server *ApiServer) authorizeStored(verb, namespace, resource, id string, storage RESTStorage, req *http.Request, w http.ResponseWriter) bool {
+	if server.authorizer == nil {
+		return true
+	}
+	obj, err := getRecord(storage, namespace, id)
+	if err != nil && !api.IsNotFound(err) {
+		server.error(err, req, w)
+		return false
+	}
+	return server.authorizeObject(verb, namespace, resource, id, obj, req, w)
+}
+
+// admit passes a change through the server's AdmissionController, and returns the
+// object to store. Refused changes are answered with a 403.
+func (server *ApiServer) admit(operation, namespace, resource, id string, obj interface{}, req *http.Request, w http.ResponseWriter) (interface{}, bool) {
+	if server.admission == nil {
+		return obj, true
+	}
+	user, _ := UserFrom(req)
+	attributes := AdmissionAttributes{User: user, Operation: operation, Namespace: namespace, Resource: resource, ID: id, Object: obj}
+	if err := server.admission.Admit(&attributes); err != nil {
+		if _, ok := err.(*api.StatusError); !ok {
+			err = api.NewForbiddenErr(resource, id, err)
+		}
+		server.error(err, req, w)
+		return nil, false
+	}
+	return attributes.Object, true
+}
+
+// handleLog streams the log of a single object. Like a watch, a followed log is cut
+// short by the server's write timeout.
+func (server *ApiServer) handleLog(namespace string, parts []string, url *url.URL, req *http.Request, w http.ResponseWriter, storage RESTStorage) {
+	streamer, ok := storage.(LogStreamer)
+	if !ok {
+		server.notFound(req, w)
+		return
+	}
+	if !server.authorizeStored("log", namespace, parts[0], parts[1], storage, req, w) {
+		return
+	}
+	stream, err := streamer.StreamLog(namespace, parts[1], url.Query())
+	if err != nil {
+		server.error(err, req, w)
+		return
+	}
+	defer stream.Close()
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(util.NewFlushWriter(w), stream); err != nil {
+		log.Printf("Error streaming the log of %s %s: %v", parts[0], parts[1], err)
+	}
+}
+
+// handleConnect joins the client to a stream opened by the storage, once the client is
+// allowed to. The storage is connected to before the client's connection is upgraded,
+// so that its errors are still sent as a status.
+func (server *ApiServer) handleConnect(namespace string, parts []string, url *url.URL, req *http.Request, w http.ResponseWriter, storage RESTStorage, audit *AuditEvent) {
+	connecter, ok := storage.(Connecter)
+	if !ok || !connectActions[parts[2]] {
+		server.notFound(req, w)
+		return
+	}
+	if audit != nil {
+		audit.Verb = parts[2]
+	}
+	if !stream.IsUpgradeRequest(req) {
+		server.error(api.NewBadRequestErr(fmt.Sprintf("%s must upgrade the connection to %s", parts[2], stream.Protocol)), req, w)
+		return
+	}
+	if !server.authorizeStored(parts[2], namespace, parts[0], parts[1], storage, req, w) {
+		return
+	}
+	backend, err := connecter.Connect(namespace, parts[1], parts[2], url.Query())
+	if err != nil {
+		server.error(err, req, w)
+		return
+	}
+	conn, err := stream.Upgrade(w, req)
+	if err != nil {
+		log.Printf("Error upgrading %s of %s %s: %v", parts[2], parts[0], parts[1], err)
+		backend.Close()
+		return
+	}
+	stream.Join(conn, backend)
+}
+
+// handleWatch streams events from storage until either the watch ends or the client
+// goes away. Clients should expect the stream to be closed at any time (for example by
+// the server's write timeout) and start a new watch when that happens.
+func (server *ApiServer) handleWatch(target resourceRequest, parts []string, url *url.URL, req *http.Request, w http.ResponseWriter, storage RESTStorage) {
+	watcher, ok := storage.(ResourceWatcher)
+	if !ok {
+		server.error(api.NewBadRequestErr(fmt.Sprintf("%s does not support watch", parts[0])), req, w)
+		return
+	}
+	var watching watch.Interface
+	var err error
+	switch len(parts) {
+	case 1:
+		if !server.authorizeList("watch", target.namespace, parts[0], url, req, w) {
+			return
+		}
+		watching, err = watcher.WatchAll(target.namespace, url)
+	case 2:
+		if !server.authorizeStored("watch", target.namespace, parts[0], parts[1], storage, req, w) {
+			return
+		}
+		watching, err = watcher.WatchSingle(target.namespace, parts[1])
 	default:
 		server.notFound(req, w)
+		return
+	}
+	if err != nil {
+		server.error(err, req, w)
+		return
+	}
+	defer watching.Stop()
+
+	contentType := responseContentType(req)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case event, ok := <-watching.ResultChan():
+			if !ok {
+				return
+			}
+			object, err := server.codec.Encode(setSelfLink(event.Object, target.collection))
+			if err != nil {
+				log.Printf("Error encoding watch event: %v", err)
+				return
+			}
+			if err := writeWatchEvent(w, contentType, WatchEvent{Type: event.Type, Object: json.RawMessage(object)}); err != nil {
+				log.Printf("Error writing watch event: %v", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-req.Context().Done():
+			return
+		}
 	}
 }
@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"testing"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/stream"
+	"k8s-firstcommit/pkg/watch"
 )
 
 // TODO: This doesn't reduce typing enough to make it worth the less readable errors. Remove.
@@ -27,26 +32,40 @@ type SimpleList struct {
 	Items []Simple
 }
 
+// simpleCodec encodes the test types, which aren't registered with api.Scheme, as plain JSON.
+type simpleCodec struct{}
+
+func (simpleCodec) Encode(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+var codec = simpleCodec{}
+
 type SimpleRESTStorage struct {
 	err     error
 	list    []Simple
 	item    Simple
 	deleted string
 	updated Simple
+	// namespace is the namespace of the last List, Get or Delete.
+	namespace string
 }
 
-func (storage *SimpleRESTStorage) List(*url.URL) (interface{}, error) {
+func (storage *SimpleRESTStorage) List(namespace string, url *url.URL) (interface{}, error) {
+	storage.namespace = namespace
 	result := SimpleList{
 		Items: storage.list,
 	}
 	return result, storage.err
 }
 
-func (storage *SimpleRESTStorage) Get(id string) (interface{}, error) {
+func (storage *SimpleRESTStorage) Get(namespace, id string) (interface{}, error) {
+	storage.namespace = namespace
 	return storage.item, storage.err
 }
 
-func (storage *SimpleRESTStorage) Delete(id string) error {
+func (storage *SimpleRESTStorage) Delete(namespace, id string) error {
+	storage.namespace = namespace
 	storage.deleted = id
 	return storage.err
 }
@@ -57,13 +76,13 @@ func (storage *SimpleRESTStorage) Extract(body string) (interface{}, error) {
 	return item, storage.err
 }
 
-func (storage *SimpleRESTStorage) Create(interface{}) error {
-	return storage.err
+func (storage *SimpleRESTStorage) Create(object interface{}) (interface{}, error) {
+	return object, storage.err
 }
 
-func (storage *SimpleRESTStorage) Update(object interface{}) error {
+func (storage *SimpleRESTStorage) Update(object interface{}) (interface{}, error) {
 	storage.updated = object.(Simple)
-	return storage.err
+	return object, storage.err
 }
 
 func extractBody(response *http.Response, object interface{}) (string, error) {
@@ -80,7 +99,7 @@ func TestSimpleList(t *testing.T) {
 	storage := map[string]RESTStorage{}
 	simpleStorage := SimpleRESTStorage{}
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	resp, err := http.Get(server.URL + "/prefix/version/simple")
@@ -91,13 +110,29 @@ func TestSimpleList(t *testing.T) {
 	}
 }
 
+func TestListBadSelector(t *testing.T) {
+	storage := map[string]RESTStorage{}
+	storage["simple"] = &SimpleRESTStorage{}
+	handler := New(storage, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	for _, query := range []url.Values{
+		{"labels": []string{"name in (foo"}},
+		{"labels": []string{"name in (foo"}, "watch": []string{"true"}},
+	} {
+		resp, err := http.Get(server.URL + "/prefix/version/simple?" + query.Encode())
+		expectNoError(t, err)
+		expectStatus(t, resp, http.StatusBadRequest, api.StatusReasonBadRequest)
+	}
+}
+
 func TestErrorList(t *testing.T) {
 	storage := map[string]RESTStorage{}
 	simpleStorage := SimpleRESTStorage{
 		err: fmt.Errorf("Test Error"),
 	}
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	resp, err := http.Get(server.URL + "/prefix/version/simple")
@@ -118,7 +153,7 @@ func TestNonEmptyList(t *testing.T) {
 		},
 	}
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	resp, err := http.Get(server.URL + "/prefix/version/simple")
@@ -146,7 +181,7 @@ func TestGet(t *testing.T) {
 		},
 	}
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	resp, err := http.Get(server.URL + "/prefix/version/simple/id")
@@ -163,7 +198,7 @@ func TestDelete(t *testing.T) {
 	simpleStorage := SimpleRESTStorage{}
 	ID := "id"
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	client := http.Client{}
@@ -180,7 +215,7 @@ func TestUpdate(t *testing.T) {
 	simpleStorage := SimpleRESTStorage{}
 	ID := "id"
 	storage["simple"] = &simpleStorage
-	handler := New(storage, "/prefix/version")
+	handler := New(storage, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 
 	item := Simple{
@@ -198,7 +233,7 @@ func TestUpdate(t *testing.T) {
 }
 
 func TestBadPath(t *testing.T) {
-	handler := New(map[string]RESTStorage{}, "/prefix/version")
+	handler := New(map[string]RESTStorage{}, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 	client := http.Client{}
 
@@ -212,7 +247,7 @@ func TestBadPath(t *testing.T) {
 }
 
 func TestMissingPath(t *testing.T) {
-	handler := New(map[string]RESTStorage{}, "/prefix/version")
+	handler := New(map[string]RESTStorage{}, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 	client := http.Client{}
 
@@ -228,7 +263,7 @@ func TestMissingPath(t *testing.T) {
 func TestMissingStorage(t *testing.T) {
 	handler := New(map[string]RESTStorage{
 		"foo": &SimpleRESTStorage{},
-	}, "/prefix/version")
+	}, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 	client := http.Client{}
 
@@ -244,7 +279,7 @@ func TestMissingStorage(t *testing.T) {
 func TestCreate(t *testing.T) {
 	handler := New(map[string]RESTStorage{
 		"foo": &SimpleRESTStorage{},
-	}, "/prefix/version")
+	}, codec, "/prefix/version")
 	server := httptest.NewServer(handler)
 	client := http.Client{}
 
@@ -265,3 +300,457 @@ func TestCreate(t *testing.T) {
 		t.Errorf("Unexpected data: %#v, expected %#v (%s)", itemOut, simple, string(body))
 	}
 }
+
+func expectStatus(t *testing.T, response *http.Response, code int, reason api.StatusReason) {
+	if response.StatusCode != code {
+		t.Errorf("Unexpected status code: %d, expected %d", response.StatusCode, code)
+	}
+	var status api.Status
+	body, err := extractBody(response, &status)
+	expectNoError(t, err)
+	if status.Code != code || status.Reason != reason || status.Status != api.StatusFailure {
+		t.Errorf("Unexpected status: %#v (%s)", status, body)
+	}
+}
+
+func TestGetNotFound(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"simple": &SimpleRESTStorage{
+			err: api.NewNotFoundErr("simple", "id"),
+		},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/version/simple/id")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusNotFound, api.StatusReasonNotFound)
+}
+
+func TestCreateAlreadyExists(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"simple": &SimpleRESTStorage{
+			err: api.NewAlreadyExistsErr("simple", "foo"),
+		},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	data, _ := json.Marshal(Simple{Name: "foo"})
+	resp, err := http.Post(server.URL+"/prefix/version/simple", "application/json", bytes.NewBuffer(data))
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusConflict, api.StatusReasonAlreadyExists)
+}
+
+func TestCreateInvalid(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"simple": &SimpleRESTStorage{
+			err: api.NewInvalidErr("simple", "foo", []api.StatusCause{{Field: "name", Message: "is required"}}),
+		},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	data, _ := json.Marshal(Simple{Name: "foo"})
+	resp, err := http.Post(server.URL+"/prefix/version/simple", "application/json", bytes.NewBuffer(data))
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusUnprocessableEntity, api.StatusReasonInvalid)
+}
+
+func TestInternalErrorStatus(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"simple": &SimpleRESTStorage{
+			err: fmt.Errorf("etcd is down"),
+		},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/version/simple")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusInternalServerError, api.StatusReasonInternalError)
+}
+
+func TestNotFoundPathStatus(t *testing.T) {
+	handler := New(map[string]RESTStorage{}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/version/missing")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusNotFound, api.StatusReasonNotFound)
+}
+
+type WatchableRESTStorage struct {
+	SimpleRESTStorage
+	fakeWatch *watch.FakeWatcher
+	watchedID string
+}
+
+func (storage *WatchableRESTStorage) WatchAll(namespace string, url *url.URL) (watch.Interface, error) {
+	return storage.fakeWatch, storage.err
+}
+
+func (storage *WatchableRESTStorage) WatchSingle(namespace, id string) (watch.Interface, error) {
+	storage.watchedID = id
+	return storage.fakeWatch, storage.err
+}
+
+func TestWatch(t *testing.T) {
+	simpleStorage := &WatchableRESTStorage{fakeWatch: watch.NewFake()}
+	handler := New(map[string]RESTStorage{
+		"simple": simpleStorage,
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/version/simple/foo?watch=true")
+	expectNoError(t, err)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Unexpected status: %d", resp.StatusCode)
+	}
+	if simpleStorage.watchedID != "foo" {
+		t.Errorf("Unexpected watch id: %s", simpleStorage.watchedID)
+	}
+	go func() {
+		simpleStorage.fakeWatch.Add(Simple{Name: "foo"})
+		simpleStorage.fakeWatch.Delete(Simple{Name: "foo"})
+		simpleStorage.fakeWatch.Stop()
+	}()
+
+	decoder := json.NewDecoder(resp.Body)
+	defer resp.Body.Close()
+	for _, expectedType := range []watch.EventType{watch.Added, watch.Deleted} {
+		var event struct {
+			Type   watch.EventType
+			Object Simple
+		}
+		expectNoError(t, decoder.Decode(&event))
+		if event.Type != expectedType || event.Object.Name != "foo" {
+			t.Errorf("Unexpected event: %#v", event)
+		}
+	}
+}
+
+func TestWatchNotSupported(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"simple": &SimpleRESTStorage{},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/version/simple?watch=true")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusBadRequest, api.StatusReasonBadRequest)
+}
+
+// ServiceRESTStorage returns a registered api type, so it can be served with the real codecs.
+type ServiceRESTStorage struct {
+	SimpleRESTStorage
+}
+
+func (storage *ServiceRESTStorage) Get(namespace, id string) (interface{}, error) {
+	return api.Service{JSONBase: api.JSONBase{ID: id}, Port: 80}, nil
+}
+
+func TestNewVersioned(t *testing.T) {
+	handler := NewVersioned(map[string]RESTStorage{
+		"services": &ServiceRESTStorage{},
+	}, "/prefix", Config{})
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/v1beta1/services/foo")
+	expectNoError(t, err)
+	var out map[string]interface{}
+	body, err := extractBody(resp, &out)
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK || out["apiVersion"] != "v1beta1" || out["kind"] != "Service" || out["id"] != "foo" {
+		t.Errorf("Unexpected response: %d %s", resp.StatusCode, body)
+	}
+	if out["selfLink"] != "/prefix/v1beta1/services/foo" {
+		t.Errorf("Unexpected self link: %v", out["selfLink"])
+	}
+
+	resp, err = http.Get(server.URL + "/prefix/v0/services/foo")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusNotFound, api.StatusReasonNotFound)
+
+	resp, err = http.Get(server.URL + "/")
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected status for the index: %d", resp.StatusCode)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	simpleStorage := &SimpleRESTStorage{}
+	handler := New(map[string]RESTStorage{
+		"simple": simpleStorage,
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	table := []struct {
+		path      string
+		code      int
+		namespace string
+	}{
+		{"/prefix/version/simple", http.StatusOK, api.NamespaceDefault},
+		{"/prefix/version/simple/foo", http.StatusOK, api.NamespaceDefault},
+		{"/prefix/version/namespaces/other/simple", http.StatusOK, "other"},
+		{"/prefix/version/namespaces/other/simple/foo", http.StatusOK, "other"},
+		{"/prefix/version/namespaces/other", http.StatusNotFound, ""},
+		{"/prefix/version/namespaces/Not_A_Label/simple", http.StatusNotFound, ""},
+		{"/prefix/version/namespaces/other/missing", http.StatusNotFound, ""},
+	}
+	for _, item := range table {
+		simpleStorage.namespace = ""
+		resp, err := http.Get(server.URL + item.path)
+		expectNoError(t, err)
+		if resp.StatusCode != item.code || simpleStorage.namespace != item.namespace {
+			t.Errorf("%s: unexpected status %d, namespace %q", item.path, resp.StatusCode, simpleStorage.namespace)
+		}
+	}
+}
+
+func TestNamespacedSelfLink(t *testing.T) {
+	handler := NewVersioned(map[string]RESTStorage{
+		"services": &ServiceRESTStorage{},
+	}, "/prefix", Config{})
+	server := httptest.NewServer(handler)
+
+	resp, err := http.Get(server.URL + "/prefix/v1beta1/namespaces/other/services/foo")
+	expectNoError(t, err)
+	var out map[string]interface{}
+	body, err := extractBody(resp, &out)
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK || out["selfLink"] != "/prefix/v1beta1/namespaces/other/services/foo" {
+		t.Errorf("Unexpected response: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestCreateYAML(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"foo": &SimpleRESTStorage{},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	request, err := http.NewRequest("POST", server.URL+"/prefix/version/foo", bytes.NewBufferString("Name: foo\n"))
+	expectNoError(t, err)
+	request.Header.Set("Content-Type", "application/yaml")
+	request.Header.Set("Accept", "application/yaml")
+	response, err := http.DefaultClient.Do(request)
+	expectNoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	expectNoError(t, err)
+	if response.StatusCode != http.StatusOK || string(body) != "Name: foo\n" {
+		t.Errorf("Unexpected response: %d %q", response.StatusCode, body)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/yaml" {
+		t.Errorf("Unexpected content type: %s", contentType)
+	}
+}
+
+func TestCreateInvalidYAML(t *testing.T) {
+	handler := New(map[string]RESTStorage{
+		"foo": &SimpleRESTStorage{},
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	request, err := http.NewRequest("POST", server.URL+"/prefix/version/foo", bytes.NewBufferString("Name: [foo\n"))
+	expectNoError(t, err)
+	request.Header.Set("Content-Type", "text/yaml")
+	response, err := http.DefaultClient.Do(request)
+	expectNoError(t, err)
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Unexpected content type: %s", contentType)
+	}
+	expectStatus(t, response, http.StatusBadRequest, api.StatusReasonBadRequest)
+}
+
+func TestIndexContentType(t *testing.T) {
+	server := httptest.NewServer(New(map[string]RESTStorage{}, codec, "/prefix/version"))
+
+	response, err := http.Get(server.URL + "/")
+	expectNoError(t, err)
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected content type: %s", contentType)
+	}
+}
+
+func TestWatchYAML(t *testing.T) {
+	simpleStorage := &WatchableRESTStorage{fakeWatch: watch.NewFake()}
+	handler := New(map[string]RESTStorage{
+		"simple": simpleStorage,
+	}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+
+	request, err := http.NewRequest("GET", server.URL+"/prefix/version/simple?watch=true", nil)
+	expectNoError(t, err)
+	request.Header.Set("Accept", "application/yaml")
+	resp, err := http.DefaultClient.Do(request)
+	expectNoError(t, err)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/yaml" {
+		t.Errorf("Unexpected content type: %s", contentType)
+	}
+	go func() {
+		simpleStorage.fakeWatch.Add(Simple{Name: "foo"})
+		simpleStorage.fakeWatch.Stop()
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	expectNoError(t, err)
+	expected := "---\nobject:\n  Name: foo\ntype: ADDED\n"
+	if string(body) != expected {
+		t.Errorf("Unexpected stream: %q", body)
+	}
+}
+
+// LogRESTStorage is a SimpleRESTStorage whose objects have logs.
+type LogRESTStorage struct {
+	SimpleRESTStorage
+	query url.Values
+}
+
+func (storage *LogRESTStorage) StreamLog(namespace, id string, query url.Values) (io.ReadCloser, error) {
+	storage.query = query
+	if storage.err != nil {
+		return nil, storage.err
+	}
+	return ioutil.NopCloser(bytes.NewBufferString("log of " + id)), nil
+}
+
+func TestLog(t *testing.T) {
+	storage := &LogRESTStorage{}
+	server := New(map[string]RESTStorage{"simple": storage, "plain": &SimpleRESTStorage{}}, codec, "/prefix/version")
+	handler := httptest.NewServer(server)
+	defer handler.Close()
+
+	resp, err := http.Get(handler.URL + "/prefix/version/simple/foo/log?tail=5")
+	expectNoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/plain" || string(body) != "log of foo" {
+		t.Errorf("Unexpected response %#v: %s", resp, body)
+	}
+	if storage.query.Get("tail") != "5" {
+		t.Errorf("Unexpected query: %v", storage.query)
+	}
+
+	for _, path := range []string{"/simple/foo/status", "/plain/foo/log"} {
+		resp, err = http.Get(handler.URL + "/prefix/version" + path)
+		expectNoError(t, err)
+		expectStatus(t, resp, http.StatusNotFound, api.StatusReasonNotFound)
+	}
+
+	storage.err = api.NewBadRequestErr("no machine")
+	resp, err = http.Get(handler.URL + "/prefix/version/simple/foo/log")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusBadRequest, api.StatusReasonBadRequest)
+
+	storage.err = nil
+	server.authorizer = NewPolicyAuthorizer([]PolicyRule{{Verbs: []string{"get"}}})
+	resp, err = http.Get(handler.URL + "/prefix/version/simple/foo/log")
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusForbidden, api.StatusReasonForbidden)
+}
+
+// ConnectRESTStorage is a SimpleRESTStorage whose objects connect to backend.
+type ConnectRESTStorage struct {
+	SimpleRESTStorage
+	backend string
+	action  string
+	query   url.Values
+}
+
+func (storage *ConnectRESTStorage) Connect(namespace, id, action string, query url.Values) (*stream.Conn, error) {
+	storage.action, storage.query = action, query
+	if storage.err != nil {
+		return nil, storage.err
+	}
+	req, err := http.NewRequest("POST", storage.backend, nil)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Dial(req, nil)
+}
+
+// channelAuditor sends every event to a channel, so that events recorded once a stream
+// ends can be waited for.
+type channelAuditor chan AuditEvent
+
+func (a channelAuditor) Audit(event AuditEvent) {
+	a <- event
+}
+
+func dialConnect(url string) (*stream.Conn, error) {
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Dial(req, nil)
+}
+
+func TestConnect(t *testing.T) {
+	// The backend echoes a single frame back, and ends.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := stream.Upgrade(w, req)
+		expectNoError(t, err)
+		defer conn.Close()
+		_, data, err := conn.ReadFrame()
+		expectNoError(t, err)
+		conn.WriteFrame(stream.Stdout, data)
+		conn.WriteJSON(stream.Status, stream.ExitStatus{})
+	}))
+	defer backend.Close()
+	storage := &ConnectRESTStorage{SimpleRESTStorage: SimpleRESTStorage{item: Simple{Name: "foo"}}, backend: backend.URL}
+	server := New(map[string]RESTStorage{"simple": storage, "plain": &SimpleRESTStorage{}}, codec, "/prefix/version")
+	auditor := make(channelAuditor, 10)
+	server.auditor = auditor
+	handler := httptest.NewServer(server)
+	defer handler.Close()
+
+	conn, err := dialConnect(handler.URL + "/prefix/version/simple/foo/exec?command=ls&command=-l")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectNoError(t, conn.WriteFrame(stream.Stdin, []byte("hello")))
+	channel, data, err := conn.ReadFrame()
+	expectNoError(t, err)
+	if channel != stream.Stdout || string(data) != "hello" {
+		t.Errorf("Unexpected frame %d: %s", channel, data)
+	}
+	channel, _, err = conn.ReadFrame()
+	expectNoError(t, err)
+	if channel != stream.Status {
+		t.Errorf("Expected a status, got channel %d", channel)
+	}
+	// The stream is over once the connection closes.
+	if _, _, err := conn.ReadFrame(); err == nil {
+		t.Error("Expected the stream to be closed")
+	}
+	conn.Close()
+	if event := <-auditor; event.Verb != "exec" || event.ID != "foo" || event.Code != http.StatusSwitchingProtocols {
+		t.Errorf("Unexpected audit event: %#v", event)
+	}
+	if storage.action != "exec" || len(storage.query["command"]) != 2 {
+		t.Errorf("Unexpected connect to %s with %v", storage.action, storage.query)
+	}
+
+	for path, code := range map[string]int{
+		"/simple/foo/attach":      http.StatusNotFound,
+		"/plain/foo/exec":         http.StatusNotFound,
+		"/simple/foo/portforward": http.StatusBadRequest,
+	} {
+		if path == "/simple/foo/portforward" {
+			storage.err = api.NewBadRequestErr("no port")
+		}
+		_, err := dialConnect(handler.URL + "/prefix/version" + path)
+		if upgradeErr, ok := err.(*stream.UpgradeError); !ok || upgradeErr.StatusCode != code {
+			t.Errorf("Expected %d for %s, got %#v", code, path, err)
+		}
+	}
+	storage.err = nil
+
+	resp, err := http.Post(handler.URL+"/prefix/version/simple/foo/exec", "application/json", nil)
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusBadRequest, api.StatusReasonBadRequest)
+
+	server.authorizer = NewPolicyAuthorizer([]PolicyRule{{Verbs: []string{"get", "log"}}})
+	_, err = dialConnect(handler.URL + "/prefix/version/simple/foo/exec?command=ls")
+	if upgradeErr, ok := err.(*stream.UpgradeError); !ok || upgradeErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected exec to be forbidden, got %#v", err)
+	}
+}
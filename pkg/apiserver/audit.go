@@ -0,0 +1,124 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditEvent records a request which changed, or tried to change, an object, or which
+// connected to one.
+type AuditEvent struct {
+	Timestamp string   `json:"timestamp"`
+	User      string   `json:"user,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	// Verb is one of "create", "update", "patch", "delete", "exec" or "portforward".
+	Verb      string `json:"verb"`
+	Namespace string `json:"namespace"`
+	Resource  string `json:"resource"`
+	ID        string `json:"id,omitempty"`
+	// Code is the HTTP status code of the response.
+	Code int `json:"code"`
+	// Body is the body of the request, as sent.
+	Body string `json:"body,omitempty"`
+	// DryRun is set for requests which only checked the change (see DryRunner).
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Auditor is told about every create, update and delete, once it has been answered.
+type Auditor interface {
+	Audit(event AuditEvent)
+}
+
+// AuditLog is an Auditor which writes events to a file as JSON, one per line.
+type AuditLog struct {
+	lock        sync.Mutex
+	w           io.Writer
+	includeBody bool
+}
+
+// NewAuditLog returns an AuditLog writing to w. Request bodies are only logged if
+// includeBody is set.
+func NewAuditLog(w io.Writer, includeBody bool) *AuditLog {
+	return &AuditLog{w: w, includeBody: includeBody}
+}
+
+func (l *AuditLog) Audit(event AuditEvent) {
+	if !l.includeBody {
+		event.Body = ""
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Unable to encode audit event %#v: %v", event, err)
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Unable to write audit event %s: %v", data, err)
+	}
+}
+
+// auditResponseWriter remembers the status code of a response.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack hands the connection over to a stream, which switches protocols.
+func (w *auditResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the connection can't be hijacked")
+	}
+	w.code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// startAudit begins the audit event for a request, returning the writer the response
+// must go through so that its code can be recorded. The body is read in full and
+// replaced, so it can still be read by the handler.
+func (server *ApiServer) startAudit(verb, namespace string, parts []string, req *http.Request, w http.ResponseWriter) (*AuditEvent, *auditResponseWriter) {
+	event := &AuditEvent{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Verb:      verb,
+		Namespace: namespace,
+		Resource:  parts[0],
+	}
+	if len(parts) > 1 {
+		event.ID = parts[1]
+	}
+	if user, ok := UserFrom(req); ok {
+		event.User = user.Name
+		event.Groups = user.Groups
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			log.Printf("Unable to read the body of %s %s for the audit log: %v", req.Method, req.RequestURI, err)
+		}
+		event.Body = string(body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return event, &auditResponseWriter{ResponseWriter: w, code: http.StatusOK}
+}
+
+// finishAudit completes event with the outcome of the request, and records it.
+func (server *ApiServer) finishAudit(event *AuditEvent, w *auditResponseWriter) {
+	event.Code = w.code
+	server.auditor.Audit(*event)
+}
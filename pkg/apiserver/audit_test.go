@@ -0,0 +1,80 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingAuditor []AuditEvent
+
+func (r *recordingAuditor) Audit(event AuditEvent) {
+	*r = append(*r, event)
+}
+
+func TestAuditRequests(t *testing.T) {
+	storage := &SimpleRESTStorage{}
+	server := New(map[string]RESTStorage{"simple": storage}, codec, "/prefix/version")
+	auditor := &recordingAuditor{}
+	server.auditor = auditor
+	server.admission = AdmissionFunc(func(a *AdmissionAttributes) error {
+		if a.Operation == "delete" {
+			return errors.New("deletes are not allowed")
+		}
+		return nil
+	})
+	user := &UserInfo{Name: "olivia", Groups: []string{"ops"}}
+	handler := httptest.NewServer(WithAuthentication(server, staticAuthenticator(user, true, nil)))
+	defer handler.Close()
+
+	for _, item := range []struct{ method, path, body string }{
+		{"GET", "/simple/foo", ""},
+		{"PUT", "/simple/foo", `{"Name": "bar"}`},
+		{"DELETE", "/simple/foo", ""},
+	} {
+		req, _ := http.NewRequest(item.method, handler.URL+"/prefix/version"+item.path, bytes.NewBufferString(item.body))
+		_, err := http.DefaultClient.Do(req)
+		expectNoError(t, err)
+	}
+	if storage.updated.Name != "bar" {
+		t.Errorf("Expected the update to read the body, got %#v", storage.updated)
+	}
+
+	if len(*auditor) != 2 {
+		t.Fatalf("Expected only changes to be audited, got %#v", *auditor)
+	}
+	update, remove := (*auditor)[0], (*auditor)[1]
+	if update.User != "olivia" || update.Verb != "update" || update.Resource != "simple" || update.ID != "foo" || update.Code != http.StatusOK || update.Body != `{"Name": "bar"}` {
+		t.Errorf("Unexpected event: %#v", update)
+	}
+	if remove.Verb != "delete" || remove.Code != http.StatusForbidden || len(remove.Timestamp) == 0 {
+		t.Errorf("Unexpected event: %#v", remove)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var buffer bytes.Buffer
+	event := AuditEvent{Timestamp: "2014-06-06T00:00:00Z", User: "bob", Verb: "create", Resource: "tasks", ID: "foo", Code: 200, Body: "{}"}
+	NewAuditLog(&buffer, false).Audit(event)
+	NewAuditLog(&buffer, true).Audit(event)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per event, got %q", buffer.String())
+	}
+	for i, line := range lines {
+		var logged AuditEvent
+		expectNoError(t, json.Unmarshal([]byte(line), &logged))
+		expected := event
+		if i == 0 {
+			expected.Body = ""
+		}
+		if logged.User != expected.User || logged.ID != expected.ID || logged.Body != expected.Body {
+			t.Errorf("Unexpected event logged: %#v", logged)
+		}
+	}
+}
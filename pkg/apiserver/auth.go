@@ -0,0 +1,99 @@
+package apiserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// UserInfo describes the user a request is made on behalf of.
+type UserInfo struct {
+	Name string
+	// Groups the user belongs to, for authorizers which grant access to whole teams.
+	Groups []string
+}
+
+// Authenticator works out who sent a request. It returns false, with a nil error, if
+// the request doesn't carry credentials it understands or they don't check out; errors
+// are reserved for failures of the authenticator itself.
+type Authenticator interface {
+	AuthenticateRequest(req *http.Request) (*UserInfo, bool, error)
+}
+
+// AuthenticatorFunc lets an ordinary function be used as an Authenticator.
+type AuthenticatorFunc func(req *http.Request) (*UserInfo, bool, error)
+
+func (f AuthenticatorFunc) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	return f(req)
+}
+
+type unionAuthenticator []Authenticator
+
+// NewUnionAuthenticator returns an Authenticator which tries each of authenticators in
+// turn and accepts the first user any of them recognizes.
+func NewUnionAuthenticator(authenticators ...Authenticator) Authenticator {
+	return unionAuthenticator(authenticators)
+}
+
+func (union unionAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	var firstErr error
+	for _, authenticator := range union {
+		user, ok, err := authenticator.AuthenticateRequest(req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if ok {
+			return user, true, nil
+		}
+	}
+	return nil, false, firstErr
+}
+
+// NewClientCertAuthenticator returns an Authenticator which accepts requests made with a
+// TLS client certificate. The user is named by the certificate's common name, and its
+// organizations are taken as groups. Only certificates the server verified count, so
+// the server's tls.Config must set ClientCAs.
+func NewClientCertAuthenticator() Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) (*UserInfo, bool, error) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			return nil, false, nil
+		}
+		subject := req.TLS.VerifiedChains[0][0].Subject
+		if len(subject.CommonName) == 0 {
+			return nil, false, nil
+		}
+		return &UserInfo{Name: subject.CommonName, Groups: subject.Organization}, true, nil
+	})
+}
+
+type userKey struct{}
+
+// UserFrom returns the user a request was authenticated as by WithAuthentication.
+func UserFrom(req *http.Request) (*UserInfo, bool) {
+	user, ok := req.Context().Value(userKey{}).(*UserInfo)
+	return user, ok
+}
+
+// WithAuthentication returns a handler which only passes requests on to handler if
+// authenticator recognizes their sender; see UserFrom. Every other request is answered
+// with a 401 and a Status object.
+func WithAuthentication(handler http.Handler, authenticator Authenticator) http.Handler {
+	codec := api.CodecForVersion(api.LatestVersion)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, ok, err := authenticator.AuthenticateRequest(req)
+		if err != nil {
+			log.Printf("Unable to authenticate %s %s: %v", req.Method, req.RequestURI, err)
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kubernetes"`)
+			writeStatus(codec, api.NewUnauthorizedErr("Unauthorized").(*api.StatusError).Status(), req, w)
+			return
+		}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), userKey{}, user)))
+	})
+}
@@ -0,0 +1,188 @@
+package apiserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func writeTempFile(t *testing.T, contents string) string {
+	file, err := ioutil.TempFile("", "auth")
+	expectNoError(t, err)
+	_, err = file.WriteString(contents)
+	expectNoError(t, err)
+	expectNoError(t, file.Close())
+	return file.Name()
+}
+
+func staticAuthenticator(user *UserInfo, ok bool, err error) Authenticator {
+	return AuthenticatorFunc(func(*http.Request) (*UserInfo, bool, error) {
+		return user, ok, err
+	})
+}
+
+func TestUnionAuthenticator(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	failure := errors.New("broken")
+	bob := &UserInfo{Name: "bob"}
+
+	user, ok, err := NewUnionAuthenticator(
+		staticAuthenticator(nil, false, failure),
+		staticAuthenticator(nil, false, nil),
+		staticAuthenticator(bob, true, nil),
+	).AuthenticateRequest(req)
+	if !ok || err != nil || user != bob {
+		t.Errorf("Unexpected result: %#v %v %v", user, ok, err)
+	}
+
+	user, ok, err = NewUnionAuthenticator(
+		staticAuthenticator(nil, false, nil),
+		staticAuthenticator(nil, false, failure),
+	).AuthenticateRequest(req)
+	if ok || err != failure || user != nil {
+		t.Errorf("Unexpected result: %#v %v %v", user, ok, err)
+	}
+}
+
+func TestWithAuthentication(t *testing.T) {
+	var seen *UserInfo
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen, _ = UserFrom(req)
+	})
+	bob := &UserInfo{Name: "bob"}
+	server := httptest.NewServer(WithAuthentication(handler, staticAuthenticator(bob, true, nil)))
+	resp, err := http.Get(server.URL + "/api/v1beta1/tasks")
+	expectNoError(t, err)
+	if resp.StatusCode != http.StatusOK || seen != bob {
+		t.Errorf("Unexpected response: %d, user %#v", resp.StatusCode, seen)
+	}
+}
+
+func TestWithAuthenticationUnauthorized(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	})
+	server := httptest.NewServer(WithAuthentication(handler, staticAuthenticator(nil, false, errors.New("broken"))))
+	resp, err := http.Get(server.URL + "/api/v1beta1/tasks")
+	expectNoError(t, err)
+	if called {
+		t.Errorf("Unexpected call to the wrapped handler")
+	}
+	if len(resp.Header.Get("WWW-Authenticate")) == 0 {
+		t.Errorf("Expected a WWW-Authenticate header")
+	}
+	expectStatus(t, resp, http.StatusUnauthorized, api.StatusReasonUnauthorized)
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	authenticator := NewClientCertAuthenticator()
+	req, _ := http.NewRequest("GET", "/", nil)
+	if _, ok, _ := authenticator.AuthenticateRequest(req); ok {
+		t.Errorf("Unexpected success without TLS")
+	}
+
+	// Certificates which weren't verified against the client CAs don't count.
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops", Organization: []string{"sre"}}}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, ok, _ := authenticator.AuthenticateRequest(req); ok {
+		t.Errorf("Unexpected success with an unverified certificate")
+	}
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	user, ok, err := authenticator.AuthenticateRequest(req)
+	expectNoError(t, err)
+	if !ok || !reflect.DeepEqual(*user, UserInfo{Name: "ops", Groups: []string{"sre"}}) {
+		t.Errorf("Unexpected user: %#v", user)
+	}
+}
+
+func TestPasswordFileAuthenticator(t *testing.T) {
+	path := writeTempFile(t, `# users
+alice:$apr1$rqXexS6Z$aHkKxtrJ39SjHzMujenay1
+bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=
+`)
+	defer os.Remove(path)
+	authenticator, err := NewPasswordFileAuthenticator(path)
+	expectNoError(t, err)
+
+	table := []struct {
+		user, password string
+		ok             bool
+	}{
+		{"alice", "secret", true},
+		{"bob", "secret", true},
+		{"alice", "wrong", false},
+		{"carol", "secret", false},
+	}
+	for _, item := range table {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(item.user, item.password)
+		user, ok, err := authenticator.AuthenticateRequest(req)
+		expectNoError(t, err)
+		if ok != item.ok || (ok && user.Name != item.user) {
+			t.Errorf("Unexpected result for %s/%s: %#v %v", item.user, item.password, user, ok)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	if _, ok, _ := authenticator.AuthenticateRequest(req); ok {
+		t.Errorf("Unexpected success without credentials")
+	}
+}
+
+func TestPasswordFileUnsupportedHash(t *testing.T) {
+	for _, contents := range []string{"alice:secret\n", "alice:$2y$05$abcdefghijklmnopqrstuv\n", "alice\n"} {
+		path := writeTempFile(t, contents)
+		if _, err := NewPasswordFileAuthenticator(path); err == nil {
+			t.Errorf("Expected an error for %q", contents)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestTokenFileAuthenticator(t *testing.T) {
+	path := writeTempFile(t, "token1,alice\ntoken2, bob, ops, dev\n")
+	defer os.Remove(path)
+	authenticator, err := NewTokenFileAuthenticator(path)
+	expectNoError(t, err)
+
+	table := []struct {
+		header string
+		user   *UserInfo
+	}{
+		{"Bearer token1", &UserInfo{Name: "alice", Groups: []string{}}},
+		{"bearer token2", &UserInfo{Name: "bob", Groups: []string{"ops", "dev"}}},
+		{"Bearer token3", nil},
+		{"Bearer token", nil},
+		{"Bearer token10", nil},
+		{"Basic token1", nil},
+		{"", nil},
+	}
+	for _, item := range table {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", item.header)
+		user, ok, err := authenticator.AuthenticateRequest(req)
+		expectNoError(t, err)
+		if ok != (item.user != nil) || (ok && !reflect.DeepEqual(user, item.user)) {
+			t.Errorf("Unexpected result for %q: %#v %v", item.header, user, ok)
+		}
+	}
+}
+
+func TestTokenFileDuplicate(t *testing.T) {
+	path := writeTempFile(t, "token1,alice\ntoken1,bob\n")
+	defer os.Remove(path)
+	if _, err := NewTokenFileAuthenticator(path); err == nil {
+		t.Errorf("Expected an error for a duplicate token")
+	}
+}
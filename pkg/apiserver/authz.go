@@ -0,0 +1,166 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+// Attributes describe a request for an Authorizer.
+type Attributes struct {
+	// User is who made the request, or nil if the server doesn't authenticate requests.
+	User *UserInfo
+	// Verb is one of "get", "list", "watch", "log", "create", "update", "delete",
+	// "exec" or "portforward".
+	Verb string
+	// Namespace is the namespace of the objects the request is for.
+	Namespace string
+	// Resource is the collection the request is for, e.g. "tasks".
+	Resource string
+	// ID names the object the request is for; it is empty for lists and for objects
+	// whose ID the server will generate.
+	ID string
+	// Labels are the labels of the object the request touches. For lists and watches of
+	// a whole collection they are the labels the request's label selector pins to a
+	// single value (see labels.Selector.RequiredValues), which only restricts what is
+	// returned if the storage filters lists by label.
+	Labels map[string]string
+}
+
+// Authorizer decides whether a request is allowed. It returns nil if it is, and an error
+// explaining why not otherwise.
+type Authorizer interface {
+	Authorize(a Attributes) error
+}
+
+// AuthorizerFunc lets an ordinary function be used as an Authorizer.
+type AuthorizerFunc func(a Attributes) error
+
+func (f AuthorizerFunc) Authorize(a Attributes) error {
+	return f(a)
+}
+
+// PolicyRule allows the requests it matches. Empty fields match anything; a rule with
+// several fields set only matches requests which match all of them.
+type PolicyRule struct {
+	// User and Group match the requesting user's name, or one of their groups.
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Verbs lists the verbs allowed (see Attributes).
+	Verbs     []string `json:"verbs,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	Resource  string   `json:"resource,omitempty"`
+	ID        string   `json:"id,omitempty"`
+	// Labels must all be present, with the same values, on the object.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (rule *PolicyRule) matches(a Attributes) bool {
+	if len(rule.User) > 0 && (a.User == nil || a.User.Name != rule.User) {
+		return false
+	}
+	if len(rule.Group) > 0 && (a.User == nil || !contains(a.User.Groups, rule.Group)) {
+		return false
+	}
+	if len(rule.Verbs) > 0 && !contains(rule.Verbs, a.Verb) {
+		return false
+	}
+	if len(rule.Namespace) > 0 && rule.Namespace != a.Namespace {
+		return false
+	}
+	if len(rule.Resource) > 0 && rule.Resource != a.Resource {
+		return false
+	}
+	if len(rule.ID) > 0 && rule.ID != a.ID {
+		return false
+	}
+	for key, value := range rule.Labels {
+		if actual, ok := a.Labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type policyAuthorizer []PolicyRule
+
+// NewPolicyAuthorizer returns an Authorizer which allows a request if any of rules
+// matches it.
+func NewPolicyAuthorizer(rules []PolicyRule) Authorizer {
+	return policyAuthorizer(rules)
+}
+
+// NewPolicyFileAuthorizer reads a policy from a file of PolicyRules, one JSON object per
+// line, for example:
+// {"group": "ops", "resource": "replicationControllers"}
+// {"group": "frontend", "resource": "tasks", "labels": {"team": "frontend"}}
+// {"group": "payments", "namespace": "payments"}
+func NewPolicyFileAuthorizer(path string) (Authorizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	rules := []PolicyRule{}
+	for {
+		var rule PolicyRule
+		if err := decoder.Decode(&rule); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", path, len(rules)+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return NewPolicyAuthorizer(rules), nil
+}
+
+func (policy policyAuthorizer) Authorize(a Attributes) error {
+	for i := range policy {
+		if policy[i].matches(a) {
+			return nil
+		}
+	}
+	name := "anonymous user"
+	if a.User != nil {
+		name = fmt.Sprintf("user %q", a.User.Name)
+	}
+	if len(a.ID) > 0 {
+		return fmt.Errorf("%s cannot %s %s %q in namespace %q", name, a.Verb, a.Resource, a.ID, a.Namespace)
+	}
+	return fmt.Errorf("%s cannot %s %s in namespace %q", name, a.Verb, a.Resource, a.Namespace)
+}
+
+// objectAttributes returns the ID and labels of obj, a struct or pointer to one which
+// embeds api.JSONBase and may have a Labels field.
+func objectAttributes(obj interface{}) (id string, labels map[string]string) {
+	value := reflect.ValueOf(obj)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "", nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return "", nil
+	}
+	if field := value.FieldByName("ID"); field.IsValid() && field.Kind() == reflect.String {
+		id = field.String()
+	}
+	if field := value.FieldByName("Labels"); field.IsValid() {
+		labels, _ = field.Interface().(map[string]string)
+	}
+	return id, labels
+}
@@ -0,0 +1,214 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+type Labeled struct {
+	ID     string
+	Labels map[string]string
+}
+
+// LabeledRESTStorage holds Labeled objects by ID.
+type LabeledRESTStorage struct {
+	items   map[string]Labeled
+	deleted string
+}
+
+func (storage *LabeledRESTStorage) List(namespace string, url *url.URL) (interface{}, error) {
+	return []Labeled{}, nil
+}
+
+func (storage *LabeledRESTStorage) Get(namespace, id string) (interface{}, error) {
+	item, ok := storage.items[id]
+	if !ok {
+		return nil, api.NewNotFoundErr("labeled", id)
+	}
+	return item, nil
+}
+
+func (storage *LabeledRESTStorage) Delete(namespace, id string) error {
+	storage.deleted = id
+	return nil
+}
+
+func (storage *LabeledRESTStorage) Extract(body string) (interface{}, error) {
+	var item Labeled
+	err := json.Unmarshal([]byte(body), &item)
+	return item, err
+}
+
+func (storage *LabeledRESTStorage) Create(object interface{}) (interface{}, error) {
+	return object, nil
+}
+
+func (storage *LabeledRESTStorage) Update(object interface{}) (interface{}, error) {
+	return object, nil
+}
+
+// RecordedRESTStorage is a LabeledRESTStorage whose records are always available, but
+// whose Get fails, like that of tasks on a machine which can't be reached.
+type RecordedRESTStorage struct {
+	LabeledRESTStorage
+	gets int
+}
+
+func (storage *RecordedRESTStorage) Get(namespace, id string) (interface{}, error) {
+	storage.gets++
+	return nil, fmt.Errorf("machine unreachable")
+}
+
+func (storage *RecordedRESTStorage) GetRecord(namespace, id string) (interface{}, error) {
+	return storage.LabeledRESTStorage.Get(namespace, id)
+}
+
+var testPolicy = `{"group": "ops", "resource": "replicationControllers", "verbs": ["get", "update"]}
+{"group": "frontend", "resource": "tasks", "labels": {"team": "frontend"}}
+{"group": "payments", "namespace": "payments"}
+`
+
+func TestPolicyRules(t *testing.T) {
+	path := writeTempFile(t, testPolicy)
+	defer os.Remove(path)
+	authorizer, err := NewPolicyFileAuthorizer(path)
+	expectNoError(t, err)
+
+	ops := &UserInfo{Name: "olivia", Groups: []string{"ops"}}
+	frontend := &UserInfo{Name: "fred", Groups: []string{"frontend"}}
+	payments := &UserInfo{Name: "pat", Groups: []string{"payments"}}
+	table := []struct {
+		attributes Attributes
+		allowed    bool
+	}{
+		{Attributes{User: ops, Verb: "get", Resource: "replicationControllers", ID: "foo"}, true},
+		{Attributes{User: ops, Verb: "update", Resource: "replicationControllers", ID: "foo"}, true},
+		{Attributes{User: ops, Verb: "delete", Resource: "replicationControllers", ID: "foo"}, false},
+		{Attributes{User: ops, Verb: "get", Resource: "tasks", ID: "foo"}, false},
+		{Attributes{User: frontend, Verb: "delete", Resource: "tasks", ID: "foo", Labels: map[string]string{"team": "frontend", "name": "foo"}}, true},
+		{Attributes{User: frontend, Verb: "delete", Resource: "tasks", ID: "foo", Labels: map[string]string{"team": "backend"}}, false},
+		{Attributes{User: frontend, Verb: "list", Resource: "tasks"}, false},
+		{Attributes{User: frontend, Verb: "update", Resource: "replicationControllers", ID: "foo"}, false},
+		{Attributes{Verb: "get", Resource: "replicationControllers", ID: "foo"}, false},
+		{Attributes{User: payments, Verb: "delete", Namespace: "payments", Resource: "services", ID: "foo"}, true},
+		{Attributes{User: payments, Verb: "list", Namespace: "payments", Resource: "tasks"}, true},
+		{Attributes{User: payments, Verb: "get", Namespace: "default", Resource: "services", ID: "foo"}, false},
+	}
+	for _, item := range table {
+		err := authorizer.Authorize(item.attributes)
+		if (err == nil) != item.allowed {
+			t.Errorf("Unexpected result for %#v: %v", item.attributes, err)
+		}
+	}
+}
+
+func TestPolicyFileInvalid(t *testing.T) {
+	for _, contents := range []string{`{"users": "bob"}`, `{"user": "bob"`, `["bob"]`} {
+		path := writeTempFile(t, contents)
+		if _, err := NewPolicyFileAuthorizer(path); err == nil {
+			t.Errorf("Expected an error for %q", contents)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestAuthorizeRequests(t *testing.T) {
+	storage := &LabeledRESTStorage{
+		items: map[string]Labeled{
+			"mine":   {ID: "mine", Labels: map[string]string{"team": "frontend"}},
+			"theirs": {ID: "theirs", Labels: map[string]string{"team": "backend"}},
+		},
+	}
+	server := New(map[string]RESTStorage{"tasks": storage}, codec, "/prefix/version")
+	server.authorizer = NewPolicyAuthorizer([]PolicyRule{
+		{Group: "frontend", Resource: "tasks", Labels: map[string]string{"team": "frontend"}},
+	})
+	user := &UserInfo{Name: "fred", Groups: []string{"frontend"}}
+	handler := httptest.NewServer(WithAuthentication(server, staticAuthenticator(user, true, nil)))
+	defer handler.Close()
+
+	table := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/tasks/mine", "", http.StatusOK},
+		{"GET", "/tasks/theirs", "", http.StatusForbidden},
+		// Whether an object exists is only told to those who may get it.
+		{"GET", "/tasks/missing", "", http.StatusForbidden},
+		{"GET", "/tasks?labels=team%3Dfrontend", "", http.StatusOK},
+		{"GET", "/tasks", "", http.StatusForbidden},
+		{"POST", "/tasks", `{"ID": "new", "Labels": {"team": "frontend"}}`, http.StatusOK},
+		{"POST", "/tasks", `{"ID": "new", "Labels": {"team": "backend"}}`, http.StatusForbidden},
+		{"PUT", "/tasks/mine", `{"ID": "mine", "Labels": {"team": "frontend", "version": "2"}}`, http.StatusOK},
+		// Neither taking over another team's task, nor giving one away, is allowed.
+		{"PUT", "/tasks/theirs", `{"ID": "theirs", "Labels": {"team": "frontend"}}`, http.StatusForbidden},
+		{"PUT", "/tasks/mine", `{"ID": "mine", "Labels": {"team": "backend"}}`, http.StatusForbidden},
+		{"PUT", "/tasks/mine", `{"ID": "theirs", "Labels": {"team": "frontend"}}`, http.StatusForbidden},
+		{"DELETE", "/tasks/theirs", "", http.StatusForbidden},
+		{"DELETE", "/tasks/mine", "", http.StatusOK},
+	}
+	for _, item := range table {
+		req, err := http.NewRequest(item.method, handler.URL+"/prefix/version"+item.path, bytes.NewBufferString(item.body))
+		expectNoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		expectNoError(t, err)
+		if item.code == http.StatusForbidden {
+			expectStatus(t, resp, http.StatusForbidden, api.StatusReasonForbidden)
+		} else if resp.StatusCode != item.code {
+			t.Errorf("%s %s: expected %d, got %d", item.method, item.path, item.code, resp.StatusCode)
+		}
+	}
+	if storage.deleted != "mine" {
+		t.Errorf("Unexpected delete of %q", storage.deleted)
+	}
+}
+
+func TestAuthorizeRequestsByRecord(t *testing.T) {
+	storage := &RecordedRESTStorage{
+		LabeledRESTStorage: LabeledRESTStorage{
+			items: map[string]Labeled{
+				"mine":   {ID: "mine", Labels: map[string]string{"team": "frontend"}},
+				"theirs": {ID: "theirs", Labels: map[string]string{"team": "backend"}},
+			},
+		},
+	}
+	server := New(map[string]RESTStorage{"tasks": storage}, codec, "/prefix/version")
+	server.authorizer = NewPolicyAuthorizer([]PolicyRule{
+		{Group: "frontend", Resource: "tasks", Labels: map[string]string{"team": "frontend"}},
+	})
+	user := &UserInfo{Name: "fred", Groups: []string{"frontend"}}
+	handler := httptest.NewServer(WithAuthentication(server, staticAuthenticator(user, true, nil)))
+	defer handler.Close()
+
+	table := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/tasks/theirs", "", http.StatusForbidden},
+		{"PUT", "/tasks/mine", `{"ID": "mine", "Labels": {"team": "frontend"}}`, http.StatusOK},
+		{"DELETE", "/tasks/mine", "", http.StatusOK},
+	}
+	for _, item := range table {
+		req, err := http.NewRequest(item.method, handler.URL+"/prefix/version"+item.path, bytes.NewBufferString(item.body))
+		expectNoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		expectNoError(t, err)
+		if resp.StatusCode != item.code {
+			t.Errorf("%s %s: expected %d, got %d", item.method, item.path, item.code, resp.StatusCode)
+		}
+	}
+	if storage.gets != 0 {
+		t.Errorf("Expected no gets, got %d", storage.gets)
+	}
+	if storage.deleted != "mine" {
+		t.Errorf("Unexpected delete of %q", storage.deleted)
+	}
+}
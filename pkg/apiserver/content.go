@@ -0,0 +1,94 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s-firstcommit/pkg/util"
+)
+
+const (
+	jsonContentType = "application/json"
+	yamlContentType = "application/yaml"
+)
+
+// yamlMediaTypes are the names YAML goes by in Content-Type and Accept headers.
+var yamlMediaTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// isYAML returns true if contentType names YAML. Bodies of any other type, or without a
+// type at all, are read as JSON.
+func isYAML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && yamlMediaTypes[mediaType]
+}
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+// responseContentType picks the content type of the response from the request's Accept
+// header: YAML if the client prefers it, JSON otherwise.
+func responseContentType(req *http.Request) string {
+	accepted := []acceptedType{}
+	for _, header := range req.Header["Accept"] {
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				if quality, err = strconv.ParseFloat(q, 64); err != nil {
+					continue
+				}
+			}
+			if quality > 0 {
+				accepted = append(accepted, acceptedType{mediaType, quality})
+			}
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+	for _, t := range accepted {
+		switch {
+		case yamlMediaTypes[t.mediaType]:
+			return yamlContentType
+		case t.mediaType == jsonContentType || t.mediaType == "application/*" || t.mediaType == "*/*":
+			return jsonContentType
+		}
+	}
+	return jsonContentType
+}
+
+// writeWatchEvent writes a single event of a watch stream. JSON streams have one event
+// per line; YAML streams have one document per event.
+func writeWatchEvent(w io.Writer, contentType string, event WatchEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if contentType == yamlContentType {
+		if data, err = util.JSONToYAML(data); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "---\n"); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
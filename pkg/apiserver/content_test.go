@@ -0,0 +1,46 @@
+package apiserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseContentType(t *testing.T) {
+	table := map[string]string{
+		"":                                       jsonContentType,
+		"application/json":                       jsonContentType,
+		"application/yaml":                       yamlContentType,
+		"text/x-yaml; charset=utf-8":             yamlContentType,
+		"text/html, application/x-yaml":          yamlContentType,
+		"application/json, application/yaml":     jsonContentType,
+		"application/json;q=0.5, text/yaml":      yamlContentType,
+		"application/yaml;q=0, application/json": jsonContentType,
+		"*/*":                                    jsonContentType,
+		"text/html":                              jsonContentType,
+		"garbage;;":                              jsonContentType,
+	}
+	for accept, expected := range table {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", accept)
+		}
+		if actual := responseContentType(req); actual != expected {
+			t.Errorf("Accept %q: expected %s, got %s", accept, expected, actual)
+		}
+	}
+}
+
+func TestIsYAML(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"":                                  false,
+		"application/json":                  false,
+		"application/x-www-form-urlencoded": false,
+		"application/yaml":                  true,
+		"application/x-yaml; charset=utf-8": true,
+		"text/yaml":                         true,
+	} {
+		if isYAML(contentType) != expected {
+			t.Errorf("Content-Type %q: expected %v", contentType, expected)
+		}
+	}
+}
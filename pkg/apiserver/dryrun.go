@@ -0,0 +1,43 @@
+package apiserver
+
+import (
+	"net/url"
+)
+
+// DryRunner is an optional interface for RESTStorage objects which can check a change
+// without making it. Storage which implements it accepts ?dryRun=true on creates,
+// updates, patches and deletes: the change goes through the same extraction, defaulting,
+// validation, admission and scheduling as a real one, and the response carries the
+// object which would have been stored, but nothing is written.
+type DryRunner interface {
+	DryRunCreate(interface{}) (interface{}, error)
+	DryRunUpdate(interface{}) (interface{}, error)
+	DryRunDelete(namespace, id string) error
+}
+
+// isDryRun returns true if the request asks for a dry run.
+func isDryRun(url *url.URL) bool {
+	return url.Query().Get("dryRun") == "true"
+}
+
+// dryRunStorage turns the writes of a RESTStorage into dry runs.
+type dryRunStorage struct {
+	RESTStorage
+	dryRunner DryRunner
+}
+
+func (storage dryRunStorage) GetRecord(namespace, id string) (interface{}, error) {
+	return getRecord(storage.RESTStorage, namespace, id)
+}
+
+func (storage dryRunStorage) Create(obj interface{}) (interface{}, error) {
+	return storage.dryRunner.DryRunCreate(obj)
+}
+
+func (storage dryRunStorage) Update(obj interface{}) (interface{}, error) {
+	return storage.dryRunner.DryRunUpdate(obj)
+}
+
+func (storage dryRunStorage) Delete(namespace, id string) error {
+	return storage.dryRunner.DryRunDelete(namespace, id)
+}
@@ -0,0 +1,86 @@
+package apiserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// DryRunRESTStorage is a SimpleRESTStorage which records its dry runs.
+type DryRunRESTStorage struct {
+	SimpleRESTStorage
+	dryRuns []string
+}
+
+func (storage *DryRunRESTStorage) DryRunCreate(obj interface{}) (interface{}, error) {
+	storage.dryRuns = append(storage.dryRuns, "create")
+	return obj, storage.err
+}
+
+func (storage *DryRunRESTStorage) DryRunUpdate(obj interface{}) (interface{}, error) {
+	storage.dryRuns = append(storage.dryRuns, "update")
+	return obj, storage.err
+}
+
+func (storage *DryRunRESTStorage) DryRunDelete(namespace, id string) error {
+	storage.dryRuns = append(storage.dryRuns, "delete")
+	return storage.err
+}
+
+func TestDryRun(t *testing.T) {
+	storage := &DryRunRESTStorage{}
+	server := New(map[string]RESTStorage{"simple": storage}, codec, "/prefix/version")
+	auditor := &recordingAuditor{}
+	server.auditor = auditor
+	admitted := 0
+	server.admission = AdmissionFunc(func(a *AdmissionAttributes) error {
+		admitted++
+		return nil
+	})
+	handler := httptest.NewServer(server)
+	defer handler.Close()
+
+	for _, item := range []struct{ method, path, body string }{
+		{"POST", "/simple?dryRun=true", `{"Name": "foo"}`},
+		{"PUT", "/simple/foo?dryRun=true", `{"Name": "bar"}`},
+		{"DELETE", "/simple/foo?dryRun=true", ""},
+	} {
+		req, _ := http.NewRequest(item.method, handler.URL+"/prefix/version"+item.path, bytes.NewBufferString(item.body))
+		resp, err := http.DefaultClient.Do(req)
+		expectNoError(t, err)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected response to %s %s: %#v", item.method, item.path, resp)
+		}
+	}
+	if len(storage.dryRuns) != 3 || storage.dryRuns[0] != "create" || storage.dryRuns[1] != "update" || storage.dryRuns[2] != "delete" {
+		t.Errorf("Unexpected dry runs: %v", storage.dryRuns)
+	}
+	if storage.updated.Name != "" || storage.deleted != "" {
+		t.Errorf("Expected nothing to be stored, got %#v", storage.SimpleRESTStorage)
+	}
+	if admitted != 3 {
+		t.Errorf("Expected every dry run to go through admission, got %d", admitted)
+	}
+	if len(*auditor) != 3 {
+		t.Errorf("Expected every dry run to be audited, got %#v", *auditor)
+	}
+	for _, event := range *auditor {
+		if !event.DryRun {
+			t.Errorf("Expected a dry run to be audited as one: %#v", event)
+		}
+	}
+}
+
+func TestDryRunNotSupported(t *testing.T) {
+	storage := &SimpleRESTStorage{}
+	handler := httptest.NewServer(New(map[string]RESTStorage{"simple": storage}, codec, "/prefix/version"))
+	defer handler.Close()
+
+	req, _ := http.NewRequest("POST", handler.URL+"/prefix/version/simple?dryRun=true", bytes.NewBufferString(`{"Name": "foo"}`))
+	resp, err := http.DefaultClient.Do(req)
+	expectNoError(t, err)
+	expectStatus(t, resp, http.StatusBadRequest, api.StatusReasonBadRequest)
+}
@@ -0,0 +1,140 @@
+package apiserver
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const apr1Magic = "$apr1$"
+
+type passwordFileAuthenticator struct {
+	// hashes maps user names to password hashes, in htpasswd format.
+	hashes map[string]string
+}
+
+// NewPasswordFileAuthenticator returns an Authenticator which checks basic auth
+// credentials against an htpasswd file: one "user:hash" pair per line. Hashes must be
+// either {SHA} (htpasswd -s) or $apr1$ (htpasswd -m, the default); plain text and
+// other schemes are refused when the file is loaded.
+func NewPasswordFileAuthenticator(path string) (Authenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, lineNumber)
+		}
+		if !strings.HasPrefix(parts[1], "{SHA}") && !strings.HasPrefix(parts[1], apr1Magic) {
+			return nil, fmt.Errorf("%s:%d: unsupported password hash for %q, use {SHA} or $apr1$", path, lineNumber, parts[0])
+		}
+		hashes[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &passwordFileAuthenticator{hashes}, nil
+}
+
+func (a *passwordFileAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, false, nil
+	}
+	hash, ok := a.hashes[user]
+	if !ok || !checkPassword(password, hash) {
+		return nil, false, nil
+	}
+	return &UserInfo{Name: user}, true, nil
+}
+
+func checkPassword(password, hash string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, apr1Magic):
+		salt := strings.SplitN(hash[len(apr1Magic):], "$", 2)[0]
+		computed = apr1(password, salt)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1 computes Apache's variant of the MD5 crypt(3) hash of password.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	alternate := md5.Sum([]byte(password + salt + password))
+
+	ctx := []byte(password + apr1Magic + salt)
+	for i := len(password); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		ctx = append(ctx, alternate[:n]...)
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx = append(ctx, 0)
+		} else {
+			ctx = append(ctx, password[0])
+		}
+	}
+	final := md5.Sum(ctx)
+
+	// Deliberately slow things down.
+	for i := 0; i < 1000; i++ {
+		ctx = ctx[:0]
+		if i&1 != 0 {
+			ctx = append(ctx, password...)
+		} else {
+			ctx = append(ctx, final[:]...)
+		}
+		if i%3 != 0 {
+			ctx = append(ctx, salt...)
+		}
+		if i%7 != 0 {
+			ctx = append(ctx, password...)
+		}
+		if i&1 != 0 {
+			ctx = append(ctx, final[:]...)
+		} else {
+			ctx = append(ctx, password...)
+		}
+		final = md5.Sum(ctx)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	encoded := make([]byte, 0, 22)
+	to64 := func(v uint, n int) {
+		for ; n > 0; n-- {
+			encoded = append(encoded, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint(final[group[0]])<<16|uint(final[group[1]])<<8|uint(final[group[2]]), 4)
+	}
+	to64(uint(final[11]), 2)
+	return apr1Magic + salt + "$" + string(encoded)
+}
@@ -0,0 +1,488 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// maxPatchAttempts is how many times a patch is applied to the latest version of an
+// object when it keeps losing races with other writers.
+const maxPatchAttempts = 5
+
+// patchTestError is returned when a "test" operation of a JSON patch doesn't hold.
+type patchTestError struct {
+	path string
+}
+
+func (e patchTestError) Error() string {
+	return fmt.Sprintf("the value at %q is not the one the patch tests for", e.path)
+}
+
+// handlePatch applies the patch in the body of req to the object named by parts, and
+// stores the result as an update. The user must be allowed to update both the object
+// and the result. Updates which lose a race with another writer are retried against the
+// object as it is then, so clients don't need to read an object to patch it. Patches
+// apply to the object as it is stored (see RecordGetter).
+func (server *ApiServer) handlePatch(target resourceRequest, parts []string, req *http.Request, w http.ResponseWriter, storage RESTStorage) {
+	namespace, resource, id := target.namespace, parts[0], parts[1]
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	patchType := api.PatchType(mediaType)
+	switch patchType {
+	case api.JSONPatchType, api.MergePatchType, api.StrategicMergePatchType:
+	default:
+		server.error(api.NewBadRequestErr(fmt.Sprintf("unsupported patch content type %q, expected %s, %s or %s", mediaType, api.JSONPatchType, api.MergePatchType, api.StrategicMergePatchType)), req, w)
+		return
+	}
+	defer req.Body.Close()
+	patch, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		server.error(err, req, w)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		existing, err := getRecord(storage, namespace, id)
+		if err != nil {
+			server.error(err, req, w)
+			return
+		}
+		if existing == nil {
+			server.notFound(req, w)
+			return
+		}
+		if !server.authorizeObject("update", namespace, resource, id, existing, req, w) {
+			return
+		}
+		original, err := server.codec.Encode(existing)
+		if err != nil {
+			server.error(err, req, w)
+			return
+		}
+		patched, err := applyPatch(patchType, original, patch)
+		if err != nil {
+			if _, ok := err.(patchTestError); ok {
+				err = api.NewConflictErr(resource, id, err)
+			} else {
+				err = api.NewBadRequestErr(fmt.Sprintf("unable to apply the patch to %s %q: %v", resource, id, err))
+			}
+			server.error(err, req, w)
+			return
+		}
+		obj, err := storage.Extract(string(patched))
+		if err == nil {
+			obj, err = setNamespace(obj, namespace)
+		}
+		if err != nil {
+			server.badRequest(err, req, w)
+			return
+		}
+		originalID, _ := objectAttributes(existing)
+		if patchedID, _ := objectAttributes(obj); patchedID != originalID {
+			server.error(api.NewBadRequestErr(fmt.Sprintf("a patch may not change the ID of %s %q", resource, id)), req, w)
+			return
+		}
+		if !server.authorizeObject("update", namespace, resource, id, obj, req, w) {
+			return
+		}
+		obj, ok := server.admit("update", namespace, resource, id, obj, req, w)
+		if !ok {
+			return
+		}
+		obj, err = storage.Update(obj)
+		if api.IsConflict(err) && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			server.error(err, req, w)
+			return
+		}
+		server.write(200, setSelfLink(obj, target.collection), req, w)
+		return
+	}
+}
+
+// applyPatch returns the JSON document original changed by patch.
+func applyPatch(patchType api.PatchType, original, patch []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return nil, err
+	}
+	var changes interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+	var err error
+	switch patchType {
+	case api.JSONPatchType:
+		doc, err = jsonPatch(doc, changes)
+	case api.MergePatchType:
+		doc = mergePatch(doc, changes)
+	case api.StrategicMergePatchType:
+		doc, err = strategicMergePatch(doc, changes)
+	default:
+		err = fmt.Errorf("unknown patch type %q", patchType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// mergePatch applies an RFC 7386 merge patch: the fields of a patch object are merged
+// into the document recursively, nulls remove fields, and anything else replaces the
+// value it is merged into.
+func mergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+		object[key] = mergePatch(object[key], value)
+	}
+	return object
+}
+
+// The "$patch" directive of a strategic merge patch. An element of a list of named
+// objects with {"$patch": "delete"} removes the element with its name, and a list holding
+// {"$patch": "replace"} replaces the list instead of being merged into it.
+const (
+	patchDirective = "$patch"
+	patchDelete    = "delete"
+	patchReplace   = "replace"
+)
+
+// strategicMergePatch is like mergePatch, but lists whose elements are all objects with a
+// "name", such as containers or environment variables, are merged by name: elements of
+// the patch are merged into the element of the document with the same name, or appended
+// if there isn't one.
+func strategicMergePatch(doc, patch interface{}) (interface{}, error) {
+	switch patch := patch.(type) {
+	case map[string]interface{}:
+		object, ok := doc.(map[string]interface{})
+		if !ok {
+			object = map[string]interface{}{}
+		}
+		for key, value := range patch {
+			if value == nil {
+				delete(object, key)
+				continue
+			}
+			merged, err := strategicMergePatch(object[key], value)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = merged
+		}
+		return object, nil
+	case []interface{}:
+		list, _ := doc.([]interface{})
+		return mergeNamedList(list, patch)
+	}
+	return patch, nil
+}
+
+// elementName returns the name of an element of a list of named objects, and its
+// $patch directive if it has one.
+func elementName(element interface{}) (name, directive string, ok bool) {
+	object, isObject := element.(map[string]interface{})
+	if !isObject {
+		return "", "", false
+	}
+	directive, _ = object[patchDirective].(string)
+	name, ok = object["name"].(string)
+	return name, directive, ok
+}
+
+// mergeNamedList merges patch into list by name. Lists which aren't both lists of named
+// objects are replaced by the patch.
+func mergeNamedList(list, patch []interface{}) (interface{}, error) {
+	replace := false
+	named := []interface{}{}
+	for _, element := range patch {
+		_, directive, ok := elementName(element)
+		switch {
+		case directive == patchReplace:
+			replace = true
+		case directive != "" && directive != patchDelete:
+			return nil, fmt.Errorf("unknown %s directive %q", patchDirective, directive)
+		case directive == patchDelete && !ok:
+			return nil, fmt.Errorf("a %s directive %q needs the name of the element to delete", patchDirective, directive)
+		case !ok:
+			return patch, nil
+		default:
+			named = append(named, element)
+		}
+	}
+	for _, element := range list {
+		if _, _, ok := elementName(element); !ok {
+			return patch, nil
+		}
+	}
+	if replace {
+		// The remaining elements are the new list, less any directives.
+		result := []interface{}{}
+		for _, element := range named {
+			if _, directive, _ := elementName(element); directive != patchDelete {
+				result = append(result, element)
+			}
+		}
+		return result, nil
+	}
+
+	result := append([]interface{}{}, list...)
+	for _, element := range named {
+		name, directive, _ := elementName(element)
+		index := -1
+		for i, existing := range result {
+			if existingName, _, _ := elementName(existing); existingName == name {
+				index = i
+				break
+			}
+		}
+		switch {
+		case directive == patchDelete && index >= 0:
+			result = append(result[:index], result[index+1:]...)
+		case directive == patchDelete:
+		case index >= 0:
+			merged, err := strategicMergePatch(result[index], element)
+			if err != nil {
+				return nil, err
+			}
+			result[index] = merged
+		default:
+			merged, err := strategicMergePatch(nil, element)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, merged)
+		}
+	}
+	return result, nil
+}
+
+// jsonPatchOperation is one operation of an RFC 6902 JSON patch.
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from"`
+	Value interface{} `json:"value"`
+}
+
+// jsonPatch applies an RFC 6902 JSON patch, a list of operations which are applied in
+// order. The patch fails as a whole if any of them does.
+func jsonPatch(doc, patch interface{}) (interface{}, error) {
+	// Round trip through JSON to read the operations into structs.
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, fmt.Errorf("a JSON patch must be a list of operations: %v", err)
+	}
+	for _, op := range operations {
+		if doc, err = applyOperation(doc, op); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc interface{}, op jsonPatchOperation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, op.Value)
+	case "remove":
+		doc, _, err := removeValue(doc, path)
+		return doc, err
+	case "replace":
+		if len(path) == 0 {
+			return op.Value, nil
+		}
+		if doc, _, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, op.Value)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if op.Op == "move" {
+			doc, value, err = removeValue(doc, from)
+		} else {
+			value, err = getValue(doc, from)
+			if err == nil {
+				value, err = deepCopy(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "test":
+		value, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, op.Value) {
+			return nil, patchTestError{op.Path}
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into the keys it is made of.
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	keys := strings.Split(pointer[1:], "/")
+	for i, key := range keys {
+		keys[i] = strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+	}
+	return keys, nil
+}
+
+// arrayIndex returns the index key names in an array of the given length. "-", the end
+// of the array, is only allowed if end is set.
+func arrayIndex(key string, length int, end bool) (int, error) {
+	if key == "-" && end {
+		return length, nil
+	}
+	index, err := strconv.Atoi(key)
+	if err != nil || index < 0 || index > length || (index == length && !end) {
+		return 0, fmt.Errorf("invalid array index %q", key)
+	}
+	return index, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, key := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[key]
+			if !ok {
+				return nil, fmt.Errorf("no value for key %q", key)
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(key, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("no value for key %q", key)
+		}
+	}
+	return doc, nil
+}
+
+// updateParent calls update with the container holding the value at path and the key of
+// the value in it, and returns doc with the container update returns in its place.
+func updateParent(doc interface{}, path []string, update func(container interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("the whole document can't be added or removed")
+	}
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	updated, err := update(parent, path[len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 1 {
+		return updated, nil
+	}
+	// Containers which are objects are changed in place, arrays may have to be replaced
+	// in their own parent.
+	return updateParent(doc, path[:len(path)-1], func(container interface{}, key string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[key] = updated
+		case []interface{}:
+			index, _ := arrayIndex(key, len(container), false)
+			container[index] = updated
+		}
+		return container, nil
+	})
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[key] = value
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(key, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			result := append([]interface{}{}, container[:index]...)
+			result = append(result, value)
+			return append(result, container[index:]...), nil
+		}
+		return nil, fmt.Errorf("can't add %q to a value which isn't an object or an array", key)
+	})
+}
+
+// removeValue returns doc without the value at path, and the value.
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	value, err := getValue(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err = updateParent(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			delete(container, key)
+			return container, nil
+		case []interface{}:
+			index, _ := arrayIndex(key, len(container), false)
+			return append(append([]interface{}{}, container[:index]...), container[index+1:]...), nil
+		}
+		return container, nil
+	})
+	return doc, value, err
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
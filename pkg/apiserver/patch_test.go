@@ -0,0 +1,237 @@
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func expectJSON(t *testing.T, name string, data []byte, expected string) {
+	var actual, wanted interface{}
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Errorf("%s: unexpected output %s: %v", name, data, err)
+		return
+	}
+	if err := json.Unmarshal([]byte(expected), &wanted); err != nil {
+		t.Fatalf("%s: bad expected value: %v", name, err)
+	}
+	if !reflect.DeepEqual(actual, wanted) {
+		t.Errorf("%s: expected %s, got %s", name, expected, data)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	original := `{
+		"id": "foo",
+		"labels": {"name": "foo", "tier": "web"},
+		"desiredState": {"replicas": 2, "containers": [
+			{"name": "web", "image": "nginx", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}]},
+			{"name": "log", "image": "fluentd"}
+		]}
+	}`
+	table := []struct {
+		name      string
+		patchType api.PatchType
+		patch     string
+		expected  string
+	}{
+		{
+			"merge patch",
+			api.MergePatchType,
+			`{"labels": {"tier": null, "env": "prod"}, "desiredState": {"replicas": 5}}`,
+			`{
+				"id": "foo",
+				"labels": {"name": "foo", "env": "prod"},
+				"desiredState": {"replicas": 5, "containers": [
+					{"name": "web", "image": "nginx", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}]},
+					{"name": "log", "image": "fluentd"}
+				]}
+			}`,
+		},
+		{
+			"merge patch replaces lists",
+			api.MergePatchType,
+			`{"desiredState": {"containers": [{"name": "web", "image": "apache"}]}}`,
+			`{
+				"id": "foo",
+				"labels": {"name": "foo", "tier": "web"},
+				"desiredState": {"replicas": 2, "containers": [{"name": "web", "image": "apache"}]}
+			}`,
+		},
+		{
+			"strategic merge patch merges named lists",
+			api.StrategicMergePatchType,
+			`{"desiredState": {"containers": [
+				{"name": "web", "image": "apache", "env": [{"name": "B", "value": "3"}, {"name": "C", "value": "4"}]},
+				{"name": "log", "$patch": "delete"},
+				{"name": "cache", "image": "redis"}
+			]}}`,
+			`{
+				"id": "foo",
+				"labels": {"name": "foo", "tier": "web"},
+				"desiredState": {"replicas": 2, "containers": [
+					{"name": "web", "image": "apache", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "3"}, {"name": "C", "value": "4"}]},
+					{"name": "cache", "image": "redis"}
+				]}
+			}`,
+		},
+		{
+			"strategic merge patch replace directive",
+			api.StrategicMergePatchType,
+			`{"desiredState": {"containers": [{"$patch": "replace"}, {"name": "db", "image": "mysql"}]}}`,
+			`{
+				"id": "foo",
+				"labels": {"name": "foo", "tier": "web"},
+				"desiredState": {"replicas": 2, "containers": [{"name": "db", "image": "mysql"}]}
+			}`,
+		},
+		{
+			"JSON patch",
+			api.JSONPatchType,
+			`[
+				{"op": "test", "path": "/desiredState/replicas", "value": 2},
+				{"op": "replace", "path": "/desiredState/replicas", "value": 3},
+				{"op": "remove", "path": "/labels/tier"},
+				{"op": "add", "path": "/labels/a~1b", "value": "c"},
+				{"op": "add", "path": "/desiredState/containers/0/env/-", "value": {"name": "C", "value": "4"}},
+				{"op": "move", "from": "/desiredState/containers/1", "path": "/desiredState/containers/0"},
+				{"op": "copy", "from": "/labels/name", "path": "/labels/copy"}
+			]`,
+			`{
+				"id": "foo",
+				"labels": {"name": "foo", "a/b": "c", "copy": "foo"},
+				"desiredState": {"replicas": 3, "containers": [
+					{"name": "log", "image": "fluentd"},
+					{"name": "web", "image": "nginx", "env": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}, {"name": "C", "value": "4"}]}
+				]}
+			}`,
+		},
+	}
+	for _, item := range table {
+		patched, err := applyPatch(item.patchType, []byte(original), []byte(item.patch))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", item.name, err)
+			continue
+		}
+		expectJSON(t, item.name, patched, item.expected)
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	original := []byte(`{"id": "foo", "items": [1, 2]}`)
+	for _, patch := range []string{
+		`{"op": "add"}`,
+		`[{"op": "frobnicate", "path": "/id"}]`,
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "add", "path": "/items/3", "value": 3}]`,
+		`[{"op": "replace", "path": "id", "value": "bar"}]`,
+		`not json`,
+	} {
+		if _, err := applyPatch(api.JSONPatchType, original, []byte(patch)); err == nil {
+			t.Errorf("Expected an error applying %s", patch)
+		}
+	}
+	for _, patch := range []string{
+		`{"items": [{"$patch": "delete"}]}`,
+		`{"items": [{"name": "a", "$patch": "frobnicate"}]}`,
+	} {
+		if _, err := applyPatch(api.StrategicMergePatchType, original, []byte(patch)); err == nil {
+			t.Errorf("Expected an error applying %s", patch)
+		}
+	}
+	_, err := applyPatch(api.JSONPatchType, original, []byte(`[{"op": "test", "path": "/id", "value": "bar"}]`))
+	if _, ok := err.(patchTestError); !ok {
+		t.Errorf("Expected a failed test, got %#v", err)
+	}
+}
+
+func patchRequest(t *testing.T, url string, patchType api.PatchType, patch string) *http.Response {
+	request, err := http.NewRequest("PATCH", url, bytes.NewBufferString(patch))
+	expectNoError(t, err)
+	request.Header.Set("Content-Type", string(patchType))
+	response, err := http.DefaultClient.Do(request)
+	expectNoError(t, err)
+	return response
+}
+
+func TestPatch(t *testing.T) {
+	simpleStorage := &SimpleRESTStorage{item: Simple{Name: "foo"}}
+	handler := New(map[string]RESTStorage{"simple": simpleStorage}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response := patchRequest(t, server.URL+"/prefix/version/simple/foo", api.MergePatchType, `{"Name": "bar"}`)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected response %#v", response)
+	}
+	if simpleStorage.updated.Name != "bar" {
+		t.Errorf("Unexpected update: %#v", simpleStorage.updated)
+	}
+
+	response = patchRequest(t, server.URL+"/prefix/version/simple/foo", "application/json", `{"Name": "bar"}`)
+	expectStatus(t, response, http.StatusBadRequest, api.StatusReasonBadRequest)
+	response = patchRequest(t, server.URL+"/prefix/version/simple/foo", api.StrategicMergePatchType, `{"Items": [{"$patch": "delete"}]}`)
+	expectStatus(t, response, http.StatusBadRequest, api.StatusReasonBadRequest)
+	response = patchRequest(t, server.URL+"/prefix/version/simple/foo", api.JSONPatchType, `[{"op": "test", "path": "/Name", "value": "baz"}]`)
+	expectStatus(t, response, http.StatusConflict, api.StatusReasonConflict)
+	response = patchRequest(t, server.URL+"/prefix/version/simple", api.MergePatchType, `{}`)
+	expectStatus(t, response, http.StatusNotFound, api.StatusReasonNotFound)
+}
+
+// racingStorage fails the first updates with a conflict, as if someone else had written
+// the object in the meantime.
+type racingStorage struct {
+	SimpleRESTStorage
+	conflicts int
+	gets      int
+}
+
+func (storage *racingStorage) Get(namespace, id string) (interface{}, error) {
+	storage.gets++
+	return storage.SimpleRESTStorage.Get(namespace, id)
+}
+
+func (storage *racingStorage) Update(object interface{}) (interface{}, error) {
+	if storage.conflicts > 0 {
+		storage.conflicts--
+		return nil, api.NewConflictErr("simple", "foo", nil)
+	}
+	return storage.SimpleRESTStorage.Update(object)
+}
+
+func TestPatchRetriesConflicts(t *testing.T) {
+	storage := &racingStorage{SimpleRESTStorage: SimpleRESTStorage{item: Simple{Name: "foo"}}, conflicts: 2}
+	handler := New(map[string]RESTStorage{"simple": storage}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response := patchRequest(t, server.URL+"/prefix/version/simple/foo", api.StrategicMergePatchType, `{"Name": "bar"}`)
+	if response.StatusCode != http.StatusOK || storage.updated.Name != "bar" || storage.gets != 3 {
+		t.Errorf("Unexpected response %#v after %d gets, updated %#v", response, storage.gets, storage.updated)
+	}
+
+	storage.conflicts = maxPatchAttempts
+	response = patchRequest(t, server.URL+"/prefix/version/simple/foo", api.StrategicMergePatchType, `{"Name": "bar"}`)
+	expectStatus(t, response, http.StatusConflict, api.StatusReasonConflict)
+}
+
+func TestPatchStoredRecord(t *testing.T) {
+	storage := &RecordedRESTStorage{
+		LabeledRESTStorage: LabeledRESTStorage{
+			items: map[string]Labeled{"foo": {ID: "foo", Labels: map[string]string{"team": "frontend"}}},
+		},
+	}
+	handler := New(map[string]RESTStorage{"tasks": storage}, codec, "/prefix/version")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response := patchRequest(t, server.URL+"/prefix/version/tasks/foo", api.MergePatchType, `{"Labels": {"version": "2"}}`)
+	if response.StatusCode != http.StatusOK || storage.gets != 0 {
+		t.Errorf("Unexpected response %#v after %d gets", response, storage.gets)
+	}
+}
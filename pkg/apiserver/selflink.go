@@ -0,0 +1,103 @@
+package apiserver
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+var jsonBaseType = reflect.TypeOf(api.JSONBase{})
+
+// setSelfLink returns a copy of obj whose JSONBase.SelfLink points at where the object
+// can be fetched from. collection is the path of the collection the object is in; lists
+// get the collection's link and each of their Items gets its own. Objects which don't
+// embed api.JSONBase are returned unchanged.
+func setSelfLink(obj interface{}, collection string) interface{} {
+	if obj == nil {
+		return obj
+	}
+	value := reflect.ValueOf(obj)
+	isPtr := value.Kind() == reflect.Ptr
+	if isPtr {
+		if value.IsNil() {
+			return obj
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return obj
+	}
+	// Work on a copy; obj may be shared with the storage.
+	out := reflect.New(value.Type())
+	out.Elem().Set(value)
+	if items := out.Elem().FieldByName("Items"); items.IsValid() && items.Kind() == reflect.Slice {
+		setJSONBaseSelfLink(out.Elem(), collection)
+		copied := reflect.MakeSlice(items.Type(), items.Len(), items.Len())
+		reflect.Copy(copied, items)
+		for i := 0; i < copied.Len(); i++ {
+			setItemSelfLink(copied.Index(i), collection)
+		}
+		items.Set(copied)
+	} else {
+		setItemSelfLink(out.Elem(), collection)
+	}
+	if isPtr {
+		return out.Interface()
+	}
+	return out.Elem().Interface()
+}
+
+// setNamespace returns a copy of obj, a struct or pointer to one embedding api.JSONBase,
+// placed in namespace. It is an error for obj to already be in a different namespace.
+func setNamespace(obj interface{}, namespace string) (interface{}, error) {
+	value := reflect.ValueOf(obj)
+	isPtr := value.Kind() == reflect.Ptr
+	if isPtr {
+		if value.IsNil() {
+			return obj, nil
+		}
+		value = value.Elem()
+	}
+	out := reflect.New(value.Type())
+	out.Elem().Set(value)
+	base := jsonBase(out.Elem())
+	if base == nil {
+		return obj, nil
+	}
+	if len(base.Namespace) > 0 && base.Namespace != namespace {
+		return nil, fmt.Errorf("the namespace of the object (%q) does not match the namespace of the request (%q)", base.Namespace, namespace)
+	}
+	base.Namespace = namespace
+	if isPtr {
+		return out.Interface(), nil
+	}
+	return out.Elem().Interface(), nil
+}
+
+func setItemSelfLink(item reflect.Value, collection string) {
+	base := jsonBase(item)
+	if base == nil || len(base.ID) == 0 {
+		return
+	}
+	base.SelfLink = path.Join(collection, base.ID)
+}
+
+func setJSONBaseSelfLink(obj reflect.Value, link string) {
+	if base := jsonBase(obj); base != nil {
+		base.SelfLink = link
+	}
+}
+
+// jsonBase returns the api.JSONBase embedded in the addressable struct obj, if there is one.
+func jsonBase(obj reflect.Value) *api.JSONBase {
+	if obj.Kind() != reflect.Struct {
+		return nil
+	}
+	field := obj.FieldByName("JSONBase")
+	if !field.IsValid() || field.Type() != jsonBaseType || !field.CanAddr() {
+		return nil
+	}
+	return field.Addr().Interface().(*api.JSONBase)
+}
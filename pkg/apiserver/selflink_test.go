@@ -0,0 +1,76 @@
+package apiserver
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func TestSetSelfLinkItem(t *testing.T) {
+	task := &api.Task{JSONBase: api.JSONBase{ID: "foo"}}
+	out := setSelfLink(task, "/prefix/version/tasks").(*api.Task)
+	if out.SelfLink != "/prefix/version/tasks/foo" {
+		t.Errorf("Unexpected self link: %s", out.SelfLink)
+	}
+	if len(task.SelfLink) != 0 {
+		t.Errorf("Expected the original to be left alone: %#v", task)
+	}
+
+	service := setSelfLink(api.Service{JSONBase: api.JSONBase{ID: "bar"}}, "/prefix/version/namespaces/other/services").(api.Service)
+	if service.SelfLink != "/prefix/version/namespaces/other/services/bar" {
+		t.Errorf("Unexpected self link: %s", service.SelfLink)
+	}
+}
+
+func TestSetSelfLinkList(t *testing.T) {
+	list := api.TaskList{
+		Items: []api.Task{
+			{JSONBase: api.JSONBase{ID: "foo"}},
+			{JSONBase: api.JSONBase{ID: "bar"}},
+		},
+	}
+	out := setSelfLink(list, "/prefix/version/tasks").(api.TaskList)
+	if out.SelfLink != "/prefix/version/tasks" {
+		t.Errorf("Unexpected self link: %s", out.SelfLink)
+	}
+	for i, id := range []string{"foo", "bar"} {
+		if out.Items[i].SelfLink != "/prefix/version/tasks/"+id {
+			t.Errorf("Unexpected self link: %s", out.Items[i].SelfLink)
+		}
+		if len(list.Items[i].SelfLink) != 0 {
+			t.Errorf("Expected the original to be left alone: %#v", list.Items[i])
+		}
+	}
+}
+
+func TestSetSelfLinkWithoutJSONBase(t *testing.T) {
+	simple := SimpleList{Items: []Simple{{Name: "foo"}}}
+	if out := setSelfLink(simple, "/prefix/version/simple"); !reflect.DeepEqual(out, simple) {
+		t.Errorf("Unexpected change: %#v", out)
+	}
+}
+
+func TestSetNamespace(t *testing.T) {
+	task := api.Task{JSONBase: api.JSONBase{ID: "foo"}}
+	out, err := setNamespace(task, "other")
+	expectNoError(t, err)
+	if out.(api.Task).Namespace != "other" || len(task.Namespace) != 0 {
+		t.Errorf("Unexpected namespaces %#v, %#v", out, task)
+	}
+
+	out, err = setNamespace(&api.Task{JSONBase: api.JSONBase{ID: "foo", Namespace: "other"}}, "other")
+	expectNoError(t, err)
+	if out.(*api.Task).Namespace != "other" {
+		t.Errorf("Unexpected namespace %#v", out)
+	}
+
+	if _, err := setNamespace(api.Task{JSONBase: api.JSONBase{ID: "foo", Namespace: "other"}}, "default"); err == nil {
+		t.Errorf("Expected an error for a mismatched namespace")
+	}
+
+	simple := Simple{Name: "foo"}
+	if out, err := setNamespace(simple, "other"); err != nil || !reflect.DeepEqual(out, simple) {
+		t.Errorf("Unexpected change: %#v, %v", out, err)
+	}
+}
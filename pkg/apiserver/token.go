@@ -0,0 +1,78 @@
+package apiserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenEntry is a token of a token file, kept as its SHA-256 digest, and its user.
+type tokenEntry struct {
+	digest [sha256.Size]byte
+	user   *UserInfo
+}
+
+type tokenFileAuthenticator struct {
+	tokens []tokenEntry
+}
+
+// NewTokenFileAuthenticator returns an Authenticator which accepts the bearer tokens
+// listed in a CSV file. Each line holds a token and the user it belongs to, optionally
+// followed by the groups the user is in: "token,user[,group...]".
+func NewTokenFileAuthenticator(path string) (Authenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	tokens := []tokenEntry{}
+	seen := map[[sha256.Size]byte]bool{}
+	for entry := 1; ; entry++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(record) < 2 || len(record[0]) == 0 || len(record[1]) == 0 {
+			return nil, fmt.Errorf("%s: entry %d: expected token,user[,group...]", path, entry)
+		}
+		digest := sha256.Sum256([]byte(record[0]))
+		if seen[digest] {
+			return nil, fmt.Errorf("%s: entry %d: duplicate token", path, entry)
+		}
+		seen[digest] = true
+		tokens = append(tokens, tokenEntry{digest, &UserInfo{Name: record[1], Groups: record[2:]}})
+	}
+	return &tokenFileAuthenticator{tokens}, nil
+}
+
+func (a *tokenFileAuthenticator) AuthenticateRequest(req *http.Request) (*UserInfo, bool, error) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil, false, nil
+	}
+	// The digest of the token is compared with every entry in constant time, so how long
+	// this takes doesn't tell how much of a token was right.
+	digest := sha256.Sum256([]byte(strings.TrimSpace(parts[1])))
+	var user *UserInfo
+	for i := range a.tokens {
+		if subtle.ConstantTimeCompare(digest[:], a.tokens[i].digest[:]) == 1 {
+			user = a.tokens[i].user
+		}
+	}
+	if user == nil {
+		return nil, false, nil
+	}
+	return user, true, nil
+}
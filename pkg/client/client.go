@@ -3,55 +3,107 @@ package client
 import (
 	"bytes"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
 )
 
 type ClientInterface interface {
-	ListTasks(labelQuery map[string]string) (api.TaskList, error)
+	ListTasks(selector labels.Selector) (api.TaskList, error)
 	GetTask(name string) (api.Task, error)
 	DeleteTask(name string) error
 	CreateTask(task api.Task) (api.Task, error)
 	UpdateTask(task api.Task) (api.Task, error)
+	PatchTask(name string, patchType api.PatchType, patch []byte) (api.Task, error)
 
+	ListReplicationControllers(selector labels.Selector) (api.ReplicationControllerList, error)
 	GetReplicationController(name string) (api.ReplicationController, error)
 	CreateReplicationController(api.ReplicationController) (api.ReplicationController, error)
 	UpdateReplicationController(api.ReplicationController) (api.ReplicationController, error)
+	PatchReplicationController(name string, patchType api.PatchType, patch []byte) (api.ReplicationController, error)
 	DeleteReplicationController(string) error
 
+	ListServices(selector labels.Selector) (api.ServiceList, error)
 	GetService(name string) (api.Service, error)
 	CreateService(api.Service) (api.Service, error)
 	UpdateService(api.Service) (api.Service, error)
+	PatchService(name string, patchType api.PatchType, patch []byte) (api.Service, error)
 	DeleteService(string) error
+
+	// InNamespace returns a client which makes the same calls against the objects in
+	// namespace.
+	InNamespace(namespace string) ClientInterface
 }
 
+// AuthInfo holds the credentials sent with every request. A BearerToken, if set, is
+// sent instead of the user name and password.
 type AuthInfo struct {
-	User     string
-	Password string
+	User        string
+	Password    string
+	BearerToken string
 }
 
 // Client is the actual implementation of a Kubernetes client.
 // Host is the http://... base for the URL
+// Version is the API version to speak; it defaults to api.LatestVersion.
+// Namespace is the namespace of the objects the client works with; if it is empty the
+// server puts them in the default namespace.
+// PageSize, if set, makes lists read at most that many objects per request. The pages
+// come from one snapshot on the server, so the list is the same as if it had been read at
+// once.
 type Client struct {
 	Host       string
+	Version    string
+	Namespace  string
 	Auth       *AuthInfo
+	PageSize   int
 	httpClient *http.Client
 }
 
-func (client Client) rawRequest(method, path string, requestBody io.Reader, target interface{}) ([]byte, error) {
+func (client Client) InNamespace(namespace string) ClientInterface {
+	client.Namespace = namespace
+	return client
+}
+
+func (client Client) apiVersion() string {
+	if len(client.Version) == 0 {
+		return api.LatestVersion
+	}
+	return client.Version
+}
+
+// encode returns the body for a request sending obj.
+func (client Client) encode(obj interface{}) (io.Reader, error) {
+	data, err := api.EncodeToVersion(obj, client.apiVersion())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(data), nil
+}
+
+// doRequest sends a request to the API server, with credentials attached. The body is
+// sent with contentType, if it is set.
+func (client Client) doRequest(method, path, contentType string, requestBody io.Reader) (*http.Response, error) {
 	request, err := http.NewRequest(method, client.makeURL(path), requestBody)
 	if err != nil {
-		return []byte{}, err
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
 	}
 	if client.Auth != nil {
-		request.SetBasicAuth(client.Auth.User, client.Auth.Password)
+		if len(client.Auth.BearerToken) > 0 {
+			request.Header.Set("Authorization", "Bearer "+client.Auth.BearerToken)
+		} else {
+			request.SetBasicAuth(client.Auth.User, client.Auth.Password)
+		}
 	}
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -62,21 +114,29 @@ func (client Client) rawRequest(method, path string, requestBody io.Reader, targ
 	} else {
 		httpClient = &http.Client{Transport: tr}
 	}
+	return httpClient.Do(request)
+}
 
-	response, err := httpClient.Do(request)
+func (client Client) rawRequest(method, path string, requestBody io.Reader, target interface{}) ([]byte, error) {
+	return client.typedRequest(method, path, "", requestBody, target)
+}
+
+// typedRequest is like rawRequest for a body of the given content type.
+func (client Client) typedRequest(method, path, contentType string, requestBody io.Reader, target interface{}) ([]byte, error) {
+	response, err := client.doRequest(method, path, contentType, requestBody)
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("request [%s %s] failed (%d) %s", method, client.makeURL(path), response.StatusCode, response.Status)
-	}
 	defer response.Body.Close()
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return body, err
 	}
+	if response.StatusCode != 200 {
+		return nil, decodeStatusError(method, client.makeURL(path), response, body)
+	}
 	if target != nil {
-		err = json.Unmarshal(body, target)
+		err = api.DecodeInto(body, target)
 	}
 	if err != nil {
 		log.Printf("Failed to parse: %s\n", string(body))
@@ -85,43 +145,88 @@ func (client Client) rawRequest(method, path string, requestBody io.Reader, targ
 	return body, err
 }
 
-func (client Client) makeURL(path string) string {
-	return client.Host + "/api/v1beta1/" + path
+// decodeStatusError turns a failed response into an *api.StatusError. Servers which
+// don't send a Status object still produce one, built from the HTTP status.
+func decodeStatusError(method, url string, response *http.Response, body []byte) error {
+	var status api.Status
+	if err := api.DecodeInto(body, &status); err != nil || status.Status != api.StatusFailure {
+		status = api.Status{
+			Status: api.StatusFailure,
+			Code:   response.StatusCode,
+		}
+		switch response.StatusCode {
+		case http.StatusNotFound:
+			status.Reason = api.StatusReasonNotFound
+		case http.StatusConflict:
+			status.Reason = api.StatusReasonConflict
+		case http.StatusUnprocessableEntity:
+			status.Reason = api.StatusReasonInvalid
+		case http.StatusBadRequest:
+			status.Reason = api.StatusReasonBadRequest
+		case http.StatusUnauthorized:
+			status.Reason = api.StatusReasonUnauthorized
+		case http.StatusForbidden:
+			status.Reason = api.StatusReasonForbidden
+		}
+	}
+	if status.Code == 0 {
+		status.Code = response.StatusCode
+	}
+	status.Message = fmt.Sprintf("request [%s %s] failed (%d) %s: %s", method, url, response.StatusCode, response.Status, status.Message)
+	return &api.StatusError{ErrStatus: status}
 }
 
-func EncodeLabelQuery(labelQuery map[string]string) string {
-	query := make([]string, 0, len(labelQuery))
-	for key, value := range labelQuery {
-		query = append(query, key+"="+value)
+func (client Client) makeURL(path string) string {
+	if len(client.Namespace) > 0 {
+		path = "namespaces/" + client.Namespace + "/" + path
 	}
-	return url.QueryEscape(strings.Join(query, ","))
+	return client.Host + "/api/" + client.apiVersion() + "/" + path
 }
 
-func DecodeLabelQuery(labelQuery string) map[string]string {
-	result := map[string]string{}
-	if len(labelQuery) == 0 {
-		return result
+// listPath returns the path of the page of the collection with the objects matching
+// selector which follows the continue token, the first page if it is empty.
+func (client Client) listPath(collection string, selector labels.Selector, token string) string {
+	query := url.Values{}
+	if !selector.Empty() {
+		query.Set("labels", selector.String())
 	}
-	parts := strings.Split(labelQuery, ",")
-	for _, part := range parts {
-		pieces := strings.Split(part, "=")
-		if len(pieces) == 2 {
-			result[pieces[0]] = pieces[1]
-		} else {
-			log.Printf("Invalid label query: %s", labelQuery)
-		}
+	if client.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(client.PageSize))
+	}
+	if len(token) > 0 {
+		query.Set("continue", token)
 	}
-	return result
+	if len(query) == 0 {
+		return collection
+	}
+	return collection + "?" + query.Encode()
 }
 
-// ListTasks takes a label query, and returns the list of tasks that match that query
-func (client Client) ListTasks(labelQuery map[string]string) (api.TaskList, error) {
-	path := "tasks"
-	if labelQuery != nil && len(labelQuery) > 0 {
-		path += "?labels=" + EncodeLabelQuery(labelQuery)
+// readPages calls readPage for each page of a list in turn, with the continue token of
+// the page before, until it returns an empty token.
+func readPages(readPage func(token string) (string, error)) error {
+	token := ""
+	for {
+		next, err := readPage(token)
+		if err != nil || len(next) == 0 {
+			return err
+		}
+		token = next
 	}
+}
+
+// ListTasks takes a label selector, and returns the list of tasks that match it
+func (client Client) ListTasks(selector labels.Selector) (api.TaskList, error) {
 	var result api.TaskList
-	_, err := client.rawRequest("GET", path, nil, &result)
+	err := readPages(func(token string) (string, error) {
+		var page api.TaskList
+		_, err := client.rawRequest("GET", client.listPath("tasks", selector, token), nil, &page)
+		if len(token) > 0 {
+			page.Items = append(result.Items, page.Items...)
+		}
+		result = page
+		return page.Continue, err
+	})
 	return result, err
 }
 
@@ -141,9 +246,9 @@ func (client Client) DeleteTask(name string) error {
 // CreateTask takes the representation of a task.  Returns the server's representation of the task, and an error, if it occurs
 func (client Client) CreateTask(task api.Task) (api.Task, error) {
 	var result api.Task
-	body, err := json.Marshal(task)
+	body, err := client.encode(task)
 	if err == nil {
-		_, err = client.rawRequest("POST", "tasks", bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("POST", "tasks", body, &result)
 	}
 	return result, err
 }
@@ -151,13 +256,36 @@ func (client Client) CreateTask(task api.Task) (api.Task, error) {
 // UpdateTask takes the representation of a task to update.  Returns the server's representation of the task, and an error, if it occurs
 func (client Client) UpdateTask(task api.Task) (api.Task, error) {
 	var result api.Task
-	body, err := json.Marshal(task)
+	body, err := client.encode(task)
 	if err == nil {
-		_, err = client.rawRequest("PUT", "tasks/"+task.ID, bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("PUT", "tasks/"+task.ID, body, &result)
 	}
 	return result, err
 }
 
+// PatchTask applies patch, of the given type, to the task named name, and returns the
+// server's representation of the result.
+func (client Client) PatchTask(name string, patchType api.PatchType, patch []byte) (api.Task, error) {
+	var result api.Task
+	_, err := client.typedRequest("PATCH", "tasks/"+name, string(patchType), bytes.NewReader(patch), &result)
+	return result, err
+}
+
+// ListReplicationControllers returns the replication controllers whose labels match selector
+func (client Client) ListReplicationControllers(selector labels.Selector) (api.ReplicationControllerList, error) {
+	var result api.ReplicationControllerList
+	err := readPages(func(token string) (string, error) {
+		var page api.ReplicationControllerList
+		_, err := client.rawRequest("GET", client.listPath("replicationControllers", selector, token), nil, &page)
+		if len(token) > 0 {
+			page.Items = append(result.Items, page.Items...)
+		}
+		result = page
+		return page.Continue, err
+	})
+	return result, err
+}
+
 // GetReplicationController returns information about a particular replication controller
 func (client Client) GetReplicationController(name string) (api.ReplicationController, error) {
 	var result api.ReplicationController
@@ -168,9 +296,9 @@ func (client Client) GetReplicationController(name string) (api.ReplicationContr
 // CreateReplicationController creates a new replication controller
 func (client Client) CreateReplicationController(controller api.ReplicationController) (api.ReplicationController, error) {
 	var result api.ReplicationController
-	body, err := json.Marshal(controller)
+	body, err := client.encode(controller)
 	if err == nil {
-		_, err = client.rawRequest("POST", "replicationControllers", bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("POST", "replicationControllers", body, &result)
 	}
 	return result, err
 }
@@ -178,18 +306,41 @@ func (client Client) CreateReplicationController(controller api.ReplicationContr
 // UpdateReplicationController updates an existing replication controller
 func (client Client) UpdateReplicationController(controller api.ReplicationController) (api.ReplicationController, error) {
 	var result api.ReplicationController
-	body, err := json.Marshal(controller)
+	body, err := client.encode(controller)
 	if err == nil {
-		_, err = client.rawRequest("PUT", "replicationControllers/"+controller.ID, bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("PUT", "replicationControllers/"+controller.ID, body, &result)
 	}
 	return result, err
 }
 
+// PatchReplicationController applies patch, of the given type, to the replication
+// controller named name.
+func (client Client) PatchReplicationController(name string, patchType api.PatchType, patch []byte) (api.ReplicationController, error) {
+	var result api.ReplicationController
+	_, err := client.typedRequest("PATCH", "replicationControllers/"+name, string(patchType), bytes.NewReader(patch), &result)
+	return result, err
+}
+
 func (client Client) DeleteReplicationController(name string) error {
 	_, err := client.rawRequest("DELETE", "replicationControllers/"+name, nil, nil)
 	return err
 }
 
+// ListServices returns the services whose labels match selector
+func (client Client) ListServices(selector labels.Selector) (api.ServiceList, error) {
+	var result api.ServiceList
+	err := readPages(func(token string) (string, error) {
+		var page api.ServiceList
+		_, err := client.rawRequest("GET", client.listPath("services", selector, token), nil, &page)
+		if len(token) > 0 {
+			page.Items = append(result.Items, page.Items...)
+		}
+		result = page
+		return page.Continue, err
+	})
+	return result, err
+}
+
 // GetReplicationController returns information about a particular replication controller
 func (client Client) GetService(name string) (api.Service, error) {
 	var result api.Service
@@ -200,9 +351,9 @@ func (client Client) GetService(name string) (api.Service, error) {
 // CreateReplicationController creates a new replication controller
 func (client Client) CreateService(svc api.Service) (api.Service, error) {
 	var result api.Service
-	body, err := json.Marshal(svc)
+	body, err := client.encode(svc)
 	if err == nil {
-		_, err = client.rawRequest("POST", "services", bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("POST", "services", body, &result)
 	}
 	return result, err
 }
@@ -210,14 +361,40 @@ func (client Client) CreateService(svc api.Service) (api.Service, error) {
 // UpdateReplicationController updates an existing replication controller
 func (client Client) UpdateService(svc api.Service) (api.Service, error) {
 	var result api.Service
-	body, err := json.Marshal(svc)
+	body, err := client.encode(svc)
 	if err == nil {
-		_, err = client.rawRequest("PUT", "services/"+svc.ID, bytes.NewBuffer(body), &result)
+		_, err = client.rawRequest("PUT", "services/"+svc.ID, body, &result)
 	}
 	return result, err
 }
 
+// PatchService applies patch, of the given type, to the service named name.
+func (client Client) PatchService(name string, patchType api.PatchType, patch []byte) (api.Service, error) {
+	var result api.Service
+	_, err := client.typedRequest("PATCH", "services/"+name, string(patchType), bytes.NewReader(patch), &result)
+	return result, err
+}
+
 func (client Client) DeleteService(name string) error {
 	_, err := client.rawRequest("DELETE", "services/"+name, nil, nil)
 	return err
 }
+
+// WatchTasks returns a stream of changes to the tasks matching selector.
+func (client Client) WatchTasks(selector labels.Selector) (watch.Interface, error) {
+	path := "tasks?watch=true"
+	if !selector.Empty() {
+		path += "&labels=" + url.QueryEscape(selector.String())
+	}
+	return client.watch(path, func() interface{} { return &api.Task{} })
+}
+
+// WatchReplicationControllers returns a stream of changes to replication controllers.
+func (client Client) WatchReplicationControllers() (watch.Interface, error) {
+	return client.watch("replicationControllers?watch=true", func() interface{} { return &api.ReplicationController{} })
+}
+
+// WatchServices returns a stream of changes to services.
+func (client Client) WatchServices() (watch.Interface, error) {
+	return client.watch("services?watch=true", func() interface{} { return &api.Service{} })
+}
@@ -2,13 +2,16 @@ package client
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
-	"net/url"
 	"reflect"
 	"testing"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
 	"k8s-firstcommit/pkg/util"
+	"k8s-firstcommit/pkg/watch"
 )
 
 // TODO: This doesn't reduce typing enough to make it worth the less readable errors. Remove.
@@ -102,14 +105,11 @@ func TestListTasksLabels(t *testing.T) {
 	client := Client{
 		Host: testServer.URL,
 	}
-	query := map[string]string{"foo": "bar", "name": "baz"}
-	receivedTaskList, err := client.ListTasks(query)
+	selector, _ := labels.Parse("foo=bar,name in (baz,qux)")
+	receivedTaskList, err := client.ListTasks(selector)
 	fakeHandler.ValidateRequest(t, makeUrl("/tasks"), "GET", nil)
 	queryString := fakeHandler.RequestReceived.URL.Query().Get("labels")
-	queryString, _ = url.QueryUnescape(queryString)
-	// TODO(bburns) : This assumes some ordering in serialization that might not always
-	// be true, parse it into a map.
-	if queryString != "foo=bar,name=baz" {
+	if queryString != "foo=bar,name in (baz,qux)" {
 		t.Errorf("Unexpected label query: %s", queryString)
 	}
 	if err != nil {
@@ -121,6 +121,70 @@ func TestListTasksLabels(t *testing.T) {
 	testServer.Close()
 }
 
+func TestListTasksPages(t *testing.T) {
+	pages := map[string]api.TaskList{
+		"": {
+			Items:    []api.Task{{JSONBase: api.JSONBase{ID: "foo"}}},
+			Continue: "next",
+		},
+		"next": {
+			Items: []api.Task{{JSONBase: api.JSONBase{ID: "bar"}}},
+		},
+	}
+	limits := []string{}
+	testServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limits = append(limits, req.URL.Query().Get("limit"))
+		page, ok := pages[req.URL.Query().Get("continue")]
+		if !ok {
+			t.Errorf("Unexpected request: %v", req.URL)
+		}
+		body, _ := json.Marshal(page)
+		w.Write(body)
+	}))
+	defer testServer.Close()
+	client := Client{
+		Host:     testServer.URL,
+		PageSize: 1,
+	}
+	list, err := client.ListTasks(nil)
+	expectNoError(t, err)
+	if len(list.Items) != 2 || list.Items[0].ID != "foo" || list.Items[1].ID != "bar" || len(list.Continue) != 0 {
+		t.Errorf("Unexpected task list: %#v", list)
+	}
+	if !reflect.DeepEqual(limits, []string{"1", "1"}) {
+		t.Errorf("Unexpected limits: %v", limits)
+	}
+}
+
+func TestListServices(t *testing.T) {
+	expectedServiceList := api.ServiceList{
+		Items: []api.Service{
+			{JSONBase: api.JSONBase{ID: "foo"}, Port: 80, Labels: map[string]string{"tier": "web"}},
+		},
+	}
+	body, _ := json.Marshal(expectedServiceList)
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: string(body),
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	client := Client{
+		Host: testServer.URL,
+	}
+	receivedServiceList, err := client.ListServices(labels.SelectorFromSet(map[string]string{"tier": "web"}))
+	fakeHandler.ValidateRequest(t, makeUrl("/services"), "GET", nil)
+	if queryString := fakeHandler.RequestReceived.URL.Query().Get("labels"); queryString != "tier=web" {
+		t.Errorf("Unexpected label query: %s", queryString)
+	}
+	if err != nil {
+		t.Errorf("Unexpected error in listing services: %#v", err)
+	}
+	if !reflect.DeepEqual(expectedServiceList, receivedServiceList) {
+		t.Errorf("Unexpected service list: %#v\nvs.\n%#v", receivedServiceList, expectedServiceList)
+	}
+	testServer.Close()
+}
+
 func TestGetTask(t *testing.T) {
 	expectedTask := api.Task{
 		CurrentState: api.TaskState{
@@ -151,6 +215,44 @@ func TestGetTask(t *testing.T) {
 	testServer.Close()
 }
 
+func TestGetTaskNotFound(t *testing.T) {
+	body, _ := json.Marshal(api.NewNotFoundErr("task", "foo").(*api.StatusError).Status())
+	fakeHandler := util.FakeHandler{
+		StatusCode:   404,
+		ResponseBody: string(body),
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	client := Client{
+		Host: testServer.URL,
+	}
+	_, err := client.GetTask("foo")
+	fakeHandler.ValidateRequest(t, makeUrl("/tasks/foo"), "GET", nil)
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %#v", err)
+	}
+	status := err.(*api.StatusError).Status()
+	if status.Details == nil || status.Details.ID != "foo" {
+		t.Errorf("Unexpected status: %#v", status)
+	}
+	testServer.Close()
+}
+
+func TestGetTaskPlainError(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   409,
+		ResponseBody: "conflict",
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	client := Client{
+		Host: testServer.URL,
+	}
+	_, err := client.GetTask("foo")
+	if !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+	testServer.Close()
+}
+
 func TestDeleteTask(t *testing.T) {
 	fakeHandler := util.FakeHandler{
 		StatusCode:   200,
@@ -168,6 +270,28 @@ func TestDeleteTask(t *testing.T) {
 	testServer.Close()
 }
 
+func TestNamespacedRequests(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: `{ "items": []}`,
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	client := Client{
+		Host: testServer.URL,
+	}
+	_, err := client.InNamespace("other").ListTasks(nil)
+	expectNoError(t, err)
+	fakeHandler.ValidateRequest(t, makeUrl("/namespaces/other/tasks"), "GET", nil)
+
+	err = client.InNamespace("other").DeleteService("foo")
+	expectNoError(t, err)
+	fakeHandler.ValidateRequest(t, makeUrl("/namespaces/other/services/foo"), "DELETE", nil)
+	if len(client.Namespace) != 0 {
+		t.Errorf("Expected the original client to be unchanged: %#v", client)
+	}
+	testServer.Close()
+}
+
 func TestCreateTask(t *testing.T) {
 	requestTask := api.Task{
 		CurrentState: api.TaskState{
@@ -233,30 +357,6 @@ func expectEqual(t *testing.T, expected, observed interface{}) {
 	}
 }
 
-func TestEncodeDecodeLabelQuery(t *testing.T) {
-	queryIn := map[string]string{
-		"foo": "bar",
-		"baz": "blah",
-	}
-	queryString, _ := url.QueryUnescape(EncodeLabelQuery(queryIn))
-	queryOut := DecodeLabelQuery(queryString)
-	expectEqual(t, queryIn, queryOut)
-}
-
-func TestDecodeEmpty(t *testing.T) {
-	query := DecodeLabelQuery("")
-	if len(query) != 0 {
-		t.Errorf("Unexpected query: %#v", query)
-	}
-}
-
-func TestDecodeBad(t *testing.T) {
-	query := DecodeLabelQuery("foo")
-	if len(query) != 0 {
-		t.Errorf("Unexpected query: %#v", query)
-	}
-}
-
 func TestGetController(t *testing.T) {
 	expectedController := api.ReplicationController{
 		JSONBase: api.JSONBase{
@@ -323,6 +423,36 @@ func TestUpdateController(t *testing.T) {
 	testServer.Close()
 }
 
+func TestPatchController(t *testing.T) {
+	expectedController := api.ReplicationController{
+		JSONBase: api.JSONBase{
+			ID: "foo",
+		},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: 5,
+		},
+	}
+	body, _ := json.Marshal(expectedController)
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: string(body),
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	defer testServer.Close()
+	client := Client{
+		Host: testServer.URL,
+	}
+	receivedController, err := client.PatchReplicationController("foo", api.MergePatchType, []byte(`{"desiredState":{"replicas":5}}`))
+	expectNoError(t, err)
+	fakeHandler.ValidateRequest(t, makeUrl("/replicationControllers/foo"), "PATCH", nil)
+	if contentType := fakeHandler.RequestReceived.Header.Get("Content-Type"); contentType != string(api.MergePatchType) {
+		t.Errorf("Unexpected content type: %s", contentType)
+	}
+	if !reflect.DeepEqual(expectedController, receivedController) {
+		t.Errorf("Unexpected controller, expected: %#v, received %#v", expectedController, receivedController)
+	}
+}
+
 func TestDeleteController(t *testing.T) {
 	fakeHandler := util.FakeHandler{
 		StatusCode:   200,
@@ -374,3 +504,120 @@ func TestCreateController(t *testing.T) {
 	fakeHandler.ValidateRequest(t, makeUrl("/replicationControllers"), "POST", nil)
 	testServer.Close()
 }
+
+func TestWatchTasks(t *testing.T) {
+	var requestURL string
+	testServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestURL = req.URL.String()
+		w.WriteHeader(200)
+		fmt.Fprintln(w, `{"type": "ADDED", "object": {"id": "foo"}}`)
+		fmt.Fprintln(w, `{"type": "DELETED", "object": {"id": "foo"}}`)
+	}))
+	defer testServer.Close()
+	client := Client{
+		Host: testServer.URL,
+	}
+	w, err := client.WatchTasks(labels.SelectorFromSet(map[string]string{"name": "foo"}))
+	expectNoError(t, err)
+	if requestURL != makeUrl("/tasks?watch=true&labels=name%3Dfoo") {
+		t.Errorf("Unexpected request: %s", requestURL)
+	}
+	for _, expectedType := range []watch.EventType{watch.Added, watch.Deleted} {
+		event, ok := <-w.ResultChan()
+		if !ok {
+			t.Fatalf("Unexpected close")
+		}
+		if event.Type != expectedType || event.Object.(api.Task).ID != "foo" {
+			t.Errorf("Unexpected event: %#v", event)
+		}
+	}
+	if _, ok := <-w.ResultChan(); ok {
+		t.Errorf("Expected closed channel at end of stream")
+	}
+}
+
+func TestCreateServiceVersion(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: `{"kind": "Service", "apiVersion": "v1beta1", "id": "foo", "port": 80}`,
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	defer testServer.Close()
+	client := Client{
+		Host:    testServer.URL,
+		Version: "v1beta1",
+	}
+	received, err := client.CreateService(api.Service{JSONBase: api.JSONBase{ID: "foo"}, Port: 80})
+	expectNoError(t, err)
+	fakeHandler.ValidateRequest(t, "/api/v1beta1/services", "POST", nil)
+
+	var sent map[string]interface{}
+	if err := json.Unmarshal([]byte(fakeHandler.ResponseBody), &sent); err != nil {
+		t.Fatalf("Unexpected request body %q: %v", fakeHandler.ResponseBody, err)
+	}
+	if sent["kind"] != "Service" || sent["apiVersion"] != "v1beta1" {
+		t.Errorf("Expected the request to carry its kind and version: %v", sent)
+	}
+	// The internal objects handed back to callers don't carry wire metadata.
+	expected := api.Service{JSONBase: api.JSONBase{ID: "foo"}, Port: 80}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Unexpected service: %#v", received)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: `{}`,
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	defer testServer.Close()
+	client := Client{
+		Host:    testServer.URL,
+		Version: "v0",
+	}
+	if _, err := client.CreateService(api.Service{JSONBase: api.JSONBase{ID: "foo"}}); err == nil {
+		t.Error("Expected an error encoding to an unknown version")
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	table := []struct {
+		auth     AuthInfo
+		expected string
+	}{
+		{AuthInfo{User: "user", Password: "pass"}, "Basic dXNlcjpwYXNz"},
+		{AuthInfo{User: "user", Password: "pass", BearerToken: "token"}, "Bearer token"},
+	}
+	for _, item := range table {
+		var header string
+		testServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			header = req.Header.Get("Authorization")
+			w.Write([]byte(`{}`))
+		}))
+		auth := item.auth
+		client := Client{Host: testServer.URL, Auth: &auth}
+		_, err := client.GetService("foo")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if header != item.expected {
+			t.Errorf("Expected %q, got %q", item.expected, header)
+		}
+		testServer.Close()
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	body, _ := json.Marshal(api.NewUnauthorizedErr("Unauthorized").(*api.StatusError).Status())
+	fakeHandler := util.FakeHandler{
+		StatusCode:   401,
+		ResponseBody: string(body),
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	defer testServer.Close()
+	client := Client{Host: testServer.URL}
+	if _, err := client.GetService("foo"); !api.IsUnauthorized(err) {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
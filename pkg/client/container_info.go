@@ -3,12 +3,27 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s-firstcommit/pkg/stream"
 )
 
 type ContainerInfo interface {
 	GetContainerInfo(host, name string) (interface{}, error)
+	// GetContainerLogs streams the output of the container named container in the
+	// manifest manifestID from the kubelet on host. options holds the kubelet's follow,
+	// tail and timestamps arguments. The caller must close the stream.
+	GetContainerLogs(host, manifestID, container string, options url.Values) (io.ReadCloser, error)
+	// ExecInContainer opens a stream (see pkg/stream) running a command in the container
+	// from the kubelet on host. options holds the kubelet's command, stdin and tty args.
+	ExecInContainer(host, manifestID, container string, options url.Values) (*stream.Conn, error)
+	// PortForward opens a stream to port of the container, from the kubelet on host.
+	PortForward(host, manifestID, container string, port int) (*stream.Conn, error)
 }
 
 type HTTPContainerInfo struct {
@@ -35,12 +50,82 @@ func (c *HTTPContainerInfo) GetContainerInfo(host, name string) (interface{}, er
 	return data, err
 }
 
+func (c *HTTPContainerInfo) GetContainerLogs(host, manifestID, container string, options url.Values) (io.ReadCloser, error) {
+	query := url.Values{}
+	for key, values := range options {
+		query[key] = values
+	}
+	query.Set("manifest", manifestID)
+	query.Set("container", container)
+	response, err := c.Client.Get(fmt.Sprintf("http://%s:%d/logs?%s", host, c.Port, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("kubelet on %s returned %d: %s", host, response.StatusCode, body)
+	}
+	return response.Body, nil
+}
+
+func (c *HTTPContainerInfo) ExecInContainer(host, manifestID, container string, options url.Values) (*stream.Conn, error) {
+	query := url.Values{}
+	for key, values := range options {
+		query[key] = values
+	}
+	return c.dial(host, "/exec", manifestID, container, query)
+}
+
+func (c *HTTPContainerInfo) PortForward(host, manifestID, container string, port int) (*stream.Conn, error) {
+	return c.dial(host, "/portForward", manifestID, container, url.Values{"port": {strconv.Itoa(port)}})
+}
+
+// dial opens a stream to the kubelet on host.
+func (c *HTTPContainerInfo) dial(host, path, manifestID, container string, query url.Values) (*stream.Conn, error) {
+	query.Set("manifest", manifestID)
+	query.Set("container", container)
+	request, err := http.NewRequest("POST", fmt.Sprintf("http://%s:%d%s?%s", host, c.Port, path, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := stream.Dial(request, nil)
+	if upgradeErr, ok := err.(*stream.UpgradeError); ok {
+		return nil, fmt.Errorf("kubelet on %s returned %d: %s", host, upgradeErr.StatusCode, upgradeErr.Body)
+	}
+	return conn, err
+}
+
 // Useful for testing.
 type FakeContainerInfo struct {
 	data interface{}
+	logs string
 	err  error
 }
 
 func (c *FakeContainerInfo) GetContainerInfo(host, name string) (interface{}, error) {
 	return c.data, c.err
 }
+
+func (c *FakeContainerInfo) GetContainerLogs(host, manifestID, container string, options url.Values) (io.ReadCloser, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return ioutil.NopCloser(strings.NewReader(c.logs)), nil
+}
+
+func (c *FakeContainerInfo) ExecInContainer(host, manifestID, container string, options url.Values) (*stream.Conn, error) {
+	return nil, c.streamErr()
+}
+
+func (c *FakeContainerInfo) PortForward(host, manifestID, container string, port int) (*stream.Conn, error) {
+	return nil, c.streamErr()
+}
+
+// streamErr is the error of every stream, which FakeContainerInfo can't open.
+func (c *FakeContainerInfo) streamErr() error {
+	if c.err != nil {
+		return c.err
+	}
+	return fmt.Errorf("no kubelet to stream from")
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"k8s-firstcommit/pkg/stream"
 	"k8s-firstcommit/pkg/util"
 )
 
@@ -37,3 +39,90 @@ func TestHTTPContainerInfo(t *testing.T) {
 		t.Errorf("Unexpected response.  Expected: %s, received %s", body, string(dataString))
 	}
 }
+
+func TestHTTPContainerLogs(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: "hello\n",
+	}
+	testServer := httptest.NewServer(&fakeHandler)
+	defer testServer.Close()
+
+	hostUrl, err := url.Parse(testServer.URL)
+	expectNoError(t, err)
+	parts := strings.Split(hostUrl.Host, ":")
+	port, err := strconv.Atoi(parts[1])
+	expectNoError(t, err)
+	containerInfo := &HTTPContainerInfo{
+		Client: http.DefaultClient,
+		Port:   uint(port),
+	}
+	logs, err := containerInfo.GetContainerLogs(parts[0], "foo", "web", url.Values{"tail": []string{"10"}})
+	expectNoError(t, err)
+	defer logs.Close()
+	data, err := ioutil.ReadAll(logs)
+	expectNoError(t, err)
+	if string(data) != "hello\n" {
+		t.Errorf("Unexpected logs: %s", data)
+	}
+	fakeHandler.ValidateRequest(t, "/logs", "GET", nil)
+	query := fakeHandler.RequestReceived.URL.Query()
+	if query.Get("manifest") != "foo" || query.Get("container") != "web" || query.Get("tail") != "10" {
+		t.Errorf("Unexpected query: %v", query)
+	}
+
+	fakeHandler.StatusCode = 404
+	if _, err := containerInfo.GetContainerLogs(parts[0], "foo", "db", nil); err == nil {
+		t.Error("Expected an error for a missing container")
+	}
+}
+
+func TestHTTPContainerStreams(t *testing.T) {
+	var received *http.Request
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req
+		if req.URL.Query().Get("container") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		conn, err := stream.Upgrade(w, req)
+		expectNoError(t, err)
+		conn.WriteJSON(stream.Status, stream.ExitStatus{ExitCode: 1})
+		conn.Close()
+	}))
+	defer testServer.Close()
+
+	hostUrl, err := url.Parse(testServer.URL)
+	expectNoError(t, err)
+	parts := strings.Split(hostUrl.Host, ":")
+	port, err := strconv.Atoi(parts[1])
+	expectNoError(t, err)
+	containerInfo := &HTTPContainerInfo{
+		Client: http.DefaultClient,
+		Port:   uint(port),
+	}
+
+	conn, err := containerInfo.ExecInContainer(parts[0], "foo", "redis", url.Values{"command": {"redis-cli"}, "tty": {"true"}})
+	expectNoError(t, err)
+	channel, data, err := conn.ReadFrame()
+	expectNoError(t, err)
+	if channel != stream.Status || string(data) != `{"exitCode":1}` {
+		t.Errorf("Unexpected frame %d: %s", channel, data)
+	}
+	conn.Close()
+	query := received.URL.Query()
+	if received.URL.Path != "/exec" || query.Get("manifest") != "foo" || query.Get("container") != "redis" || query.Get("command") != "redis-cli" || query.Get("tty") != "true" {
+		t.Errorf("Unexpected request: %v", received.URL)
+	}
+
+	conn, err = containerInfo.PortForward(parts[0], "foo", "redis", 6379)
+	expectNoError(t, err)
+	conn.Close()
+	if received.URL.Path != "/portForward" || received.URL.Query().Get("port") != "6379" {
+		t.Errorf("Unexpected request: %v", received.URL)
+	}
+
+	if _, err := containerInfo.PortForward(parts[0], "foo", "missing", 6379); err == nil {
+		t.Error("Expected an error for a missing container")
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sync"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/watch"
+)
+
+// watchEvent mirrors apiserver.WatchEvent, but leaves the object undecoded until we know
+// what type it should be.
+type watchEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watch opens a streaming GET against path. newObj must return a pointer to an empty
+// object of the type being watched; events carry the value it points to.
+func (client Client) watch(path string, newObj func() interface{}) (watch.Interface, error) {
+	response, err := client.doRequest("GET", path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != 200 {
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, decodeStatusError("GET", client.makeURL(path), response, body)
+	}
+	w := &streamWatcher{
+		source: response.Body,
+		newObj: newObj,
+		result: make(chan watch.Event),
+		done:   make(chan struct{}),
+	}
+	go w.receive()
+	return w, nil
+}
+
+// streamWatcher turns a stream of JSON encoded watch events into a watch.Interface.
+type streamWatcher struct {
+	source   io.ReadCloser
+	newObj   func() interface{}
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *streamWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// Stop closes the underlying connection, which ends receive().
+func (w *streamWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		w.source.Close()
+	})
+}
+
+func (w *streamWatcher) isStopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *streamWatcher) receive() {
+	defer close(w.result)
+	defer w.Stop()
+	decoder := json.NewDecoder(w.source)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err != io.EOF && !w.isStopped() {
+				log.Printf("Unable to decode watch event: %v", err)
+			}
+			return
+		}
+		obj := w.newObj()
+		if err := api.DecodeInto(event.Object, obj); err != nil {
+			log.Printf("Unable to decode watched object: %v", err)
+			continue
+		}
+		select {
+		case w.result <- watch.Event{Type: event.Type, Object: reflect.ValueOf(obj).Elem().Interface()}:
+		case <-w.done:
+			return
+		}
+	}
+}
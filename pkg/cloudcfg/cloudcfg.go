@@ -5,10 +5,12 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"k8s-firstcommit/pkg/api"
 	"k8s-firstcommit/pkg/client"
+	"k8s-firstcommit/pkg/labels"
 )
 
 func promptForString(field string) string {
@@ -55,9 +58,9 @@ func Update(name string, client client.ClientInterface, updatePeriod time.Durati
 	if err != nil {
 		return err
 	}
-	labels := controller.DesiredState.ReplicasInSet
+	selector := labels.SelectorFromSet(controller.DesiredState.ReplicasInSet)
 
-	taskList, err := client.ListTasks(labels)
+	taskList, err := client.ListTasks(selector)
 	if err != nil {
 		return err
 	}
@@ -82,7 +85,18 @@ func RequestWithBody(configFile, url, method string) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	return RequestWithBodyData(data, url, method)
+	request, err := RequestWithBodyData(data, url, method)
+	if err != nil {
+		return nil, err
+	}
+	// The API server reads YAML as well as JSON, but has to be told which it's getting.
+	switch strings.ToLower(path.Ext(configFile)) {
+	case ".yaml", ".yml":
+		request.Header.Set("Content-Type", "application/yaml")
+	default:
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return request, nil
 }
 
 // RequestWithBodyData is a helper method that creates an HTTP request with the specified url, method
@@ -112,6 +126,27 @@ func DoRequest(request *http.Request, user, password string) (string, error) {
 	return string(body), err
 }
 
+// StreamRequest sends request and copies the response to out as it arrives, for
+// responses which may go on for a long time, like a followed log.
+func StreamRequest(request *http.Request, user, password string, out io.Writer) error {
+	request.SetBasicAuth(user, password)
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client := &http.Client{Transport: tr}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("request failed with %d: %s", response.StatusCode, body)
+	}
+	_, err = io.Copy(out, response.Body)
+	return err
+}
+
 // StopController stops a controller named 'name' by setting replicas to zero
 func StopController(name string, client client.ClientInterface) error {
 	controller, err := client.GetReplicationController(name)
@@ -131,6 +166,38 @@ func StopController(name string, client client.ClientInterface) error {
 	return nil
 }
 
+// ResizeController sets the number of replicas of the controller named 'name', sending
+// only the new count so that nothing else about the controller can be overwritten.
+func ResizeController(name string, replicas int, client client.ClientInterface) error {
+	patch := fmt.Sprintf(`{"desiredState":{"replicas":%d}}`, replicas)
+	controllerOut, err := client.PatchReplicationController(name, api.MergePatchType, []byte(patch))
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(controllerOut)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// LabelPatch returns a merge patch making the label changes in args: "key=value" sets a
+// label and "key-" removes it.
+func LabelPatch(args []string) ([]byte, error) {
+	labels := map[string]interface{}{}
+	for _, arg := range args {
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 && len(parts[0]) > 0 {
+			labels[parts[0]] = parts[1]
+		} else if strings.HasSuffix(arg, "-") && len(arg) > 1 {
+			labels[strings.TrimSuffix(arg, "-")] = nil
+		} else {
+			return nil, fmt.Errorf("invalid label change %q, expected key=value or key-", arg)
+		}
+	}
+	return json.Marshal(map[string]interface{}{"labels": labels})
+}
+
 func makePorts(spec string) []api.Port {
 	parts := strings.Split(spec, ",")
 	var result []api.Port
@@ -1,13 +1,20 @@
 package cloudcfg
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
 	"testing"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/client"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/stream"
 	"k8s-firstcommit/pkg/util"
 )
 
@@ -29,7 +36,12 @@ type FakeKubeClient struct {
 	ctrl    api.ReplicationController
 }
 
-func (client *FakeKubeClient) ListTasks(labelQuery map[string]string) (api.TaskList, error) {
+func (client *FakeKubeClient) InNamespace(namespace string) client.ClientInterface {
+	client.actions = append(client.actions, Action{action: "in-namespace", value: namespace})
+	return client
+}
+
+func (client *FakeKubeClient) ListTasks(selector labels.Selector) (api.TaskList, error) {
 	client.actions = append(client.actions, Action{action: "list-tasks"})
 	return client.tasks, nil
 }
@@ -54,6 +66,16 @@ func (client *FakeKubeClient) UpdateTask(task api.Task) (api.Task, error) {
 	return api.Task{}, nil
 }
 
+func (client *FakeKubeClient) PatchTask(name string, patchType api.PatchType, patch []byte) (api.Task, error) {
+	client.actions = append(client.actions, Action{action: "patch-task", value: string(patch)})
+	return api.Task{}, nil
+}
+
+func (client *FakeKubeClient) ListReplicationControllers(selector labels.Selector) (api.ReplicationControllerList, error) {
+	client.actions = append(client.actions, Action{action: "list-controllers"})
+	return api.ReplicationControllerList{Items: []api.ReplicationController{client.ctrl}}, nil
+}
+
 func (client *FakeKubeClient) GetReplicationController(name string) (api.ReplicationController, error) {
 	client.actions = append(client.actions, Action{action: "get-controller", value: name})
 	return client.ctrl, nil
@@ -69,11 +91,21 @@ func (client *FakeKubeClient) UpdateReplicationController(controller api.Replica
 	return api.ReplicationController{}, nil
 }
 
+func (client *FakeKubeClient) PatchReplicationController(name string, patchType api.PatchType, patch []byte) (api.ReplicationController, error) {
+	client.actions = append(client.actions, Action{action: "patch-controller", value: string(patch)})
+	return client.ctrl, nil
+}
+
 func (client *FakeKubeClient) DeleteReplicationController(controller string) error {
 	client.actions = append(client.actions, Action{action: "delete-controller", value: controller})
 	return nil
 }
 
+func (client *FakeKubeClient) ListServices(selector labels.Selector) (api.ServiceList, error) {
+	client.actions = append(client.actions, Action{action: "list-services"})
+	return api.ServiceList{}, nil
+}
+
 func (client *FakeKubeClient) GetService(name string) (api.Service, error) {
 	client.actions = append(client.actions, Action{action: "get-controller", value: name})
 	return api.Service{}, nil
@@ -89,6 +121,11 @@ func (client *FakeKubeClient) UpdateService(controller api.Service) (api.Service
 	return api.Service{}, nil
 }
 
+func (client *FakeKubeClient) PatchService(name string, patchType api.PatchType, patch []byte) (api.Service, error) {
+	client.actions = append(client.actions, Action{action: "patch-service", value: string(patch)})
+	return api.Service{}, nil
+}
+
 func (client *FakeKubeClient) DeleteService(controller string) error {
 	client.actions = append(client.actions, Action{action: "delete-service", value: controller})
 	return nil
@@ -150,6 +187,32 @@ func TestDoRequest(t *testing.T) {
 	fakeHandler.ValidateRequest(t, "/foo/bar", "GET", &fakeHandler.ResponseBody)
 }
 
+func TestStreamRequest(t *testing.T) {
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: "hello\n",
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	defer testServer.Close()
+	request, _ := http.NewRequest("GET", testServer.URL+"/tasks/foo/log", nil)
+	out := &bytes.Buffer{}
+	err := StreamRequest(request, "user", "pass", out)
+	expectNoError(t, err)
+	if request.Header["Authorization"] == nil {
+		t.Errorf("Request is missing authorization header: %#v", *request)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	fakeHandler.StatusCode = 404
+	fakeHandler.ResponseBody = "not found"
+	request, _ = http.NewRequest("GET", testServer.URL+"/tasks/bar/log", nil)
+	if err := StreamRequest(request, "user", "pass", &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
 func TestRunController(t *testing.T) {
 	fakeClient := FakeKubeClient{}
 	name := "name"
@@ -204,6 +267,29 @@ func TestStopController(t *testing.T) {
 	}
 }
 
+func TestResizeController(t *testing.T) {
+	fakeClient := FakeKubeClient{}
+	err := ResizeController("name", 5, &fakeClient)
+	expectNoError(t, err)
+	if len(fakeClient.actions) != 1 {
+		t.Fatalf("Unexpected actions: %#v", fakeClient.actions)
+	}
+	validateAction(Action{action: "patch-controller", value: `{"desiredState":{"replicas":5}}`}, fakeClient.actions[0], t)
+}
+
+func TestLabelPatch(t *testing.T) {
+	patch, err := LabelPatch([]string{"tier=web", "canary-", "empty="})
+	expectNoError(t, err)
+	if string(patch) != `{"labels":{"canary":null,"empty":"","tier":"web"}}` {
+		t.Errorf("Unexpected patch: %s", patch)
+	}
+	for _, arg := range []string{"tier", "-", "=web"} {
+		if _, err := LabelPatch([]string{arg}); err == nil {
+			t.Errorf("Expected an error for %q", arg)
+		}
+	}
+}
+
 func TestCloudCfgDeleteController(t *testing.T) {
 	fakeClient := FakeKubeClient{}
 	name := "name"
@@ -291,3 +377,92 @@ func TestMakePorts(t *testing.T) {
 	validatePort(t, ports[1], 8081, 8081)
 	validatePort(t, ports[2], 443, 444)
 }
+
+func TestRequestWithBodyContentType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudcfg")
+	expectNoError(t, err)
+	defer os.RemoveAll(dir)
+	for file, expected := range map[string]string{
+		"task.json": "application/json",
+		"task.yaml": "application/yaml",
+		"task.YML":  "application/yaml",
+		"task":      "application/json",
+	} {
+		name := path.Join(dir, file)
+		expectNoError(t, ioutil.WriteFile(name, []byte("id: foo\n"), 0644))
+		request, err := RequestWithBody(name, "http://www.google.com", "POST")
+		expectNoError(t, err)
+		if contentType := request.Header.Get("Content-Type"); contentType != expected {
+			t.Errorf("%s: expected %s, got %s", file, expected, contentType)
+		}
+	}
+}
+
+// streamServer serves streams which send stdin back on stdout, upper cased, and end with
+// the exit code 3 once stdin is closed.
+func streamServer(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, _, ok := req.BasicAuth(); !ok {
+			t.Errorf("Request is missing authorization: %#v", req)
+		}
+		conn, err := stream.Upgrade(w, req)
+		expectNoError(t, err)
+		defer conn.Close()
+		for {
+			channel, data, err := conn.ReadFrame()
+			if err != nil {
+				return
+			}
+			if channel == stream.Stdin && len(data) == 0 {
+				conn.WriteFrame(stream.Stderr, []byte("done"))
+				conn.WriteJSON(stream.Status, stream.ExitStatus{ExitCode: 3})
+				return
+			}
+			conn.WriteFrame(stream.Stdout, bytes.ToUpper(data))
+		}
+	}))
+}
+
+func TestExec(t *testing.T) {
+	server := streamServer(t)
+	defer server.Close()
+
+	conn, err := DialStream(server.URL+"/tasks/foo/exec", "user", "pass")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code, err := Exec(conn, bytes.NewBufferString("ping"), stdout, stderr)
+	expectNoError(t, err)
+	if code != 3 || stdout.String() != "PING" || stderr.String() != "done" {
+		t.Errorf("Unexpected exit code %d, stdout %q and stderr %q", code, stdout.String(), stderr.String())
+	}
+}
+
+func TestForwardPort(t *testing.T) {
+	server := streamServer(t)
+	defer server.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	go ForwardPort(listener, func() (*stream.Conn, error) {
+		return DialStream(server.URL+"/tasks/foo/portforward?port=6379", "user", "pass")
+	})
+	defer listener.Close()
+
+	local, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer local.Close()
+	_, err = local.Write([]byte("ping"))
+	expectNoError(t, err)
+	local.(*net.TCPConn).CloseWrite()
+	data, err := ioutil.ReadAll(local)
+	expectNoError(t, err)
+	if string(data) != "PING" {
+		t.Errorf("Unexpected response: %q", data)
+	}
+}
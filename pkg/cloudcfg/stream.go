@@ -0,0 +1,137 @@
+package cloudcfg
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s-firstcommit/pkg/stream"
+)
+
+// DialStream asks the API server for the stream (see pkg/stream) at url.
+func DialStream(url, user, password string) (*stream.Conn, error) {
+	request, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.SetBasicAuth(user, password)
+	return stream.Dial(request, &tls.Config{InsecureSkipVerify: true})
+}
+
+// Exec sends stdin, if it isn't nil, to the command at the other end of conn and copies
+// the command's output to stdout and stderr. It returns the command's exit code once it
+// is done.
+func Exec(conn *stream.Conn, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if stdin != nil {
+		go func() {
+			io.Copy(conn.Writer(stream.Stdin), stdin)
+			conn.WriteFrame(stream.Stdin, nil)
+		}()
+	}
+	for {
+		channel, data, err := conn.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch channel {
+		case stream.Stdout:
+			stdout.Write(data)
+		case stream.Stderr:
+			stderr.Write(data)
+		case stream.Status:
+			var status stream.ExitStatus
+			if err := json.Unmarshal(data, &status); err != nil {
+				return 0, err
+			}
+			if len(status.Error) > 0 {
+				return status.ExitCode, errors.New(status.Error)
+			}
+			return status.ExitCode, nil
+		}
+	}
+}
+
+// ForwardPort accepts connections from listener until it's closed, and joins each of
+// them to a new stream opened by dial.
+func ForwardPort(listener net.Listener, dial func() (*stream.Conn, error)) error {
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go forwardConnection(local, dial)
+	}
+}
+
+func forwardConnection(local net.Conn, dial func() (*stream.Conn, error)) {
+	defer local.Close()
+	conn, err := dial()
+	if err != nil {
+		log.Printf("Unable to forward a connection from %s: %v", local.RemoteAddr(), err)
+		return
+	}
+	defer conn.Close()
+	go func() {
+		io.Copy(conn.Writer(stream.Stdin), local)
+		conn.WriteFrame(stream.Stdin, nil)
+	}()
+	for {
+		channel, data, err := conn.ReadFrame()
+		if err != nil {
+			return
+		}
+		switch channel {
+		case stream.Stdout:
+			if _, err := local.Write(data); err != nil {
+				return
+			}
+		case stream.Status:
+			var status stream.ExitStatus
+			if json.Unmarshal(data, &status) == nil && len(status.Error) > 0 {
+				log.Printf("Forwarding a connection from %s failed: %s", local.RemoteAddr(), status.Error)
+			}
+			return
+		}
+	}
+}
+
+// RawTerminal puts the terminal on stdin in raw mode, so that every key goes straight
+// to a remote terminal, and returns a function which puts it back the way it was.
+func RawTerminal() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(state))
+	}, nil
+}
+
+// TerminalSize returns the size of the terminal on stdin.
+func TerminalSize() (stream.TerminalSize, error) {
+	size := stream.TerminalSize{}
+	output, err := stty("size")
+	if err != nil {
+		return size, err
+	}
+	_, err = fmt.Sscanf(output, "%d %d", &size.Height, &size.Width)
+	return size, err
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
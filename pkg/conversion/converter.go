@@ -0,0 +1,179 @@
+// Package conversion converts objects between the versions of an API. Types with the
+// same shape are converted field by field; wherever that isn't enough, a conversion
+// function can be registered for the pair of types involved.
+package conversion
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Scope is passed to conversion functions so that they can hand nested fields back to
+// the Converter.
+type Scope interface {
+	Convert(src, dest interface{}) error
+}
+
+type typePair struct {
+	source reflect.Type
+	dest   reflect.Type
+}
+
+var (
+	scopeType = reflect.TypeOf((*Scope)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Converter knows how to convert one type to another.
+type Converter struct {
+	funcs map[typePair]reflect.Value
+}
+
+// NewConverter creates a Converter with no conversion functions.
+func NewConverter() *Converter {
+	return &Converter{
+		funcs: map[typePair]reflect.Value{},
+	}
+}
+
+// Register adds a conversion function with the signature func(in *A, out *B, s Scope) error.
+// It is used whenever an A needs to be converted to a B, at any depth.
+func (c *Converter) Register(conversionFunc interface{}) error {
+	fv := reflect.ValueOf(conversionFunc)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return fmt.Errorf("expected a func, got %v", ft)
+	}
+	if ft.NumIn() != 3 || ft.NumOut() != 1 {
+		return fmt.Errorf("expected func(in *A, out *B, s Scope) error, got %v", ft)
+	}
+	if ft.In(0).Kind() != reflect.Ptr || ft.In(1).Kind() != reflect.Ptr {
+		return fmt.Errorf("expected pointer arguments, got %v", ft)
+	}
+	if ft.In(2) != scopeType {
+		return fmt.Errorf("expected the third argument to be a Scope, got %v", ft)
+	}
+	if ft.Out(0) != errorType {
+		return fmt.Errorf("expected an error result, got %v", ft)
+	}
+	c.funcs[typePair{ft.In(0).Elem(), ft.In(1).Elem()}] = fv
+	return nil
+}
+
+// Convert converts src into dest. Both must be pointers. Structs are converted by
+// matching field names, and every exported field of dest must have a counterpart in src
+// unless a conversion function handles the enclosing type.
+func (c *Converter) Convert(src, dest interface{}) error {
+	sv, dv := reflect.ValueOf(src), reflect.ValueOf(dest)
+	if sv.Kind() != reflect.Ptr || sv.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer to convert from, got %v", sv.Type())
+	}
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer to convert into, got %v", dv.Type())
+	}
+	return c.convert(sv.Elem(), dv.Elem())
+}
+
+func (c *Converter) convert(sv, dv reflect.Value) error {
+	st, dt := sv.Type(), dv.Type()
+	if fv, ok := c.funcs[typePair{st, dt}]; ok {
+		return c.call(fv, sv, dv)
+	}
+	if !dv.CanSet() {
+		return fmt.Errorf("can't set %v", dt)
+	}
+
+	switch dt.Kind() {
+	case reflect.Struct:
+		if st.Kind() != reflect.Struct {
+			break
+		}
+		for i := 0; i < dt.NumField(); i++ {
+			field := dt.Field(i)
+			if len(field.PkgPath) > 0 {
+				// Unexported.
+				continue
+			}
+			sf, ok := st.FieldByName(field.Name)
+			if !ok || len(sf.Index) != 1 {
+				return fmt.Errorf("%v has no field %s, needed by %v", st, field.Name, dt)
+			}
+			if err := c.convert(sv.Field(sf.Index[0]), dv.Field(i)); err != nil {
+				return fmt.Errorf("%v.%s: %v", dt, field.Name, err)
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if st.Kind() != reflect.Slice {
+			break
+		}
+		if sv.IsNil() {
+			dv.Set(reflect.Zero(dt))
+			return nil
+		}
+		dv.Set(reflect.MakeSlice(dt, sv.Len(), sv.Len()))
+		for i := 0; i < sv.Len(); i++ {
+			if err := c.convert(sv.Index(i), dv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if st.Kind() != reflect.Map {
+			break
+		}
+		if sv.IsNil() {
+			dv.Set(reflect.Zero(dt))
+			return nil
+		}
+		dv.Set(reflect.MakeMap(dt))
+		for _, key := range sv.MapKeys() {
+			newKey := reflect.New(dt.Key()).Elem()
+			if err := c.convert(key, newKey); err != nil {
+				return err
+			}
+			newValue := reflect.New(dt.Elem()).Elem()
+			if err := c.convert(sv.MapIndex(key), newValue); err != nil {
+				return err
+			}
+			dv.SetMapIndex(newKey, newValue)
+		}
+		return nil
+	case reflect.Ptr:
+		if st.Kind() != reflect.Ptr {
+			break
+		}
+		if sv.IsNil() {
+			dv.Set(reflect.Zero(dt))
+			return nil
+		}
+		dv.Set(reflect.New(dt.Elem()))
+		return c.convert(sv.Elem(), dv.Elem())
+	case reflect.Interface:
+		if !st.AssignableTo(dt) {
+			break
+		}
+		// Values held in interfaces have no declared type to convert to, so they are
+		// copied as they are.
+		dv.Set(sv)
+		return nil
+	default:
+		if st.Kind() != dt.Kind() || !st.ConvertibleTo(dt) {
+			break
+		}
+		dv.Set(sv.Convert(dt))
+		return nil
+	}
+	return fmt.Errorf("couldn't convert %v to %v", st, dt)
+}
+
+func (c *Converter) call(fv, sv, dv reflect.Value) error {
+	// Values read out of maps aren't addressable; conversion functions only ever see copies.
+	in := reflect.New(sv.Type())
+	in.Elem().Set(sv)
+	ret := fv.Call([]reflect.Value{in, dv.Addr(), reflect.ValueOf(Scope(c))})[0]
+	if ret.IsNil() {
+		return nil
+	}
+	return ret.Interface().(error)
+}
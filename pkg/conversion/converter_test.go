@@ -0,0 +1,131 @@
+package conversion
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type internalThing struct {
+	Name    string
+	Count   int
+	Tags    map[string]string
+	Items   []internalItem
+	Next    *internalItem
+	Info    interface{}
+	private string
+}
+
+type internalItem struct {
+	Command []string
+}
+
+type externalCount int
+
+type externalThing struct {
+	Name  string
+	Count externalCount
+	Tags  map[string]string
+	Items []externalItem
+	Next  *externalItem
+	Info  interface{}
+}
+
+type externalItem struct {
+	Command string
+}
+
+func newTestConverter(t *testing.T) *Converter {
+	c := NewConverter()
+	err := c.Register(func(in *externalItem, out *internalItem, s Scope) error {
+		out.Command = strings.Fields(in.Command)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = c.Register(func(in *internalItem, out *externalItem, s Scope) error {
+		out.Command = strings.Join(in.Command, " ")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	c := newTestConverter(t)
+	in := externalThing{
+		Name:  "foo",
+		Count: 3,
+		Tags:  map[string]string{"a": "b"},
+		Items: []externalItem{{Command: "echo hello world"}, {}},
+		Next:  &externalItem{Command: "true"},
+		Info:  map[string]interface{}{"x": 1.0},
+	}
+	var internal internalThing
+	if err := c.Convert(&in, &internal); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(internal.Items[0].Command, []string{"echo", "hello", "world"}) || internal.Next.Command[0] != "true" {
+		t.Errorf("Conversion func wasn't used: %#v", internal)
+	}
+	if internal.Count != 3 || internal.Tags["a"] != "b" {
+		t.Errorf("Unexpected conversion: %#v", internal)
+	}
+	var out externalThing
+	if err := c.Convert(&internal, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Round trip changed the object:\n%#v\n%#v", in, out)
+	}
+}
+
+func TestConvertNils(t *testing.T) {
+	c := newTestConverter(t)
+	var out internalThing
+	if err := c.Convert(&externalThing{}, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.Tags != nil || out.Items != nil || out.Next != nil || out.Info != nil {
+		t.Errorf("Expected nils to stay nil: %#v", out)
+	}
+}
+
+func TestConvertMissingField(t *testing.T) {
+	type smaller struct {
+		Name string
+	}
+	var out externalThing
+	if err := NewConverter().Convert(&smaller{"foo"}, &out); err == nil {
+		t.Error("Expected an error for fields missing from the source")
+	}
+}
+
+func TestConvertFuncError(t *testing.T) {
+	c := NewConverter()
+	c.Register(func(in *externalItem, out *internalItem, s Scope) error {
+		return fmt.Errorf("no")
+	})
+	var out internalThing
+	if err := c.Convert(&externalThing{Items: []externalItem{{}}}, &out); err == nil {
+		t.Error("Expected the conversion func's error")
+	}
+}
+
+func TestRegisterBadFuncs(t *testing.T) {
+	funcs := []interface{}{
+		"not a func",
+		func(in *externalItem, out *internalItem) error { return nil },
+		func(in externalItem, out *internalItem, s Scope) error { return nil },
+		func(in *externalItem, out *internalItem, s Scope) {},
+	}
+	for _, f := range funcs {
+		if err := NewConverter().Register(f); err == nil {
+			t.Errorf("Expected an error registering %T", f)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Scheme knows the named types ("kinds") of every version of an API, and how to convert
+// between them. One version, the internal version, is what programs work with; it is
+// never written to the wire. The others are external versions, which are encoded as
+// JSON with "kind" and "apiVersion" fields naming their type.
+type Scheme struct {
+	// versionMap maps each version to the kinds it knows about.
+	versionMap map[string]map[string]reflect.Type
+
+	// typeToVersion and typeToKind record where each registered type came from.
+	typeToVersion map[reflect.Type]string
+	typeToKind    map[reflect.Type]string
+
+	converter *Converter
+
+	// InternalVersion is the version of the types programs work with.
+	InternalVersion string
+
+	// DefaultVersion is assumed for data which doesn't name its version.
+	DefaultVersion string
+}
+
+// NewScheme creates an empty Scheme.
+func NewScheme(internalVersion, defaultVersion string) *Scheme {
+	return &Scheme{
+		versionMap:      map[string]map[string]reflect.Type{},
+		typeToVersion:   map[reflect.Type]string{},
+		typeToKind:      map[reflect.Type]string{},
+		converter:       NewConverter(),
+		InternalVersion: internalVersion,
+		DefaultVersion:  defaultVersion,
+	}
+}
+
+// AddKnownTypes registers types as belonging to version. Each type's kind is the name
+// of its Go type, so every version must use the same names for the same kinds. Types
+// may be passed as values or pointers.
+func (s *Scheme) AddKnownTypes(version string, types ...interface{}) {
+	for _, obj := range types {
+		s.AddKnownTypeWithName(version, typeOf(obj).Name(), obj)
+	}
+}
+
+// AddKnownTypeWithName registers obj's type as the given kind in version, for types
+// whose Go name differs from their kind.
+func (s *Scheme) AddKnownTypeWithName(version, kind string, obj interface{}) {
+	t := typeOf(obj)
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("only struct types can be registered, got %v", t))
+	}
+	known, ok := s.versionMap[version]
+	if !ok {
+		known = map[string]reflect.Type{}
+		s.versionMap[version] = known
+	}
+	known[kind] = t
+	s.typeToVersion[t] = version
+	s.typeToKind[t] = kind
+}
+
+// AddConversionFuncs registers functions which convert between types that can't be
+// converted field by field. See Converter.Register for the required signature.
+func (s *Scheme) AddConversionFuncs(conversionFuncs ...interface{}) error {
+	for _, f := range conversionFuncs {
+		if err := s.converter.Register(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewObject returns a pointer to a new, empty object of the given version and kind.
+func (s *Scheme) NewObject(version, kind string) (interface{}, error) {
+	if t, ok := s.versionMap[version][kind]; ok {
+		return reflect.New(t).Interface(), nil
+	}
+	return nil, fmt.Errorf("%q is not a known kind in version %q", kind, version)
+}
+
+// Convert converts in into out, which must be a pointer. in may be a value or a pointer.
+func (s *Scheme) Convert(in, out interface{}) error {
+	return s.converter.Convert(toPointer(in), out)
+}
+
+// Encode is like EncodeToVersion, but encodes to the default version.
+func (s *Scheme) Encode(obj interface{}) ([]byte, error) {
+	return s.EncodeToVersion(obj, s.DefaultVersion)
+}
+
+// EncodeToVersion converts obj, which may be of any registered version, to destVersion
+// and returns its JSON. Kind and APIVersion are filled in on the way.
+func (s *Scheme) EncodeToVersion(obj interface{}, destVersion string) ([]byte, error) {
+	if destVersion == s.InternalVersion {
+		return nil, fmt.Errorf("the internal version can't be encoded")
+	}
+	obj = toPointer(obj)
+	t := reflect.TypeOf(obj).Elem()
+	version, ok := s.typeToVersion[t]
+	if !ok {
+		return nil, fmt.Errorf("type %v is not registered", t)
+	}
+	kind := s.typeToKind[t]
+
+	out := obj
+	if version != destVersion {
+		var err error
+		if out, err = s.NewObject(destVersion, kind); err != nil {
+			return nil, err
+		}
+		if err := s.converter.Convert(obj, out); err != nil {
+			return nil, err
+		}
+	} else {
+		// Don't stamp the version into the caller's object.
+		copied := reflect.New(t)
+		copied.Elem().Set(reflect.ValueOf(obj).Elem())
+		out = copied.Interface()
+	}
+	if err := setTypeMeta(out, destVersion, kind); err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// typeMeta is the part of every encoded object which says what it is.
+type typeMeta struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+// Decode reads an object of any known external version and kind, and returns a pointer
+// to it converted to the internal version.
+func (s *Scheme) Decode(data []byte) (interface{}, error) {
+	version, kind, err := s.dataVersionAndKind(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(kind) == 0 {
+		return nil, fmt.Errorf("couldn't get the kind of %q", string(data))
+	}
+	obj, err := s.NewObject(s.InternalVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decodeInto(data, version, kind, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// DecodeInto reads data into obj, which must be a pointer to a registered type. Data
+// which doesn't name its kind is assumed to be of obj's kind.
+func (s *Scheme) DecodeInto(data []byte, obj interface{}) error {
+	t := reflect.TypeOf(obj)
+	if t.Kind() != reflect.Ptr {
+		return fmt.Errorf("expected a pointer, got %v", t)
+	}
+	objKind, ok := s.typeToKind[t.Elem()]
+	if !ok {
+		return fmt.Errorf("type %v is not registered", t.Elem())
+	}
+	version, kind, err := s.dataVersionAndKind(data)
+	if err != nil {
+		return err
+	}
+	if len(kind) == 0 {
+		kind = objKind
+	} else if kind != objKind {
+		return fmt.Errorf("can't decode a %s into a %s", kind, objKind)
+	}
+	return s.decodeInto(data, version, kind, obj)
+}
+
+func (s *Scheme) dataVersionAndKind(data []byte) (version, kind string, err error) {
+	var meta typeMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", "", err
+	}
+	version = meta.APIVersion
+	if len(version) == 0 {
+		version = s.DefaultVersion
+	}
+	if version == s.InternalVersion {
+		return "", "", fmt.Errorf("the internal version can't be decoded")
+	}
+	return version, meta.Kind, nil
+}
+
+func (s *Scheme) decodeInto(data []byte, version, kind string, obj interface{}) error {
+	if s.typeToVersion[reflect.TypeOf(obj).Elem()] == version {
+		return json.Unmarshal(data, obj)
+	}
+	external, err := s.NewObject(version, kind)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, external); err != nil {
+		return err
+	}
+	if err := s.converter.Convert(external, obj); err != nil {
+		return err
+	}
+	// Objects in the internal version don't carry wire metadata.
+	return setTypeMeta(obj, "", "")
+}
+
+// setTypeMeta sets the APIVersion and Kind fields of obj, if it has them.
+func setTypeMeta(obj interface{}, version, kind string) error {
+	v := reflect.ValueOf(obj).Elem()
+	for name, value := range map[string]string{"APIVersion": version, "Kind": kind} {
+		field := v.FieldByName(name)
+		if !field.IsValid() {
+			continue
+		}
+		if field.Kind() != reflect.String {
+			return fmt.Errorf("%v.%s is not a string", v.Type(), name)
+		}
+		field.SetString(value)
+	}
+	return nil
+}
+
+func typeOf(obj interface{}) reflect.Type {
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func toPointer(obj interface{}) interface{} {
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		return obj
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
@@ -0,0 +1,103 @@
+package conversion
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type InternalSimple struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	TestString string `json:"testString"`
+	Args       []string
+}
+
+type ExternalSimple struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	TestString string `json:"testString"`
+	Args       string `json:"args"`
+}
+
+func newTestScheme(t *testing.T) *Scheme {
+	s := NewScheme("", "v1")
+	s.AddKnownTypeWithName("", "Simple", InternalSimple{})
+	s.AddKnownTypeWithName("v1", "Simple", &ExternalSimple{})
+	err := s.AddConversionFuncs(
+		func(in *InternalSimple, out *ExternalSimple, scope Scope) error {
+			out.TestString = in.TestString
+			out.Args = strings.Join(in.Args, " ")
+			return nil
+		},
+		func(in *ExternalSimple, out *InternalSimple, scope Scope) error {
+			out.TestString = in.TestString
+			out.Args = strings.Fields(in.Args)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return s
+}
+
+func TestSchemeEncodeDecode(t *testing.T) {
+	s := newTestScheme(t)
+	in := InternalSimple{TestString: "foo", Args: []string{"a", "b"}}
+	data, err := s.EncodeToVersion(in, "v1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var wire map[string]interface{}
+	json.Unmarshal(data, &wire)
+	expected := map[string]interface{}{"apiVersion": "v1", "kind": "Simple", "testString": "foo", "args": "a b"}
+	if !reflect.DeepEqual(wire, expected) {
+		t.Errorf("Unexpected encoding: %s", data)
+	}
+
+	obj, err := s.Decode(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(obj, &in) {
+		t.Errorf("Unexpected decoding: %#v", obj)
+	}
+}
+
+func TestSchemeDecodeIntoDefaults(t *testing.T) {
+	s := newTestScheme(t)
+	var out InternalSimple
+	// No kind and no version: the kind comes from the target, the version is the default.
+	if err := s.DecodeInto([]byte(`{"testString": "foo", "args": "x y"}`), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(out, InternalSimple{TestString: "foo", Args: []string{"x", "y"}}) {
+		t.Errorf("Unexpected decoding: %#v", out)
+	}
+}
+
+func TestSchemeErrors(t *testing.T) {
+	s := newTestScheme(t)
+	var out InternalSimple
+	for _, data := range []string{
+		`{"apiVersion": "v2"}`,
+		`{"kind": "Other"}`,
+		`{"apiVersion": "", "kind": "Simple", "testString": 1}`,
+		`not json`,
+	} {
+		if err := s.DecodeInto([]byte(data), &out); err == nil {
+			t.Errorf("Expected an error decoding %s", data)
+		}
+	}
+	if _, err := s.Decode([]byte(`{}`)); err == nil {
+		t.Error("Expected an error decoding data without a kind")
+	}
+	if _, err := s.EncodeToVersion(InternalSimple{}, ""); err == nil {
+		t.Error("Expected an error encoding to the internal version")
+	}
+	if _, err := s.EncodeToVersion(struct{}{}, "v1"); err == nil {
+		t.Error("Expected an error encoding an unregistered type")
+	}
+}
@@ -0,0 +1,155 @@
+// Package fields implements the selector language used to pick objects by the values of
+// some of their fields, for example "currentState.host=machine1,desiredState.replicas>0".
+package fields
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Set is the value of each field an object can be selected by, keyed by the field's
+// path, e.g. "currentState.host".
+type Set map[string]string
+
+// Operator is the relation a Requirement asks for between a field and its value.
+type Operator string
+
+const (
+	// Equals requires the field to have the value, "field=value".
+	Equals Operator = "="
+	// NotEquals requires the field to have another value, "field!=value".
+	NotEquals Operator = "!="
+	// GreaterThan requires the field to be greater than the value, "field>value".
+	GreaterThan Operator = ">"
+	// LessThan requires the field to be less than the value, "field<value".
+	LessThan Operator = "<"
+)
+
+// Requirement is a single term of a selector. GreaterThan and LessThan compare the field
+// and the value as integers.
+type Requirement struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+// Matches returns true if the field in fields satisfies the requirement. A field which
+// isn't in fields, or isn't an integer when compared as one, never matches.
+func (r Requirement) Matches(fields Set) bool {
+	actual, ok := fields[r.Field]
+	if !ok {
+		return false
+	}
+	switch r.Operator {
+	case Equals:
+		return actual == r.Value
+	case NotEquals:
+		return actual != r.Value
+	case GreaterThan, LessThan:
+		a, err := strconv.Atoi(actual)
+		if err != nil {
+			return false
+		}
+		// The value was checked by Parse.
+		v, _ := strconv.Atoi(r.Value)
+		if r.Operator == GreaterThan {
+			return a > v
+		}
+		return a < v
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	return r.Field + string(r.Operator) + r.Value
+}
+
+// Selector matches the objects whose fields satisfy all of its requirements. A nil or
+// empty Selector matches everything.
+type Selector []Requirement
+
+// Everything returns a selector which matches all objects.
+func Everything() Selector {
+	return nil
+}
+
+// Matches returns true if fields satisfy every requirement of the selector.
+func (s Selector) Matches(fields Set) bool {
+	for _, r := range s {
+		if !r.Matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector matches everything.
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// Supported returns an error naming the first field the selector requires which isn't in
+// fields, the set of fields of the objects it is applied to.
+func (s Selector) Supported(fields Set) error {
+	for _, r := range s {
+		if _, ok := fields[r.Field]; !ok {
+			return fmt.Errorf("field %q can't be selected on", r.Field)
+		}
+	}
+	return nil
+}
+
+// String returns the selector in the form Parse reads.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, r := range s {
+		terms = append(terms, r.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+// Parse reads a selector: a comma separated list of terms of the form "field=value",
+// "field!=value", "field>value" or "field<value". The values of > and < must be integers.
+// The empty string selects everything.
+func Parse(selector string) (Selector, error) {
+	result := Selector{}
+	if len(strings.TrimSpace(selector)) == 0 {
+		return result, nil
+	}
+	for _, term := range strings.Split(selector, ",") {
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field selector %q: %v", selector, err)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	i := strings.IndexAny(term, "!=<>")
+	if i == -1 {
+		return Requirement{}, fmt.Errorf("%q has no operator", term)
+	}
+	op := Operator(term[i : i+1])
+	if strings.HasPrefix(term[i:], string(NotEquals)) {
+		op = NotEquals
+	} else if op == "!" {
+		return Requirement{}, fmt.Errorf("%q has no operator", term)
+	}
+	r := Requirement{
+		Field:    strings.TrimSpace(term[:i]),
+		Operator: op,
+		Value:    strings.TrimSpace(term[i+len(op):]),
+	}
+	if len(r.Field) == 0 {
+		return r, fmt.Errorf("%q doesn't name a field", term)
+	}
+	if op == GreaterThan || op == LessThan {
+		if _, err := strconv.Atoi(r.Value); err != nil {
+			return r, fmt.Errorf("%q must compare with an integer", term)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,82 @@
+package fields
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	selector, err := Parse("currentState.host=machine1, currentState.status!=Running,desiredState.replicas>0,port<1024")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Selector{
+		{"currentState.host", Equals, "machine1"},
+		{"currentState.status", NotEquals, "Running"},
+		{"desiredState.replicas", GreaterThan, "0"},
+		{"port", LessThan, "1024"},
+	}
+	if !reflect.DeepEqual(selector, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, selector)
+	}
+	if s := selector.String(); s != "currentState.host=machine1,currentState.status!=Running,desiredState.replicas>0,port<1024" {
+		t.Errorf("Unexpected string: %s", s)
+	}
+
+	if selector, err := Parse(" "); err != nil || !selector.Empty() {
+		t.Errorf("Expected an empty selector, got %#v %v", selector, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, selector := range []string{
+		"host",
+		"=machine1",
+		"host!machine1",
+		"host=machine1,",
+		"replicas>many",
+		"replicas<",
+	} {
+		if _, err := Parse(selector); err == nil {
+			t.Errorf("Expected an error parsing %q", selector)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	fields := Set{"currentState.host": "machine1", "desiredState.replicas": "2", "id": "foo"}
+	table := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"currentState.host=machine1", true},
+		{"currentState.host=machine2", false},
+		{"currentState.host!=machine2,id=foo", true},
+		{"desiredState.replicas>0", true},
+		{"desiredState.replicas>2", false},
+		{"desiredState.replicas<3", true},
+		{"id>0", false},
+		{"missing=", false},
+	}
+	for _, item := range table {
+		selector, err := Parse(item.selector)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", item.selector, err)
+			continue
+		}
+		if selector.Matches(fields) != item.matches {
+			t.Errorf("Expected %q matching %v to be %v", item.selector, fields, item.matches)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	selector, _ := Parse("id=foo,currentState.host=machine1")
+	if err := selector.Supported(Set{"id": "", "currentState.host": ""}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := selector.Supported(Set{"id": ""}); err == nil {
+		t.Errorf("Expected an error for an unsupported field")
+	}
+}
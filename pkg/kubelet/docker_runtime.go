@@ -0,0 +1,332 @@
+package kubelet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/stream"
+)
+
+// State, sub object of the Docker JSON data
+type State struct {
+	Running bool
+}
+
+// The structured representation of the JSON object returned by Docker inspect
+type DockerContainerData struct {
+	state State
+}
+
+// Interface for testability
+type DockerInterface interface {
+	ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error)
+	InspectContainer(id string) (*docker.Container, error)
+	CreateContainer(docker.CreateContainerOptions) (*docker.Container, error)
+	StartContainer(id string, hostConfig *docker.HostConfig) error
+	StopContainer(id string, timeout uint) error
+	Logs(opts docker.LogsOptions) error
+	CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error)
+	StartExec(id string, opts docker.StartExecOptions) error
+	ResizeExecTTY(id string, height, width int) error
+	InspectExec(id string) (*docker.ExecInspect, error)
+	InspectImage(name string) (*docker.Image, error)
+	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
+}
+
+// DockerRuntime runs containers with a Docker daemon. The manifest and container a
+// docker container was created for are kept in its name.
+type DockerRuntime struct {
+	client DockerInterface
+	// Credentials, if not nil, are the credentials images are pulled with, by registry.
+	Credentials *docker.AuthConfigurations
+}
+
+func NewDockerRuntime(client DockerInterface) *DockerRuntime {
+	return &DockerRuntime{client: client}
+}
+
+// dockerHubRegistry is the registry of images which don't name one.
+const dockerHubRegistry = "index.docker.io"
+
+// imageRegistry returns the host of the registry image is pulled from.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return dockerHubRegistry
+}
+
+// registryHost returns the host of a registry as credentials name it, which may be a URL
+// such as https://index.docker.io/v1/.
+func registryHost(registry string) string {
+	if index := strings.Index(registry, "://"); index >= 0 {
+		registry = registry[index+3:]
+	}
+	registry = strings.SplitN(registry, "/", 2)[0]
+	switch registry {
+	case "docker.io", "registry-1.docker.io":
+		return dockerHubRegistry
+	}
+	return registry
+}
+
+// credentials returns the credentials to pull image with, which are empty if there are none.
+func (r *DockerRuntime) credentials(image string) docker.AuthConfiguration {
+	if r.Credentials == nil {
+		return docker.AuthConfiguration{}
+	}
+	registry := imageRegistry(image)
+	for name, auth := range r.Credentials.Configs {
+		if registryHost(name) == registry {
+			return auth
+		}
+	}
+	return docker.AuthConfiguration{}
+}
+
+func (r *DockerRuntime) ImagePresent(image string) (bool, error) {
+	_, err := r.client.InspectImage(image)
+	if err == docker.ErrNoSuchImage {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DockerRuntime) PullImage(image string, progress io.Writer) error {
+	options := docker.PullImageOptions{
+		Repository:   image,
+		OutputStream: progress,
+	}
+	// Docker pulls every tag of a repository pulled without one, so the default is
+	// spelled out. Digests are split off by the client.
+	if !strings.Contains(image, "@") {
+		options.Repository, options.Tag = docker.ParseRepositoryTag(image)
+		if len(options.Tag) == 0 {
+			options.Tag = "latest"
+		}
+	}
+	return r.client.PullImage(options, r.credentials(image))
+}
+
+// Converts "-" to "_-_" and "_" to "___" so that we can use "--" to meaningfully separate parts of a docker name.
+func escapeDash(in string) (out string) {
+	out = strings.Replace(in, "_", "___", -1)
+	out = strings.Replace(out, "-", "_-_", -1)
+	return
+}
+
+// Reverses the transformation of escapeDash.
+func unescapeDash(in string) (out string) {
+	out = strings.Replace(in, "_-_", "-", -1)
+	out = strings.Replace(out, "___", "_", -1)
+	return
+}
+
+// Creates a name which can be reversed to identify both manifest id and container name.
+func manifestAndContainerToDockerName(manifest *api.ContainerManifest, container *api.Container) string {
+	// Note, manifest.Id could be blank.
+	return fmt.Sprintf("%s--%s--%x", escapeDash(container.Name), escapeDash(manifest.Id), rand.Uint32())
+}
+
+// Upacks a container name, returning the manifest id and container name we would have used to
+// construct the docker name. If the docker name isn't one we created, we may return empty strings.
+func dockerNameToManifestAndContainer(name string) (manifestId, containerName string) {
+	// For some reason docker appears to be appending '/' to names.
+	// If its there, strip it.
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	parts := strings.Split(name, "--")
+	if len(parts) > 0 {
+		containerName = unescapeDash(parts[0])
+	}
+	if len(parts) > 1 {
+		manifestId = unescapeDash(parts[1])
+	}
+	return
+}
+
+func (r *DockerRuntime) CreateContainer(manifest *api.ContainerManifest, container *api.Container) (string, error) {
+	envVariables := []string{}
+	for _, value := range container.Env {
+		envVariables = append(envVariables, fmt.Sprintf("%s=%s", value.Name, value.Value))
+	}
+
+	volumes := map[string]struct{}{}
+	binds := []string{}
+	for _, volume := range container.VolumeMounts {
+		volumes[volume.MountPath] = struct{}{}
+		basePath := "/exports/" + volume.Name + ":" + volume.MountPath
+		if volume.ReadOnly {
+			basePath += ":ro"
+		}
+		binds = append(binds, basePath)
+	}
+
+	exposedPorts := map[docker.Port]struct{}{}
+	portBindings := map[docker.Port][]docker.PortBinding{}
+	for _, port := range container.Ports {
+		interiorPort := port.ContainerPort
+		exteriorPort := port.HostPort
+		// Some of this port stuff is under-documented voodoo.
+		// See http://stackoverflow.com/questions/20428302/binding-a-port-to-a-host-interface-using-the-rest-api
+		protocol := "tcp"
+		if len(port.Protocol) > 0 {
+			protocol = strings.ToLower(port.Protocol)
+		}
+		dockerPort := docker.Port(strconv.Itoa(interiorPort) + "/" + protocol)
+		exposedPorts[dockerPort] = struct{}{}
+		portBindings[dockerPort] = []docker.PortBinding{
+			docker.PortBinding{
+				HostPort: strconv.Itoa(exteriorPort),
+			},
+		}
+	}
+	cmdList := []string(container.Command)
+	opts := docker.CreateContainerOptions{
+		Name: manifestAndContainerToDockerName(manifest, container),
+		Config: &docker.Config{
+			Image:        container.Image,
+			ExposedPorts: exposedPorts,
+			Env:          envVariables,
+			Volumes:      volumes,
+			WorkingDir:   container.WorkingDir,
+			Cmd:          cmdList,
+		},
+		// The host configuration is given on create, so that starting needs nothing more.
+		HostConfig: &docker.HostConfig{
+			PortBindings: portBindings,
+			Binds:        binds,
+		},
+	}
+	dockerContainer, err := r.client.CreateContainer(opts)
+	if err != nil {
+		return "", err
+	}
+	return dockerContainer.ID, nil
+}
+
+func (r *DockerRuntime) StartContainer(id string) error {
+	return r.client.StartContainer(id, nil)
+}
+
+func (r *DockerRuntime) StopContainer(id string, timeout time.Duration) error {
+	return r.client.StopContainer(id, uint(timeout/time.Second))
+}
+
+func (r *DockerRuntime) ListContainers(all bool) ([]RuntimeContainer, error) {
+	containerList, err := r.client.ListContainers(docker.ListContainersOptions{All: all})
+	if err != nil {
+		return nil, err
+	}
+	result := []RuntimeContainer{}
+	for _, value := range containerList {
+		if len(value.Names) == 0 {
+			continue
+		}
+		manifestID, name := dockerNameToManifestAndContainer(value.Names[0])
+		result = append(result, RuntimeContainer{
+			ID:         value.ID,
+			ManifestID: manifestID,
+			Name:       name,
+			Running:    value.State == "running" || strings.HasPrefix(value.Status, "Up"),
+		})
+	}
+	return result, nil
+}
+
+func (r *DockerRuntime) InspectContainer(id string) (interface{}, error) {
+	container, err := r.client.InspectContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	return container, nil
+}
+
+func (r *DockerRuntime) ExitStatus(id string) (ContainerExit, error) {
+	container, err := r.client.InspectContainer(id)
+	if err != nil {
+		return ContainerExit{}, err
+	}
+	return ContainerExit{
+		ExitCode:   container.State.ExitCode,
+		OOMKilled:  container.State.OOMKilled,
+		FinishedAt: container.State.FinishedAt,
+	}, nil
+}
+
+func (r *DockerRuntime) ContainerLogs(ctx context.Context, id string, options LogOptions, stdout, stderr io.Writer) error {
+	return r.client.Logs(docker.LogsOptions{
+		Context:      ctx,
+		Container:    id,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Tail:         options.Tail,
+		Follow:       options.Follow,
+		Timestamps:   options.Timestamps,
+		Stdout:       true,
+		Stderr:       true,
+	})
+}
+
+func (r *DockerRuntime) RunInContainer(id string, command []string, tty bool, stdin io.Reader, stdout, stderr io.Writer, resize <-chan stream.TerminalSize) (int, error) {
+	exec, err := r.client.CreateExec(docker.CreateExecOptions{
+		Container:    id,
+		Cmd:          command,
+		Tty:          tty,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	go func() {
+		for size := range resize {
+			if !tty {
+				continue
+			}
+			if err := r.client.ResizeExecTTY(exec.ID, int(size.Height), int(size.Width)); err != nil {
+				log.Printf("Error resizing the terminal of exec %s: %v", exec.ID, err)
+			}
+		}
+	}()
+	err = r.client.StartExec(exec.ID, docker.StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Tty:          tty,
+		RawTerminal:  tty,
+	})
+	if err != nil {
+		return 0, err
+	}
+	inspect, err := r.client.InspectExec(exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// DialContainerPort connects to port of the container id at the container's own address,
+// so the port needn't be published on the host.
+func (r *DockerRuntime) DialContainerPort(id string, port int) (net.Conn, error) {
+	container, err := r.client.InspectContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	if container.NetworkSettings == nil || len(container.NetworkSettings.IPAddress) == 0 {
+		return nil, fmt.Errorf("container %s has no address", id)
+	}
+	return net.DialTimeout("tcp", net.JoinHostPort(container.NetworkSettings.IPAddress, strconv.Itoa(port)), 10*time.Second)
+}
@@ -0,0 +1,240 @@
+package kubelet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"k8s-firstcommit/pkg/api"
+)
+
+type FakeDockerClient struct {
+	containerList []docker.APIContainers
+	container     *docker.Container
+	err           error
+	called        []string
+	logs          string
+	logsOptions   docker.LogsOptions
+	execOptions   docker.CreateExecOptions
+	execExitCode  int
+	// images are the images present; pulled ones are added.
+	images      []string
+	pullOptions docker.PullImageOptions
+	pullAuth    docker.AuthConfiguration
+	// resized, if not nil, gets the height and width of every exec terminal resize.
+	resized chan [2]int
+}
+
+func (f *FakeDockerClient) clearCalls() {
+	f.called = []string{}
+}
+
+func (f *FakeDockerClient) appendCall(call string) {
+	f.called = append(f.called, call)
+}
+
+func (f *FakeDockerClient) ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error) {
+	f.appendCall("list")
+	return f.containerList, f.err
+}
+
+func (f *FakeDockerClient) InspectContainer(id string) (*docker.Container, error) {
+	f.appendCall("inspect")
+	return f.container, f.err
+}
+
+func (f *FakeDockerClient) CreateContainer(docker.CreateContainerOptions) (*docker.Container, error) {
+	f.appendCall("create")
+	return &docker.Container{}, f.err
+}
+
+func (f *FakeDockerClient) StartContainer(id string, hostConfig *docker.HostConfig) error {
+	f.appendCall("start")
+	return nil
+}
+
+func (f *FakeDockerClient) StopContainer(id string, timeout uint) error {
+	f.appendCall("stop")
+	return f.err
+}
+
+func (f *FakeDockerClient) Logs(opts docker.LogsOptions) error {
+	f.appendCall("logs")
+	f.logsOptions = opts
+	opts.OutputStream.Write([]byte(f.logs))
+	return f.err
+}
+
+func (f *FakeDockerClient) CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error) {
+	f.appendCall("create_exec")
+	f.execOptions = opts
+	return &docker.Exec{ID: "exec"}, f.err
+}
+
+// StartExec runs cat: it copies the input, if there is one, to the output.
+func (f *FakeDockerClient) StartExec(id string, opts docker.StartExecOptions) error {
+	f.appendCall("start_exec")
+	if opts.InputStream != nil {
+		io.Copy(opts.OutputStream, opts.InputStream)
+	}
+	return f.err
+}
+
+func (f *FakeDockerClient) ResizeExecTTY(id string, height, width int) error {
+	if f.resized != nil {
+		f.resized <- [2]int{height, width}
+	}
+	return f.err
+}
+
+func (f *FakeDockerClient) InspectExec(id string) (*docker.ExecInspect, error) {
+	f.appendCall("inspect_exec")
+	return &docker.ExecInspect{ID: id, ExitCode: f.execExitCode}, f.err
+}
+
+func verifyCalls(t *testing.T, fakeDocker FakeDockerClient, calls []string) {
+	verifyStringArrayEquals(t, fakeDocker.called, calls)
+}
+
+func (f *FakeDockerClient) InspectImage(name string) (*docker.Image, error) {
+	f.appendCall("inspect_image")
+	for _, image := range f.images {
+		if image == name {
+			return &docker.Image{ID: name}, f.err
+		}
+	}
+	return nil, docker.ErrNoSuchImage
+}
+
+func (f *FakeDockerClient) PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error {
+	f.appendCall("pull")
+	f.pullOptions = opts
+	f.pullAuth = auth
+	fmt.Fprintf(opts.OutputStream, "%s: Pulling from library\n", opts.Tag)
+	f.images = append(f.images, opts.Repository+":"+opts.Tag)
+	return f.err
+}
+
+func verifyPackUnpack(t *testing.T, manifestId, containerName string) {
+	name := manifestAndContainerToDockerName(
+		&api.ContainerManifest{Id: manifestId},
+		&api.Container{Name: containerName},
+	)
+	returnedManifestId, returnedContainerName := dockerNameToManifestAndContainer(name)
+	if manifestId != returnedManifestId || containerName != returnedContainerName {
+		t.Errorf("For (%s, %s), unpacked (%s, %s)", manifestId, containerName, returnedManifestId, returnedContainerName)
+	}
+}
+
+func TestContainerManifestNaming(t *testing.T) {
+	verifyPackUnpack(t, "manifest1234", "container5678")
+	verifyPackUnpack(t, "manifest--", "container__")
+	verifyPackUnpack(t, "--manifest", "__container")
+	verifyPackUnpack(t, "m___anifest_", "container-_-")
+	verifyPackUnpack(t, "_m___anifest", "-_-container")
+}
+
+func TestDockerListContainers(t *testing.T) {
+	fakeDocker := FakeDockerClient{
+		err: nil,
+	}
+	runtime := NewDockerRuntime(&fakeDocker)
+	fakeDocker.containerList = []docker.APIContainers{
+		docker.APIContainers{
+			Names:  []string{"/foo--qux--1234"},
+			ID:     "1234",
+			Status: "Up 2 minutes",
+		},
+		docker.APIContainers{
+			Names:  []string{"/bar--qux--5678"},
+			ID:     "5678",
+			Status: "Exited (0) 3 minutes ago",
+		},
+	}
+
+	containers, err := runtime.ListContainers(true)
+	verifyNoError(t, err)
+	verifyCalls(t, fakeDocker, []string{"list"})
+	if len(containers) != 2 ||
+		containers[0] != (RuntimeContainer{ID: "1234", ManifestID: "qux", Name: "foo", Running: true}) ||
+		containers[1] != (RuntimeContainer{ID: "5678", ManifestID: "qux", Name: "bar", Running: false}) {
+		t.Errorf("Unexpected containers: %#v", containers)
+	}
+}
+
+func TestDockerImagePresent(t *testing.T) {
+	fakeDocker := FakeDockerClient{
+		images: []string{"dockerfile/redis"},
+	}
+	runtime := NewDockerRuntime(&fakeDocker)
+
+	present, err := runtime.ImagePresent("dockerfile/redis")
+	verifyNoError(t, err)
+	if !present {
+		t.Errorf("Expected dockerfile/redis to be present")
+	}
+	present, err = runtime.ImagePresent("dockerfile/nginx")
+	verifyNoError(t, err)
+	if present {
+		t.Errorf("Expected dockerfile/nginx not to be present")
+	}
+	verifyCalls(t, fakeDocker, []string{"inspect_image", "inspect_image"})
+}
+
+func TestDockerExitStatus(t *testing.T) {
+	finished := time.Now()
+	fakeDocker := FakeDockerClient{
+		container: &docker.Container{
+			ID:    "1234",
+			State: docker.State{ExitCode: 137, OOMKilled: true, FinishedAt: finished},
+		},
+	}
+	runtime := NewDockerRuntime(&fakeDocker)
+
+	exit, err := runtime.ExitStatus("1234")
+	verifyNoError(t, err)
+	if exit != (ContainerExit{ExitCode: 137, OOMKilled: true, FinishedAt: finished}) {
+		t.Errorf("Unexpected exit: %#v", exit)
+	}
+	verifyCalls(t, fakeDocker, []string{"inspect"})
+}
+
+func TestDockerPullImage(t *testing.T) {
+	fakeDocker := FakeDockerClient{}
+	runtime := NewDockerRuntime(&fakeDocker)
+	hubAuth := docker.AuthConfiguration{Username: "hub", Password: "secret"}
+	privateAuth := docker.AuthConfiguration{Username: "private", Password: "secret"}
+	runtime.Credentials = &docker.AuthConfigurations{
+		Configs: map[string]docker.AuthConfiguration{
+			"https://index.docker.io/v1/": hubAuth,
+			"registry.example.com:5000":   privateAuth,
+		},
+	}
+
+	for _, test := range []struct {
+		image      string
+		repository string
+		tag        string
+		auth       docker.AuthConfiguration
+	}{
+		{"dockerfile/redis", "dockerfile/redis", "latest", hubAuth},
+		{"redis:2.8", "redis", "2.8", hubAuth},
+		{"registry.example.com:5000/redis", "registry.example.com:5000/redis", "latest", privateAuth},
+		{"registry.example.com:5000/redis:2.8", "registry.example.com:5000/redis", "2.8", privateAuth},
+		{"other.example.com/redis@sha256:1234", "other.example.com/redis@sha256:1234", "", docker.AuthConfiguration{}},
+	} {
+		var progress bytes.Buffer
+		verifyNoError(t, runtime.PullImage(test.image, &progress))
+		options := fakeDocker.pullOptions
+		if options.Repository != test.repository || options.Tag != test.tag || fakeDocker.pullAuth != test.auth {
+			t.Errorf("Unexpected pull of %s: %#v with %#v", test.image, options, fakeDocker.pullAuth)
+		}
+		verifyStringEquals(t, progress.String(), test.tag+": Pulling from library\n")
+	}
+
+	fakeDocker.err = fmt.Errorf("Sample Error")
+	verifyError(t, runtime.PullImage("redis", &bytes.Buffer{}))
+}
@@ -2,54 +2,48 @@ package kubelet
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
 	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/coreos/go-etcd/etcd"
-	"github.com/fsouza/go-dockerclient"
 	//"gopkg.in/v1/yaml"
 	"gopkg.in/yaml.v2"
 	"k8s-firstcommit/pkg/api"
 	"k8s-firstcommit/pkg/registry"
+	"k8s-firstcommit/pkg/stream"
 	"k8s-firstcommit/pkg/util"
 )
 
-// State, sub object of the Docker JSON data
-type State struct {
-	Running bool
-}
-
-// The structured representation of the JSON object returned by Docker inspect
-type DockerContainerData struct {
-	state State
-}
-
-// Interface for testability
-type DockerInterface interface {
-	ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error)
-	InspectContainer(id string) (*docker.Container, error)
-	CreateContainer(docker.CreateContainerOptions) (*docker.Container, error)
-	StartContainer(id string, hostConfig *docker.HostConfig) error
-	StopContainer(id string, timeout uint) error
-}
-
 // The main kubelet implementation
 type Kubelet struct {
 	Client             registry.EtcdClient
-	DockerClient       DockerInterface
+	Runtime            ContainerRuntime
 	FileCheckFrequency time.Duration
 	SyncFrequency      time.Duration
 	HTTPCheckFrequency time.Duration
-	pullLock           sync.Mutex
+
+	lock sync.Mutex
+	// hostname is this host's name in etcd, once known.
+	hostname string
+	// manifests are the manifests last synced, whose containers are probed.
+	manifests []api.ContainerManifest
+	// probes are the states of the probes of the running containers, by ID.
+	probes map[string]*probeState
+	// restarts are the restart states of the containers of manifests.
+	restarts map[containerKey]*restartState
+	// lastStatuses are the task statuses last recorded in etcd, at lastRecorded.
+	lastStatuses map[string]registry.TaskStatus
+	lastRecorded time.Time
 }
 
 // Starts background goroutines. If file, manifest_url, or address are empty,
@@ -70,6 +64,7 @@ func (sl *Kubelet) RunKubelet(file, manifest_url, etcd_servers, address string,
 		sl.Client = etcd.NewClient(servers)
 		go util.Forever(func() { sl.SyncAndSetupEtcdWatch(etcdChannel) }, 20*time.Second)
 	}
+	go util.Forever(func() { sl.RunProbes() }, probeCheckPeriod)
 	if address != "" {
 		log.Printf("Starting to listen on %s:%d", address, port)
 		handler := KubeletServer{
@@ -117,186 +112,191 @@ func (sl *Kubelet) LogEvent(event *api.Event) error {
 	return err
 }
 
-// Does this container exist on this host? Returns true if so, and the name under which the container is running.
+// Does this container exist on this host? Returns true if so, and the ID of the running container.
 // Returns an error if one occurs.
-func (sl *Kubelet) ContainerExists(manifest *api.ContainerManifest, container *api.Container) (exists bool, foundName string, err error) {
-	containers, err := sl.ListContainers()
+func (sl *Kubelet) ContainerExists(manifest *api.ContainerManifest, container *api.Container) (exists bool, id string, err error) {
+	containers, err := sl.Runtime.ListContainers(false)
 	if err != nil {
 		return false, "", err
 	}
-	for _, name := range containers {
-		manifestId, containerName := dockerNameToManifestAndContainer(name)
-		if manifestId == manifest.Id && containerName == container.Name {
-			// TODO(bburns) : This leads to an extra list.  Convert this to use the returned ID and a straight call
-			// to inspect
-			data, err := sl.GetContainerByName(name)
-			return data != nil, name, err
+	for _, value := range containers {
+		if value.ManifestID == manifest.Id && value.Name == container.Name {
+			return true, value.ID, nil
 		}
 	}
 	return false, "", nil
 }
 
+// GetContainerID returns the ID of a running container which is either named name, has
+// the ID name, or was started for the manifest name.
 func (sl *Kubelet) GetContainerID(name string) (string, error) {
-	containerList, err := sl.DockerClient.ListContainers(docker.ListContainersOptions{})
+	containers, err := sl.Runtime.ListContainers(false)
 	if err != nil {
 		return "", err
 	}
-	for _, value := range containerList {
-		if strings.Contains(value.Names[0], name) {
+	for _, value := range containers {
+		if value.ID == name || value.Name == name || value.ManifestID == name {
 			return value.ID, nil
 		}
 	}
 	return "", fmt.Errorf("couldn't find name: %s", name)
 }
 
-// Get a container by name.
-// returns the container data from Docker, or an error if one exists.
-func (sl *Kubelet) GetContainerByName(name string) (*docker.Container, error) {
-	id, err := sl.GetContainerID(name)
+// GetManifestContainerID returns the ID of the container named containerName which was
+// started for the manifest manifestID. Stopped containers count too, so that the logs
+// of a crashed container can still be read; the newest is found first.
+func (sl *Kubelet) GetManifestContainerID(manifestID, containerName string) (string, error) {
+	containers, err := sl.Runtime.ListContainers(true)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	for _, value := range containers {
+		if value.ManifestID == manifestID && value.Name == containerName {
+			return value.ID, nil
+		}
 	}
-	return sl.DockerClient.InspectContainer(id)
+	return "", fmt.Errorf("couldn't find container %s of manifest %s", containerName, manifestID)
 }
 
-func (sl *Kubelet) ListContainers() ([]string, error) {
-	result := []string{}
-	containerList, err := sl.DockerClient.ListContainers(docker.ListContainersOptions{})
-	if err != nil {
-		return result, err
+// GetContainerLogs copies the output of the container id to stdout and stderr.
+func (sl *Kubelet) GetContainerLogs(ctx context.Context, id string, options LogOptions, stdout, stderr io.Writer) error {
+	return sl.Runtime.ContainerLogs(ctx, id, options, stdout, stderr)
+}
+
+// ExecInContainer runs command in the container id, if the runtime can (see CommandRunner).
+func (sl *Kubelet) ExecInContainer(id string, command []string, tty bool, stdin io.Reader, stdout, stderr io.Writer, resize <-chan stream.TerminalSize) (int, error) {
+	runner, ok := sl.Runtime.(CommandRunner)
+	if !ok {
+		return 0, fmt.Errorf("the container runtime can't run commands in containers")
 	}
-	for _, value := range containerList {
-		result = append(result, value.Names[0])
+	return runner.RunInContainer(id, command, tty, stdin, stdout, stderr, resize)
+}
+
+// DialContainerPort connects to port of the container id, if the runtime can (see PortDialer).
+func (sl *Kubelet) DialContainerPort(id string, port int) (net.Conn, error) {
+	dialer, ok := sl.Runtime.(PortDialer)
+	if !ok {
+		return nil, fmt.Errorf("the container runtime can't connect to container ports")
 	}
-	return result, err
+	return dialer.DialContainerPort(id, port)
 }
 
-func (sl *Kubelet) pullImage(image string) error {
-	sl.pullLock.Lock()
-	defer sl.pullLock.Unlock()
-	cmd := exec.Command("docker", "pull", image)
-	err := cmd.Start()
-	if err != nil {
-		return err
+// pullProgressPeriod is how often the progress of a pull is logged as an event.
+const pullProgressPeriod = 10 * time.Second
+
+// pullPolicy returns the pull policy of container, or its default.
+func pullPolicy(container *api.Container) api.PullPolicy {
+	if len(container.ImagePullPolicy) > 0 {
+		return container.ImagePullPolicy
 	}
-	return cmd.Wait()
+	image := container.Image
+	if strings.Contains(image, "@") {
+		// Pulled by digest, so it can't change.
+		return api.PullIfNotPresent
+	}
+	// The tag follows the last colon, unless that's the port of the registry.
+	if index := strings.LastIndex(image, ":"); index < 0 || strings.Contains(image[index:], "/") || image[index+1:] == "latest" {
+		return api.PullAlways
+	}
+	return api.PullIfNotPresent
 }
 
-// Converts "-" to "_-_" and "_" to "___" so that we can use "--" to meaningfully separate parts of a docker name.
-func escapeDash(in string) (out string) {
-	out = strings.Replace(in, "_", "___", -1)
-	out = strings.Replace(out, "-", "_-_", -1)
-	return
+// logPullEvent logs an event about pulling the image of container.
+func (sl *Kubelet) logPullEvent(event string, manifest *api.ContainerManifest, container *api.Container, message string) {
+	sl.LogEvent(&api.Event{
+		Event: event,
+		Manifest: &api.ContainerManifest{
+			Id: manifest.Id,
+		},
+		Container: &api.Container{
+			Name:  container.Name,
+			Image: container.Image,
+		},
+		Message: message,
+	})
 }
 
-// Reverses the transformation of escapeDash.
-func unescapeDash(in string) (out string) {
-	out = strings.Replace(in, "_-_", "-", -1)
-	out = strings.Replace(out, "___", "_", -1)
-	return
+// pullProgress logs the progress of a pull as PULLING events, at most one every
+// pullProgressPeriod, with the last line written.
+type pullProgress struct {
+	kubelet   *Kubelet
+	manifest  *api.ContainerManifest
+	container *api.Container
+	partial   []byte
+	lastEvent time.Time
 }
 
-// Creates a name which can be reversed to identify both manifest id and container name.
-func manifestAndContainerToDockerName(manifest *api.ContainerManifest, container *api.Container) string {
-	// Note, manifest.Id could be blank.
-	return fmt.Sprintf("%s--%s--%x", escapeDash(container.Name), escapeDash(manifest.Id), rand.Uint32())
+func (p *pullProgress) Write(data []byte) (int, error) {
+	p.partial = append(p.partial, data...)
+	for {
+		end := bytes.IndexByte(p.partial, '\n')
+		if end < 0 {
+			return len(data), nil
+		}
+		line := strings.TrimSpace(string(p.partial[:end]))
+		p.partial = p.partial[end+1:]
+		if len(line) > 0 && time.Since(p.lastEvent) >= pullProgressPeriod {
+			p.lastEvent = time.Now()
+			p.kubelet.logPullEvent("PULLING", p.manifest, p.container, line)
+		}
+	}
 }
 
-// Upacks a container name, returning the manifest id and container name we would have used to
-// construct the docker name. If the docker name isn't one we created, we may return empty strings.
-func dockerNameToManifestAndContainer(name string) (manifestId, containerName string) {
-	// For some reason docker appears to be appending '/' to names.
-	// If its there, strip it.
-	if name[0] == '/' {
-		name = name[1:]
+// pullImage pulls the image of container if its pull policy says so. The pull, its
+// progress and its outcome are logged as events.
+func (sl *Kubelet) pullImage(manifest *api.ContainerManifest, container *api.Container) error {
+	policy := pullPolicy(container)
+	if policy != api.PullAlways {
+		present, err := sl.Runtime.ImagePresent(container.Image)
+		if err != nil {
+			return err
+		}
+		if present {
+			return nil
+		}
+		if policy == api.PullNever {
+			err := fmt.Errorf("image %s isn't present, and its pull policy is %s", container.Image, policy)
+			sl.logPullEvent("PULL_FAILED", manifest, container, err.Error())
+			return err
+		}
 	}
-	parts := strings.Split(name, "--")
-	if len(parts) > 0 {
-		containerName = unescapeDash(parts[0])
+	sl.logPullEvent("PULL", manifest, container, fmt.Sprintf("Pulling image %s", container.Image))
+	progress := &pullProgress{
+		kubelet:   sl,
+		manifest:  manifest,
+		container: container,
+		lastEvent: time.Now(),
 	}
-	if len(parts) > 1 {
-		manifestId = unescapeDash(parts[1])
+	if err := sl.Runtime.PullImage(container.Image, progress); err != nil {
+		sl.logPullEvent("PULL_FAILED", manifest, container, err.Error())
+		return err
 	}
-	return
+	sl.logPullEvent("PULLED", manifest, container, fmt.Sprintf("Pulled image %s", container.Image))
+	return nil
 }
 
-func (sl *Kubelet) RunContainer(manifest *api.ContainerManifest, container *api.Container) (name string, err error) {
-	err = sl.pullImage(container.Image)
+// RunContainer creates and starts a container for container of manifest, and returns its ID.
+func (sl *Kubelet) RunContainer(manifest *api.ContainerManifest, container *api.Container) (id string, err error) {
+	err = sl.pullImage(manifest, container)
 	if err != nil {
 		return "", err
 	}
-
-	name = manifestAndContainerToDockerName(manifest, container)
-	envVariables := []string{}
-	for _, value := range container.Env {
-		envVariables = append(envVariables, fmt.Sprintf("%s=%s", value.Name, value.Value))
-	}
-
-	volumes := map[string]struct{}{}
-	binds := []string{}
-	for _, volume := range container.VolumeMounts {
-		volumes[volume.MountPath] = struct{}{}
-		basePath := "/exports/" + volume.Name + ":" + volume.MountPath
-		if volume.ReadOnly {
-			basePath += ":ro"
-		}
-		binds = append(binds, basePath)
-	}
-
-	exposedPorts := map[docker.Port]struct{}{}
-	portBindings := map[docker.Port][]docker.PortBinding{}
-	for _, port := range container.Ports {
-		interiorPort := port.ContainerPort
-		exteriorPort := port.HostPort
-		// Some of this port stuff is under-documented voodoo.
-		// See http://stackoverflow.com/questions/20428302/binding-a-port-to-a-host-interface-using-the-rest-api
-		dockerPort := docker.Port(strconv.Itoa(interiorPort) + "/tcp")
-		exposedPorts[dockerPort] = struct{}{}
-		portBindings[dockerPort] = []docker.PortBinding{
-			docker.PortBinding{
-				HostPort: strconv.Itoa(exteriorPort),
-			},
-		}
-	}
-	var cmdList []string
-	if len(container.Command) > 0 {
-		cmdList = strings.Split(container.Command, " ")
-	}
-	opts := docker.CreateContainerOptions{
-		Name: name,
-		Config: &docker.Config{
-			Image:        container.Image,
-			ExposedPorts: exposedPorts,
-			Env:          envVariables,
-			Volumes:      volumes,
-			WorkingDir:   container.WorkingDir,
-			Cmd:          cmdList,
-		},
-	}
-	dockerContainer, err := sl.DockerClient.CreateContainer(opts)
+	id, err = sl.Runtime.CreateContainer(manifest, container)
 	if err != nil {
 		return "", err
 	}
-	return name, sl.DockerClient.StartContainer(dockerContainer.ID, &docker.HostConfig{
-		PortBindings: portBindings,
-		Binds:        binds,
-	})
+	return id, sl.Runtime.StartContainer(id)
 }
 
-func (sl *Kubelet) KillContainer(name string) error {
-	id, err := sl.GetContainerID(name)
-	if err != nil {
-		return err
-	}
-	err = sl.DockerClient.StopContainer(id, 10)
-	manifestId, containerName := dockerNameToManifestAndContainer(name)
+func (sl *Kubelet) KillContainer(container RuntimeContainer) error {
+	err := sl.Runtime.StopContainer(container.ID, 10*time.Second)
 	sl.LogEvent(&api.Event{
 		Event: "STOP",
 		Manifest: &api.ContainerManifest{
-			Id: manifestId,
+			Id: container.ManifestID,
 		},
 		Container: &api.Container{
-			Name: containerName,
+			Name: container.Name,
 		},
 	})
 
@@ -416,6 +416,9 @@ func (sl *Kubelet) SyncAndSetupEtcdWatch(changeChannel chan<- []api.ContainerMan
 		log.Printf("Couldn't determine hostname : %v", err)
 		return
 	}
+	sl.lock.Lock()
+	sl.hostname = strings.TrimSpace(string(hostname))
+	sl.lock.Unlock()
 	key := "/registry/hosts/" + strings.TrimSpace(string(hostname))
 	// First fetch the initial configuration (watch only gives changes...)
 	for {
@@ -494,39 +497,39 @@ func (sl *Kubelet) WatchEtcd(watchChannel <-chan *etcd.Response, changeChannel c
 // Sync the configured list of containers (desired state) with the host current state
 func (sl *Kubelet) SyncManifests(config []api.ContainerManifest) error {
 	log.Printf("Desired:%#v", config)
+	sl.lock.Lock()
+	sl.manifests = config
+	sl.lock.Unlock()
 	var err error
+	// The IDs of the containers to keep.
 	desired := map[string]bool{}
+	synced := map[containerKey]bool{}
 	for _, manifest := range config {
 		for _, element := range manifest.Containers {
-			var exists bool
-			exists, actualName, err := sl.ContainerExists(&manifest, &element)
+			synced[containerKey{manifest.Id, element.Name}] = true
+			id, err := sl.syncContainer(&manifest, &element)
 			if err != nil {
-				log.Printf("Error detecting container: %#v skipping.", err)
+				log.Printf("Error syncing container: %#v", err)
 				continue
 			}
-			if !exists {
-				log.Printf("%#v doesn't exist, creating", element)
-				actualName, err = sl.RunContainer(&manifest, &element)
-				// For some reason, list gives back names that start with '/'
-				actualName = "/" + actualName
-
-				if err != nil {
-					// TODO(bburns) : Perhaps blacklist a container after N failures?
-					log.Printf("Error creating container: %#v", err)
-					desired[actualName] = true
-					continue
-				}
-			} else {
-				log.Printf("%#v exists as %v", element.Name, actualName)
+			if len(id) > 0 {
+				desired[id] = true
 			}
-			desired[actualName] = true
 		}
 	}
-	existingContainers, _ := sl.ListContainers()
+	// The restarts of containers which are gone from the manifests are forgotten.
+	sl.lock.Lock()
+	for key := range sl.restarts {
+		if !synced[key] {
+			delete(sl.restarts, key)
+		}
+	}
+	sl.lock.Unlock()
+	existingContainers, _ := sl.Runtime.ListContainers(false)
 	log.Printf("Existing:\n%#v Desired: %#v", existingContainers, desired)
 	for _, container := range existingContainers {
-		if !desired[container] {
-			log.Printf("Killing: %s", container)
+		if !desired[container.ID] {
+			log.Printf("Killing: %s", container.ID)
 			err = sl.KillContainer(container)
 			if err != nil {
 				log.Printf("Error killing container: %#v", err)
@@ -572,8 +575,8 @@ func (sl *Kubelet) RunSyncLoop(etcdChannel <-chan []api.ContainerManifest, fileC
 	}
 }
 
-func (sl *Kubelet) GetContainerInfo(name string) (string, error) {
-	info, err := sl.DockerClient.InspectContainer(name)
+func (sl *Kubelet) GetContainerInfo(id string) (string, error) {
+	info, err := sl.Runtime.InspectContainer(id)
 	if err != nil {
 		return "{}", err
 	}
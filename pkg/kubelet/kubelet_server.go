@@ -1,13 +1,19 @@
 package kubelet
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"gopkg.in/yaml.v2"
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/stream"
+	"k8s-firstcommit/pkg/util"
 )
 
 type KubeletServer struct {
@@ -58,8 +64,200 @@ func (s *KubeletServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w.Header().Add("Content-type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprint(w, body)
+	case u.Path == "/logs":
+		s.handleLogs(w, req, u.Query())
+	case u.Path == "/exec":
+		s.handleExec(w, req, u.Query())
+	case u.Path == "/portForward":
+		s.handlePortForward(w, req, u.Query())
 	default:
 		w.WriteHeader(http.StatusNotFound)
 		fmt.Fprint(w, "Not found.")
 	}
 }
+
+// containerID returns the ID of the container a request is for, or writes the reason it
+// can't be found. The container is either named as for /containerInfo, or by the
+// manifest it was started for and its name within it.
+func (s *KubeletServer) containerID(w http.ResponseWriter, query url.Values) (string, bool) {
+	container := query.Get("container")
+	if len(container) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing container query arg.")
+		return "", false
+	}
+	var id string
+	var err error
+	if manifest := query.Get("manifest"); len(manifest) > 0 {
+		id, err = s.Kubelet.GetManifestContainerID(manifest, container)
+	} else {
+		id, err = s.Kubelet.GetContainerID(container)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Not found: %v", err)
+		return "", false
+	}
+	return id, true
+}
+
+// handleLogs streams the output of a container. tail limits the output to that many
+// lines from the end, follow keeps the stream open as the container writes more, and
+// timestamps prefixes every line with the time it was written.
+func (s *KubeletServer) handleLogs(w http.ResponseWriter, req *http.Request, query url.Values) {
+	tail := query.Get("tail")
+	if len(tail) == 0 {
+		tail = "all"
+	} else if lines, err := strconv.Atoi(tail); err != nil || lines < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid tail query arg %q.", tail)
+		return
+	}
+	id, ok := s.containerID(w, query)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	out := util.NewFlushWriter(w)
+	options := LogOptions{
+		Tail:       tail,
+		Follow:     query.Get("follow") == "true",
+		Timestamps: query.Get("timestamps") == "true",
+	}
+	err := s.Kubelet.GetContainerLogs(req.Context(), id, options, out, out)
+	if err != nil {
+		// The status is already sent, all that's left is to cut the stream short.
+		log.Printf("Error streaming logs of %s: %v", id, err)
+	}
+}
+
+// handleExec runs a command in a container, over a stream (see pkg/stream). The command
+// is given by one or more command query args. With stdin=true the stdin frames are its
+// input; its output comes back on stdout and stderr, or all on stdout with tty=true. The
+// stream ends with the command's exit code.
+func (s *KubeletServer) handleExec(w http.ResponseWriter, req *http.Request, query url.Values) {
+	if !stream.IsUpgradeRequest(req) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Exec must upgrade to %s.", stream.Protocol)
+		return
+	}
+	command := query["command"]
+	if len(command) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing command query arg.")
+		return
+	}
+	id, ok := s.containerID(w, query)
+	if !ok {
+		return
+	}
+	conn, err := stream.Upgrade(w, req)
+	if err != nil {
+		log.Printf("Error upgrading exec in %s: %v", id, err)
+		return
+	}
+
+	useStdin := query.Get("stdin") == "true"
+	stdinReader, stdinWriter := io.Pipe()
+	resize := make(chan stream.TerminalSize)
+	go func() {
+		defer close(resize)
+		for {
+			channel, data, err := conn.ReadFrame()
+			if err != nil {
+				stdinWriter.CloseWithError(err)
+				return
+			}
+			switch {
+			case channel == stream.Stdin && useStdin && len(data) == 0:
+				stdinWriter.Close()
+			case channel == stream.Stdin && useStdin:
+				// Fails once the command is done with its input, which is fine.
+				stdinWriter.Write(data)
+			case channel == stream.Resize:
+				var size stream.TerminalSize
+				if err := json.Unmarshal(data, &size); err == nil {
+					resize <- size
+				}
+			}
+		}
+	}()
+	var stdin io.Reader
+	if useStdin {
+		stdin = stdinReader
+	}
+	code, err := s.Kubelet.ExecInContainer(id, command, query.Get("tty") == "true", stdin, conn.Writer(stream.Stdout), conn.Writer(stream.Stderr), resize)
+	status := stream.ExitStatus{ExitCode: code}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	conn.WriteJSON(stream.Status, status)
+	conn.Close()
+	stdinReader.Close()
+	// The reader stops now that the connection is closed; it may have been left trying
+	// to resize a terminal that's already gone.
+	for range resize {
+	}
+}
+
+// handlePortForward connects a stream to a port of a container. Stdin frames are sent
+// to the port and everything read from it comes back on stdout. An empty stdin frame
+// closes our side of the connection; the stream ends once the port closes its own.
+func (s *KubeletServer) handlePortForward(w http.ResponseWriter, req *http.Request, query url.Values) {
+	if !stream.IsUpgradeRequest(req) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Port forwarding must upgrade to %s.", stream.Protocol)
+		return
+	}
+	port, err := strconv.Atoi(query.Get("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid port query arg %q.", query.Get("port"))
+		return
+	}
+	id, ok := s.containerID(w, query)
+	if !ok {
+		return
+	}
+	target, err := s.Kubelet.DialContainerPort(id, port)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "Unable to connect to port %d: %v", port, err)
+		return
+	}
+	defer target.Close()
+	conn, err := stream.Upgrade(w, req)
+	if err != nil {
+		log.Printf("Error upgrading port forward to %s: %v", id, err)
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		for {
+			channel, data, err := conn.ReadFrame()
+			if err != nil {
+				target.Close()
+				return
+			}
+			if channel != stream.Stdin {
+				continue
+			}
+			if len(data) == 0 {
+				if closer, ok := target.(interface{ CloseWrite() error }); ok {
+					closer.CloseWrite()
+				}
+				continue
+			}
+			if _, err := target.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+	status := stream.ExitStatus{}
+	if _, err := io.Copy(conn.Writer(stream.Stdout), target); err != nil {
+		status.Error = err.Error()
+	}
+	conn.WriteJSON(stream.Status, status)
+}
@@ -0,0 +1,170 @@
+package kubelet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"k8s-firstcommit/pkg/stream"
+)
+
+func TestServeLogs(t *testing.T) {
+	fakeDocker := FakeDockerClient{
+		containerList: []docker.APIContainers{
+			{Names: []string{"/web--foo--1234"}, ID: "1234"},
+			{Names: []string{"/log--foo--5678"}, ID: "5678"},
+		},
+		logs: "hello\nworld\n",
+	}
+	server := httptest.NewServer(&KubeletServer{Kubelet: &Kubelet{Runtime: NewDockerRuntime(&fakeDocker)}})
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/logs?manifest=foo&container=log&tail=10&follow=true")
+	expectNoError(t, err)
+	body, err := ioutil.ReadAll(response.Body)
+	expectNoError(t, err)
+	if response.StatusCode != http.StatusOK || string(body) != fakeDocker.logs {
+		t.Errorf("Unexpected response %#v: %s", response, body)
+	}
+	verifyCalls(t, fakeDocker, []string{"list", "logs"})
+	options := fakeDocker.logsOptions
+	if options.Container != "5678" || options.Tail != "10" || !options.Follow || options.Timestamps || !options.Stdout || !options.Stderr {
+		t.Errorf("Unexpected logs options: %#v", options)
+	}
+
+	fakeDocker.clearCalls()
+	response, err = http.Get(server.URL + "/logs?container=web&timestamps=true")
+	expectNoError(t, err)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected response %#v", response)
+	}
+	options = fakeDocker.logsOptions
+	if options.Container != "1234" || options.Tail != "all" || options.Follow || !options.Timestamps {
+		t.Errorf("Unexpected logs options: %#v", options)
+	}
+
+	for path, status := range map[string]int{
+		"/logs": http.StatusBadRequest,
+		"/logs?container=web&manifest=foo&tail=x": http.StatusBadRequest,
+		"/logs?container=db&manifest=foo":         http.StatusNotFound,
+		"/logs?container=web&manifest=bar":        http.StatusNotFound,
+	} {
+		response, err = http.Get(server.URL + path)
+		expectNoError(t, err)
+		if response.StatusCode != status {
+			t.Errorf("Expected %d for %s, got %#v", status, path, response)
+		}
+	}
+}
+
+// dialStream asks the kubelet at url for a stream.
+func dialStream(t *testing.T, url string) *stream.Conn {
+	req, err := http.NewRequest("POST", url, nil)
+	expectNoError(t, err)
+	conn, err := stream.Dial(req, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return conn
+}
+
+// readStream returns everything sent on stdout until the status arrives.
+func readStream(t *testing.T, conn *stream.Conn) (string, stream.ExitStatus) {
+	output := ""
+	for {
+		channel, data, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		switch channel {
+		case stream.Stdout:
+			output += string(data)
+		case stream.Status:
+			var status stream.ExitStatus
+			expectNoError(t, json.Unmarshal(data, &status))
+			return output, status
+		default:
+			t.Errorf("Unexpected frame on %d: %s", channel, data)
+		}
+	}
+}
+
+func TestServeExec(t *testing.T) {
+	fakeDocker := FakeDockerClient{
+		containerList: []docker.APIContainers{{Names: []string{"/redis--foo--1234"}, ID: "1234"}},
+		execExitCode:  2,
+		resized:       make(chan [2]int, 1),
+	}
+	server := httptest.NewServer(&KubeletServer{Kubelet: &Kubelet{Runtime: NewDockerRuntime(&fakeDocker)}})
+	defer server.Close()
+
+	conn := dialStream(t, server.URL+"/exec?manifest=foo&container=redis&command=cat&command=-&stdin=true&tty=true")
+	defer conn.Close()
+	expectNoError(t, conn.WriteJSON(stream.Resize, stream.TerminalSize{Width: 80, Height: 24}))
+	expectNoError(t, conn.WriteFrame(stream.Stdin, []byte("PING\n")))
+	expectNoError(t, conn.WriteFrame(stream.Stdin, nil))
+	output, status := readStream(t, conn)
+	if output != "PING\n" || status.ExitCode != 2 || len(status.Error) != 0 {
+		t.Errorf("Unexpected output %q and status %#v", output, status)
+	}
+	if size := <-fakeDocker.resized; size != [2]int{24, 80} {
+		t.Errorf("Unexpected resize: %v", size)
+	}
+	options := fakeDocker.execOptions
+	if options.Container != "1234" || len(options.Cmd) != 2 || options.Cmd[1] != "-" || !options.Tty || !options.AttachStdin {
+		t.Errorf("Unexpected exec options: %#v", options)
+	}
+	verifyCalls(t, fakeDocker, []string{"list", "create_exec", "start_exec", "inspect_exec"})
+
+	for path, status := range map[string]int{
+		"/exec?manifest=foo&container=redis":               http.StatusBadRequest,
+		"/exec?manifest=foo&container=web&command=ls":      http.StatusNotFound,
+		"/portForward?manifest=foo&container=redis&port=0": http.StatusBadRequest,
+	} {
+		req, err := http.NewRequest("POST", server.URL+path, nil)
+		expectNoError(t, err)
+		_, err = stream.Dial(req, nil)
+		if upgradeErr, ok := err.(*stream.UpgradeError); !ok || upgradeErr.StatusCode != status {
+			t.Errorf("Expected %d for %s, got %#v", status, path, err)
+		}
+	}
+}
+
+func TestServePortForward(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	fakeDocker := FakeDockerClient{
+		containerList: []docker.APIContainers{{Names: []string{"/redis--foo--1234"}, ID: "1234"}},
+		container:     &docker.Container{NetworkSettings: &docker.NetworkSettings{IPAddress: "127.0.0.1"}},
+	}
+	server := httptest.NewServer(&KubeletServer{Kubelet: &Kubelet{Runtime: NewDockerRuntime(&fakeDocker)}})
+	defer server.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	conn := dialStream(t, fmt.Sprintf("%s/portForward?manifest=foo&container=redis&port=%d", server.URL, port))
+	defer conn.Close()
+	expectNoError(t, conn.WriteFrame(stream.Stdin, []byte("PING\n")))
+	expectNoError(t, conn.WriteFrame(stream.Stdin, nil))
+	output, status := readStream(t, conn)
+	if output != "PING\n" || len(status.Error) != 0 {
+		t.Errorf("Unexpected output %q and status %#v", output, status)
+	}
+	verifyCalls(t, fakeDocker, []string{"list", "inspect"})
+}
@@ -1,12 +1,16 @@
 package kubelet
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/coreos/go-etcd/etcd"
 	"github.com/fsouza/go-dockerclient"
@@ -68,50 +72,6 @@ func TestExtractJSON(t *testing.T) {
 	verifyIntEquals(t, obj.Data.Number, 10)
 }
 
-type FakeDockerClient struct {
-	containerList []docker.APIContainers
-	container     *docker.Container
-	err           error
-	called        []string
-}
-
-func (f *FakeDockerClient) clearCalls() {
-	f.called = []string{}
-}
-
-func (f *FakeDockerClient) appendCall(call string) {
-	f.called = append(f.called, call)
-}
-
-func (f *FakeDockerClient) ListContainers(options docker.ListContainersOptions) ([]docker.APIContainers, error) {
-	f.appendCall("list")
-	return f.containerList, f.err
-}
-
-func (f *FakeDockerClient) InspectContainer(id string) (*docker.Container, error) {
-	f.appendCall("inspect")
-	return f.container, f.err
-}
-
-func (f *FakeDockerClient) CreateContainer(docker.CreateContainerOptions) (*docker.Container, error) {
-	f.appendCall("create")
-	return nil, nil
-}
-
-func (f *FakeDockerClient) StartContainer(id string, hostConfig *docker.HostConfig) error {
-	f.appendCall("start")
-	return nil
-}
-
-func (f *FakeDockerClient) StopContainer(id string, timeout uint) error {
-	f.appendCall("stop")
-	return nil
-}
-
-func verifyCalls(t *testing.T, fakeDocker FakeDockerClient, calls []string) {
-	verifyStringArrayEquals(t, fakeDocker.called, calls)
-}
-
 func verifyStringArrayEquals(t *testing.T, actual, expected []string) {
 	invalid := len(actual) != len(expected)
 	for ix, value := range actual {
@@ -124,31 +84,12 @@ func verifyStringArrayEquals(t *testing.T, actual, expected []string) {
 	}
 }
 
-func verifyPackUnpack(t *testing.T, manifestId, containerName string) {
-	name := manifestAndContainerToDockerName(
-		&api.ContainerManifest{Id: manifestId},
-		&api.Container{Name: containerName},
-	)
-	returnedManifestId, returnedContainerName := dockerNameToManifestAndContainer(name)
-	if manifestId != returnedManifestId || containerName != returnedContainerName {
-		t.Errorf("For (%s, %s), unpacked (%s, %s)", manifestId, containerName, returnedManifestId, returnedContainerName)
-	}
-}
-
-func TestContainerManifestNaming(t *testing.T) {
-	verifyPackUnpack(t, "manifest1234", "container5678")
-	verifyPackUnpack(t, "manifest--", "container__")
-	verifyPackUnpack(t, "--manifest", "__container")
-	verifyPackUnpack(t, "m___anifest_", "container-_-")
-	verifyPackUnpack(t, "_m___anifest", "-_-container")
-}
-
 func TestContainerExists(t *testing.T) {
 	fakeDocker := FakeDockerClient{
 		err: nil,
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 	manifest := api.ContainerManifest{
 		Id: "qux",
@@ -169,7 +110,7 @@ func TestContainerExists(t *testing.T) {
 	}
 
 	exists, _, err := kubelet.ContainerExists(&manifest, &container)
-	verifyCalls(t, fakeDocker, []string{"list", "list", "inspect"})
+	verifyCalls(t, fakeDocker, []string{"list"})
 	if !exists {
 		t.Errorf("Failed to find container %#v", container)
 	}
@@ -183,7 +124,7 @@ func TestGetContainerID(t *testing.T) {
 		err: nil,
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 	fakeDocker.containerList = []docker.APIContainers{
 		docker.APIContainers{
@@ -213,74 +154,35 @@ func TestGetContainerID(t *testing.T) {
 	verifyCalls(t, fakeDocker, []string{"list"})
 }
 
-func TestGetContainerByName(t *testing.T) {
+func TestGetContainerInfo(t *testing.T) {
 	fakeDocker := FakeDockerClient{
 		err: nil,
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
-	}
-	fakeDocker.containerList = []docker.APIContainers{
-		docker.APIContainers{
-			Names: []string{"foo"},
-		},
-		docker.APIContainers{
-			Names: []string{"bar"},
-		},
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 	fakeDocker.container = &docker.Container{
 		ID: "foobar",
 	}
 
-	container, err := kubelet.GetContainerByName("foo")
-	verifyCalls(t, fakeDocker, []string{"list", "inspect"})
-	if container == nil {
-		t.Errorf("Unexpected nil container")
-	}
+	info, err := kubelet.GetContainerInfo("foobar")
+	verifyCalls(t, fakeDocker, []string{"inspect"})
+	var container docker.Container
+	expectNoError(t, json.Unmarshal([]byte(info), &container))
 	verifyStringEquals(t, container.ID, "foobar")
 	verifyNoError(t, err)
 }
 
-func TestListContainers(t *testing.T) {
-	fakeDocker := FakeDockerClient{
-		err: nil,
-	}
-	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
-	}
-	fakeDocker.containerList = []docker.APIContainers{
-		docker.APIContainers{
-			Names: []string{"foo"},
-		},
-		docker.APIContainers{
-			Names: []string{"bar"},
-		},
-	}
-
-	containers, err := kubelet.ListContainers()
-	verifyStringArrayEquals(t, containers, []string{"foo", "bar"})
-	verifyNoError(t, err)
-	verifyCalls(t, fakeDocker, []string{"list"})
-}
-
 func TestKillContainerWithError(t *testing.T) {
 	fakeDocker := FakeDockerClient{
 		err: fmt.Errorf("Sample Error"),
-		containerList: []docker.APIContainers{
-			docker.APIContainers{
-				Names: []string{"foo"},
-			},
-			docker.APIContainers{
-				Names: []string{"bar"},
-			},
-		},
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
-	err := kubelet.KillContainer("foo")
+	err := kubelet.KillContainer(RuntimeContainer{ID: "1234", Name: "foo"})
 	verifyError(t, err)
-	verifyCalls(t, fakeDocker, []string{"list"})
+	verifyCalls(t, fakeDocker, []string{"stop"})
 }
 
 func TestKillContainer(t *testing.T) {
@@ -288,23 +190,12 @@ func TestKillContainer(t *testing.T) {
 		err: nil,
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
-	}
-	fakeDocker.containerList = []docker.APIContainers{
-		docker.APIContainers{
-			Names: []string{"foo"},
-		},
-		docker.APIContainers{
-			Names: []string{"bar"},
-		},
-	}
-	fakeDocker.container = &docker.Container{
-		ID: "foobar",
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 
-	err := kubelet.KillContainer("foo")
+	err := kubelet.KillContainer(RuntimeContainer{ID: "1234", Name: "foo"})
 	verifyNoError(t, err)
-	verifyCalls(t, fakeDocker, []string{"list", "stop"})
+	verifyCalls(t, fakeDocker, []string{"stop"})
 }
 
 func TestSyncHTTP(t *testing.T) {
@@ -495,15 +386,16 @@ func TestSyncManifestsDoesNothing(t *testing.T) {
 	fakeDocker.containerList = []docker.APIContainers{
 		docker.APIContainers{
 			// format is <container-id>--<manifest-id>
-			Names: []string{"bar--foo"},
-			ID:    "1234",
+			Names:  []string{"bar--foo"},
+			ID:     "1234",
+			Status: "Up 2 minutes",
 		},
 	}
 	fakeDocker.container = &docker.Container{
 		ID: "1234",
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 	err := kubelet.SyncManifests([]api.ContainerManifest{
 		api.ContainerManifest{
@@ -514,11 +406,9 @@ func TestSyncManifestsDoesNothing(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	if len(fakeDocker.called) != 4 ||
+	if len(fakeDocker.called) != 2 ||
 		fakeDocker.called[0] != "list" ||
-		fakeDocker.called[1] != "list" ||
-		fakeDocker.called[2] != "inspect" ||
-		fakeDocker.called[3] != "list" {
+		fakeDocker.called[1] != "list" {
 		t.Errorf("Unexpected call sequence: %#v", fakeDocker.called)
 	}
 }
@@ -534,14 +424,202 @@ func TestSyncManifestsDeletes(t *testing.T) {
 		},
 	}
 	kubelet := Kubelet{
-		DockerClient: &fakeDocker,
+		Runtime: NewDockerRuntime(&fakeDocker),
 	}
 	err := kubelet.SyncManifests([]api.ContainerManifest{})
 	expectNoError(t, err)
-	if len(fakeDocker.called) != 3 ||
+	if len(fakeDocker.called) != 2 ||
 		fakeDocker.called[0] != "list" ||
-		fakeDocker.called[1] != "list" ||
-		fakeDocker.called[2] != "stop" {
+		fakeDocker.called[1] != "stop" {
 		t.Errorf("Unexpected call sequence: %#v", fakeDocker.called)
 	}
 }
+
+// FakeRuntime keeps its containers in a list, and records what's done to them.
+type FakeRuntime struct {
+	containers []RuntimeContainer
+	images     map[string]bool
+	pulled     []string
+	started    []string
+	stopped    []string
+	exits      map[string]ContainerExit
+	err        error
+}
+
+func (f *FakeRuntime) ImagePresent(image string) (bool, error) {
+	return f.images[image], nil
+}
+
+func (f *FakeRuntime) PullImage(image string, progress io.Writer) error {
+	f.pulled = append(f.pulled, image)
+	fmt.Fprintf(progress, "Pulling %s\n", image)
+	return f.err
+}
+
+func (f *FakeRuntime) CreateContainer(manifest *api.ContainerManifest, container *api.Container) (string, error) {
+	id := fmt.Sprintf("%d", len(f.containers)+1)
+	f.containers = append([]RuntimeContainer{{ID: id, ManifestID: manifest.Id, Name: container.Name}}, f.containers...)
+	return id, f.err
+}
+
+func (f *FakeRuntime) setRunning(id string, running bool) {
+	for ix := range f.containers {
+		if f.containers[ix].ID == id {
+			f.containers[ix].Running = running
+		}
+	}
+}
+
+func (f *FakeRuntime) StartContainer(id string) error {
+	f.started = append(f.started, id)
+	f.setRunning(id, true)
+	return f.err
+}
+
+func (f *FakeRuntime) StopContainer(id string, timeout time.Duration) error {
+	f.stopped = append(f.stopped, id)
+	f.setRunning(id, false)
+	return f.err
+}
+
+func (f *FakeRuntime) ListContainers(all bool) ([]RuntimeContainer, error) {
+	result := []RuntimeContainer{}
+	for _, container := range f.containers {
+		if all || container.Running {
+			result = append(result, container)
+		}
+	}
+	return result, f.err
+}
+
+func (f *FakeRuntime) InspectContainer(id string) (interface{}, error) {
+	return map[string]string{"id": id}, f.err
+}
+
+func (f *FakeRuntime) ExitStatus(id string) (ContainerExit, error) {
+	return f.exits[id], f.err
+}
+
+func (f *FakeRuntime) ContainerLogs(ctx context.Context, id string, options LogOptions, stdout, stderr io.Writer) error {
+	return f.err
+}
+
+func TestSyncManifestsRuntime(t *testing.T) {
+	runtime := &FakeRuntime{
+		containers: []RuntimeContainer{
+			{ID: "2", ManifestID: "foo", Name: "bar", Running: true},
+			{ID: "1", ManifestID: "old", Name: "bar", Running: true},
+		},
+	}
+	kubelet := Kubelet{
+		Runtime: runtime,
+	}
+	err := kubelet.SyncManifests([]api.ContainerManifest{
+		api.ContainerManifest{
+			Id: "foo",
+			Containers: []api.Container{
+				api.Container{Name: "bar", Image: "dockerfile/bar"},
+				api.Container{Name: "baz", Image: "dockerfile/baz"},
+			},
+		},
+	})
+	expectNoError(t, err)
+	verifyStringArrayEquals(t, runtime.pulled, []string{"dockerfile/baz"})
+	verifyStringArrayEquals(t, runtime.started, []string{"3"})
+	verifyStringArrayEquals(t, runtime.stopped, []string{"1"})
+
+	id, err := kubelet.GetManifestContainerID("old", "bar")
+	expectNoError(t, err)
+	verifyStringEquals(t, id, "1")
+	_, err = kubelet.GetContainerID("old")
+	verifyError(t, err)
+	id, err = kubelet.GetContainerID("baz")
+	expectNoError(t, err)
+	verifyStringEquals(t, id, "3")
+
+	_, err = kubelet.ExecInContainer("3", []string{"ls"}, false, nil, ioutil.Discard, ioutil.Discard, nil)
+	verifyError(t, err)
+	_, err = kubelet.DialContainerPort("3", 80)
+	verifyError(t, err)
+}
+
+func TestPullPolicy(t *testing.T) {
+	for _, test := range []struct {
+		container api.Container
+		expected  api.PullPolicy
+	}{
+		{api.Container{Image: "redis"}, api.PullAlways},
+		{api.Container{Image: "redis:latest"}, api.PullAlways},
+		{api.Container{Image: "redis:2.8"}, api.PullIfNotPresent},
+		{api.Container{Image: "localhost:5000/redis"}, api.PullAlways},
+		{api.Container{Image: "localhost:5000/redis:2.8"}, api.PullIfNotPresent},
+		{api.Container{Image: "redis@sha256:1234"}, api.PullIfNotPresent},
+		{api.Container{Image: "redis", ImagePullPolicy: api.PullNever}, api.PullNever},
+	} {
+		if policy := pullPolicy(&test.container); policy != test.expected {
+			t.Errorf("Expected %s for %#v, got %s", test.expected, test.container, policy)
+		}
+	}
+}
+
+// lastEvent returns the last event logged for the container name.
+func lastEvent(t *testing.T, fakeClient *registry.FakeEtcdClient, name string) api.Event {
+	var event api.Event
+	response := fakeClient.Data["/events/"+name].R
+	if response == nil || response.Node == nil {
+		t.Errorf("No event for %s", name)
+		return event
+	}
+	expectNoError(t, json.Unmarshal([]byte(response.Node.Value), &event))
+	return event
+}
+
+func TestPullImage(t *testing.T) {
+	fakeClient := registry.MakeFakeEtcdClient(t)
+	runtime := &FakeRuntime{
+		images: map[string]bool{"redis:2.8": true},
+	}
+	kubelet := Kubelet{
+		Client:  fakeClient,
+		Runtime: runtime,
+	}
+	manifest := api.ContainerManifest{Id: "foo"}
+
+	expectNoError(t, kubelet.pullImage(&manifest, &api.Container{Name: "cache", Image: "redis:2.8"}))
+	verifyStringArrayEquals(t, runtime.pulled, nil)
+
+	expectNoError(t, kubelet.pullImage(&manifest, &api.Container{Name: "db", Image: "redis:2.8", ImagePullPolicy: api.PullAlways}))
+	verifyStringArrayEquals(t, runtime.pulled, []string{"redis:2.8"})
+	if event := lastEvent(t, fakeClient, "db"); event.Event != "PULLED" || event.Manifest.Id != "foo" || event.Container.Image != "redis:2.8" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+
+	verifyError(t, kubelet.pullImage(&manifest, &api.Container{Name: "web", Image: "nginx", ImagePullPolicy: api.PullNever}))
+	verifyStringArrayEquals(t, runtime.pulled, []string{"redis:2.8"})
+	if event := lastEvent(t, fakeClient, "web"); event.Event != "PULL_FAILED" || len(event.Message) == 0 {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+
+	runtime.err = fmt.Errorf("Sample Error")
+	verifyError(t, kubelet.pullImage(&manifest, &api.Container{Name: "web", Image: "nginx"}))
+	if event := lastEvent(t, fakeClient, "web"); event.Event != "PULL_FAILED" || event.Message != "Sample Error" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+}
+
+func TestPullProgress(t *testing.T) {
+	fakeClient := registry.MakeFakeEtcdClient(t)
+	progress := &pullProgress{
+		kubelet:   &Kubelet{Client: fakeClient},
+		manifest:  &api.ContainerManifest{Id: "foo"},
+		container: &api.Container{Name: "db", Image: "redis"},
+	}
+	fmt.Fprint(progress, "latest: Pulling from ")
+	if _, ok := fakeClient.Data["/events/db"]; ok {
+		t.Errorf("Unexpected event for a partial line")
+	}
+	fmt.Fprint(progress, "library/redis\nDownloading\n")
+	if event := lastEvent(t, fakeClient, "db"); event.Event != "PULLING" || event.Message != "latest: Pulling from library/redis" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+}
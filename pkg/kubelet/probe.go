@@ -0,0 +1,333 @@
+package kubelet
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/registry"
+	"k8s-firstcommit/pkg/stream"
+)
+
+// The defaults of the settings of a probe which are left zero.
+const (
+	defaultProbePeriod           = 10 * time.Second
+	defaultProbeTimeout          = time.Second
+	defaultProbeFailureThreshold = 3
+)
+
+// probeCheckPeriod is how often the kubelet looks for probes which are due.
+const probeCheckPeriod = time.Second
+
+// statusRecordPeriod is how often the status of tasks is recorded in etcd when it
+// hasn't changed, so that writes skipped because a task changed meanwhile are made.
+const statusRecordPeriod = 30 * time.Second
+
+// probeTracker follows the outcome of one probe of a container.
+type probeTracker struct {
+	// last is when the probe was last checked.
+	last time.Time
+	// failures counts the checks in a row which failed.
+	failures int
+	// ok is whether the probe has succeeded; it turns false once failures reach the
+	// probe's threshold.
+	ok bool
+}
+
+// probeState is what the kubelet knows about the probes of a running container.
+type probeState struct {
+	// seen is when the container was first found running, which initial delays count from.
+	seen      time.Time
+	liveness  probeTracker
+	readiness probeTracker
+}
+
+// probeSettings returns the period, timeout and failure threshold of probe.
+func probeSettings(probe *api.Probe) (period, timeout time.Duration, threshold int) {
+	period = time.Duration(probe.PeriodSeconds) * time.Second
+	if period == 0 {
+		period = defaultProbePeriod
+	}
+	timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	threshold = probe.FailureThreshold
+	if threshold == 0 {
+		threshold = defaultProbeFailureThreshold
+	}
+	return
+}
+
+// due returns whether probe of a container first seen at seen should be checked at now.
+func (t *probeTracker) due(probe *api.Probe, seen, now time.Time) bool {
+	if now.Sub(seen) < time.Duration(probe.InitialDelaySeconds)*time.Second {
+		return false
+	}
+	period, _, _ := probeSettings(probe)
+	return t.last.IsZero() || now.Sub(t.last) >= period
+}
+
+// record counts the outcome of a check of probe, which failed if err isn't nil.
+func (t *probeTracker) record(probe *api.Probe, err error) {
+	if err == nil {
+		t.failures = 0
+		t.ok = true
+		return
+	}
+	t.failures++
+	if _, _, threshold := probeSettings(probe); t.failures >= threshold {
+		t.ok = false
+	}
+}
+
+// withTimeout returns the error of check, or an error if it takes longer than timeout.
+func withTimeout(timeout time.Duration, check func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// runProbe checks probe against the container id once, and returns why it failed.
+// Ports are reached and commands run through the container runtime.
+func (sl *Kubelet) runProbe(probe *api.Probe, id string) error {
+	_, timeout, _ := probeSettings(probe)
+	switch {
+	case probe.HTTPGet != nil:
+		port := probe.HTTPGet.Port
+		client := &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return sl.DialContainerPort(id, port)
+				},
+				DisableKeepAlives: true,
+			},
+		}
+		path := probe.HTTPGet.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		url := fmt.Sprintf("http://localhost:%d%s", port, path)
+		response, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("GET %s returned %s", url, response.Status)
+		}
+		return nil
+	case probe.TCPSocket != nil:
+		return withTimeout(timeout, func() error {
+			conn, err := sl.DialContainerPort(id, probe.TCPSocket.Port)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+	case probe.Exec != nil:
+		return withTimeout(timeout, func() error {
+			resize := make(chan stream.TerminalSize)
+			close(resize)
+			code, err := sl.ExecInContainer(id, probe.Exec.Command, false, nil, ioutil.Discard, ioutil.Discard, resize)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return fmt.Errorf("%v exited with %d", probe.Exec.Command, code)
+			}
+			return nil
+		})
+	}
+	return fmt.Errorf("probe has no action")
+}
+
+// probeCheck is a probe of a running container which is due.
+type probeCheck struct {
+	probe   *api.Probe
+	id      string
+	tracker *probeTracker
+}
+
+// ProbeContainers checks the probes of the containers of the last synced manifests which
+// are due, and kills the containers which failed their liveness probes, for the next
+// sync to restart. It returns, by manifest ID, whether every container of each manifest
+// is running and ready.
+func (sl *Kubelet) ProbeContainers() (map[string]bool, error) {
+	containers, err := sl.Runtime.ListContainers(false)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	checks := []probeCheck{}
+
+	sl.lock.Lock()
+	manifests := sl.manifests
+	if sl.probes == nil {
+		sl.probes = map[string]*probeState{}
+	}
+	probes := map[string]*probeState{}
+	for _, container := range containers {
+		state, ok := sl.probes[container.ID]
+		if !ok {
+			state = &probeState{seen: now}
+			state.liveness.ok = true
+		}
+		// Containers which are gone are forgotten.
+		probes[container.ID] = state
+	}
+	sl.probes = probes
+	for _, manifest := range manifests {
+		for i := range manifest.Containers {
+			container := &manifest.Containers[i]
+			id, ok := findContainer(containers, manifest.Id, container.Name)
+			if !ok {
+				continue
+			}
+			state := probes[id]
+			if probe := container.LivenessProbe; probe != nil && state.liveness.due(probe, state.seen, now) {
+				state.liveness.last = now
+				checks = append(checks, probeCheck{probe, id, &state.liveness})
+			}
+			if probe := container.ReadinessProbe; probe != nil && state.readiness.due(probe, state.seen, now) {
+				state.readiness.last = now
+				checks = append(checks, probeCheck{probe, id, &state.readiness})
+			}
+		}
+	}
+	sl.lock.Unlock()
+
+	var wait sync.WaitGroup
+	for _, check := range checks {
+		wait.Add(1)
+		go func(check probeCheck) {
+			defer wait.Done()
+			err := sl.runProbe(check.probe, check.id)
+			if err != nil {
+				log.Printf("Probe of container %s failed: %v", check.id, err)
+			}
+			sl.lock.Lock()
+			defer sl.lock.Unlock()
+			check.tracker.record(check.probe, err)
+		}(check)
+	}
+	wait.Wait()
+
+	ready := map[string]bool{}
+	unhealthy := []RuntimeContainer{}
+	sl.lock.Lock()
+	for _, manifest := range manifests {
+		ready[manifest.Id] = true
+		for _, container := range manifest.Containers {
+			id, ok := findContainer(containers, manifest.Id, container.Name)
+			if !ok {
+				ready[manifest.Id] = false
+				continue
+			}
+			state := probes[id]
+			if !state.liveness.ok {
+				ready[manifest.Id] = false
+				unhealthy = append(unhealthy, RuntimeContainer{ID: id, ManifestID: manifest.Id, Name: container.Name})
+				delete(sl.probes, id)
+			} else if container.ReadinessProbe != nil && !state.readiness.ok {
+				ready[manifest.Id] = false
+			}
+		}
+	}
+	sl.lock.Unlock()
+
+	for _, container := range unhealthy {
+		log.Printf("Killing unhealthy container %s", container.ID)
+		sl.LogEvent(&api.Event{
+			Event: "UNHEALTHY",
+			Manifest: &api.ContainerManifest{
+				Id: container.ManifestID,
+			},
+			Container: &api.Container{
+				Name: container.Name,
+			},
+			Message: "Liveness probe failed",
+		})
+		if err := sl.KillContainer(container); err != nil {
+			log.Printf("Error killing container: %#v", err)
+		}
+	}
+	return ready, nil
+}
+
+// findContainer returns the ID of the running container named name of the manifest manifestID.
+func findContainer(containers []RuntimeContainer, manifestID, name string) (string, bool) {
+	for _, container := range containers {
+		if container.ManifestID == manifestID && container.Name == name {
+			return container.ID, true
+		}
+	}
+	return "", false
+}
+
+// taskStatuses returns the status of each manifest last synced, by ID, given whether
+// each is ready.
+func (sl *Kubelet) taskStatuses(ready map[string]bool) map[string]registry.TaskStatus {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	statuses := map[string]registry.TaskStatus{}
+	for i := range sl.manifests {
+		manifest := &sl.manifests[i]
+		statuses[manifest.Id] = registry.TaskStatus{
+			Ready:             ready[manifest.Id],
+			ContainerStatuses: sl.containerStatuses(manifest),
+		}
+	}
+	return statuses
+}
+
+// recordStatus records statuses, by manifest ID, in the current state of the tasks on
+// this host, when they have changed or haven't been recorded for statusRecordPeriod.
+func (sl *Kubelet) recordStatus(statuses map[string]registry.TaskStatus) error {
+	sl.lock.Lock()
+	hostname := sl.hostname
+	recorded := reflect.DeepEqual(statuses, sl.lastStatuses) && time.Since(sl.lastRecorded) < statusRecordPeriod
+	sl.lock.Unlock()
+	if sl.Client == nil || len(hostname) == 0 || recorded {
+		return nil
+	}
+	err := registry.MakeEtcdRegistry(sl.Client, []string{hostname}).SetTasksStatus(hostname, statuses)
+	if err != nil {
+		return err
+	}
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	sl.lastStatuses = statuses
+	sl.lastRecorded = time.Now()
+	return nil
+}
+
+// RunProbes probes containers and records the status of tasks every probeCheckPeriod.
+// Never returns.
+func (sl *Kubelet) RunProbes() {
+	for {
+		ready, err := sl.ProbeContainers()
+		if err != nil {
+			log.Printf("Error probing containers: %v", err)
+		} else if err := sl.recordStatus(sl.taskStatuses(ready)); err != nil {
+			log.Printf("Error recording task status: %v", err)
+		}
+		time.Sleep(probeCheckPeriod)
+	}
+}
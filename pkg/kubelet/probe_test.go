@@ -0,0 +1,157 @@
+package kubelet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/stream"
+)
+
+// ProbedRuntime is a FakeRuntime whose containers' ports are the ports of addresses,
+// and whose commands exit with the codes in exitCodes.
+type ProbedRuntime struct {
+	FakeRuntime
+	addresses map[int]string
+	exitCodes map[string]int
+}
+
+func (f *ProbedRuntime) DialContainerPort(id string, port int) (net.Conn, error) {
+	address, ok := f.addresses[port]
+	if !ok {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return net.Dial("tcp", address)
+}
+
+func (f *ProbedRuntime) RunInContainer(id string, command []string, tty bool, stdin io.Reader, stdout, stderr io.Writer, resize <-chan stream.TerminalSize) (int, error) {
+	return f.exitCodes[strings.Join(command, " ")], nil
+}
+
+func TestProbeTracker(t *testing.T) {
+	probe := &api.Probe{InitialDelaySeconds: 5, PeriodSeconds: 2, FailureThreshold: 2}
+	seen := time.Now()
+	tracker := probeTracker{}
+	if tracker.due(probe, seen, seen.Add(4*time.Second)) || !tracker.due(probe, seen, seen.Add(5*time.Second)) {
+		t.Errorf("Unexpected initial delay")
+	}
+	tracker.last = seen.Add(5 * time.Second)
+	if tracker.due(probe, seen, seen.Add(6*time.Second)) || !tracker.due(probe, seen, seen.Add(7*time.Second)) {
+		t.Errorf("Unexpected period")
+	}
+
+	tracker.record(probe, nil)
+	tracker.record(probe, fmt.Errorf("failed"))
+	if !tracker.ok || tracker.failures != 1 {
+		t.Errorf("Unexpected tracker: %#v", tracker)
+	}
+	tracker.record(probe, fmt.Errorf("failed"))
+	if tracker.ok || tracker.failures != 2 {
+		t.Errorf("Unexpected tracker: %#v", tracker)
+	}
+	tracker.record(probe, nil)
+	if !tracker.ok || tracker.failures != 0 {
+		t.Errorf("Unexpected tracker: %#v", tracker)
+	}
+}
+
+func TestRunProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	runtime := &ProbedRuntime{
+		addresses: map[int]string{80: server.Listener.Addr().String()},
+		exitCodes: map[string]int{"false": 1},
+	}
+	kubelet := Kubelet{
+		Runtime: runtime,
+	}
+
+	expectNoError(t, kubelet.runProbe(&api.Probe{HTTPGet: &api.HTTPGetAction{Path: "healthz", Port: 80}}, "1"))
+	verifyError(t, kubelet.runProbe(&api.Probe{HTTPGet: &api.HTTPGetAction{Path: "/", Port: 80}}, "1"))
+	verifyError(t, kubelet.runProbe(&api.Probe{HTTPGet: &api.HTTPGetAction{Path: "/healthz", Port: 81}}, "1"))
+	expectNoError(t, kubelet.runProbe(&api.Probe{TCPSocket: &api.TCPSocketAction{Port: 80}}, "1"))
+	verifyError(t, kubelet.runProbe(&api.Probe{TCPSocket: &api.TCPSocketAction{Port: 81}}, "1"))
+	expectNoError(t, kubelet.runProbe(&api.Probe{Exec: &api.ExecAction{Command: []string{"true"}}}, "1"))
+	verifyError(t, kubelet.runProbe(&api.Probe{Exec: &api.ExecAction{Command: []string{"false"}}}, "1"))
+	verifyError(t, kubelet.runProbe(&api.Probe{}, "1"))
+
+	kubelet.Runtime = &FakeRuntime{}
+	verifyError(t, kubelet.runProbe(&api.Probe{Exec: &api.ExecAction{Command: []string{"true"}}}, "1"))
+}
+
+func TestProbeContainers(t *testing.T) {
+	runtime := &ProbedRuntime{
+		FakeRuntime: FakeRuntime{
+			containers: []RuntimeContainer{
+				{ID: "3", ManifestID: "web", Name: "php", Running: true},
+				{ID: "2", ManifestID: "db", Name: "redis", Running: true},
+				{ID: "1", ManifestID: "batch", Name: "job", Running: true},
+			},
+		},
+		exitCodes: map[string]int{"redis-cli ping": 1},
+	}
+	kubelet := Kubelet{
+		Runtime: runtime,
+		manifests: []api.ContainerManifest{
+			{
+				Id: "web",
+				Containers: []api.Container{{
+					Name:           "php",
+					ReadinessProbe: &api.Probe{TCPSocket: &api.TCPSocketAction{Port: 80}, FailureThreshold: 1},
+				}},
+			},
+			{
+				Id: "db",
+				Containers: []api.Container{{
+					Name:          "redis",
+					LivenessProbe: &api.Probe{Exec: &api.ExecAction{Command: []string{"redis-cli", "ping"}}, FailureThreshold: 1},
+				}},
+			},
+			{
+				Id:         "batch",
+				Containers: []api.Container{{Name: "job"}},
+			},
+			{
+				Id:         "missing",
+				Containers: []api.Container{{Name: "job"}},
+			},
+		},
+	}
+
+	ready, err := kubelet.ProbeContainers()
+	expectNoError(t, err)
+	expected := map[string]bool{"web": false, "db": false, "batch": true, "missing": false}
+	if fmt.Sprint(ready) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, ready)
+	}
+	verifyStringArrayEquals(t, runtime.stopped, []string{"2"})
+	if _, ok := kubelet.probes["2"]; ok || len(kubelet.probes) != 2 {
+		t.Errorf("Unexpected probes: %#v", kubelet.probes)
+	}
+
+	// The readiness probe isn't due again until its period has passed.
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	runtime.addresses = map[int]string{80: server.Listener.Addr().String()}
+	ready, err = kubelet.ProbeContainers()
+	expectNoError(t, err)
+	if ready["web"] {
+		t.Errorf("Unexpected readiness: %v", ready)
+	}
+	kubelet.probes["3"].readiness.last = time.Now().Add(-defaultProbePeriod)
+	ready, err = kubelet.ProbeContainers()
+	expectNoError(t, err)
+	if !ready["web"] {
+		t.Errorf("Unexpected readiness: %v", ready)
+	}
+}
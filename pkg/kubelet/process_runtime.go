@@ -0,0 +1,378 @@
+package kubelet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// defaultPath is the PATH of processes whose container doesn't set one.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// logPollPeriod is how often a followed log is checked for more output.
+const logPollPeriod = 100 * time.Millisecond
+
+// ProcessRuntime runs containers as plain processes, for hosts without a Docker daemon.
+// An image is a directory under ImageRoot holding the root filesystem its processes are
+// chrooted to, and has to be put there beforehand, since images can't be pulled. Every
+// process also gets PID, mount, UTS and IPC namespaces of its own, so this only works
+// on Linux. Processes share the host's network, so a container's ports are the host's, and volumes aren't
+// supported. The first word of a container's command is the path of the program in its
+// image. Output goes to a file per container under LogRoot.
+//
+// Processes are only known to the ProcessRuntime which started them, so the ones left
+// behind by an earlier kubelet aren't listed.
+type ProcessRuntime struct {
+	ImageRoot string
+	LogRoot   string
+
+	lock       sync.Mutex
+	containers map[string]*process
+	lastID     int
+}
+
+// process is a container of a ProcessRuntime.
+type process struct {
+	RuntimeContainer
+	// number orders the processes by creation.
+	number  int
+	cmd     *exec.Cmd
+	root    string
+	logPath string
+	created time.Time
+	// started and exited are zero until the process starts and exits.
+	started  time.Time
+	exited   time.Time
+	exitCode int
+	// done is closed once the process has exited.
+	done chan struct{}
+}
+
+// ProcessInfo is what InspectContainer returns for a process.
+type ProcessInfo struct {
+	ID         string    `json:"id"`
+	ManifestID string    `json:"manifestId"`
+	Name       string    `json:"name"`
+	Command    []string  `json:"command"`
+	Root       string    `json:"root"`
+	Running    bool      `json:"running"`
+	Pid        int       `json:"pid,omitempty"`
+	Created    time.Time `json:"created"`
+	Started    time.Time `json:"started"`
+	Exited     time.Time `json:"exited"`
+	ExitCode   int       `json:"exitCode"`
+}
+
+func NewProcessRuntime(imageRoot, logRoot string) *ProcessRuntime {
+	return &ProcessRuntime{
+		ImageRoot:  imageRoot,
+		LogRoot:    logRoot,
+		containers: map[string]*process{},
+	}
+}
+
+// imagePath returns the root filesystem of image, which can't be outside ImageRoot.
+func (r *ProcessRuntime) imagePath(image string) string {
+	return filepath.Join(r.ImageRoot, filepath.Clean("/"+image))
+}
+
+func (r *ProcessRuntime) ImagePresent(image string) (bool, error) {
+	info, err := os.Stat(r.imagePath(image))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// PullImage fails unless image is there already, since it has to be put there by hand.
+func (r *ProcessRuntime) PullImage(image string, progress io.Writer) error {
+	present, err := r.ImagePresent(image)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return fmt.Errorf("image %s isn't in %s, and images can't be pulled", image, r.ImageRoot)
+	}
+	return nil
+}
+
+func (r *ProcessRuntime) CreateContainer(manifest *api.ContainerManifest, container *api.Container) (string, error) {
+	if len(container.VolumeMounts) > 0 {
+		return "", fmt.Errorf("container %s has volumes, which processes can't have", container.Name)
+	}
+	command := []string(container.Command)
+	if len(command) == 0 {
+		return "", fmt.Errorf("container %s has no command", container.Name)
+	}
+	root := r.imagePath(container.Image)
+	attributes, err := processAttributes(root)
+	if err != nil {
+		return "", err
+	}
+	env := []string{"PATH=" + defaultPath}
+	for _, value := range container.Env {
+		env = append(env, fmt.Sprintf("%s=%s", value.Name, value.Value))
+	}
+	dir := container.WorkingDir
+	if len(dir) == 0 {
+		dir = "/"
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.lastID++
+	id := strconv.Itoa(r.lastID)
+	r.containers[id] = &process{
+		RuntimeContainer: RuntimeContainer{
+			ID:         id,
+			ManifestID: manifest.Id,
+			Name:       container.Name,
+		},
+		number: r.lastID,
+		// The path isn't looked up, since the program is in the image.
+		cmd: &exec.Cmd{
+			Path:        command[0],
+			Args:        command,
+			Env:         env,
+			Dir:         dir,
+			SysProcAttr: attributes,
+		},
+		root:    root,
+		logPath: filepath.Join(r.LogRoot, id+".log"),
+		created: time.Now(),
+		done:    make(chan struct{}),
+	}
+	return id, nil
+}
+
+func (r *ProcessRuntime) getProcess(id string) (*process, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	p, ok := r.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	return p, nil
+}
+
+func (r *ProcessRuntime) StartContainer(id string) error {
+	p, err := r.getProcess(id)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !p.started.IsZero() {
+		return fmt.Errorf("container %s was already started", id)
+	}
+	if err := os.MkdirAll(r.LogRoot, 0755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(p.logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// The process has a copy of the file once started.
+	defer logFile.Close()
+	p.cmd.Stdout = logFile
+	p.cmd.Stderr = logFile
+	if err := p.cmd.Start(); err != nil {
+		return err
+	}
+	p.started = time.Now()
+	p.Running = true
+	go func() {
+		p.cmd.Wait()
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		p.Running = false
+		p.exited = time.Now()
+		p.exitCode = p.cmd.ProcessState.ExitCode()
+		// Like a shell, a process killed by a signal exits with 128 plus the signal.
+		if status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			p.exitCode = 128 + int(status.Signal())
+		}
+		close(p.done)
+	}()
+	return nil
+}
+
+// StopContainer sends the process SIGTERM, and SIGKILL after timeout. With a PID
+// namespace of its own, the rest of the container goes with it.
+func (r *ProcessRuntime) StopContainer(id string, timeout time.Duration) error {
+	p, err := r.getProcess(id)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	running := p.Running
+	r.lock.Unlock()
+	if !running {
+		return nil
+	}
+	if err := p.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(timeout):
+	}
+	if err := p.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	<-p.done
+	return nil
+}
+
+func (r *ProcessRuntime) ListContainers(all bool) ([]RuntimeContainer, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	processes := []*process{}
+	for _, p := range r.containers {
+		if all || p.Running {
+			processes = append(processes, p)
+		}
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].number > processes[j].number
+	})
+	result := []RuntimeContainer{}
+	for _, p := range processes {
+		result = append(result, p.RuntimeContainer)
+	}
+	return result, nil
+}
+
+func (r *ProcessRuntime) InspectContainer(id string) (interface{}, error) {
+	p, err := r.getProcess(id)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	info := ProcessInfo{
+		ID:         p.ID,
+		ManifestID: p.ManifestID,
+		Name:       p.Name,
+		Command:    p.cmd.Args,
+		Root:       p.root,
+		Running:    p.Running,
+		Created:    p.created,
+		Started:    p.started,
+		Exited:     p.exited,
+		ExitCode:   p.exitCode,
+	}
+	if p.Running {
+		info.Pid = p.cmd.Process.Pid
+	}
+	return info, nil
+}
+
+// ExitStatus returns how the process exited. Processes can't tell if they ran out of memory.
+func (r *ProcessRuntime) ExitStatus(id string) (ContainerExit, error) {
+	p, err := r.getProcess(id)
+	if err != nil {
+		return ContainerExit{}, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if p.Running {
+		return ContainerExit{}, fmt.Errorf("container %s is running", id)
+	}
+	return ContainerExit{
+		ExitCode:   p.exitCode,
+		FinishedAt: p.exited,
+	}, nil
+}
+
+// ContainerLogs copies the output of the process, all of which goes to stdout.
+// Timestamps aren't recorded.
+func (r *ProcessRuntime) ContainerLogs(ctx context.Context, id string, options LogOptions, stdout, stderr io.Writer) error {
+	if options.Timestamps {
+		return fmt.Errorf("the output of processes has no timestamps")
+	}
+	p, err := r.getProcess(id)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Open(p.logPath)
+	if os.IsNotExist(err) {
+		// It hasn't started, so there's nothing to read yet.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	if len(options.Tail) > 0 && options.Tail != "all" {
+		lines, err := strconv.Atoi(options.Tail)
+		if err != nil {
+			return fmt.Errorf("invalid tail %q", options.Tail)
+		}
+		data, err := ioutil.ReadAll(logFile)
+		if err != nil {
+			return err
+		}
+		if _, err := stdout.Write(lastLines(data, lines)); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(stdout, logFile); err != nil {
+		return err
+	}
+	if !options.Follow {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.done:
+			_, err := io.Copy(stdout, logFile)
+			return err
+		case <-time.After(logPollPeriod):
+			if _, err := io.Copy(stdout, logFile); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// lastLines returns the last n lines of data.
+func lastLines(data []byte, n int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for ; n > 0; n-- {
+		end = bytes.LastIndexByte(data[:end], '\n')
+		if end < 0 {
+			return data
+		}
+	}
+	return data[end+1:]
+}
+
+// DialContainerPort connects to port on the host, since processes share its network.
+func (r *ProcessRuntime) DialContainerPort(id string, port int) (net.Conn, error) {
+	if _, err := r.getProcess(id); err != nil {
+		return nil, err
+	}
+	return net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 10*time.Second)
+}
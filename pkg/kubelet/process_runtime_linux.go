@@ -0,0 +1,15 @@
+package kubelet
+
+import (
+	"syscall"
+)
+
+// processAttributes chroots a process to root and gives it namespaces of its own, all
+// but the network's.
+func processAttributes(root string) (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{
+		Chroot:     root,
+		Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC,
+		Setsid:     true,
+	}, nil
+}
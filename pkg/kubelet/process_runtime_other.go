@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package kubelet
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// processAttributes fails, since processes can only be isolated on Linux.
+func processAttributes(root string) (*syscall.SysProcAttr, error) {
+	return nil, fmt.Errorf("processes can only run as containers on Linux")
+}
@@ -0,0 +1,107 @@
+package kubelet
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func TestLastLines(t *testing.T) {
+	for _, test := range []struct {
+		data     string
+		lines    int
+		expected string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 1, "c"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"a\nb\n", 0, ""},
+		{"", 1, ""},
+	} {
+		if actual := string(lastLines([]byte(test.data), test.lines)); actual != test.expected {
+			t.Errorf("Expected %q for the last %d lines of %q, got %q", test.expected, test.lines, test.data, actual)
+		}
+	}
+}
+
+func TestProcessRuntimeRejectsContainers(t *testing.T) {
+	imageRoot, err := ioutil.TempDir("", "images")
+	expectNoError(t, err)
+	defer os.RemoveAll(imageRoot)
+	processRuntime := NewProcessRuntime(imageRoot, imageRoot)
+	manifest := api.ContainerManifest{Id: "foo"}
+
+	verifyError(t, processRuntime.PullImage("redis", ioutil.Discard))
+	verifyError(t, processRuntime.PullImage("../images", ioutil.Discard))
+	_, err = processRuntime.CreateContainer(&manifest, &api.Container{Name: "bar", Image: "redis"})
+	verifyError(t, err)
+	_, err = processRuntime.CreateContainer(&manifest, &api.Container{
+		Name:         "bar",
+		Image:        "redis",
+		Command:      api.CommandLine{"/bin/redis-server"},
+		VolumeMounts: []api.VolumeMount{{Name: "data", MountPath: "/data"}},
+	})
+	verifyError(t, err)
+	verifyError(t, processRuntime.StartContainer("1"))
+}
+
+// TestProcessRuntime runs processes in the host's root filesystem, which needs root.
+func TestProcessRuntime(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("processes can only be run as containers by root on Linux")
+	}
+	logRoot, err := ioutil.TempDir("", "logs")
+	expectNoError(t, err)
+	defer os.RemoveAll(logRoot)
+	processRuntime := NewProcessRuntime("/", logRoot)
+	manifest := api.ContainerManifest{Id: "foo"}
+	expectNoError(t, processRuntime.PullImage("/", ioutil.Discard))
+
+	echo, err := processRuntime.CreateContainer(&manifest, &api.Container{Name: "echo", Image: "/", Command: api.CommandLine{"/bin/echo", "hello", "world"}})
+	expectNoError(t, err)
+	expectNoError(t, processRuntime.StartContainer(echo))
+	var output bytes.Buffer
+	expectNoError(t, processRuntime.ContainerLogs(context.Background(), echo, LogOptions{Tail: "all", Follow: true}, &output, &output))
+	verifyStringEquals(t, output.String(), "hello world\n")
+	info, err := processRuntime.InspectContainer(echo)
+	expectNoError(t, err)
+	if info := info.(ProcessInfo); info.Running || info.ExitCode != 0 || info.Name != "echo" {
+		t.Errorf("Unexpected info: %#v", info)
+	}
+	exit, err := processRuntime.ExitStatus(echo)
+	expectNoError(t, err)
+	if exit.ExitCode != 0 || exit.FinishedAt.IsZero() {
+		t.Errorf("Unexpected exit: %#v", exit)
+	}
+	output.Reset()
+	expectNoError(t, processRuntime.ContainerLogs(context.Background(), echo, LogOptions{Tail: "0"}, &output, &output))
+	verifyStringEquals(t, output.String(), "")
+
+	sleep, err := processRuntime.CreateContainer(&manifest, &api.Container{Name: "sleep", Image: "/", Command: api.CommandLine{"/bin/sleep", "60"}})
+	expectNoError(t, err)
+	expectNoError(t, processRuntime.StartContainer(sleep))
+	running, err := processRuntime.ListContainers(false)
+	expectNoError(t, err)
+	all, err := processRuntime.ListContainers(true)
+	expectNoError(t, err)
+	if len(running) != 1 || running[0].ID != sleep || !running[0].Running ||
+		len(all) != 2 || all[0].ID != sleep || all[1] != (RuntimeContainer{ID: echo, ManifestID: "foo", Name: "echo"}) {
+		t.Errorf("Unexpected containers %#v of %#v", running, all)
+	}
+	// sleep is the init of its PID namespace, so it ignores SIGTERM and has to be killed.
+	expectNoError(t, processRuntime.StopContainer(sleep, 100*time.Millisecond))
+	running, err = processRuntime.ListContainers(false)
+	expectNoError(t, err)
+	if len(running) != 0 {
+		t.Errorf("Unexpected containers: %#v", running)
+	}
+	exit, err = processRuntime.ExitStatus(sleep)
+	expectNoError(t, err)
+	verifyIntEquals(t, exit.ExitCode, 137)
+}
@@ -0,0 +1,173 @@
+package kubelet
+
+import (
+	"log"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// The backoff between runs of a container which keeps stopping or failing to start
+// doubles from initialRestartBackoff up to maxRestartBackoff, and starts over once the
+// container has kept running for restartBackoffReset.
+const (
+	initialRestartBackoff = 10 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+	restartBackoffReset   = 10 * time.Minute
+)
+
+// containerKey names a container of a manifest.
+type containerKey struct {
+	manifestID string
+	name       string
+}
+
+// restartState is what the kubelet remembers of the runs of a container of a manifest,
+// across syncs. It's lost when the kubelet restarts.
+type restartState struct {
+	restarts int
+	// backoff is how long after the container last stopped it's run again.
+	backoff time.Duration
+	// started is when the container was last run, and stopped when it last stopped or
+	// failed to start.
+	started time.Time
+	stopped time.Time
+	// failed is whether the container failed to start when last run.
+	failed bool
+	// termination is how the container exitedID, the last to stop, exited.
+	termination *api.ContainerTermination
+	exitedID    string
+}
+
+// nextBackoff returns the backoff after one of backoff.
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return initialRestartBackoff
+	}
+	if backoff*2 > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+	return backoff * 2
+}
+
+// termination returns how a container which exited as exit terminated.
+func termination(exit ContainerExit) *api.ContainerTermination {
+	reason := "Completed"
+	if exit.OOMKilled {
+		reason = "OOMKilled"
+	} else if exit.ExitCode != 0 {
+		reason = "Error"
+	}
+	return &api.ContainerTermination{
+		ExitCode:   exit.ExitCode,
+		Reason:     reason,
+		FinishedAt: exit.FinishedAt.Format(time.RFC3339),
+	}
+}
+
+// latestContainer returns the newest container of container of manifest, running or not.
+func (sl *Kubelet) latestContainer(manifest *api.ContainerManifest, container *api.Container) (RuntimeContainer, bool, error) {
+	containers, err := sl.Runtime.ListContainers(true)
+	if err != nil {
+		return RuntimeContainer{}, false, err
+	}
+	for _, value := range containers {
+		if value.ManifestID == manifest.Id && value.Name == container.Name {
+			return value, true, nil
+		}
+	}
+	return RuntimeContainer{}, false, nil
+}
+
+// syncContainer runs container of manifest, unless it's running already, the restart
+// policy of manifest keeps it stopped, or it's backing off. It returns the ID of the
+// running container, which is empty if there is none.
+func (sl *Kubelet) syncContainer(manifest *api.ContainerManifest, container *api.Container) (string, error) {
+	latest, found, err := sl.latestContainer(manifest, container)
+	if err != nil {
+		return "", err
+	}
+	key := containerKey{manifest.Id, container.Name}
+	sl.lock.Lock()
+	if sl.restarts == nil {
+		sl.restarts = map[containerKey]*restartState{}
+	}
+	state, known := sl.restarts[key]
+	if !known {
+		state = &restartState{}
+		sl.restarts[key] = state
+	}
+	if found && latest.Running {
+		if time.Since(state.started) >= restartBackoffReset {
+			state.backoff = 0
+		}
+		sl.lock.Unlock()
+		log.Printf("%#v exists as %v", container.Name, latest.ID)
+		return latest.ID, nil
+	}
+	exitedID := state.exitedID
+	sl.lock.Unlock()
+
+	if found && latest.ID != exitedID {
+		exit, err := sl.Runtime.ExitStatus(latest.ID)
+		if err != nil {
+			return "", err
+		}
+		sl.lock.Lock()
+		state.exitedID = latest.ID
+		// A container which never ran failed to start, when it was run.
+		state.failed = exit.FinishedAt.IsZero()
+		if !state.failed {
+			state.stopped = exit.FinishedAt
+			state.termination = termination(exit)
+		}
+		sl.lock.Unlock()
+	}
+
+	first := !known && !found
+	sl.lock.Lock()
+	if !first && !state.failed {
+		policy := manifest.RestartPolicy
+		if policy == api.RestartNever || policy == api.RestartOnFailure && state.termination != nil && state.termination.Reason == "Completed" {
+			sl.lock.Unlock()
+			return "", nil
+		}
+	}
+	if !first && time.Since(state.stopped) < state.backoff {
+		sl.lock.Unlock()
+		log.Printf("%#v stopped, backing off for %v", container.Name, state.backoff)
+		return "", nil
+	}
+	sl.lock.Unlock()
+
+	log.Printf("%#v isn't running, running it", container.Name)
+	id, err := sl.RunContainer(manifest, container)
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+	if !first {
+		state.restarts++
+		state.backoff = nextBackoff(state.backoff)
+	}
+	state.started = time.Now()
+	state.failed = err != nil
+	if err != nil {
+		state.stopped = state.started
+		return "", err
+	}
+	return id, nil
+}
+
+// containerStatuses returns the statuses of the containers of manifest. The caller
+// holds sl.lock.
+func (sl *Kubelet) containerStatuses(manifest *api.ContainerManifest) []api.ContainerStatus {
+	statuses := []api.ContainerStatus{}
+	for _, container := range manifest.Containers {
+		status := api.ContainerStatus{Name: container.Name}
+		if state, ok := sl.restarts[containerKey{manifest.Id, container.Name}]; ok {
+			status.RestartCount = state.restarts
+			status.LastTermination = state.termination
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
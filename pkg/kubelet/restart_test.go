@@ -0,0 +1,146 @@
+package kubelet
+
+import (
+	"testing"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+func TestNextBackoff(t *testing.T) {
+	backoff := time.Duration(0)
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 5 * time.Minute, 5 * time.Minute}
+	for _, value := range expected {
+		backoff = nextBackoff(backoff)
+		if backoff != value {
+			t.Errorf("Expected %v, got %v", value, backoff)
+		}
+	}
+}
+
+func TestTermination(t *testing.T) {
+	finished := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		exit   ContainerExit
+		reason string
+	}{
+		{ContainerExit{ExitCode: 0, FinishedAt: finished}, "Completed"},
+		{ContainerExit{ExitCode: 1, FinishedAt: finished}, "Error"},
+		{ContainerExit{ExitCode: 137, OOMKilled: true, FinishedAt: finished}, "OOMKilled"},
+	} {
+		expected := api.ContainerTermination{ExitCode: test.exit.ExitCode, Reason: test.reason, FinishedAt: "2014-06-01T12:00:00Z"}
+		if actual := termination(test.exit); *actual != expected {
+			t.Errorf("Expected %#v, got %#v", expected, *actual)
+		}
+	}
+}
+
+func TestSyncContainerRestartPolicy(t *testing.T) {
+	finished := time.Now().Add(-time.Minute)
+	for _, test := range []struct {
+		policy   api.RestartPolicy
+		exitCode int
+		restart  bool
+	}{
+		{"", 0, true},
+		{api.RestartAlways, 0, true},
+		{api.RestartOnFailure, 0, false},
+		{api.RestartOnFailure, 1, true},
+		{api.RestartNever, 1, false},
+	} {
+		runtime := &FakeRuntime{
+			containers: []RuntimeContainer{{ID: "1", ManifestID: "foo", Name: "bar"}},
+			exits:      map[string]ContainerExit{"1": {ExitCode: test.exitCode, FinishedAt: finished}},
+			images:     map[string]bool{"redis:2.8": true},
+		}
+		kubelet := Kubelet{
+			Runtime: runtime,
+		}
+		manifest := api.ContainerManifest{
+			Id:            "foo",
+			RestartPolicy: test.policy,
+			Containers:    []api.Container{{Name: "bar", Image: "redis:2.8"}},
+		}
+		id, err := kubelet.syncContainer(&manifest, &manifest.Containers[0])
+		expectNoError(t, err)
+		if test.restart {
+			verifyStringEquals(t, id, "2")
+			verifyStringArrayEquals(t, runtime.started, []string{"2"})
+		} else {
+			verifyStringEquals(t, id, "")
+			verifyStringArrayEquals(t, runtime.started, nil)
+		}
+		statuses := kubelet.containerStatuses(&manifest)
+		if len(statuses) != 1 || statuses[0].LastTermination == nil || statuses[0].LastTermination.ExitCode != test.exitCode {
+			t.Errorf("Unexpected statuses: %#v", statuses)
+		}
+	}
+}
+
+func TestSyncContainerBackoff(t *testing.T) {
+	runtime := &FakeRuntime{}
+	kubelet := Kubelet{
+		Runtime: runtime,
+	}
+	// The image can't be pulled, so every run fails.
+	manifest := api.ContainerManifest{
+		Id:            "foo",
+		RestartPolicy: api.RestartNever,
+		Containers:    []api.Container{{Name: "bar", Image: "redis:2.8", ImagePullPolicy: api.PullNever}},
+	}
+	container := &manifest.Containers[0]
+	key := containerKey{"foo", "bar"}
+
+	_, err := kubelet.syncContainer(&manifest, container)
+	verifyError(t, err)
+	// Containers which fail to start are retried whatever the policy.
+	_, err = kubelet.syncContainer(&manifest, container)
+	verifyError(t, err)
+	if state := kubelet.restarts[key]; state.restarts != 1 || state.backoff != 10*time.Second {
+		t.Errorf("Unexpected state: %#v", state)
+	}
+	_, err = kubelet.syncContainer(&manifest, container)
+	expectNoError(t, err)
+	if state := kubelet.restarts[key]; state.restarts != 1 {
+		t.Errorf("Unexpected state: %#v", state)
+	}
+
+	kubelet.restarts[key].stopped = time.Now().Add(-10 * time.Second)
+	_, err = kubelet.syncContainer(&manifest, container)
+	verifyError(t, err)
+	if state := kubelet.restarts[key]; state.restarts != 2 || state.backoff != 20*time.Second {
+		t.Errorf("Unexpected state: %#v", state)
+	}
+	statuses := kubelet.containerStatuses(&manifest)
+	if len(statuses) != 1 || statuses[0].RestartCount != 2 || statuses[0].LastTermination != nil {
+		t.Errorf("Unexpected statuses: %#v", statuses)
+	}
+
+	// Once the manifest is gone, so are its restarts.
+	expectNoError(t, kubelet.SyncManifests(nil))
+	if len(kubelet.restarts) != 0 {
+		t.Errorf("Unexpected restarts: %#v", kubelet.restarts)
+	}
+}
+
+func TestSyncContainerResetsBackoff(t *testing.T) {
+	runtime := &FakeRuntime{
+		containers: []RuntimeContainer{{ID: "1", ManifestID: "foo", Name: "bar", Running: true}},
+	}
+	kubelet := Kubelet{
+		Runtime: runtime,
+		restarts: map[containerKey]*restartState{
+			{"foo", "bar"}: {restarts: 3, backoff: 40 * time.Second, started: time.Now().Add(-restartBackoffReset)},
+		},
+	}
+	manifest := api.ContainerManifest{
+		Id:         "foo",
+		Containers: []api.Container{{Name: "bar"}},
+	}
+	id, err := kubelet.syncContainer(&manifest, &manifest.Containers[0])
+	expectNoError(t, err)
+	verifyStringEquals(t, id, "1")
+	if state := kubelet.restarts[containerKey{"foo", "bar"}]; state.restarts != 3 || state.backoff != 0 {
+		t.Errorf("Unexpected state: %#v", state)
+	}
+}
@@ -0,0 +1,84 @@
+package kubelet
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/stream"
+)
+
+// RuntimeContainer is a container, as listed by a ContainerRuntime.
+type RuntimeContainer struct {
+	// ID is the runtime's name for the container.
+	ID string
+	// ManifestID and Name are the manifest the container was created for and the name
+	// of the container within it.
+	ManifestID string
+	Name       string
+	Running    bool
+}
+
+// LogOptions select the part of a container's output to read.
+type LogOptions struct {
+	// Tail is the number of lines to start from, counted from the end, or "all".
+	Tail string
+	// Follow keeps reading as the container writes more, until it exits.
+	Follow bool
+	// Timestamps prefixes every line with the time it was written.
+	Timestamps bool
+}
+
+// ContainerExit is how a stopped container exited.
+type ContainerExit struct {
+	ExitCode  int
+	OOMKilled bool
+	// FinishedAt is zero if the container never ran.
+	FinishedAt time.Time
+}
+
+// ContainerRuntime runs the containers of manifests on this host. Every container is
+// created for a container of a manifest, and must be listed with the IDs of both, so
+// that the kubelet can tell which of the containers it wants are already there.
+type ContainerRuntime interface {
+	// ImagePresent returns true if containers can be created from image without pulling it.
+	ImagePresent(image string) (bool, error)
+	// PullImage makes image available to the containers created from it, and writes
+	// its progress to progress, a line at a time.
+	PullImage(image string, progress io.Writer) error
+	// CreateContainer creates, but doesn't start, a container for container of manifest,
+	// and returns its ID.
+	CreateContainer(manifest *api.ContainerManifest, container *api.Container) (string, error)
+	StartContainer(id string) error
+	// StopContainer asks the container id to stop, and kills it if it hasn't after timeout.
+	StopContainer(id string, timeout time.Duration) error
+	// ListContainers returns the running containers, newest first. With all set the
+	// stopped ones are listed too.
+	ListContainers(all bool) ([]RuntimeContainer, error)
+	// InspectContainer returns whatever the runtime knows about the container id, to be
+	// served as JSON.
+	InspectContainer(id string) (interface{}, error)
+	// ExitStatus returns how the stopped container id exited.
+	ExitStatus(id string) (ContainerExit, error)
+	// ContainerLogs copies the output of the container id to stdout and stderr. A
+	// followed log ends once the container exits or ctx is done.
+	ContainerLogs(ctx context.Context, id string, options LogOptions, stdout, stderr io.Writer) error
+}
+
+// CommandRunner is implemented by runtimes which can run commands in their containers.
+type CommandRunner interface {
+	// RunInContainer runs command in the container id until it exits, and returns its
+	// exit code. stdin, which may be nil, is the command's input. With tty set the
+	// command runs in a terminal, which writes everything to stdout and is resized to
+	// every size read from resize; resize must be closed by the caller once it's done
+	// with it.
+	RunInContainer(id string, command []string, tty bool, stdin io.Reader, stdout, stderr io.Writer, resize <-chan stream.TerminalSize) (int, error)
+}
+
+// PortDialer is implemented by runtimes which can connect to the ports of their
+// containers.
+type PortDialer interface {
+	DialContainerPort(id string, port int) (net.Conn, error)
+}
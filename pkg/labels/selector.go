@@ -0,0 +1,303 @@
+// Package labels implements the selector language used to pick objects by their labels,
+// for example "name=frontend,tier in (web,cache),!canary".
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Operator is the relation a Requirement asks for between a label and its values.
+type Operator string
+
+const (
+	// Equals requires the label to be present with the value, "key=value" or "key==value".
+	Equals Operator = "="
+	// NotEquals requires the label to be absent or to have another value, "key!=value".
+	NotEquals Operator = "!="
+	// In requires the label to have one of the values, "key in (a,b)".
+	In Operator = "in"
+	// NotIn requires the label to be absent or to have none of the values, "key notin (a,b)".
+	NotIn Operator = "notin"
+	// Exists requires the label to be present, "key".
+	Exists Operator = "exists"
+	// DoesNotExist requires the label to be absent, "!key".
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a single term of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	// Values is empty for Exists and DoesNotExist, and has one entry for Equals and
+	// NotEquals.
+	Values []string
+}
+
+func (r Requirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if labels satisfy the requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, present := labels[r.Key]
+	switch r.Operator {
+	case Equals, In:
+		return present && r.hasValue(value)
+	case NotEquals, NotIn:
+		return !present || !r.hasValue(value)
+	case Exists:
+		return present
+	case DoesNotExist:
+		return !present
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Equals, NotEquals:
+		return r.Key + string(r.Operator) + r.Values[0]
+	case In, NotIn:
+		return r.Key + " " + string(r.Operator) + " (" + strings.Join(r.Values, ",") + ")"
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	}
+	return ""
+}
+
+// Selector matches the labels which satisfy all of its requirements. A nil or empty
+// Selector matches everything.
+type Selector []Requirement
+
+// Everything returns a selector which matches all labels.
+func Everything() Selector {
+	return nil
+}
+
+// SelectorFromSet returns a selector requiring every label in set, with the same value.
+func SelectorFromSet(set map[string]string) Selector {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	// Sorted, so that the selector prints the same way every time.
+	sort.Strings(keys)
+	selector := Selector{}
+	for _, key := range keys {
+		selector = append(selector, Requirement{Key: key, Operator: Equals, Values: []string{set[key]}})
+	}
+	return selector
+}
+
+// Matches returns true if labels satisfy every requirement of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector matches everything.
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// RequiredValues returns the labels the selector pins to a single value, with "key=value"
+// or "key in (value)". Every label set it matches carries them.
+func (s Selector) RequiredValues() map[string]string {
+	values := map[string]string{}
+	for _, r := range s {
+		if (r.Operator == Equals || r.Operator == In) && len(r.Values) == 1 {
+			values[r.Key] = r.Values[0]
+		}
+	}
+	return values
+}
+
+// String returns the selector in the form Parse reads.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, r := range s {
+		terms = append(terms, r.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+// Parse reads a selector: a comma separated list of terms, each one of
+//
+//	key=value, key==value    the label is present with the value
+//	key!=value               the label is absent, or has another value
+//	key in (v1,v2)           the label is present with one of the values
+//	key notin (v1,v2)        the label is absent, or has none of the values
+//	key                      the label is present
+//	!key                     the label is absent
+//
+// Whitespace around terms, operators and values is ignored. The empty string selects
+// everything.
+func Parse(selector string) (Selector, error) {
+	p := &parser{tokens: lex(selector), selector: selector}
+	result := Selector{}
+	if len(p.tokens) == 0 {
+		return result, nil
+	}
+	for {
+		r, err := p.parseRequirement()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+		switch token := p.next(); token {
+		case "":
+			return result, nil
+		case ",":
+		default:
+			return nil, p.errorf("expected ',' but found %q", token)
+		}
+	}
+}
+
+// The tokens which aren't keys or values.
+var punctuation = []string{"==", "!=", "=", "!", ",", "(", ")"}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isPunctuation(c byte) bool {
+	return strings.IndexByte("=!,()", c) != -1
+}
+
+// lex splits a selector into punctuation and words.
+func lex(selector string) []string {
+	tokens := []string{}
+	for i := 0; i < len(selector); {
+		if isSpace(selector[i]) {
+			i++
+			continue
+		}
+		if isPunctuation(selector[i]) {
+			for _, p := range punctuation {
+				if strings.HasPrefix(selector[i:], p) {
+					tokens = append(tokens, p)
+					i += len(p)
+					break
+				}
+			}
+			continue
+		}
+		start := i
+		for i < len(selector) && !isSpace(selector[i]) && !isPunctuation(selector[i]) {
+			i++
+		}
+		tokens = append(tokens, selector[start:i])
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens   []string
+	position int
+	selector string
+}
+
+// peek returns the next token without consuming it, or "" at the end.
+func (p *parser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	if p.position < len(p.tokens) {
+		p.position++
+	}
+	return token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid label selector %q: %s", p.selector, fmt.Sprintf(format, args...))
+}
+
+func isWord(token string) bool {
+	return len(token) > 0 && !isPunctuation(token[0])
+}
+
+// key reads a label key.
+func (p *parser) key() (string, error) {
+	token := p.next()
+	if !isWord(token) {
+		return "", p.errorf("expected a label key but found %q", token)
+	}
+	return token, nil
+}
+
+// value reads a label value, which may be empty.
+func (p *parser) value() string {
+	if isWord(p.peek()) {
+		return p.next()
+	}
+	return ""
+}
+
+func (p *parser) parseRequirement() (Requirement, error) {
+	if p.peek() == "!" {
+		p.next()
+		key, err := p.key()
+		return Requirement{Key: key, Operator: DoesNotExist}, err
+	}
+	key, err := p.key()
+	if err != nil {
+		return Requirement{}, err
+	}
+	switch token := p.peek(); token {
+	case "", ",":
+		return Requirement{Key: key, Operator: Exists}, nil
+	case "=", "==":
+		p.next()
+		return Requirement{Key: key, Operator: Equals, Values: []string{p.value()}}, nil
+	case "!=":
+		p.next()
+		return Requirement{Key: key, Operator: NotEquals, Values: []string{p.value()}}, nil
+	case string(In), string(NotIn):
+		p.next()
+		values, err := p.values()
+		return Requirement{Key: key, Operator: Operator(token), Values: values}, err
+	default:
+		return Requirement{}, p.errorf("expected an operator after %q but found %q", key, token)
+	}
+}
+
+// values reads a parenthesized, comma separated list of at least one value.
+func (p *parser) values() ([]string, error) {
+	if token := p.next(); token != "(" {
+		return nil, p.errorf("expected '(' but found %q", token)
+	}
+	values := []string{}
+	for {
+		value := p.next()
+		if !isWord(value) {
+			return nil, p.errorf("expected a value but found %q", value)
+		}
+		values = append(values, value)
+		switch token := p.next(); token {
+		case ")":
+			return values, nil
+		case ",":
+		default:
+			return nil, p.errorf("expected ',' or ')' but found %q", token)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	table := []struct {
+		selector string
+		expected Selector
+		printed  string
+	}{
+		{"", Selector{}, ""},
+		{"name=foo", Selector{{"name", Equals, []string{"foo"}}}, "name=foo"},
+		{" name == foo ", Selector{{"name", Equals, []string{"foo"}}}, "name=foo"},
+		{"name=", Selector{{"name", Equals, []string{""}}}, "name="},
+		{"name!=foo,tier", Selector{{"name", NotEquals, []string{"foo"}}, {"tier", Exists, nil}}, "name!=foo,tier"},
+		{"!canary", Selector{{"canary", DoesNotExist, nil}}, "!canary"},
+		{"tier in (web, cache),env notin (dev)", Selector{
+			{"tier", In, []string{"web", "cache"}},
+			{"env", NotIn, []string{"dev"}},
+		}, "tier in (web,cache),env notin (dev)"},
+	}
+	for _, item := range table {
+		selector, err := Parse(item.selector)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", item.selector, err)
+			continue
+		}
+		if !reflect.DeepEqual(selector, item.expected) {
+			t.Errorf("Expected %#v for %q, got %#v", item.expected, item.selector, selector)
+		}
+		if printed := selector.String(); printed != item.printed {
+			t.Errorf("Expected %q to print as %q, got %q", item.selector, item.printed, printed)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, selector := range []string{
+		"=foo",
+		"name=foo,",
+		"name foo",
+		"name=foo bar",
+		"name in foo",
+		"name in ()",
+		"name in (a,)",
+		"name in (a b)",
+		"!",
+		"!=foo",
+		",",
+	} {
+		if _, err := Parse(selector); err == nil {
+			t.Errorf("Expected an error parsing %q", selector)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	labels := map[string]string{"name": "foo", "tier": "web"}
+	table := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"name=foo", true},
+		{"name=foo,tier=web", true},
+		{"name=bar", false},
+		{"name=foo,tier=cache", false},
+		{"name!=bar", true},
+		{"name!=foo", false},
+		{"env!=prod", true},
+		{"tier in (web,cache)", true},
+		{"tier in (cache)", false},
+		{"env in (prod)", false},
+		{"tier notin (cache)", true},
+		{"tier notin (web)", false},
+		{"env notin (prod)", true},
+		{"name", true},
+		{"env", false},
+		{"!env", true},
+		{"!name", false},
+	}
+	for _, item := range table {
+		selector, err := Parse(item.selector)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", item.selector, err)
+			continue
+		}
+		if selector.Matches(labels) != item.matches {
+			t.Errorf("Expected %q matching %v to be %v", item.selector, labels, item.matches)
+		}
+	}
+}
+
+func TestSelectorFromSet(t *testing.T) {
+	selector := SelectorFromSet(map[string]string{"name": "baz", "foo": "bar"})
+	if s := selector.String(); s != "foo=bar,name=baz" {
+		t.Errorf("Unexpected selector: %s", s)
+	}
+	if !selector.Matches(map[string]string{"foo": "bar", "name": "baz", "other": "x"}) {
+		t.Errorf("Expected %v to match", selector)
+	}
+	if selector.Matches(map[string]string{"foo": "bar"}) {
+		t.Errorf("Expected %v not to match", selector)
+	}
+	if !SelectorFromSet(nil).Empty() || !Everything().Matches(nil) {
+		t.Errorf("Expected an empty set to select everything")
+	}
+}
+
+func TestRequiredValues(t *testing.T) {
+	selector, err := Parse("name=foo,tier in (web),env in (a,b),!canary")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"name": "foo", "tier": "web"}
+	if values := selector.RequiredValues(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
@@ -36,6 +36,16 @@ type EndpointsUpdate struct {
 	Op        Operation
 }
 
+// ServiceKey names the service, or the endpoints of the service, called name in
+// namespace. Services in the default namespace are known by their name alone.
+func ServiceKey(namespace, name string) string {
+	namespace = api.NamespaceOrDefault(namespace)
+	if namespace == api.NamespaceDefault {
+		return name
+	}
+	return namespace + "/" + name
+}
+
 type ServiceConfigHandler interface {
 	// Sent when a configuration has been changed by one of the sources. This is the
 	// union of all the configuration sources.
@@ -118,19 +128,19 @@ func (impl *ServiceConfig) ServiceChannelListener(source string, listenChannel c
 			case ADD:
 				log.Printf("Adding new service from source %s : %v", source, update.Services)
 				for _, value := range update.Services {
-					serviceMap[value.ID] = value
+					serviceMap[ServiceKey(value.Namespace, value.ID)] = value
 				}
 			case REMOVE:
 				log.Printf("Removing a service %v", update)
 				for _, value := range update.Services {
-					delete(serviceMap, value.ID)
+					delete(serviceMap, ServiceKey(value.Namespace, value.ID))
 				}
 			case SET:
 				log.Printf("Setting services %v", update)
 				// Clear the old map entries by just creating a new map
 				serviceMap = make(map[string]api.Service)
 				for _, value := range update.Services {
-					serviceMap[value.ID] = value
+					serviceMap[ServiceKey(value.Namespace, value.ID)] = value
 				}
 			default:
 				log.Printf("Received invalid update type: %v", update)
@@ -153,12 +163,12 @@ func (impl *ServiceConfig) EndpointsChannelListener(source string, listenChannel
 			case ADD:
 				log.Printf("Adding a new endpoint %v", update)
 				for _, value := range update.Endpoints {
-					endpointMap[value.Name] = value
+					endpointMap[ServiceKey(value.Namespace, value.Name)] = value
 				}
 			case REMOVE:
 				log.Printf("Removing an endpoint %v", update)
 				for _, value := range update.Endpoints {
-					delete(endpointMap, value.Name)
+					delete(endpointMap, ServiceKey(value.Namespace, value.Name))
 				}
 
 			case SET:
@@ -166,7 +176,7 @@ func (impl *ServiceConfig) EndpointsChannelListener(source string, listenChannel
 				// Clear the old map entries by just creating a new map
 				endpointMap = make(map[string]api.Endpoints)
 				for _, value := range update.Endpoints {
-					endpointMap[value.Name] = value
+					endpointMap[ServiceKey(value.Namespace, value.Name)] = value
 				}
 			default:
 				log.Printf("Received invalid update type: %v", update)
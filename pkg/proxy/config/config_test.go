@@ -222,3 +222,16 @@ func TestNewMultipleSourcesEndpointsMultipleHandlersAddRemoveSetAndNotified(t *t
 	handler.ValidateEndpoints(t, endpoints)
 	handler2.ValidateEndpoints(t, endpoints)
 }
+
+func TestServiceKey(t *testing.T) {
+	table := []struct{ namespace, name, key string }{
+		{"", "mysql", "mysql"},
+		{api.NamespaceDefault, "mysql", "mysql"},
+		{"payments", "mysql", "payments/mysql"},
+	}
+	for _, item := range table {
+		if key := ServiceKey(item.namespace, item.name); key != item.key {
+			t.Errorf("Expected %q for %q in %q, got %q", item.key, item.name, item.namespace, key)
+		}
+	}
+}
@@ -77,40 +77,55 @@ func (impl ConfigSourceEtcd) Run() {
 // Finds the list of services and their endpoints from etcd.
 // This operation is akin to a set a known good at regular intervals.
 func (impl ConfigSourceEtcd) GetServices() ([]api.Service, []api.Endpoints, error) {
-	response, err := impl.client.Get(RegistryRoot+"/specs", true, false)
+	// Services are kept in a directory per namespace.
+	response, err := impl.client.Get(RegistryRoot+"/specs", true, true)
 	if err != nil {
 		log.Printf("Failed to get the key %s: %v", RegistryRoot, err)
 		return make([]api.Service, 0), make([]api.Endpoints, 0), err
 	}
 	if response.Node.Dir == true {
-		retServices := make([]api.Service, len(response.Node.Nodes))
-		retEndpoints := make([]api.Endpoints, len(response.Node.Nodes))
+		retServices := []api.Service{}
+		retEndpoints := []api.Endpoints{}
 		// Ok, so we have directories, this list should be the list
 		// of services. Find the local port to listen on and remote endpoints
 		// and create a Service entry for it.
-		for i, node := range response.Node.Nodes {
-			var svc api.Service
-			err = json.Unmarshal([]byte(node.Value), &svc)
-			if err != nil {
-				log.Printf("Failed to load Service: %s (%#v)", node.Value, err)
-				continue
+		for _, namespace := range response.Node.Nodes {
+			nodes := namespace.Nodes
+			if !namespace.Dir {
+				// Services stored before namespaces are in the default namespace, until
+				// the API server moves them there.
+				nodes = []*etcd.Node{namespace}
 			}
-			retServices[i] = svc
-			endpoints, err := impl.GetEndpoints(svc.ID)
-			if err != nil {
-				log.Printf("Couldn't get endpoints for %s : %v skipping", svc.ID, err)
+			for _, node := range nodes {
+				var svc api.Service
+				err = json.Unmarshal([]byte(node.Value), &svc)
+				if err != nil {
+					log.Printf("Failed to load Service: %s (%#v)", node.Value, err)
+					continue
+				}
+				svc.Namespace = api.NamespaceOrDefault(svc.Namespace)
+				retServices = append(retServices, svc)
+				endpoints, err := impl.GetEndpoints(svc.Namespace, svc.ID)
+				if err != nil {
+					log.Printf("Couldn't get endpoints for %s : %v skipping", ServiceKey(svc.Namespace, svc.ID), err)
+				}
+				log.Printf("Got service: %s on localport %d mapping to: %s", ServiceKey(svc.Namespace, svc.ID), svc.Port, endpoints)
+				retEndpoints = append(retEndpoints, endpoints)
 			}
-			log.Printf("Got service: %s on localport %d mapping to: %s", svc.ID, svc.Port, endpoints)
-			retEndpoints[i] = endpoints
 		}
 		return retServices, retEndpoints, err
 	}
 	return nil, nil, fmt.Errorf("did not get the root of the registry %s", RegistryRoot)
 }
 
-func (impl ConfigSourceEtcd) GetEndpoints(service string) (api.Endpoints, error) {
-	key := fmt.Sprintf(RegistryRoot + "/endpoints/" + service)
+func (impl ConfigSourceEtcd) GetEndpoints(namespace, service string) (api.Endpoints, error) {
+	key := RegistryRoot + "/endpoints/" + namespace + "/" + service
 	response, err := impl.client.Get(key, true, false)
+	if err != nil && namespace == api.NamespaceDefault {
+		// The endpoints of the default namespace may not have been moved there yet.
+		key = RegistryRoot + "/endpoints/" + service
+		response, err = impl.client.Get(key, true, false)
+	}
 	if err != nil {
 		log.Printf("Failed to get the key: %s %v", key, err)
 		return api.Endpoints{}, err
@@ -169,10 +184,11 @@ func (impl ConfigSourceEtcd) ProcessChange(response *etcd.Response) {
 		return
 	}
 	if response.Action == "delete" {
+		// Keys look like /registry/services/specs/<namespace>/<name>.
 		parts := strings.Split(response.Node.Key[1:], "/")
-		if len(parts) == 4 {
-			log.Printf("Deleting service: %s", parts[3])
-			serviceUpdate := ServiceUpdate{Op: REMOVE, Services: []api.Service{api.Service{JSONBase: api.JSONBase{ID: parts[3]}}}}
+		if len(parts) == 5 {
+			log.Printf("Deleting service: %s", ServiceKey(parts[3], parts[4]))
+			serviceUpdate := ServiceUpdate{Op: REMOVE, Services: []api.Service{api.Service{JSONBase: api.JSONBase{ID: parts[4], Namespace: parts[3]}}}}
 			impl.serviceChannel <- serviceUpdate
 			return
 		} else {
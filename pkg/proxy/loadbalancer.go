@@ -6,7 +6,8 @@ import (
 
 type LoadBalancer interface {
 	// LoadBalance takes an incoming request and figures out where to route it to.
-	// Determination is based on destination service (for example, 'mysql') as
+	// Determination is based on destination service (for example, 'mysql', or
+	// 'payments/mysql' outside the default namespace, see config.ServiceKey) as
 	// well as the source making the connection.
 	LoadBalance(service string, srcAddr net.Addr) (string, error)
 }
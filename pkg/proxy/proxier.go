@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/proxy/config"
 )
 
 type Proxier struct {
@@ -85,14 +86,15 @@ func (proxier Proxier) AddService(service string, port int) error {
 func (proxier Proxier) OnUpdate(services []api.Service) {
 	log.Printf("Received update notice: %+v", services)
 	for _, service := range services {
-		port, exists := proxier.serviceMap[service.ID]
+		key := config.ServiceKey(service.Namespace, service.ID)
+		port, exists := proxier.serviceMap[key]
 		if !exists || port != service.Port {
-			log.Printf("Adding a new service %s on port %d", service.ID, service.Port)
-			err := proxier.AddService(service.ID, service.Port)
+			log.Printf("Adding a new service %s on port %d", key, service.Port)
+			err := proxier.AddService(key, service.Port)
 			if err == nil {
-				proxier.serviceMap[service.ID] = service.Port
+				proxier.serviceMap[key] = service.Port
 			} else {
-				log.Printf("Failed to start listening for %s on %d", service.ID, service.Port)
+				log.Printf("Failed to start listening for %s on %d", key, service.Port)
 			}
 		}
 	}
@@ -33,7 +33,7 @@ func TestProxy(t *testing.T) {
 	}()
 
 	lb := NewLoadBalancerRR()
-	lb.OnUpdate([]api.Endpoints{{"echo", []string{"127.0.0.1:2222"}}})
+	lb.OnUpdate([]api.Endpoints{{Name: "echo", Endpoints: []string{"127.0.0.1:2222"}}})
 
 	p := NewProxier(lb)
 	if err := p.AddService("echo", 2223); err != nil {
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/proxy/config"
 )
 
 type LoadBalancerRR struct {
@@ -66,14 +67,15 @@ func (impl LoadBalancerRR) OnUpdate(endpoints []api.Endpoints) {
 	defer impl.lock.Unlock()
 	// First update / add all new endpoints for services.
 	for _, value := range endpoints {
-		existingEndpoints, exists := impl.endpointsMap[value.Name]
+		key := config.ServiceKey(value.Namespace, value.Name)
+		existingEndpoints, exists := impl.endpointsMap[key]
 		if !exists || !reflect.DeepEqual(value.Endpoints, existingEndpoints) {
-			log.Printf("LoadBalancerRR: Setting endpoints for %s to %+v", value.Name, value.Endpoints)
-			impl.endpointsMap[value.Name] = impl.FilterValidEndpoints(value.Endpoints)
+			log.Printf("LoadBalancerRR: Setting endpoints for %s to %+v", key, value.Endpoints)
+			impl.endpointsMap[key] = impl.FilterValidEndpoints(value.Endpoints)
 			// Start RR from the beginning if added or updated.
-			impl.rrIndex[value.Name] = 0
+			impl.rrIndex[key] = 0
 		}
-		tmp[value.Name] = true
+		tmp[key] = true
 	}
 	// Then remove any endpoints no longer relevant
 	for key, value := range impl.endpointsMap {
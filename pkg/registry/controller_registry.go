@@ -1,54 +1,180 @@
 package registry
 
 import (
-	"encoding/json"
-
 	"net/url"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/api/validation"
 	"k8s-firstcommit/pkg/apiserver"
+	"k8s-firstcommit/pkg/fields"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
 // Implementation of RESTStorage for the api server.
 type ControllerRegistryStorage struct {
 	registry ControllerRegistry
+	// quota limits the controllers of each namespace, nil if there are no quotas.
+	quota *QuotaTracker
+	pager listPager
 }
 
-func MakeControllerRegistryStorage(registry ControllerRegistry) apiserver.RESTStorage {
+func MakeControllerRegistryStorage(registry ControllerRegistry, quota *QuotaTracker) apiserver.RESTStorage {
 	return &ControllerRegistryStorage{
 		registry: registry,
+		quota:    quota,
 	}
 }
 
-func (storage *ControllerRegistryStorage) List(*url.URL) (interface{}, error) {
+// selectorsFromURL returns the label and field selectors of a request for controllers.
+func (storage *ControllerRegistryStorage) selectorsFromURL(url *url.URL) (labels.Selector, fields.Selector, error) {
+	selector, err := selectorFromURL(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldSelector, err := fieldSelectorFromURL(url, controllerFields(api.ReplicationController{}))
+	return selector, fieldSelector, err
+}
+
+func (storage *ControllerRegistryStorage) List(namespace string, url *url.URL) (interface{}, error) {
 	var result api.ReplicationControllerList
-	controllers, err := storage.registry.ListControllers()
-	if err == nil {
-		result = api.ReplicationControllerList{
-			Items: controllers,
+	selector, fieldSelector, err := storage.selectorsFromURL(url)
+	if err != nil {
+		return result, err
+	}
+	page, err := pageFromURL(namespace, url)
+	if err != nil {
+		return result, err
+	}
+	items, index, next, err := storage.pager.page(page, func() ([]interface{}, uint64, error) {
+		controllers, index, err := listControllersAtIndex(storage.registry, namespace)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := []interface{}{}
+		for _, controller := range controllers {
+			if selector.Matches(controller.Labels) && fieldSelector.Matches(controllerFields(controller)) {
+				items = append(items, controller)
+			}
 		}
+		return items, index, nil
+	})
+	if err != nil {
+		return result, err
 	}
-	return result, err
+	result = api.ReplicationControllerList{
+		JSONBase: api.JSONBase{ResourceVersion: index},
+		Items:    []api.ReplicationController{},
+		Continue: next,
+	}
+	for _, item := range items {
+		result.Items = append(result.Items, item.(api.ReplicationController))
+	}
+	return result, nil
+}
+
+func (storage *ControllerRegistryStorage) Get(namespace, id string) (interface{}, error) {
+	return storage.registry.GetController(namespace, id)
 }
 
-func (storage *ControllerRegistryStorage) Get(id string) (interface{}, error) {
-	return storage.registry.GetController(id)
+func (storage *ControllerRegistryStorage) Delete(namespace, id string) error {
+	return storage.registry.DeleteController(namespace, id)
 }
 
-func (storage *ControllerRegistryStorage) Delete(id string) error {
-	return storage.registry.DeleteController(id)
+// DryRunDelete fails the way Delete would, without deleting anything.
+func (storage *ControllerRegistryStorage) DryRunDelete(namespace, id string) error {
+	_, err := storage.registry.GetController(namespace, id)
+	return err
 }
 
 func (storage *ControllerRegistryStorage) Extract(body string) (interface{}, error) {
 	result := api.ReplicationController{}
-	err := json.Unmarshal([]byte(body), &result)
+	err := api.DecodeInto([]byte(body), &result)
 	return result, err
 }
 
-func (storage *ControllerRegistryStorage) Create(controller interface{}) error {
-	return storage.registry.CreateController(controller.(api.ReplicationController))
+func (storage *ControllerRegistryStorage) Create(controller interface{}) (interface{}, error) {
+	return storage.create(controller, false)
+}
+
+// DryRunCreate does everything Create does but store the controller.
+func (storage *ControllerRegistryStorage) DryRunCreate(controller interface{}) (interface{}, error) {
+	return storage.create(controller, true)
+}
+
+func (storage *ControllerRegistryStorage) create(controller interface{}, dryRun bool) (interface{}, error) {
+	controllerObj := controller.(api.ReplicationController)
+	controllerObj.CreationTimestamp = creationTimestamp()
+	api.DefaultReplicationController(&controllerObj)
+	if errs := validation.ValidateReplicationController(&controllerObj); len(errs) > 0 {
+		return nil, api.NewInvalidErr("replicationController", controllerObj.ID, errs.Causes())
+	}
+	write := func() error {
+		return storage.registry.CreateController(controllerObj)
+	}
+	if dryRun {
+		write = func() error {
+			return checkAbsent("replicationController", controllerObj.ID, func() error {
+				_, err := storage.registry.GetController(controllerObj.Namespace, controllerObj.ID)
+				return err
+			})
+		}
+	}
+	return controllerObj, storage.quota.Admit(controllerObj, nil, write)
+}
+
+func (storage *ControllerRegistryStorage) Update(controller interface{}) (interface{}, error) {
+	return storage.update(controller, false)
+}
+
+// DryRunUpdate does everything Update does but store the controller.
+func (storage *ControllerRegistryStorage) DryRunUpdate(controller interface{}) (interface{}, error) {
+	return storage.update(controller, true)
+}
+
+func (storage *ControllerRegistryStorage) update(controller interface{}, dryRun bool) (interface{}, error) {
+	controllerObj := controller.(api.ReplicationController)
+	api.DefaultReplicationController(&controllerObj)
+	if errs := validation.ValidateReplicationController(&controllerObj); len(errs) > 0 {
+		return nil, api.NewInvalidErr("replicationController", controllerObj.ID, errs.Causes())
+	}
+	existing, err := storage.registry.GetController(controllerObj.Namespace, controllerObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	controllerObj.CreationTimestamp = existing.CreationTimestamp
+	write := func() error {
+		return storage.registry.UpdateController(controllerObj)
+	}
+	if dryRun {
+		write = func() error {
+			return checkResourceVersion("replicationController", controllerObj.ID, existing.ResourceVersion, controllerObj.ResourceVersion)
+		}
+	}
+	return controllerObj, storage.quota.Admit(controllerObj, *existing, write)
+}
+
+func (storage *ControllerRegistryStorage) WatchAll(namespace string, url *url.URL) (watch.Interface, error) {
+	selector, fieldSelector, err := storage.selectorsFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	w, err := storage.registry.WatchControllers(namespace)
+	if err != nil || (selector.Empty() && fieldSelector.Empty()) {
+		return w, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		controller := event.Object.(api.ReplicationController)
+		return event, selector.Matches(controller.Labels) && fieldSelector.Matches(controllerFields(controller))
+	}), nil
 }
 
-func (storage *ControllerRegistryStorage) Update(controller interface{}) error {
-	return storage.registry.UpdateController(controller.(api.ReplicationController))
+func (storage *ControllerRegistryStorage) WatchSingle(namespace, id string) (watch.Interface, error) {
+	w, err := storage.registry.WatchControllers(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		return event, event.Object.(api.ReplicationController).ID == id
+	}), nil
 }
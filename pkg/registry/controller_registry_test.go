@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"reflect"
 	"testing"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/watch"
 )
 
 type MockControllerRegistry struct {
@@ -15,11 +17,11 @@ type MockControllerRegistry struct {
 	controllers []api.ReplicationController
 }
 
-func (registry *MockControllerRegistry) ListControllers() ([]api.ReplicationController, error) {
+func (registry *MockControllerRegistry) ListControllers(namespace string) ([]api.ReplicationController, error) {
 	return registry.controllers, registry.err
 }
 
-func (registry *MockControllerRegistry) GetController(ID string) (*api.ReplicationController, error) {
+func (registry *MockControllerRegistry) GetController(namespace, ID string) (*api.ReplicationController, error) {
 	return &api.ReplicationController{}, registry.err
 }
 
@@ -30,9 +32,12 @@ func (registry *MockControllerRegistry) CreateController(controller api.Replicat
 func (registry *MockControllerRegistry) UpdateController(controller api.ReplicationController) error {
 	return registry.err
 }
-func (registry *MockControllerRegistry) DeleteController(ID string) error {
+func (registry *MockControllerRegistry) DeleteController(namespace, ID string) error {
 	return registry.err
 }
+func (registry *MockControllerRegistry) WatchControllers(namespace string) (watch.Interface, error) {
+	return watch.NewFake(), registry.err
+}
 
 func TestListControllersError(t *testing.T) {
 	mockRegistry := MockControllerRegistry{
@@ -41,7 +46,7 @@ func TestListControllersError(t *testing.T) {
 	storage := ControllerRegistryStorage{
 		registry: &mockRegistry,
 	}
-	controllersObj, err := storage.List(nil)
+	controllersObj, err := storage.List(api.NamespaceDefault, nil)
 	controllers := controllersObj.(api.ReplicationControllerList)
 	if err != mockRegistry.err {
 		t.Errorf("Expected %#v, Got %#v", mockRegistry.err, err)
@@ -56,13 +61,39 @@ func TestListEmptyControllerList(t *testing.T) {
 	storage := ControllerRegistryStorage{
 		registry: &mockRegistry,
 	}
-	controllers, err := storage.List(nil)
+	controllers, err := storage.List(api.NamespaceDefault, nil)
 	expectNoError(t, err)
 	if len(controllers.(api.ReplicationControllerList).Items) != 0 {
 		t.Errorf("Unexpected non-zero task list: %#v", controllers)
 	}
 }
 
+func TestListControllerListSelectors(t *testing.T) {
+	mockRegistry := MockControllerRegistry{
+		controllers: []api.ReplicationController{
+			{JSONBase: api.JSONBase{ID: "foo"}, Labels: map[string]string{"tier": "web"}, DesiredState: api.ReplicationControllerState{Replicas: 2}},
+			{JSONBase: api.JSONBase{ID: "bar"}, Labels: map[string]string{"tier": "web"}},
+			{JSONBase: api.JSONBase{ID: "baz"}, Labels: map[string]string{"tier": "cache"}, DesiredState: api.ReplicationControllerState{Replicas: 1}},
+		},
+	}
+	storage := ControllerRegistryStorage{
+		registry: &mockRegistry,
+	}
+	query := url.Values{"labels": []string{"tier=web"}, "fields": []string{"desiredState.replicas>0"}}
+	controllers, err := storage.List(api.NamespaceDefault, &url.URL{RawQuery: query.Encode()})
+	expectNoError(t, err)
+	items := controllers.(api.ReplicationControllerList).Items
+	if len(items) != 1 || items[0].ID != "foo" {
+		t.Errorf("Unexpected controller list: %#v", items)
+	}
+
+	query = url.Values{"fields": []string{"currentState.host=machine"}}
+	_, err = storage.List(api.NamespaceDefault, &url.URL{RawQuery: query.Encode()})
+	if !api.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error, got %#v", err)
+	}
+}
+
 func TestListControllerList(t *testing.T) {
 	mockRegistry := MockControllerRegistry{
 		controllers: []api.ReplicationController{
@@ -81,7 +112,7 @@ func TestListControllerList(t *testing.T) {
 	storage := ControllerRegistryStorage{
 		registry: &mockRegistry,
 	}
-	controllersObj, err := storage.List(nil)
+	controllersObj, err := storage.List(api.NamespaceDefault, nil)
 	controllers := controllersObj.(api.ReplicationControllerList)
 	expectNoError(t, err)
 	if len(controllers.Items) != 2 {
@@ -170,3 +201,100 @@ func TestControllerParsing(t *testing.T) {
 		t.Errorf("Parsing failed: %s %#v %#v", string(data), controller, expectedController)
 	}
 }
+
+func TestCreateControllerInvalid(t *testing.T) {
+	mockRegistry := MockControllerRegistry{}
+	storage := ControllerRegistryStorage{
+		registry: &mockRegistry,
+	}
+	_, err := storage.Create(api.ReplicationController{
+		JSONBase: api.JSONBase{ID: "nginx"},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: -1,
+			TaskTemplate: api.TaskTemplate{
+				DesiredState: api.TaskState{
+					Manifest: api.ContainerManifest{
+						Containers: []api.Container{{Image: "dockerfile/nginx"}},
+					},
+				},
+			},
+		},
+	})
+	if !api.IsInvalid(err) {
+		t.Errorf("Expected invalid error, got %#v", err)
+	}
+}
+
+func TestCreateControllerDefaultsReplicasInSet(t *testing.T) {
+	mockRegistry := MockControllerRegistry{}
+	storage := ControllerRegistryStorage{
+		registry: &mockRegistry,
+	}
+	obj, err := storage.Create(api.ReplicationController{
+		JSONBase: api.JSONBase{ID: "nginx"},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: 2,
+			TaskTemplate: api.TaskTemplate{
+				DesiredState: api.TaskState{
+					Manifest: api.ContainerManifest{
+						Containers: []api.Container{{Image: "dockerfile/nginx"}},
+					},
+				},
+				Labels: map[string]string{"name": "nginx"},
+			},
+		},
+	})
+	expectNoError(t, err)
+	controller := obj.(api.ReplicationController)
+	if !reflect.DeepEqual(controller.DesiredState.ReplicasInSet, map[string]string{"name": "nginx"}) {
+		t.Errorf("Unexpected replicasInSet: %#v", controller.DesiredState.ReplicasInSet)
+	}
+	if len(controller.CreationTimestamp) == 0 {
+		t.Error("Expected a creation timestamp")
+	}
+}
+
+func TestDryRunUpdateController(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	storage := MakeControllerRegistryStorage(registry, nil).(*ControllerRegistryStorage)
+	controller := api.ReplicationController{
+		JSONBase: api.JSONBase{ID: "foo", Namespace: api.NamespaceDefault},
+		DesiredState: api.ReplicationControllerState{
+			Replicas: 1,
+			TaskTemplate: api.TaskTemplate{
+				DesiredState: api.TaskState{
+					Manifest: api.ContainerManifest{
+						Containers: []api.Container{{Name: "web", Image: "dockerfile/nginx"}},
+					},
+				},
+			},
+		},
+	}
+	if _, err := storage.DryRunCreate(controller); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := registry.GetController(api.NamespaceDefault, "foo"); !api.IsNotFound(err) {
+		t.Errorf("Expected nothing to be stored, got %#v", err)
+	}
+	obj, err := storage.Create(controller)
+	expectNoError(t, err)
+	stored, err := registry.GetController(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+
+	update := obj.(api.ReplicationController)
+	update.DesiredState.Replicas = 5
+	update.ResourceVersion = stored.ResourceVersion
+	_, err = storage.DryRunUpdate(update)
+	expectNoError(t, err)
+	if current, _ := registry.GetController(api.NamespaceDefault, "foo"); current.DesiredState.Replicas != 1 {
+		t.Errorf("Expected the update not to be stored, got %#v", current)
+	}
+	update.ResourceVersion = stored.ResourceVersion + 1
+	if _, err := storage.DryRunUpdate(update); !api.IsConflict(err) {
+		t.Errorf("Expected a conflict, got %#v", err)
+	}
+	update.DesiredState.Replicas = -1
+	if _, err := storage.DryRunUpdate(update); !api.IsInvalid(err) {
+		t.Errorf("Expected an invalid error, got %#v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package registry
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// makeID returns a random ID for objects created without one. It is a valid DNS label.
+func makeID() string {
+	return fmt.Sprintf("%x", rand.Int63())
+}
+
+// creationTimestamp returns the value recorded as the CreationTimestamp of new objects.
+func creationTimestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,18 @@
+package registry
+
+import (
+	"k8s-firstcommit/pkg/api"
+)
+
+// checkAbsent is what a dry run does in place of creating an object: it fails the way
+// the create would if an object with the same ID is stored. get looks that object up.
+func checkAbsent(kind, id string, get func() error) error {
+	err := get()
+	if err == nil {
+		return api.NewAlreadyExistsErr(kind, id)
+	}
+	if api.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
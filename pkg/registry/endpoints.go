@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
 )
 
 func MakeEndpointController(serviceRegistry ServiceRegistry, taskRegistry TaskRegistry) *EndpointController {
@@ -20,25 +21,37 @@ type EndpointController struct {
 }
 
 func (e *EndpointController) SyncServiceEndpoints() error {
-	services, err := e.serviceRegistry.ListServices()
+	services, err := e.serviceRegistry.ListServices(api.NamespaceAll)
 	if err != nil {
 		return err
 	}
 	var resultErr error
 	for _, service := range services.Items {
-		tasks, err := e.taskRegistry.ListTasks(&service.Labels)
+		// Services only send traffic to tasks in their own namespace.
+		namespace := api.NamespaceOrDefault(service.Namespace)
+		tasks, err := e.taskRegistry.ListTasks(namespace, labels.SelectorFromSet(service.Labels))
 		if err != nil {
 			log.Printf("Error syncing service: %#v, skipping.", service)
 			resultErr = err
 			continue
 		}
-		endpoints := make([]string, len(tasks))
-		for ix, task := range tasks {
+		endpoints := []string{}
+		for _, task := range tasks {
+			// Tasks are published once the kubelet has found every container ready.
+			if !task.CurrentState.Ready {
+				continue
+			}
 			// TODO: Use port names in the service object, don't just use port #0
-			endpoints[ix] = fmt.Sprintf("%s:%d", task.CurrentState.Host, task.DesiredState.Manifest.Containers[0].Ports[0].HostPort)
+			containers := task.DesiredState.Manifest.Containers
+			if len(containers) == 0 || len(containers[0].Ports) == 0 {
+				log.Printf("Task %s exposes no ports, not adding it to service %s.", task.ID, service.ID)
+				continue
+			}
+			endpoints = append(endpoints, fmt.Sprintf("%s:%d", task.CurrentState.Host, containers[0].Ports[0].HostPort))
 		}
 		err = e.serviceRegistry.UpdateEndpoints(api.Endpoints{
 			Name:      service.ID,
+			Namespace: namespace,
 			Endpoints: endpoints,
 		})
 		if err != nil {
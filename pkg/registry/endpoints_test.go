@@ -57,6 +57,24 @@ func TestSyncEndpointsItems(t *testing.T) {
 						},
 					},
 				},
+				CurrentState: api.TaskState{
+					Ready: true,
+				},
+			},
+			api.Task{
+				DesiredState: api.TaskState{
+					Manifest: api.ContainerManifest{
+						Containers: []api.Container{
+							api.Container{
+								Ports: []api.Port{
+									api.Port{
+										HostPort: 8081,
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 		},
 	}
@@ -64,7 +82,7 @@ func TestSyncEndpointsItems(t *testing.T) {
 	endpoints := MakeEndpointController(&serviceRegistry, &taskRegistry)
 	err := endpoints.SyncServiceEndpoints()
 	expectNoError(t, err)
-	if len(serviceRegistry.endpoints.Endpoints) != 1 {
+	if len(serviceRegistry.endpoints.Endpoints) != 1 || serviceRegistry.endpoints.Endpoints[0] != ":8080" {
 		t.Errorf("Unexpected endpoints update: %#v", serviceRegistry.endpoints)
 	}
 }
@@ -91,3 +109,77 @@ func TestSyncEndpointsTaskError(t *testing.T) {
 		t.Error("Unexpected non-error")
 	}
 }
+
+func TestSyncEndpointsTaskWithoutPorts(t *testing.T) {
+	serviceRegistry := MockServiceRegistry{
+		list: api.ServiceList{
+			Items: []api.Service{
+				api.Service{
+					Labels: map[string]string{
+						"foo": "bar",
+					},
+				},
+			},
+		},
+	}
+	taskRegistry := MockTaskRegistry{
+		tasks: []api.Task{
+			api.Task{
+				DesiredState: api.TaskState{
+					Manifest: api.ContainerManifest{
+						Containers: []api.Container{
+							api.Container{},
+						},
+					},
+				},
+			},
+			api.Task{},
+		},
+	}
+
+	endpoints := MakeEndpointController(&serviceRegistry, &taskRegistry)
+	err := endpoints.SyncServiceEndpoints()
+	expectNoError(t, err)
+	if len(serviceRegistry.endpoints.Endpoints) != 0 {
+		t.Errorf("Unexpected endpoints update: %#v", serviceRegistry.endpoints)
+	}
+}
+
+func TestSyncEndpointsNamespaces(t *testing.T) {
+	serviceRegistry := MockServiceRegistry{
+		list: api.ServiceList{
+			Items: []api.Service{
+				api.Service{
+					JSONBase: api.JSONBase{ID: "redis", Namespace: "other"},
+					Labels: map[string]string{
+						"name": "redis",
+					},
+				},
+			},
+		},
+	}
+	taskRegistry := MakeMemoryRegistry()
+	for _, namespace := range []string{"default", "other"} {
+		taskRegistry.CreateTask("machine-"+namespace, api.Task{
+			JSONBase: api.JSONBase{ID: "redis", Namespace: namespace},
+			Labels:   map[string]string{"name": "redis"},
+			CurrentState: api.TaskState{
+				Host:  "machine-" + namespace,
+				Ready: true,
+			},
+			DesiredState: api.TaskState{
+				Manifest: api.ContainerManifest{
+					Containers: []api.Container{{Ports: []api.Port{{HostPort: 6379}}}},
+				},
+			},
+		})
+	}
+
+	endpoints := MakeEndpointController(&serviceRegistry, taskRegistry)
+	err := endpoints.SyncServiceEndpoints()
+	expectNoError(t, err)
+	result := serviceRegistry.endpoints
+	if result.Namespace != "other" || len(result.Endpoints) != 1 || result.Endpoints[0] != "machine-other:6379" {
+		t.Errorf("Unexpected endpoints update: %#v", result)
+	}
+}
@@ -0,0 +1,53 @@
+package registry
+
+import (
+	"log"
+	"path"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// legacyRoots returns the directories which, before namespaces, held tasks, controllers,
+// services and endpoints directly by ID.
+func (registry *EtcdRegistry) legacyRoots() []string {
+	roots := []string{"/registry/controllers", "/registry/services/specs", "/registry/services/endpoints"}
+	for _, machine := range registry.machines {
+		roots = append(roots, "/registry/hosts/"+machine+"/tasks")
+	}
+	return roots
+}
+
+// MigrateToNamespaces moves the objects stored before namespaces into the directory of
+// api.NamespaceDefault, where they now belong; until it has run they are missing from
+// lists and can't be found by ID. Each object is moved by creating its new key, then
+// deleting the old one, so it's safe to run again after a failure, and from several API
+// servers at once. An object whose new key is taken already, by an object created since
+// the upgrade, is dropped.
+func (registry *EtcdRegistry) MigrateToNamespaces() error {
+	for _, root := range registry.legacyRoots() {
+		response, err := registry.etcdClient.Get(root, false, false)
+		if isEtcdNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, node := range response.Node.Nodes {
+			if node.Dir {
+				continue
+			}
+			key := root + "/" + api.NamespaceDefault + "/" + path.Base(node.Key)
+			_, err := registry.etcdClient.Create(key, node.Value, 0)
+			if isEtcdNodeExist(err) {
+				log.Printf("Dropping %s, %s exists already", node.Key, key)
+			} else if err != nil {
+				return err
+			}
+			if _, err := registry.etcdClient.Delete(node.Key, false); err != nil && !isEtcdNotFound(err) {
+				return err
+			}
+			log.Printf("Moved %s to %s", node.Key, key)
+		}
+	}
+	return nil
+}
@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"path"
+	"reflect"
+	"strings"
 
 	"github.com/coreos/go-etcd/etcd"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
 // TODO: Need to add a reconciler loop that makes sure that things in tasks are reflected into
@@ -20,12 +25,14 @@ type EtcdClient interface {
 	Set(key, value string, ttl uint64) (*etcd.Response, error)
 	Create(key, value string, ttl uint64) (*etcd.Response, error)
 	Delete(key string, recursive bool) (*etcd.Response, error)
+	CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
 	// I'd like to use directional channels here (e.g. <-chan) but this interface mimics
 	// the etcd client interface which doesn't, and it doesn't seem worth it to wrap the api.
 	Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
 }
 
-// EtcdRegistry is an implementation of both ControllerRegistry and TaskRegistry which is backed with etcd.
+// EtcdRegistry is an implementation of TaskRegistry, ControllerRegistry, ServiceRegistry
+// and QuotaRegistry which is backed with etcd.
 type EtcdRegistry struct {
 	etcdClient      EtcdClient
 	machines        []string
@@ -47,60 +54,158 @@ func MakeEtcdRegistry(client EtcdClient, machines []string) *EtcdRegistry {
 	return registry
 }
 
-func makeTaskKey(machine, taskID string) string {
-	return "/registry/hosts/" + machine + "/tasks/" + taskID
+func makeTaskKey(machine, namespace, taskID string) string {
+	return "/registry/hosts/" + machine + "/tasks/" + api.NamespaceOrDefault(namespace) + "/" + taskID
 }
 
-func (registry *EtcdRegistry) ListTasks(query *map[string]string) ([]api.Task, error) {
+func (registry *EtcdRegistry) ListTasks(namespace string, selector labels.Selector) ([]api.Task, error) {
+	tasks, _, err := registry.ListTasksAtIndex(namespace, selector)
+	return tasks, err
+}
+
+// ListTasksAtIndex lists the tasks of every machine in one recursive read of the hosts,
+// and returns them with the etcd index of that read.
+func (registry *EtcdRegistry) ListTasksAtIndex(namespace string, selector labels.Selector) ([]api.Task, uint64, error) {
 	tasks := []api.Task{}
+	hosts, index, err := registry.listEtcdNode("/registry/hosts")
+	if err != nil {
+		return tasks, 0, err
+	}
+	byMachine := map[string]*etcd.Node{}
+	for _, host := range hosts {
+		byMachine[path.Base(host.Key)] = host
+	}
 	for _, machine := range registry.machines {
-		machineTasks, err := registry.listTasksForMachine(machine)
-		if err != nil {
-			return tasks, err
+		host, ok := byMachine[machine]
+		if !ok {
+			continue
 		}
-		for _, task := range machineTasks {
-			if LabelsMatch(task, query) {
-				tasks = append(tasks, task)
+		for _, dir := range host.Nodes {
+			if path.Base(dir.Key) != "tasks" {
+				continue
+			}
+			for _, node := range namespaceNodes(dir.Nodes, namespace) {
+				task := api.Task{}
+				if err := json.Unmarshal([]byte(node.Value), &task); err != nil {
+					return tasks, 0, err
+				}
+				task.CurrentState.Host = machine
+				task.ResourceVersion = node.ModifiedIndex
+				if selector.Matches(task.Labels) {
+					tasks = append(tasks, task)
+				}
 			}
 		}
 	}
-	return tasks, nil
+	return tasks, index, nil
 }
 
-func (registry *EtcdRegistry) listEtcdNode(key string) ([]*etcd.Node, error) {
+// listEtcdNode returns the nodes under key, read recursively, and the etcd index of the
+// read. A key which doesn't exist has no nodes.
+func (registry *EtcdRegistry) listEtcdNode(key string) ([]*etcd.Node, uint64, error) {
 	result, err := registry.etcdClient.Get(key, false, true)
 	if err != nil {
-		nodes := make([]*etcd.Node, 0)
 		if isEtcdNotFound(err) {
-			return nodes, nil
-		} else {
-			return nodes, err
+			return []*etcd.Node{}, err.(*etcd.EtcdError).Index, nil
 		}
+		return []*etcd.Node{}, 0, err
 	}
-	return result.Node.Nodes, nil
+	return result.Node.Nodes, result.EtcdIndex, nil
 }
 
-func (registry *EtcdRegistry) listTasksForMachine(machine string) ([]api.Task, error) {
-	tasks := []api.Task{}
-	key := "/registry/hosts/" + machine + "/tasks"
-	nodes, err := registry.listEtcdNode(key)
+// namespaceNodes returns the nodes of the objects in namespace, given the directories of
+// every namespace.
+func namespaceNodes(dirs []*etcd.Node, namespace string) []*etcd.Node {
+	nodes := []*etcd.Node{}
+	for _, dir := range dirs {
+		if namespace == api.NamespaceAll || path.Base(dir.Key) == namespace {
+			nodes = append(nodes, dir.Nodes...)
+		}
+	}
+	return nodes
+}
+
+// listEtcdObjects returns the nodes of the objects under key which are in namespace, and
+// the etcd index they were read at. Objects are kept in a directory per namespace; for
+// api.NamespaceAll the objects in every directory are returned. Either way, they are read
+// at once.
+func (registry *EtcdRegistry) listEtcdObjects(key, namespace string) ([]*etcd.Node, uint64, error) {
+	if namespace != api.NamespaceAll {
+		return registry.listEtcdNode(key + "/" + namespace)
+	}
+	dirs, index, err := registry.listEtcdNode(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return namespaceNodes(dirs, namespace), index, nil
+}
+
+// TaskStatus is what the kubelet on a task's machine knows of the task's containers.
+type TaskStatus struct {
+	Ready             bool
+	ContainerStatuses []api.ContainerStatus
+}
+
+// SetTasksStatus records the status of the tasks on machine, as the kubelet there sees
+// them. statuses is keyed by the ID of each task's manifest; tasks missing from it are
+// left alone. A task which changed while this ran is skipped, so that the next call
+// decides again.
+func (registry *EtcdRegistry) SetTasksStatus(machine string, statuses map[string]TaskStatus) error {
+	nodes, _, err := registry.listEtcdObjects("/registry/hosts/"+machine+"/tasks", api.NamespaceAll)
+	if err != nil {
+		return err
+	}
 	for _, node := range nodes {
-		task := api.Task{}
-		err = json.Unmarshal([]byte(node.Value), &task)
+		var task api.Task
+		if err := json.Unmarshal([]byte(node.Value), &task); err != nil {
+			return err
+		}
+		status, ok := statuses[manifestID(task.Namespace, task.ID)]
+		current := TaskStatus{task.CurrentState.Ready, task.CurrentState.ContainerStatuses}
+		if !ok || reflect.DeepEqual(current, status) {
+			continue
+		}
+		task.CurrentState.Ready = status.Ready
+		task.CurrentState.ContainerStatuses = status.ContainerStatuses
+		data, err := json.Marshal(task)
 		if err != nil {
-			return tasks, err
+			return err
+		}
+		_, err = registry.etcdClient.CompareAndSwap(node.Key, string(data), 0, "", node.ModifiedIndex)
+		if err != nil && !isEtcdTestFailed(err) {
+			return err
 		}
-		task.CurrentState.Host = machine
-		tasks = append(tasks, task)
 	}
-	return tasks, err
+	return nil
 }
 
-func (registry *EtcdRegistry) GetTask(taskID string) (*api.Task, error) {
-	task, _, err := registry.findTask(taskID)
+func (registry *EtcdRegistry) GetTask(namespace, taskID string) (*api.Task, error) {
+	task, _, err := registry.findTask(namespace, taskID)
 	return &task, err
 }
 
+// WatchTasks watches the task keys of every machine.
+func (registry *EtcdRegistry) WatchTasks(namespace string, selector labels.Selector) (watch.Interface, error) {
+	return watchEtcd(registry.etcdClient, "/registry/hosts", func(key, value string, index uint64) (interface{}, bool, error) {
+		// Keys look like /registry/hosts/<machine>/tasks/<namespace>/<id>, anything else
+		// (e.g. the kubelet manifests) is ignored.
+		parts := strings.Split(strings.TrimPrefix(key, "/registry/hosts/"), "/")
+		if len(parts) != 4 || parts[1] != "tasks" {
+			return nil, false, nil
+		}
+		if namespace != api.NamespaceAll && parts[2] != namespace {
+			return nil, false, nil
+		}
+		var task api.Task
+		if err := json.Unmarshal([]byte(value), &task); err != nil {
+			return nil, false, err
+		}
+		task.CurrentState.Host = parts[0]
+		task.ResourceVersion = index
+		return task, selector.Matches(task.Labels), nil
+	}), nil
+}
+
 func makeContainerKey(machine string) string {
 	return "/registry/hosts/" + machine + "/kubelet"
 }
@@ -130,9 +235,13 @@ func (registry *EtcdRegistry) updateManifests(machine string, manifests []api.Co
 }
 
 func (registry *EtcdRegistry) CreateTask(machineIn string, task api.Task) error {
-	taskOut, machine, err := registry.findTask(task.ID)
+	_, machine, err := registry.findTask(task.Namespace, task.ID)
 	if err == nil {
-		return fmt.Errorf("A task named %s already exists on %s (%#v)", task.ID, machine, taskOut)
+		log.Printf("A task named %s already exists on %s", task.ID, machine)
+		return api.NewAlreadyExistsErr("task", task.ID)
+	}
+	if !api.IsNotFound(err) {
+		return err
 	}
 	return registry.runTask(task, machineIn)
 }
@@ -143,7 +252,8 @@ func (registry *EtcdRegistry) runTask(task api.Task, machine string) error {
 		return err
 	}
 
-	key := makeTaskKey(machine, task.ID)
+	key := makeTaskKey(machine, task.Namespace, task.ID)
+	task.ResourceVersion = 0
 	data, err := json.Marshal(task)
 	if err != nil {
 		return err
@@ -158,27 +268,136 @@ func (registry *EtcdRegistry) runTask(task api.Task, machine string) error {
 	return registry.updateManifests(machine, manifests)
 }
 
+// UpdateTask replaces the stored task and the manifest the kubelet runs for it. Tasks
+// are updated in place on the machine they were scheduled to; moving a task to another
+// host requires deleting and recreating it.
+//
+// etcd can't write two keys in one transaction, so the task record is written first
+// with a compare-and-swap against the version that was read (or the version the caller
+// sent). Only then is the machine's manifest list rewritten, and if that fails the task
+// record is put back the way it was.
 func (registry *EtcdRegistry) UpdateTask(task api.Task) error {
-	return fmt.Errorf("Unimplemented!")
+	existing, machine, err := registry.findTask(task.Namespace, task.ID)
+	if err != nil {
+		return err
+	}
+	var causes []api.StatusCause
+	if len(task.CurrentState.Host) > 0 && task.CurrentState.Host != machine {
+		causes = append(causes, api.StatusCause{Field: "currentState.host", Message: fmt.Sprintf("cannot be changed from %q", machine)})
+	}
+	if len(task.DesiredState.Host) > 0 && task.DesiredState.Host != existing.DesiredState.Host {
+		causes = append(causes, api.StatusCause{Field: "desiredState.host", Message: fmt.Sprintf("cannot be changed from %q", existing.DesiredState.Host)})
+	}
+	if len(causes) > 0 {
+		return api.NewInvalidErr("task", task.ID, causes)
+	}
+
+	// Readiness and container statuses are only set by SetTasksStatus, from the kubelet.
+	task.CurrentState.Ready = existing.CurrentState.Ready
+	task.CurrentState.ContainerStatuses = existing.CurrentState.ContainerStatuses
+
+	resourceVersion := task.ResourceVersion
+	if resourceVersion == 0 {
+		resourceVersion = existing.ResourceVersion
+	}
+	manifest, err := registry.manifestFactory.MakeManifest(machine, task)
+	if err != nil {
+		return err
+	}
+
+	key := makeTaskKey(machine, task.Namespace, task.ID)
+	task.ResourceVersion = 0
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	existing.ResourceVersion = 0
+	oldData, err := json.Marshal(existing)
+	if err != nil {
+		return err
+	}
+	response, err := registry.etcdClient.CompareAndSwap(key, string(data), 0, "", resourceVersion)
+	if isEtcdTestFailed(err) {
+		return api.NewConflictErr("task", task.ID, fmt.Errorf("resource version %d is out of date", resourceVersion))
+	}
+	if err != nil {
+		return err
+	}
+
+	err = registry.replaceManifest(machine, manifest)
+	if err != nil {
+		log.Printf("Couldn't update manifest for %s on %s, restoring previous task: %v", task.ID, machine, err)
+		// The previous task is only put back over our own write, not over a later one.
+		_, restoreErr := registry.etcdClient.CompareAndSwap(key, string(oldData), 0, "", response.Node.ModifiedIndex)
+		if isEtcdTestFailed(restoreErr) {
+			return api.NewConflictErr("task", task.ID, fmt.Errorf("the task was changed while its manifest couldn't be updated: %v", err))
+		}
+		if restoreErr != nil {
+			log.Printf("Couldn't restore %s: %v", key, restoreErr)
+		}
+	}
+	return err
+}
+
+// How many times to retry a manifest list update that lost a race with another writer.
+const manifestUpdateRetries = 5
+
+// replaceManifest swaps the manifest with manifest.Id in machine's manifest list. The
+// list is shared by every task on the machine, so the write is a compare-and-swap that
+// is retried if another task changed the list in the meantime.
+func (registry *EtcdRegistry) replaceManifest(machine string, manifest api.ContainerManifest) error {
+	key := makeContainerKey(machine)
+	for i := 0; i < manifestUpdateRetries; i++ {
+		response, err := registry.etcdClient.Get(key, false, false)
+		if err != nil {
+			return err
+		}
+		var manifests []api.ContainerManifest
+		if err := json.Unmarshal([]byte(response.Node.Value), &manifests); err != nil {
+			return err
+		}
+		found := false
+		for ix := range manifests {
+			if manifests[ix].Id == manifest.Id {
+				manifests[ix] = manifest
+				found = true
+			}
+		}
+		if !found {
+			// As in deleteTaskFromMachine, this means something lost track of the task.
+			log.Printf("Couldn't find: %s in %#v, adding it", manifest.Id, manifests)
+			manifests = append(manifests, manifest)
+		}
+		data, err := json.Marshal(manifests)
+		if err != nil {
+			return err
+		}
+		_, err = registry.etcdClient.CompareAndSwap(key, string(data), 0, "", response.Node.ModifiedIndex)
+		if !isEtcdTestFailed(err) {
+			return err
+		}
+	}
+	return api.NewConflictErr("task", manifest.Id, fmt.Errorf("manifests on %s changed %d times while updating", machine, manifestUpdateRetries))
 }
 
-func (registry *EtcdRegistry) DeleteTask(taskID string) error {
-	_, machine, err := registry.findTask(taskID)
+func (registry *EtcdRegistry) DeleteTask(namespace, taskID string) error {
+	_, machine, err := registry.findTask(namespace, taskID)
 	if err != nil {
 		return err
 	}
-	return registry.deleteTaskFromMachine(machine, taskID)
+	return registry.deleteTaskFromMachine(machine, namespace, taskID)
 }
 
-func (registry *EtcdRegistry) deleteTaskFromMachine(machine, taskID string) error {
+func (registry *EtcdRegistry) deleteTaskFromMachine(machine, namespace, taskID string) error {
 	manifests, err := registry.loadManifests(machine)
 	if err != nil {
 		return err
 	}
+	id := manifestID(namespace, taskID)
 	newManifests := make([]api.ContainerManifest, 0)
 	found := false
 	for _, manifest := range manifests {
-		if manifest.Id != taskID {
+		if manifest.Id != id {
 			newManifests = append(newManifests, manifest)
 		} else {
 			found = true
@@ -188,22 +407,22 @@ func (registry *EtcdRegistry) deleteTaskFromMachine(machine, taskID string) erro
 		// This really shouldn't happen, it indicates something is broken, and likely
 		// there is a lost task somewhere.
 		// However it is "deleted" so log it and move on
-		log.Printf("Couldn't find: %s in %#v", taskID, manifests)
+		log.Printf("Couldn't find: %s in %#v", id, manifests)
 	}
 	if err = registry.updateManifests(machine, newManifests); err != nil {
 		return err
 	}
-	key := makeTaskKey(machine, taskID)
+	key := makeTaskKey(machine, namespace, taskID)
 	_, err = registry.etcdClient.Delete(key, true)
 	return err
 }
 
-func (registry *EtcdRegistry) getTaskForMachine(machine, taskID string) (api.Task, error) {
-	key := makeTaskKey(machine, taskID)
+func (registry *EtcdRegistry) getTaskForMachine(machine, namespace, taskID string) (api.Task, error) {
+	key := makeTaskKey(machine, namespace, taskID)
 	result, err := registry.etcdClient.Get(key, false, false)
 	if err != nil {
 		if isEtcdNotFound(err) {
-			return api.Task{}, fmt.Errorf("Not found (%#v).", err)
+			return api.Task{}, api.NewNotFoundErr("task", taskID)
 		} else {
 			return api.Task{}, err
 		}
@@ -214,20 +433,37 @@ func (registry *EtcdRegistry) getTaskForMachine(machine, taskID string) (api.Tas
 	task := api.Task{}
 	err = json.Unmarshal([]byte(result.Node.Value), &task)
 	task.CurrentState.Host = machine
+	task.ResourceVersion = result.Node.ModifiedIndex
 	return task, err
 }
 
-func (registry *EtcdRegistry) findTask(taskID string) (api.Task, string, error) {
+// findTask looks for taskID in namespace on every machine. It returns a NotFound error
+// only if every machine was checked and none of them had the task.
+func (registry *EtcdRegistry) findTask(namespace, taskID string) (api.Task, string, error) {
+	var lastErr error
 	for _, machine := range registry.machines {
-		task, err := registry.getTaskForMachine(machine, taskID)
+		task, err := registry.getTaskForMachine(machine, namespace, taskID)
 		if err == nil {
 			return task, machine, nil
 		}
+		if !api.IsNotFound(err) {
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return api.Task{}, "", lastErr
 	}
-	return api.Task{}, "", fmt.Errorf("Task not found %s", taskID)
+	return api.Task{}, "", api.NewNotFoundErr("task", taskID)
 }
 
-func isEtcdNotFound(err error) bool {
+// Error codes returned by etcd, see https://github.com/coreos/etcd/blob/master/Documentation/errorcode.md
+const (
+	etcdErrorCodeNotFound   = 100
+	etcdErrorCodeTestFailed = 101
+	etcdErrorCodeNodeExist  = 105
+)
+
+func isEtcdErrorCode(err error, code int) bool {
 	if err == nil {
 		return false
 	}
@@ -237,39 +473,79 @@ func isEtcdNotFound(err error) bool {
 		if etcdError == nil {
 			return false
 		}
-		if etcdError.ErrorCode == 100 {
+		if etcdError.ErrorCode == code {
 			return true
 		}
 	}
 	return false
 }
 
-func (registry *EtcdRegistry) ListControllers() ([]api.ReplicationController, error) {
+// updateAtVersion writes data to key. If resourceVersion is non-zero the write only
+// succeeds if key hasn't been modified since that version was read, otherwise it
+// fails with a Conflict error for the object 'kind' named 'id'.
+func (registry *EtcdRegistry) updateAtVersion(kind, id, key, data string, resourceVersion uint64) error {
+	var err error
+	if resourceVersion == 0 {
+		_, err = registry.etcdClient.Set(key, data, 0)
+	} else {
+		_, err = registry.etcdClient.CompareAndSwap(key, data, 0, "", resourceVersion)
+	}
+	switch {
+	case isEtcdNotFound(err):
+		return api.NewNotFoundErr(kind, id)
+	case isEtcdTestFailed(err):
+		return api.NewConflictErr(kind, id, fmt.Errorf("resource version %d is out of date", resourceVersion))
+	}
+	return err
+}
+
+func isEtcdNotFound(err error) bool {
+	return isEtcdErrorCode(err, etcdErrorCodeNotFound)
+}
+
+func isEtcdNodeExist(err error) bool {
+	return isEtcdErrorCode(err, etcdErrorCodeNodeExist)
+}
+
+func isEtcdTestFailed(err error) bool {
+	return isEtcdErrorCode(err, etcdErrorCodeTestFailed)
+}
+
+func (registry *EtcdRegistry) ListControllers(namespace string) ([]api.ReplicationController, error) {
+	controllers, _, err := registry.ListControllersAtIndex(namespace)
+	return controllers, err
+}
+
+// ListControllersAtIndex lists the controllers in namespace, and returns them with the
+// etcd index they were read at.
+func (registry *EtcdRegistry) ListControllersAtIndex(namespace string) ([]api.ReplicationController, uint64, error) {
 	var controllers []api.ReplicationController
-	key := "/registry/controllers"
-	nodes, err := registry.listEtcdNode(key)
+	nodes, index, err := registry.listEtcdObjects("/registry/controllers", namespace)
+	if err != nil {
+		return controllers, 0, err
+	}
 	for _, node := range nodes {
 		var controller api.ReplicationController
-		err = json.Unmarshal([]byte(node.Value), &controller)
-		if err != nil {
-			return controllers, err
+		if err := json.Unmarshal([]byte(node.Value), &controller); err != nil {
+			return controllers, 0, err
 		}
+		controller.ResourceVersion = node.ModifiedIndex
 		controllers = append(controllers, controller)
 	}
-	return controllers, nil
+	return controllers, index, nil
 }
 
-func makeControllerKey(id string) string {
-	return "/registry/controllers/" + id
+func makeControllerKey(namespace, id string) string {
+	return "/registry/controllers/" + api.NamespaceOrDefault(namespace) + "/" + id
 }
 
-func (registry *EtcdRegistry) GetController(controllerID string) (*api.ReplicationController, error) {
+func (registry *EtcdRegistry) GetController(namespace, controllerID string) (*api.ReplicationController, error) {
 	var controller api.ReplicationController
-	key := makeControllerKey(controllerID)
+	key := makeControllerKey(namespace, controllerID)
 	result, err := registry.etcdClient.Get(key, false, false)
 	if err != nil {
 		if isEtcdNotFound(err) {
-			return nil, fmt.Errorf("Controller %s not found", controllerID)
+			return nil, api.NewNotFoundErr("replicationController", controllerID)
 		} else {
 			return nil, err
 		}
@@ -278,36 +554,75 @@ func (registry *EtcdRegistry) GetController(controllerID string) (*api.Replicati
 		return nil, fmt.Errorf("no nodes field: %#v", result)
 	}
 	err = json.Unmarshal([]byte(result.Node.Value), &controller)
+	controller.ResourceVersion = result.Node.ModifiedIndex
 	return &controller, err
 }
 
 func (registry *EtcdRegistry) CreateController(controller api.ReplicationController) error {
-	// TODO : check for existence here and error.
-	return registry.UpdateController(controller)
+	controller.ResourceVersion = 0
+	controllerData, err := json.Marshal(controller)
+	if err != nil {
+		return err
+	}
+	key := makeControllerKey(controller.Namespace, controller.ID)
+	_, err = registry.etcdClient.Create(key, string(controllerData), 0)
+	if isEtcdNodeExist(err) {
+		return api.NewAlreadyExistsErr("replicationController", controller.ID)
+	}
+	return err
 }
 
 func (registry *EtcdRegistry) UpdateController(controller api.ReplicationController) error {
+	resourceVersion := controller.ResourceVersion
+	// The version lives in etcd's index, not in the stored data.
+	controller.ResourceVersion = 0
 	controllerData, err := json.Marshal(controller)
 	if err != nil {
 		return err
 	}
-	key := makeControllerKey(controller.ID)
-	_, err = registry.etcdClient.Set(key, string(controllerData), 0)
-	return err
+	key := makeControllerKey(controller.Namespace, controller.ID)
+	return registry.updateAtVersion("replicationController", controller.ID, key, string(controllerData), resourceVersion)
 }
 
-func (registry *EtcdRegistry) DeleteController(controllerID string) error {
-	key := makeControllerKey(controllerID)
+func (registry *EtcdRegistry) DeleteController(namespace, controllerID string) error {
+	key := makeControllerKey(namespace, controllerID)
 	_, err := registry.etcdClient.Delete(key, false)
+	if isEtcdNotFound(err) {
+		return api.NewNotFoundErr("replicationController", controllerID)
+	}
 	return err
 }
 
-func makeServiceKey(name string) string {
-	return "/registry/services/specs/" + name
+func (registry *EtcdRegistry) WatchControllers(namespace string) (watch.Interface, error) {
+	return watchEtcd(registry.etcdClient, namespacePrefix("/registry/controllers", namespace), func(key, value string, index uint64) (interface{}, bool, error) {
+		var controller api.ReplicationController
+		err := json.Unmarshal([]byte(value), &controller)
+		controller.ResourceVersion = index
+		return controller, err == nil, err
+	}), nil
+}
+
+// namespacePrefix returns the key under which the objects in namespace are kept, for
+// objects stored under key by namespace.
+func namespacePrefix(key, namespace string) string {
+	if namespace == api.NamespaceAll {
+		return key
+	}
+	return key + "/" + namespace
+}
+
+func makeServiceKey(namespace, name string) string {
+	return "/registry/services/specs/" + api.NamespaceOrDefault(namespace) + "/" + name
+}
+
+func makeEndpointsKey(namespace, name string) string {
+	return "/registry/services/endpoints/" + api.NamespaceOrDefault(namespace) + "/" + name
 }
 
-func (registry *EtcdRegistry) ListServices() (api.ServiceList, error) {
-	nodes, err := registry.listEtcdNode("/registry/services/specs")
+// ListServices lists the services in namespace. The ResourceVersion of the list is the
+// etcd index they were read at.
+func (registry *EtcdRegistry) ListServices(namespace string) (api.ServiceList, error) {
+	nodes, index, err := registry.listEtcdObjects("/registry/services/specs", namespace)
 	if err != nil {
 		return api.ServiceList{}, err
 	}
@@ -319,27 +634,32 @@ func (registry *EtcdRegistry) ListServices() (api.ServiceList, error) {
 		if err != nil {
 			return api.ServiceList{}, err
 		}
+		svc.ResourceVersion = node.ModifiedIndex
 		services = append(services, svc)
 	}
-	return api.ServiceList{Items: services}, nil
+	return api.ServiceList{JSONBase: api.JSONBase{ResourceVersion: index}, Items: services}, nil
 }
 
 func (registry *EtcdRegistry) CreateService(svc api.Service) error {
-	key := makeServiceKey(svc.ID)
+	svc.ResourceVersion = 0
+	key := makeServiceKey(svc.Namespace, svc.ID)
 	data, err := json.Marshal(svc)
 	if err != nil {
 		return err
 	}
-	_, err = registry.etcdClient.Set(key, string(data), 0)
+	_, err = registry.etcdClient.Create(key, string(data), 0)
+	if isEtcdNodeExist(err) {
+		return api.NewAlreadyExistsErr("service", svc.ID)
+	}
 	return err
 }
 
-func (registry *EtcdRegistry) GetService(name string) (*api.Service, error) {
-	key := makeServiceKey(name)
+func (registry *EtcdRegistry) GetService(namespace, name string) (*api.Service, error) {
+	key := makeServiceKey(namespace, name)
 	response, err := registry.etcdClient.Get(key, false, false)
 	if err != nil {
 		if isEtcdNotFound(err) {
-			return nil, fmt.Errorf("Service %s was not found.", name)
+			return nil, api.NewNotFoundErr("service", name)
 		} else {
 			return nil, err
 		}
@@ -349,22 +669,33 @@ func (registry *EtcdRegistry) GetService(name string) (*api.Service, error) {
 	if err != nil {
 		return nil, err
 	}
+	svc.ResourceVersion = response.Node.ModifiedIndex
 	return &svc, err
 }
 
-func (registry *EtcdRegistry) DeleteService(name string) error {
-	key := makeServiceKey(name)
+func (registry *EtcdRegistry) DeleteService(namespace, name string) error {
+	key := makeServiceKey(namespace, name)
 	_, err := registry.etcdClient.Delete(key, true)
+	if isEtcdNotFound(err) {
+		return api.NewNotFoundErr("service", name)
+	}
 	if err != nil {
 		return err
 	}
-	key = "/registry/services/endpoints/" + name
+	key = makeEndpointsKey(namespace, name)
 	_, err = registry.etcdClient.Delete(key, true)
 	return err
 }
 
 func (registry *EtcdRegistry) UpdateService(svc api.Service) error {
-	return registry.CreateService(svc)
+	resourceVersion := svc.ResourceVersion
+	svc.ResourceVersion = 0
+	key := makeServiceKey(svc.Namespace, svc.ID)
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return err
+	}
+	return registry.updateAtVersion("service", svc.ID, key, string(data), resourceVersion)
 }
 
 func (registry *EtcdRegistry) UpdateEndpoints(e api.Endpoints) error {
@@ -372,6 +703,86 @@ func (registry *EtcdRegistry) UpdateEndpoints(e api.Endpoints) error {
 	if err != nil {
 		return err
 	}
-	_, err = registry.etcdClient.Set("/registry/services/endpoints/"+e.Name, string(data), 0)
+	_, err = registry.etcdClient.Set(makeEndpointsKey(e.Namespace, e.Name), string(data), 0)
+	return err
+}
+
+func (registry *EtcdRegistry) WatchServices(namespace string) (watch.Interface, error) {
+	return watchEtcd(registry.etcdClient, namespacePrefix("/registry/services/specs", namespace), func(key, value string, index uint64) (interface{}, bool, error) {
+		var svc api.Service
+		err := json.Unmarshal([]byte(value), &svc)
+		svc.ResourceVersion = index
+		return svc, err == nil, err
+	}), nil
+}
+
+func makeQuotaKey(namespace, id string) string {
+	return "/registry/quotas/" + api.NamespaceOrDefault(namespace) + "/" + id
+}
+
+func (registry *EtcdRegistry) ListQuotas(namespace string) ([]api.ResourceQuota, error) {
+	quotas := []api.ResourceQuota{}
+	nodes, _, err := registry.listEtcdObjects("/registry/quotas", namespace)
+	if err != nil {
+		return quotas, err
+	}
+	for _, node := range nodes {
+		var quota api.ResourceQuota
+		if err := json.Unmarshal([]byte(node.Value), &quota); err != nil {
+			return quotas, err
+		}
+		quota.ResourceVersion = node.ModifiedIndex
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+func (registry *EtcdRegistry) GetQuota(namespace, quotaID string) (*api.ResourceQuota, error) {
+	response, err := registry.etcdClient.Get(makeQuotaKey(namespace, quotaID), false, false)
+	if err != nil {
+		if isEtcdNotFound(err) {
+			return nil, api.NewNotFoundErr("resourceQuota", quotaID)
+		}
+		return nil, err
+	}
+	var quota api.ResourceQuota
+	if err := json.Unmarshal([]byte(response.Node.Value), &quota); err != nil {
+		return nil, err
+	}
+	quota.ResourceVersion = response.Node.ModifiedIndex
+	return &quota, nil
+}
+
+func (registry *EtcdRegistry) CreateQuota(quota api.ResourceQuota) error {
+	// Usage is counted when the quota is read, it isn't stored.
+	quota.ResourceVersion = 0
+	quota.Used = nil
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+	_, err = registry.etcdClient.Create(makeQuotaKey(quota.Namespace, quota.ID), string(data), 0)
+	if isEtcdNodeExist(err) {
+		return api.NewAlreadyExistsErr("resourceQuota", quota.ID)
+	}
+	return err
+}
+
+func (registry *EtcdRegistry) UpdateQuota(quota api.ResourceQuota) error {
+	resourceVersion := quota.ResourceVersion
+	quota.ResourceVersion = 0
+	quota.Used = nil
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+	return registry.updateAtVersion("resourceQuota", quota.ID, makeQuotaKey(quota.Namespace, quota.ID), string(data), resourceVersion)
+}
+
+func (registry *EtcdRegistry) DeleteQuota(namespace, quotaID string) error {
+	_, err := registry.etcdClient.Delete(makeQuotaKey(namespace, quotaID), false)
+	if isEtcdNotFound(err) {
+		return api.NewNotFoundErr("resourceQuota", quotaID)
+	}
 	return err
 }
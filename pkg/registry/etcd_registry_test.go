@@ -12,9 +12,9 @@ import (
 
 func TestEtcdGetTask(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Set("/registry/hosts/machine/tasks/foo", util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/hosts/machine/tasks/default/foo", util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	task, err := registry.GetTask("foo")
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if task.ID != "foo" {
 		t.Errorf("Unexpected task: %#v", task)
@@ -23,7 +23,7 @@ func TestEtcdGetTask(t *testing.T) {
 
 func TestEtcdGetTaskNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -32,7 +32,7 @@ func TestEtcdGetTaskNotFound(t *testing.T) {
 		},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	_, err := registry.GetTask("foo")
+	_, err := registry.GetTask(api.NamespaceDefault, "foo")
 	if err == nil {
 		t.Errorf("Unexpected non-error.")
 	}
@@ -40,7 +40,7 @@ func TestEtcdGetTaskNotFound(t *testing.T) {
 
 func TestEtcdCreateTask(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -63,7 +63,7 @@ func TestEtcdCreateTask(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/foo", false, false)
+	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/default/foo", false, false)
 	expectNoError(t, err)
 	var task api.Task
 	err = json.Unmarshal([]byte(resp.Node.Value), &task)
@@ -82,7 +82,7 @@ func TestEtcdCreateTask(t *testing.T) {
 
 func TestEtcdCreateTaskAlreadyExisting(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
 				Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}),
@@ -103,7 +103,7 @@ func TestEtcdCreateTaskAlreadyExisting(t *testing.T) {
 
 func TestEtcdCreateTaskWithContainersError(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -124,7 +124,7 @@ func TestEtcdCreateTaskWithContainersError(t *testing.T) {
 	if err == nil {
 		t.Error("Unexpected non-error")
 	}
-	_, err = fakeClient.Get("/registry/hosts/machine/tasks/foo", false, false)
+	_, err = fakeClient.Get("/registry/hosts/machine/tasks/default/foo", false, false)
 	if err == nil {
 		t.Error("Unexpected non-error")
 	}
@@ -135,7 +135,7 @@ func TestEtcdCreateTaskWithContainersError(t *testing.T) {
 
 func TestEtcdCreateTaskWithContainersNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -164,7 +164,7 @@ func TestEtcdCreateTaskWithContainersNotFound(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/foo", false, false)
+	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/default/foo", false, false)
 	expectNoError(t, err)
 	var task api.Task
 	err = json.Unmarshal([]byte(resp.Node.Value), &task)
@@ -183,7 +183,7 @@ func TestEtcdCreateTaskWithContainersNotFound(t *testing.T) {
 
 func TestEtcdCreateTaskWithExistingContainers(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/hosts/machine/tasks/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -211,7 +211,7 @@ func TestEtcdCreateTaskWithExistingContainers(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/foo", false, false)
+	resp, err := fakeClient.Get("/registry/hosts/machine/tasks/default/foo", false, false)
 	expectNoError(t, err)
 	var task api.Task
 	err = json.Unmarshal([]byte(resp.Node.Value), &task)
@@ -228,9 +228,143 @@ func TestEtcdCreateTaskWithExistingContainers(t *testing.T) {
 	}
 }
 
+func TestEtcdUpdateTask(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks/default/foo"
+	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/hosts/machine/kubelet", util.MakeJSONString([]api.ContainerManifest{
+		api.ContainerManifest{Id: "bar"},
+		api.ContainerManifest{
+			Id:         "foo",
+			Containers: []api.Container{api.Container{Name: "foo", Image: "old"}},
+		},
+	}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	task.DesiredState.Manifest.Containers = []api.Container{api.Container{Name: "foo", Image: "new"}}
+	err = registry.UpdateTask(*task)
+	expectNoError(t, err)
+
+	task, err = registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if task.DesiredState.Manifest.Containers[0].Image != "new" {
+		t.Errorf("Unexpected task: %#v", task)
+	}
+	var manifests []api.ContainerManifest
+	response, _ := fakeClient.Get("/registry/hosts/machine/kubelet", false, false)
+	json.Unmarshal([]byte(response.Node.Value), &manifests)
+	if len(manifests) != 2 || manifests[0].Id != "bar" || manifests[1].Id != "foo" || manifests[1].Containers[0].Image != "new" {
+		t.Errorf("Unexpected manifest list: %#v", manifests)
+	}
+}
+
+func TestEtcdUpdateTaskNotFound(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	fakeClient.Data["/registry/hosts/machine/tasks/default/foo"] = EtcdResponseWithError{
+		R: &etcd.Response{},
+		E: &etcd.EtcdError{ErrorCode: 100},
+	}
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	err := registry.UpdateTask(api.Task{JSONBase: api.JSONBase{ID: "foo"}})
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %#v", err)
+	}
+}
+
+func TestEtcdUpdateTaskHostChange(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	fakeClient.Set("/registry/hosts/machine/tasks/default/foo", util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine", "other"})
+	err := registry.UpdateTask(api.Task{
+		JSONBase:     api.JSONBase{ID: "foo"},
+		CurrentState: api.TaskState{Host: "other"},
+	})
+	if !api.IsInvalid(err) {
+		t.Errorf("Expected invalid error, got %#v", err)
+	}
+}
+
+func TestEtcdUpdateTaskConflict(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks/default/foo"
+	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	// Someone else writes the task after we read it.
+	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	err = registry.UpdateTask(*task)
+	if !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+}
+
+func TestEtcdUpdateTaskManifestFailureRestoresTask(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks/default/foo"
+	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Data["/registry/hosts/machine/kubelet"] = EtcdResponseWithError{
+		R: &etcd.Response{},
+		E: &etcd.EtcdError{ErrorCode: 200},
+	}
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	err := registry.UpdateTask(api.Task{
+		JSONBase: api.JSONBase{ID: "foo"},
+		Labels:   map[string]string{"name": "new"},
+	})
+	if err == nil {
+		t.Errorf("Unexpected non-error")
+	}
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if len(task.Labels) != 0 {
+		t.Errorf("Task was not restored: %#v", task)
+	}
+}
+
+// failingManifestClient writes value to key whenever the manifest list is read, as if
+// another writer got in between.
+type failingManifestClient struct {
+	*FakeEtcdClient
+	key, value string
+}
+
+func (f *failingManifestClient) Get(key string, sort, recursive bool) (*etcd.Response, error) {
+	if key == "/registry/hosts/machine/kubelet" {
+		f.Set(f.key, f.value, 0)
+	}
+	return f.FakeEtcdClient.Get(key, sort, recursive)
+}
+
+func TestEtcdUpdateTaskManifestFailureConflict(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks/default/foo"
+	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Data["/registry/hosts/machine/kubelet"] = EtcdResponseWithError{
+		R: &etcd.Response{},
+		E: &etcd.EtcdError{ErrorCode: 200},
+	}
+	other := util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}, Labels: map[string]string{"name": "other"}})
+	client := &failingManifestClient{FakeEtcdClient: fakeClient, key: key, value: other}
+	registry := MakeTestEtcdRegistry(client, []string{"machine"})
+	err := registry.UpdateTask(api.Task{
+		JSONBase: api.JSONBase{ID: "foo"},
+		Labels:   map[string]string{"name": "new"},
+	})
+	if !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if task.Labels["name"] != "other" {
+		t.Errorf("The other write was overwritten: %#v", task)
+	}
+}
+
 func TestEtcdDeleteTask(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/hosts/machine/tasks/foo"
+	key := "/registry/hosts/machine/tasks/default/foo"
 	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	fakeClient.Set("/registry/hosts/machine/kubelet", util.MakeJSONString([]api.ContainerManifest{
 		api.ContainerManifest{
@@ -238,7 +372,7 @@ func TestEtcdDeleteTask(t *testing.T) {
 		},
 	}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	err := registry.DeleteTask("foo")
+	err := registry.DeleteTask(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if len(fakeClient.deletedKeys) != 1 {
 		t.Errorf("Expected 1 delete, found %#v", fakeClient.deletedKeys)
@@ -254,14 +388,14 @@ func TestEtcdDeleteTask(t *testing.T) {
 
 func TestEtcdDeleteTaskMultipleContainers(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/hosts/machine/tasks/foo"
+	key := "/registry/hosts/machine/tasks/default/foo"
 	fakeClient.Set(key, util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	fakeClient.Set("/registry/hosts/machine/kubelet", util.MakeJSONString([]api.ContainerManifest{
 		api.ContainerManifest{Id: "foo"},
 		api.ContainerManifest{Id: "bar"},
 	}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	err := registry.DeleteTask("foo")
+	err := registry.DeleteTask(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if len(fakeClient.deletedKeys) != 1 {
 		t.Errorf("Expected 1 delete, found %#v", fakeClient.deletedKeys)
@@ -282,7 +416,7 @@ func TestEtcdDeleteTaskMultipleContainers(t *testing.T) {
 
 func TestEtcdEmptyListTasks(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/hosts/machine/tasks"
+	key := "/registry/hosts"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
@@ -292,7 +426,7 @@ func TestEtcdEmptyListTasks(t *testing.T) {
 		E: nil,
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	tasks, err := registry.ListTasks(nil)
+	tasks, err := registry.ListTasks(api.NamespaceDefault, nil)
 	expectNoError(t, err)
 	if len(tasks) != 0 {
 		t.Errorf("Unexpected task list: %#v", tasks)
@@ -301,54 +435,207 @@ func TestEtcdEmptyListTasks(t *testing.T) {
 
 func TestEtcdListTasksNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/hosts/machine/tasks"
+	key := "/registry/hosts"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{},
-		E: &etcd.EtcdError{ErrorCode: 100},
+		E: &etcd.EtcdError{ErrorCode: 100, Index: 7},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	tasks, err := registry.ListTasks(nil)
+	tasks, index, err := registry.ListTasksAtIndex(api.NamespaceDefault, nil)
 	expectNoError(t, err)
-	if len(tasks) != 0 {
-		t.Errorf("Unexpected task list: %#v", tasks)
+	if len(tasks) != 0 || index != 7 {
+		t.Errorf("Unexpected task list at %d: %#v", index, tasks)
 	}
 }
 
 func TestEtcdListTasks(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/hosts/machine/tasks"
+	key := "/registry/hosts"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
 				Nodes: []*etcd.Node{
-					&etcd.Node{
-						Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}}),
-					},
-					&etcd.Node{
-						Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "bar"}}),
+					{
+						Key: key + "/machine",
+						Nodes: []*etcd.Node{
+							{Key: key + "/machine/kubelet", Value: "[]"},
+							{
+								Key: key + "/machine/tasks",
+								Nodes: []*etcd.Node{
+									{
+										Key: key + "/machine/tasks/default",
+										Nodes: []*etcd.Node{
+											{Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}})},
+											{Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "bar"}})},
+										},
+									},
+									{
+										Key: key + "/machine/tasks/other",
+										Nodes: []*etcd.Node{
+											{Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "baz"}})},
+										},
+									},
+								},
+							},
+						},
 					},
 				},
 			},
+			EtcdIndex: 42,
 		},
 		E: nil,
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	tasks, err := registry.ListTasks(nil)
+	tasks, index, err := registry.ListTasksAtIndex(api.NamespaceDefault, nil)
 	expectNoError(t, err)
-	if len(tasks) != 2 || tasks[0].ID != "foo" || tasks[1].ID != "bar" {
+	if len(tasks) != 2 || tasks[0].ID != "foo" || tasks[1].ID != "bar" || tasks[0].CurrentState.Host != "machine" {
 		t.Errorf("Unexpected task list: %#v", tasks)
 	}
+	if index != 42 {
+		t.Errorf("Expected the index of the read, got %d", index)
+	}
+}
+
+func TestEtcdSetTasksStatus(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks"
+	tasks := []api.Task{
+		{JSONBase: api.JSONBase{ID: "foo", Namespace: "default"}},
+		{JSONBase: api.JSONBase{ID: "bar", Namespace: "other"}, CurrentState: api.TaskState{Ready: true}},
+		{JSONBase: api.JSONBase{ID: "baz", Namespace: "other"}},
+		{JSONBase: api.JSONBase{ID: "qux", Namespace: "other"}},
+	}
+	nodes := map[string][]*etcd.Node{}
+	for i, task := range tasks {
+		node := &etcd.Node{
+			Key:           key + "/" + task.Namespace + "/" + task.ID,
+			Value:         util.MakeJSONString(task),
+			ModifiedIndex: uint64(i + 1),
+		}
+		nodes[task.Namespace] = append(nodes[task.Namespace], node)
+		fakeClient.Data[node.Key] = EtcdResponseWithError{R: &etcd.Response{Node: node}}
+	}
+	// qux changed after it was listed.
+	fakeClient.Data[key+"/other/qux"] = EtcdResponseWithError{R: &etcd.Response{Node: &etcd.Node{ModifiedIndex: 10}}}
+	fakeClient.ChangeIndex = 10
+	fakeClient.Data[key] = EtcdResponseWithError{
+		R: &etcd.Response{
+			Node: &etcd.Node{
+				Nodes: []*etcd.Node{
+					{Key: key + "/default", Nodes: nodes["default"]},
+					{Key: key + "/other", Nodes: nodes["other"]},
+				},
+			},
+		},
+	}
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+
+	statuses := []api.ContainerStatus{{Name: "redis", RestartCount: 2}}
+	err := registry.SetTasksStatus("machine", map[string]TaskStatus{
+		"foo":       {Ready: true, ContainerStatuses: statuses},
+		"bar.other": {Ready: true},
+		"qux.other": {Ready: true},
+	})
+	expectNoError(t, err)
+	var task api.Task
+	expectNoError(t, json.Unmarshal([]byte(fakeClient.Data[key+"/default/foo"].R.Node.Value), &task))
+	if !task.CurrentState.Ready || task.ID != "foo" || !reflect.DeepEqual(task.CurrentState.ContainerStatuses, statuses) {
+		t.Errorf("Unexpected task: %#v", task)
+	}
+	for _, id := range []string{"bar", "baz"} {
+		if index := fakeClient.Data[key+"/other/"+id].R.Node.ModifiedIndex; index > 4 {
+			t.Errorf("Unexpected write of %s", id)
+		}
+	}
+	if len(fakeClient.Data[key+"/other/qux"].R.Node.Value) != 0 {
+		t.Errorf("Unexpected write of qux")
+	}
+}
+
+func TestEtcdListTasksAllNamespaces(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts"
+	tasks := func(machine string, namespaces ...string) *etcd.Node {
+		dirs := []*etcd.Node{}
+		for _, namespace := range namespaces {
+			dirs = append(dirs, &etcd.Node{
+				Key: key + "/" + machine + "/tasks/" + namespace,
+				Nodes: []*etcd.Node{
+					{Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo", Namespace: namespace}})},
+				},
+			})
+		}
+		return &etcd.Node{
+			Key:   key + "/" + machine,
+			Nodes: []*etcd.Node{{Key: key + "/" + machine + "/tasks", Nodes: dirs}},
+		}
+	}
+	fakeClient.Data[key] = EtcdResponseWithError{
+		R: &etcd.Response{
+			Node: &etcd.Node{
+				// Machines which aren't the registry's are left out.
+				Nodes: []*etcd.Node{tasks("machine", "default", "other"), tasks("gone", "default")},
+			},
+		},
+	}
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	list, err := registry.ListTasks(api.NamespaceAll, nil)
+	expectNoError(t, err)
+	if len(list) != 2 || list[0].Namespace != "default" || list[1].Namespace != "other" {
+		t.Errorf("Unexpected task list: %#v", list)
+	}
+}
+
+func TestEtcdCreateDeleteTaskInNamespace(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	key := "/registry/hosts/machine/tasks/other/foo"
+	fakeClient.Data[key] = EtcdResponseWithError{
+		R: &etcd.Response{},
+		E: &etcd.EtcdError{ErrorCode: 100},
+	}
+	fakeClient.Set("/registry/hosts/machine/kubelet", util.MakeJSONString([]api.ContainerManifest{{Id: "foo"}}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	err := registry.CreateTask("machine", api.Task{
+		JSONBase: api.JSONBase{ID: "foo", Namespace: "other"},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "foo"}},
+			},
+		},
+	})
+	expectNoError(t, err)
+	task, err := registry.GetTask("other", "foo")
+	expectNoError(t, err)
+	if task.Namespace != "other" {
+		t.Errorf("Unexpected task: %#v", task)
+	}
+	var manifests []api.ContainerManifest
+	response, _ := fakeClient.Get("/registry/hosts/machine/kubelet", false, false)
+	json.Unmarshal([]byte(response.Node.Value), &manifests)
+	if len(manifests) != 2 || manifests[1].Id != "foo.other" {
+		t.Errorf("Unexpected manifest list: %#v", manifests)
+	}
+
+	expectNoError(t, registry.DeleteTask("other", "foo"))
+	if len(fakeClient.deletedKeys) != 1 || fakeClient.deletedKeys[0] != key {
+		t.Errorf("Unexpected deletes: %#v", fakeClient.deletedKeys)
+	}
+	response, _ = fakeClient.Get("/registry/hosts/machine/kubelet", false, false)
+	json.Unmarshal([]byte(response.Node.Value), &manifests)
+	if len(manifests) != 1 || manifests[0].Id != "foo" {
+		t.Errorf("Deleted the wrong manifest: %#v", manifests)
+	}
 }
 
 func TestEtcdListControllersNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/controllers"
+	key := "/registry/controllers/default"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{},
 		E: &etcd.EtcdError{ErrorCode: 100},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	controllers, err := registry.ListControllers()
+	controllers, err := registry.ListControllers(api.NamespaceDefault)
 	expectNoError(t, err)
 	if len(controllers) != 0 {
 		t.Errorf("Unexpected controller list: %#v", controllers)
@@ -357,13 +644,13 @@ func TestEtcdListControllersNotFound(t *testing.T) {
 
 func TestEtcdListServicesNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/services/specs"
+	key := "/registry/services/specs/default"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{},
 		E: &etcd.EtcdError{ErrorCode: 100},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	services, err := registry.ListServices()
+	services, err := registry.ListServices(api.NamespaceDefault)
 	expectNoError(t, err)
 	if len(services.Items) != 0 {
 		t.Errorf("Unexpected controller list: %#v", services)
@@ -372,7 +659,7 @@ func TestEtcdListServicesNotFound(t *testing.T) {
 
 func TestEtcdListControllers(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/controllers"
+	key := "/registry/controllers/default"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
@@ -389,7 +676,7 @@ func TestEtcdListControllers(t *testing.T) {
 		E: nil,
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	controllers, err := registry.ListControllers()
+	controllers, err := registry.ListControllers(api.NamespaceDefault)
 	expectNoError(t, err)
 	if len(controllers) != 2 || controllers[0].ID != "foo" || controllers[1].ID != "bar" {
 		t.Errorf("Unexpected controller list: %#v", controllers)
@@ -398,9 +685,9 @@ func TestEtcdListControllers(t *testing.T) {
 
 func TestEtcdGetController(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Set("/registry/controllers/foo", util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/controllers/default/foo", util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	ctrl, err := registry.GetController("foo")
+	ctrl, err := registry.GetController(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if ctrl.ID != "foo" {
 		t.Errorf("Unexpected controller: %#v", ctrl)
@@ -409,7 +696,7 @@ func TestEtcdGetController(t *testing.T) {
 
 func TestEtcdGetControllerNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/controllers/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/controllers/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -418,7 +705,7 @@ func TestEtcdGetControllerNotFound(t *testing.T) {
 		},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	ctrl, err := registry.GetController("foo")
+	ctrl, err := registry.GetController(api.NamespaceDefault, "foo")
 	if ctrl != nil {
 		t.Errorf("Unexpected non-nil controller: %#v", ctrl)
 	}
@@ -430,12 +717,12 @@ func TestEtcdGetControllerNotFound(t *testing.T) {
 func TestEtcdDeleteController(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	err := registry.DeleteController("foo")
+	err := registry.DeleteController(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if len(fakeClient.deletedKeys) != 1 {
 		t.Errorf("Expected 1 delete, found %#v", fakeClient.deletedKeys)
 	}
-	key := "/registry/controllers/foo"
+	key := "/registry/controllers/default/foo"
 	if fakeClient.deletedKeys[0] != key {
 		t.Errorf("Unexpected key: %s, expected %s", fakeClient.deletedKeys[0], key)
 	}
@@ -450,7 +737,7 @@ func TestEtcdCreateController(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	resp, err := fakeClient.Get("/registry/controllers/foo", false, false)
+	resp, err := fakeClient.Get("/registry/controllers/default/foo", false, false)
 	expectNoError(t, err)
 	var ctrl api.ReplicationController
 	err = json.Unmarshal([]byte(resp.Node.Value), &ctrl)
@@ -462,7 +749,7 @@ func TestEtcdCreateController(t *testing.T) {
 
 func TestEtcdUpdateController(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Set("/registry/controllers/foo", util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/controllers/default/foo", util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
 	err := registry.UpdateController(api.ReplicationController{
 		JSONBase: api.JSONBase{ID: "foo"},
@@ -471,15 +758,45 @@ func TestEtcdUpdateController(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	ctrl, err := registry.GetController("foo")
+	ctrl, err := registry.GetController(api.NamespaceDefault, "foo")
 	if ctrl.DesiredState.Replicas != 2 {
 		t.Errorf("Unexpected controller: %#v", ctrl)
 	}
 }
 
+func TestEtcdUpdateControllerConflict(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	fakeClient.Set("/registry/controllers/default/foo", util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	ctrl, err := registry.GetController(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if ctrl.ResourceVersion != fakeClient.ChangeIndex {
+		t.Errorf("Unexpected resource version: %d, expected %d", ctrl.ResourceVersion, fakeClient.ChangeIndex)
+	}
+
+	first, second := *ctrl, *ctrl
+	first.DesiredState.Replicas = 1
+	second.DesiredState.Replicas = 3
+	expectNoError(t, registry.UpdateController(first))
+	err = registry.UpdateController(second)
+	if !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+	ctrl, err = registry.GetController(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if ctrl.DesiredState.Replicas != 1 {
+		t.Errorf("Unexpected controller: %#v", ctrl)
+	}
+	var stored api.ReplicationController
+	json.Unmarshal([]byte(fakeClient.Data["/registry/controllers/default/foo"].R.Node.Value), &stored)
+	if stored.ResourceVersion != 0 {
+		t.Errorf("Resource version should not be stored: %#v", stored)
+	}
+}
+
 func TestEtcdListServices(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	key := "/registry/services/specs"
+	key := "/registry/services/specs/default"
 	fakeClient.Data[key] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
@@ -496,7 +813,7 @@ func TestEtcdListServices(t *testing.T) {
 		E: nil,
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	services, err := registry.ListServices()
+	services, err := registry.ListServices(api.NamespaceDefault)
 	expectNoError(t, err)
 	if len(services.Items) != 2 || services.Items[0].ID != "foo" || services.Items[1].ID != "bar" {
 		t.Errorf("Unexpected task list: %#v", services)
@@ -505,7 +822,7 @@ func TestEtcdListServices(t *testing.T) {
 
 func TestEtcdCreateService(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/services/specs/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/services/specs/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -516,7 +833,7 @@ func TestEtcdCreateService(t *testing.T) {
 		JSONBase: api.JSONBase{ID: "foo"},
 	})
 	expectNoError(t, err)
-	resp, err := fakeClient.Get("/registry/services/specs/foo", false, false)
+	resp, err := fakeClient.Get("/registry/services/specs/default/foo", false, false)
 	expectNoError(t, err)
 	var service api.Service
 	err = json.Unmarshal([]byte(resp.Node.Value), &service)
@@ -528,9 +845,9 @@ func TestEtcdCreateService(t *testing.T) {
 
 func TestEtcdGetService(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Set("/registry/services/specs/foo", util.MakeJSONString(api.Service{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/services/specs/default/foo", util.MakeJSONString(api.Service{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	service, err := registry.GetService("foo")
+	service, err := registry.GetService(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if service.ID != "foo" {
 		t.Errorf("Unexpected task: %#v", service)
@@ -539,7 +856,7 @@ func TestEtcdGetService(t *testing.T) {
 
 func TestEtcdGetServiceNotFound(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Data["/registry/services/specs/foo"] = EtcdResponseWithError{
+	fakeClient.Data["/registry/services/specs/default/foo"] = EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: nil,
 		},
@@ -548,7 +865,7 @@ func TestEtcdGetServiceNotFound(t *testing.T) {
 		},
 	}
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	_, err := registry.GetService("foo")
+	_, err := registry.GetService(api.NamespaceDefault, "foo")
 	if err == nil {
 		t.Errorf("Unexpected non-error.")
 	}
@@ -557,16 +874,16 @@ func TestEtcdGetServiceNotFound(t *testing.T) {
 func TestEtcdDeleteService(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
-	err := registry.DeleteService("foo")
+	err := registry.DeleteService(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if len(fakeClient.deletedKeys) != 2 {
 		t.Errorf("Expected 2 delete, found %#v", fakeClient.deletedKeys)
 	}
-	key := "/registry/services/specs/foo"
+	key := "/registry/services/specs/default/foo"
 	if fakeClient.deletedKeys[0] != key {
 		t.Errorf("Unexpected key: %s, expected %s", fakeClient.deletedKeys[0], key)
 	}
-	key = "/registry/services/endpoints/foo"
+	key = "/registry/services/endpoints/default/foo"
 	if fakeClient.deletedKeys[1] != key {
 		t.Errorf("Unexpected key: %s, expected %s", fakeClient.deletedKeys[1], key)
 	}
@@ -574,7 +891,7 @@ func TestEtcdDeleteService(t *testing.T) {
 
 func TestEtcdUpdateService(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
-	fakeClient.Set("/registry/services/specs/foo", util.MakeJSONString(api.Service{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	fakeClient.Set("/registry/services/specs/default/foo", util.MakeJSONString(api.Service{JSONBase: api.JSONBase{ID: "foo"}}), 0)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
 	err := registry.UpdateService(api.Service{
 		JSONBase: api.JSONBase{ID: "foo"},
@@ -583,22 +900,35 @@ func TestEtcdUpdateService(t *testing.T) {
 		},
 	})
 	expectNoError(t, err)
-	svc, err := registry.GetService("foo")
+	svc, err := registry.GetService(api.NamespaceDefault, "foo")
 	if svc.Labels["baz"] != "bar" {
 		t.Errorf("Unexpected service: %#v", svc)
 	}
 }
 
+func TestEtcdUpdateServiceConflict(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	fakeClient.Set("/registry/services/specs/default/foo", util.MakeJSONString(api.Service{JSONBase: api.JSONBase{ID: "foo"}}), 0)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	err := registry.UpdateService(api.Service{
+		JSONBase: api.JSONBase{ID: "foo", ResourceVersion: fakeClient.ChangeIndex + 1},
+	})
+	if !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+}
+
 func TestEtcdUpdateEndpoints(t *testing.T) {
 	fakeClient := MakeFakeEtcdClient(t)
 	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
 	endpoints := api.Endpoints{
 		Name:      "foo",
+		Namespace: "other",
 		Endpoints: []string{"baz", "bar"},
 	}
 	err := registry.UpdateEndpoints(endpoints)
 	expectNoError(t, err)
-	response, err := fakeClient.Get("/registry/services/endpoints/foo", false, false)
+	response, err := fakeClient.Get("/registry/services/endpoints/other/foo", false, false)
 	expectNoError(t, err)
 	var endpointsOut api.Endpoints
 	err = json.Unmarshal([]byte(response.Node.Value), &endpointsOut)
@@ -606,3 +936,43 @@ func TestEtcdUpdateEndpoints(t *testing.T) {
 		t.Errorf("Unexpected endpoints: %#v, expected %#v", endpointsOut, endpoints)
 	}
 }
+
+func TestEtcdMigrateToNamespaces(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	controller := util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}})
+	fakeClient.Data["/registry/controllers"] = EtcdResponseWithError{
+		R: &etcd.Response{
+			Node: &etcd.Node{
+				Nodes: []*etcd.Node{
+					{Key: "/registry/controllers/foo", Value: controller},
+					{Key: "/registry/controllers/default", Dir: true},
+				},
+			},
+		},
+	}
+	fakeClient.Data["/registry/hosts/machine/tasks"] = EtcdResponseWithError{
+		R: &etcd.Response{
+			Node: &etcd.Node{
+				Nodes: []*etcd.Node{
+					{Key: "/registry/hosts/machine/tasks/bar", Value: util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "bar"}})},
+				},
+			},
+		},
+	}
+	for _, key := range []string{"/registry/services/specs", "/registry/services/endpoints"} {
+		fakeClient.Data[key] = EtcdResponseWithError{R: &etcd.Response{}, E: &etcd.EtcdError{ErrorCode: 100}}
+	}
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+
+	expectNoError(t, registry.MigrateToNamespaces())
+	if value := fakeClient.Data["/registry/controllers/default/foo"].R.Node.Value; value != controller {
+		t.Errorf("Unexpected controller: %s", value)
+	}
+	if fakeClient.Data["/registry/hosts/machine/tasks/default/bar"].R == nil {
+		t.Errorf("Expected the task to be moved")
+	}
+	expected := []string{"/registry/controllers/foo", "/registry/hosts/machine/tasks/bar"}
+	if !reflect.DeepEqual(fakeClient.deletedKeys, expected) {
+		t.Errorf("Expected deletes of %v, got %v", expected, fakeClient.deletedKeys)
+	}
+}
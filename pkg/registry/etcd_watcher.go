@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"log"
+	"sync"
+
+	"github.com/coreos/go-etcd/etcd"
+
+	"k8s-firstcommit/pkg/util"
+	"k8s-firstcommit/pkg/watch"
+)
+
+// etcdDecodeFunc turns the value stored at key, as of etcd index 'index', into an api
+// object. It returns false if the key is not one the watcher is interested in.
+type etcdDecodeFunc func(key, value string, index uint64) (obj interface{}, ok bool, err error)
+
+// etcdWatcher converts the responses of an etcd watch into watch.Events.
+type etcdWatcher struct {
+	decode   etcdDecodeFunc
+	incoming chan *etcd.Response
+	etcdStop chan bool
+	result   chan watch.Event
+	stopOnce sync.Once
+}
+
+// watchEtcd starts watching everything under prefix. The watch runs until Stop is
+// called or etcd closes the connection.
+func watchEtcd(client EtcdClient, prefix string, decode etcdDecodeFunc) watch.Interface {
+	w := &etcdWatcher{
+		decode:   decode,
+		incoming: make(chan *etcd.Response),
+		etcdStop: make(chan bool),
+		result:   make(chan watch.Event),
+	}
+	go func() {
+		defer util.HandleCrash()
+		// The etcd client closes 'incoming' when it returns, which in turn ends translate().
+		_, err := client.Watch(prefix, 0, true, w.incoming, w.etcdStop)
+		if err != nil && err != etcd.ErrWatchStoppedByUser {
+			log.Printf("Watch of %s ended: %v", prefix, err)
+		}
+	}()
+	go w.translate()
+	return w
+}
+
+func (w *etcdWatcher) translate() {
+	defer close(w.result)
+	for response := range w.incoming {
+		event, ok := w.toEvent(response)
+		if !ok {
+			continue
+		}
+		select {
+		case w.result <- event:
+		case <-w.etcdStop:
+			// Keep draining so the etcd client isn't left blocked on a send.
+			go func() {
+				for _ = range w.incoming {
+				}
+			}()
+			return
+		}
+	}
+}
+
+func (w *etcdWatcher) toEvent(response *etcd.Response) (watch.Event, bool) {
+	if response.Node == nil {
+		log.Printf("Watch response has no node: %#v", response)
+		return watch.Event{}, false
+	}
+	var eventType watch.EventType
+	value := response.Node.Value
+	switch response.Action {
+	case "create":
+		eventType = watch.Added
+	case "set", "update", "compareAndSwap":
+		eventType = watch.Modified
+		if response.PrevNode == nil {
+			eventType = watch.Added
+		}
+	case "delete", "expire", "compareAndDelete":
+		eventType = watch.Deleted
+		if response.PrevNode == nil {
+			// Without the previous value there is nothing to decode.
+			log.Printf("Delete of %s without a previous value, skipping.", response.Node.Key)
+			return watch.Event{}, false
+		}
+		value = response.PrevNode.Value
+	default:
+		log.Printf("Unknown etcd action %q, skipping.", response.Action)
+		return watch.Event{}, false
+	}
+	obj, ok, err := w.decode(response.Node.Key, value, response.Node.ModifiedIndex)
+	if err != nil {
+		log.Printf("Couldn't decode %s: %v", response.Node.Key, err)
+		return watch.Event{}, false
+	}
+	if !ok {
+		return watch.Event{}, false
+	}
+	return watch.Event{Type: eventType, Object: obj}, true
+}
+
+func (w *etcdWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *etcdWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.etcdStop)
+	})
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/util"
+	"k8s-firstcommit/pkg/watch"
+)
+
+func TestEtcdWatchTasks(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	w, err := registry.WatchTasks(api.NamespaceAll, labels.SelectorFromSet(map[string]string{"name": "foo"}))
+	expectNoError(t, err)
+
+	fooTask := util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "foo"}, Labels: map[string]string{"name": "foo"}})
+	barTask := util.MakeJSONString(api.Task{JSONBase: api.JSONBase{ID: "bar"}, Labels: map[string]string{"name": "bar"}})
+	fakeClient.WatchResponses <- &etcd.Response{
+		Action: "create",
+		Node:   &etcd.Node{Key: "/registry/hosts/machine/tasks/default/bar", Value: barTask},
+	}
+	fakeClient.WatchResponses <- &etcd.Response{
+		Action: "set",
+		Node:   &etcd.Node{Key: "/registry/hosts/machine/kubelet", Value: "[]"},
+	}
+	fakeClient.WatchResponses <- &etcd.Response{
+		Action: "create",
+		Node:   &etcd.Node{Key: "/registry/hosts/machine/tasks/default/foo", Value: fooTask},
+	}
+	fakeClient.WatchResponses <- &etcd.Response{
+		Action:   "delete",
+		Node:     &etcd.Node{Key: "/registry/hosts/machine/tasks/default/foo"},
+		PrevNode: &etcd.Node{Key: "/registry/hosts/machine/tasks/default/foo", Value: fooTask},
+	}
+
+	event := <-w.ResultChan()
+	task := event.Object.(api.Task)
+	if event.Type != watch.Added || task.ID != "foo" || task.CurrentState.Host != "machine" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	event = <-w.ResultChan()
+	if event.Type != watch.Deleted || event.Object.(api.Task).ID != "foo" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	w.Stop()
+	if _, ok := <-w.ResultChan(); ok {
+		t.Errorf("Expected closed channel after stop")
+	}
+}
+
+func TestEtcdWatchControllers(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	w, err := registry.WatchControllers(api.NamespaceAll)
+	expectNoError(t, err)
+
+	fakeClient.WatchResponses <- &etcd.Response{
+		Action:   "set",
+		Node:     &etcd.Node{Key: "/registry/controllers/default/foo", Value: util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}})},
+		PrevNode: &etcd.Node{Key: "/registry/controllers/default/foo", Value: "{}"},
+	}
+	event := <-w.ResultChan()
+	if event.Type != watch.Modified || event.Object.(api.ReplicationController).ID != "foo" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	w.Stop()
+}
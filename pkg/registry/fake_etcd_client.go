@@ -17,12 +17,17 @@ type FakeEtcdClient struct {
 	deletedKeys []string
 	err         error
 	t           *testing.T
+	// ChangeIndex is the etcd index of the last write, used as the ModifiedIndex of stored nodes.
+	ChangeIndex uint64
+	// Responses sent here are delivered to whoever is currently watching.
+	WatchResponses chan *etcd.Response
 }
 
 func MakeFakeEtcdClient(t *testing.T) *FakeEtcdClient {
 	return &FakeEtcdClient{
-		t:    t,
-		Data: map[string]EtcdResponseWithError{},
+		t:              t,
+		Data:           map[string]EtcdResponseWithError{},
+		WatchResponses: make(chan *etcd.Response),
 	}
 }
 
@@ -40,16 +45,32 @@ func (f *FakeEtcdClient) Get(key string, sort, recursive bool) (*etcd.Response,
 }
 
 func (f *FakeEtcdClient) Set(key, value string, ttl uint64) (*etcd.Response, error) {
+	f.ChangeIndex++
 	result := EtcdResponseWithError{
 		R: &etcd.Response{
 			Node: &etcd.Node{
-				Value: value,
+				Value:         value,
+				ModifiedIndex: f.ChangeIndex,
 			},
 		},
 	}
 	f.Data[key] = result
 	return result.R, f.err
 }
+
+func (f *FakeEtcdClient) CompareAndSwap(key, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error) {
+	existing := f.Data[key]
+	if existing.R == nil || existing.R.Node == nil {
+		return nil, &etcd.EtcdError{ErrorCode: 100}
+	}
+	if prevIndex != 0 && existing.R.Node.ModifiedIndex != prevIndex {
+		return nil, &etcd.EtcdError{ErrorCode: 101}
+	}
+	if len(prevValue) != 0 && existing.R.Node.Value != prevValue {
+		return nil, &etcd.EtcdError{ErrorCode: 101}
+	}
+	return f.Set(key, value, ttl)
+}
 func (f *FakeEtcdClient) Create(key, value string, ttl uint64) (*etcd.Response, error) {
 	return f.Set(key, value, ttl)
 }
@@ -59,7 +80,22 @@ func (f *FakeEtcdClient) Delete(key string, recursive bool) (*etcd.Response, err
 }
 
 func (f *FakeEtcdClient) Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
-	return nil, fmt.Errorf("Unimplemented")
+	if receiver == nil {
+		return nil, fmt.Errorf("Unimplemented")
+	}
+	defer close(receiver)
+	for {
+		select {
+		case response := <-f.WatchResponses:
+			select {
+			case receiver <- response:
+			case <-stop:
+				return nil, etcd.ErrWatchStoppedByUser
+			}
+		case <-stop:
+			return nil, etcd.ErrWatchStoppedByUser
+		}
+	}
 }
 
 func MakeTestEtcdRegistry(client EtcdClient, machines []string) *EtcdRegistry {
@@ -2,28 +2,77 @@ package registry
 
 import (
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
-// TaskRegistry is an interface implemented by things that know how to store Task objects
+// TaskRegistry is an interface implemented by things that know how to store Task objects.
+// Tasks are named within a namespace; api.NamespaceAll lists or watches every namespace.
 type TaskRegistry interface {
-	// ListTasks obtains a list of tasks that match query.
-	// Query may be nil in which case all tasks are returned.
-	ListTasks(query *map[string]string) ([]api.Task, error)
+	// ListTasks obtains a list of tasks in namespace whose labels match selector.
+	// Selector may be nil in which case all tasks are returned.
+	ListTasks(namespace string, selector labels.Selector) ([]api.Task, error)
 	// Get a specific task
-	GetTask(taskId string) (*api.Task, error)
+	GetTask(namespace, taskId string) (*api.Task, error)
 	// Create a task based on a specification, schedule it onto a specific machine.
 	CreateTask(machine string, task api.Task) error
 	// Update an existing task
 	UpdateTask(task api.Task) error
 	// Delete an existing task
-	DeleteTask(taskId string) error
+	DeleteTask(namespace, taskId string) error
+	// WatchTasks streams changes to tasks in namespace whose labels match selector.
+	// Selector may be nil in which case changes to all tasks are returned.
+	WatchTasks(namespace string, selector labels.Selector) (watch.Interface, error)
 }
 
-// ControllerRegistry is an interface for things that know how to store Controllers
+// IndexedTaskLister is implemented by TaskRegistries which read each list of tasks at one
+// etcd index, which they return with it.
+type IndexedTaskLister interface {
+	ListTasksAtIndex(namespace string, selector labels.Selector) ([]api.Task, uint64, error)
+}
+
+// listTasksAtIndex lists the tasks of registry with the etcd index they were read at,
+// which is 0 for registries which don't read from etcd.
+func listTasksAtIndex(registry TaskRegistry, namespace string, selector labels.Selector) ([]api.Task, uint64, error) {
+	if lister, ok := registry.(IndexedTaskLister); ok {
+		return lister.ListTasksAtIndex(namespace, selector)
+	}
+	tasks, err := registry.ListTasks(namespace, selector)
+	return tasks, 0, err
+}
+
+// ControllerRegistry is an interface for things that know how to store Controllers, which
+// like tasks are named within a namespace.
 type ControllerRegistry interface {
-	ListControllers() ([]api.ReplicationController, error)
-	GetController(controllerId string) (*api.ReplicationController, error)
+	ListControllers(namespace string) ([]api.ReplicationController, error)
+	GetController(namespace, controllerId string) (*api.ReplicationController, error)
 	CreateController(controller api.ReplicationController) error
 	UpdateController(controller api.ReplicationController) error
-	DeleteController(controllerId string) error
+	DeleteController(namespace, controllerId string) error
+	WatchControllers(namespace string) (watch.Interface, error)
+}
+
+// IndexedControllerLister is to ControllerRegistry what IndexedTaskLister is to
+// TaskRegistry.
+type IndexedControllerLister interface {
+	ListControllersAtIndex(namespace string) ([]api.ReplicationController, uint64, error)
+}
+
+// listControllersAtIndex is like listTasksAtIndex, for controllers.
+func listControllersAtIndex(registry ControllerRegistry, namespace string) ([]api.ReplicationController, uint64, error) {
+	if lister, ok := registry.(IndexedControllerLister); ok {
+		return lister.ListControllersAtIndex(namespace)
+	}
+	controllers, err := registry.ListControllers(namespace)
+	return controllers, 0, err
+}
+
+// QuotaRegistry is an interface for things that know how to store ResourceQuotas, which
+// are named within the namespace they limit.
+type QuotaRegistry interface {
+	ListQuotas(namespace string) ([]api.ResourceQuota, error)
+	GetQuota(namespace, quotaID string) (*api.ResourceQuota, error)
+	CreateQuota(quota api.ResourceQuota) error
+	UpdateQuota(quota api.ResourceQuota) error
+	DeleteQuota(namespace, quotaID string) error
 }
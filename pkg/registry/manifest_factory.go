@@ -13,13 +13,25 @@ type BasicManifestFactory struct {
 	serviceRegistry ServiceRegistry
 }
 
+// manifestID returns the ID of the manifest the kubelet runs for the task named taskID
+// in namespace. Every kubelet shares one flat set of manifests, so tasks outside the
+// default namespace get the namespace appended; task IDs can't contain dots, so these
+// never collide.
+func manifestID(namespace, taskID string) string {
+	namespace = api.NamespaceOrDefault(namespace)
+	if namespace == api.NamespaceDefault {
+		return taskID
+	}
+	return taskID + "." + namespace
+}
+
 func (b *BasicManifestFactory) MakeManifest(machine string, task api.Task) (api.ContainerManifest, error) {
-	envVars, err := GetServiceEnvironmentVariables(b.serviceRegistry, machine)
+	envVars, err := GetServiceEnvironmentVariables(b.serviceRegistry, api.NamespaceOrDefault(task.Namespace), machine)
 	if err != nil {
 		return api.ContainerManifest{}, err
 	}
 	for ix, container := range task.DesiredState.Manifest.Containers {
-		task.DesiredState.Manifest.Id = task.ID
+		task.DesiredState.Manifest.Id = manifestID(task.Namespace, task.ID)
 		task.DesiredState.Manifest.Containers[ix].Env = append(container.Env, envVars...)
 	}
 	return task.DesiredState.Manifest, nil
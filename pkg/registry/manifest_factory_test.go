@@ -116,3 +116,29 @@ func TestMakeManifestServicesExistingEnvVar(t *testing.T) {
 		t.Errorf("Expected no env vars, got: %#v", manifest)
 	}
 }
+
+func TestMakeManifestNamespace(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	registry.CreateService(api.Service{JSONBase: api.JSONBase{ID: "redis", Namespace: "other"}, Port: 6379})
+	registry.CreateService(api.Service{JSONBase: api.JSONBase{ID: "mysql"}, Port: 3306})
+	factory := &BasicManifestFactory{
+		serviceRegistry: registry,
+	}
+
+	manifest, err := factory.MakeManifest("machine", api.Task{
+		JSONBase: api.JSONBase{ID: "foobar", Namespace: "other"},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "foo"}},
+			},
+		},
+	})
+	expectNoError(t, err)
+	env := manifest.Containers[0].Env
+	if len(env) != 2 || env[0].Name != "REDIS_SERVICE_PORT" || env[0].Value != "6379" {
+		t.Errorf("Expected only the services of the task's namespace, got: %#v", env)
+	}
+	if manifest.Id != "foobar.other" {
+		t.Errorf("Unexpected manifest id: %s", manifest.Id)
+	}
+}
@@ -1,122 +1,309 @@
 package registry
 
 import (
+	"fmt"
+
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
-// An implementation of TaskRegistry and ControllerRegistry that is backed by memory
+// How many events a slow watcher of the memory registry may fall behind before it is closed.
+const memoryWatchQueueLen = 100
+
+// An implementation of TaskRegistry, ControllerRegistry, ServiceRegistry and QuotaRegistry
+// that is backed by memory
 // Mainly used for testing.
 type MemoryRegistry struct {
 	taskData       map[string]api.Task
 	controllerData map[string]api.ReplicationController
 	serviceData    map[string]api.Service
+	quotaData      map[string]api.ResourceQuota
+	// The version handed to the last write, emulating etcd's index.
+	resourceVersion uint64
+
+	taskWatchers       *watch.Broadcaster
+	controllerWatchers *watch.Broadcaster
+	serviceWatchers    *watch.Broadcaster
 }
 
 func MakeMemoryRegistry() *MemoryRegistry {
 	return &MemoryRegistry{
-		taskData:       map[string]api.Task{},
-		controllerData: map[string]api.ReplicationController{},
-		serviceData:    map[string]api.Service{},
+		taskData:           map[string]api.Task{},
+		controllerData:     map[string]api.ReplicationController{},
+		serviceData:        map[string]api.Service{},
+		quotaData:          map[string]api.ResourceQuota{},
+		taskWatchers:       watch.NewBroadcaster(memoryWatchQueueLen),
+		controllerWatchers: watch.NewBroadcaster(memoryWatchQueueLen),
+		serviceWatchers:    watch.NewBroadcaster(memoryWatchQueueLen),
 	}
 }
 
-func (registry *MemoryRegistry) ListTasks(labelQuery *map[string]string) ([]api.Task, error) {
+func (registry *MemoryRegistry) nextResourceVersion() uint64 {
+	registry.resourceVersion++
+	return registry.resourceVersion
+}
+
+// checkResourceVersion returns a Conflict if an update carrying 'submitted' would overwrite
+// a newer write. A submitted version of zero always succeeds, as it does with etcd.
+func checkResourceVersion(kind, id string, stored, submitted uint64) error {
+	if submitted != 0 && submitted != stored {
+		return api.NewConflictErr(kind, id, fmt.Errorf("resource version %d is out of date, current version is %d", submitted, stored))
+	}
+	return nil
+}
+
+// memoryKey is the key of the object named id in namespace in the registry's maps.
+func memoryKey(namespace, id string) string {
+	return api.NamespaceOrDefault(namespace) + "/" + id
+}
+
+// inNamespace returns true if an object in objectNamespace should be returned for a
+// request for namespace.
+func inNamespace(objectNamespace, namespace string) bool {
+	return namespace == api.NamespaceAll || api.NamespaceOrDefault(objectNamespace) == namespace
+}
+
+func (registry *MemoryRegistry) ListTasks(namespace string, selector labels.Selector) ([]api.Task, error) {
 	result := []api.Task{}
 	for _, value := range registry.taskData {
-		if LabelsMatch(value, labelQuery) {
+		if inNamespace(value.Namespace, namespace) && selector.Matches(value.Labels) {
 			result = append(result, value)
 		}
 	}
 	return result, nil
 }
 
-func (registry *MemoryRegistry) GetTask(taskID string) (*api.Task, error) {
-	task, found := registry.taskData[taskID]
+func (registry *MemoryRegistry) GetTask(namespace, taskID string) (*api.Task, error) {
+	task, found := registry.taskData[memoryKey(namespace, taskID)]
 	if found {
 		return &task, nil
 	} else {
-		return nil, nil
+		return nil, api.NewNotFoundErr("task", taskID)
 	}
 }
 
 func (registry *MemoryRegistry) CreateTask(machine string, task api.Task) error {
-	registry.taskData[task.ID] = task
+	key := memoryKey(task.Namespace, task.ID)
+	if _, found := registry.taskData[key]; found {
+		return api.NewAlreadyExistsErr("task", task.ID)
+	}
+	task.ResourceVersion = registry.nextResourceVersion()
+	registry.taskData[key] = task
+	registry.taskWatchers.Action(watch.Added, task)
 	return nil
 }
 
-func (registry *MemoryRegistry) DeleteTask(taskID string) error {
-	delete(registry.taskData, taskID)
+func (registry *MemoryRegistry) DeleteTask(namespace, taskID string) error {
+	key := memoryKey(namespace, taskID)
+	task, found := registry.taskData[key]
+	if !found {
+		return api.NewNotFoundErr("task", taskID)
+	}
+	delete(registry.taskData, key)
+	registry.taskWatchers.Action(watch.Deleted, task)
 	return nil
 }
 
 func (registry *MemoryRegistry) UpdateTask(task api.Task) error {
-	registry.taskData[task.ID] = task
+	key := memoryKey(task.Namespace, task.ID)
+	existing, found := registry.taskData[key]
+	if !found {
+		return api.NewNotFoundErr("task", task.ID)
+	}
+	if err := checkResourceVersion("task", task.ID, existing.ResourceVersion, task.ResourceVersion); err != nil {
+		return err
+	}
+	task.ResourceVersion = registry.nextResourceVersion()
+	registry.taskData[key] = task
+	registry.taskWatchers.Action(watch.Modified, task)
 	return nil
 }
 
-func (registry *MemoryRegistry) ListControllers() ([]api.ReplicationController, error) {
+func (registry *MemoryRegistry) WatchTasks(namespace string, selector labels.Selector) (watch.Interface, error) {
+	return watch.Filter(registry.taskWatchers.Watch(), func(event watch.Event) (watch.Event, bool) {
+		task := event.Object.(api.Task)
+		return event, inNamespace(task.Namespace, namespace) && selector.Matches(task.Labels)
+	}), nil
+}
+
+func (registry *MemoryRegistry) ListControllers(namespace string) ([]api.ReplicationController, error) {
 	result := []api.ReplicationController{}
 	for _, value := range registry.controllerData {
-		result = append(result, value)
+		if inNamespace(value.Namespace, namespace) {
+			result = append(result, value)
+		}
 	}
 	return result, nil
 }
 
-func (registry *MemoryRegistry) GetController(controllerID string) (*api.ReplicationController, error) {
-	controller, found := registry.controllerData[controllerID]
+func (registry *MemoryRegistry) GetController(namespace, controllerID string) (*api.ReplicationController, error) {
+	controller, found := registry.controllerData[memoryKey(namespace, controllerID)]
 	if found {
 		return &controller, nil
 	} else {
-		return nil, nil
+		return nil, api.NewNotFoundErr("replicationController", controllerID)
 	}
 }
 
 func (registry *MemoryRegistry) CreateController(controller api.ReplicationController) error {
-	registry.controllerData[controller.ID] = controller
+	key := memoryKey(controller.Namespace, controller.ID)
+	if _, found := registry.controllerData[key]; found {
+		return api.NewAlreadyExistsErr("replicationController", controller.ID)
+	}
+	controller.ResourceVersion = registry.nextResourceVersion()
+	registry.controllerData[key] = controller
+	registry.controllerWatchers.Action(watch.Added, controller)
 	return nil
 }
 
-func (registry *MemoryRegistry) DeleteController(controllerId string) error {
-	delete(registry.controllerData, controllerId)
+func (registry *MemoryRegistry) DeleteController(namespace, controllerId string) error {
+	key := memoryKey(namespace, controllerId)
+	controller, found := registry.controllerData[key]
+	if !found {
+		return api.NewNotFoundErr("replicationController", controllerId)
+	}
+	delete(registry.controllerData, key)
+	registry.controllerWatchers.Action(watch.Deleted, controller)
 	return nil
 }
 
 func (registry *MemoryRegistry) UpdateController(controller api.ReplicationController) error {
-	registry.controllerData[controller.ID] = controller
+	key := memoryKey(controller.Namespace, controller.ID)
+	existing, found := registry.controllerData[key]
+	if !found {
+		return api.NewNotFoundErr("replicationController", controller.ID)
+	}
+	if err := checkResourceVersion("replicationController", controller.ID, existing.ResourceVersion, controller.ResourceVersion); err != nil {
+		return err
+	}
+	controller.ResourceVersion = registry.nextResourceVersion()
+	registry.controllerData[key] = controller
+	registry.controllerWatchers.Action(watch.Modified, controller)
 	return nil
 }
 
-func (registry *MemoryRegistry) ListServices() (api.ServiceList, error) {
+func (registry *MemoryRegistry) WatchControllers(namespace string) (watch.Interface, error) {
+	return watch.Filter(registry.controllerWatchers.Watch(), func(event watch.Event) (watch.Event, bool) {
+		return event, inNamespace(event.Object.(api.ReplicationController).Namespace, namespace)
+	}), nil
+}
+
+func (registry *MemoryRegistry) ListServices(namespace string) (api.ServiceList, error) {
 	var list []api.Service
 	for _, value := range registry.serviceData {
-		list = append(list, value)
+		if inNamespace(value.Namespace, namespace) {
+			list = append(list, value)
+		}
 	}
 	return api.ServiceList{Items: list}, nil
 }
 
 func (registry *MemoryRegistry) CreateService(svc api.Service) error {
-	registry.serviceData[svc.ID] = svc
+	key := memoryKey(svc.Namespace, svc.ID)
+	if _, found := registry.serviceData[key]; found {
+		return api.NewAlreadyExistsErr("service", svc.ID)
+	}
+	svc.ResourceVersion = registry.nextResourceVersion()
+	registry.serviceData[key] = svc
+	registry.serviceWatchers.Action(watch.Added, svc)
 	return nil
 }
 
-func (registry *MemoryRegistry) GetService(name string) (*api.Service, error) {
-	svc, found := registry.serviceData[name]
+func (registry *MemoryRegistry) GetService(namespace, name string) (*api.Service, error) {
+	svc, found := registry.serviceData[memoryKey(namespace, name)]
 	if found {
 		return &svc, nil
 	} else {
-		return nil, nil
+		return nil, api.NewNotFoundErr("service", name)
 	}
 }
 
-func (registry *MemoryRegistry) DeleteService(name string) error {
-	delete(registry.serviceData, name)
+func (registry *MemoryRegistry) DeleteService(namespace, name string) error {
+	key := memoryKey(namespace, name)
+	svc, found := registry.serviceData[key]
+	if !found {
+		return api.NewNotFoundErr("service", name)
+	}
+	delete(registry.serviceData, key)
+	registry.serviceWatchers.Action(watch.Deleted, svc)
 	return nil
 }
 
 func (registry *MemoryRegistry) UpdateService(svc api.Service) error {
-	return registry.CreateService(svc)
+	key := memoryKey(svc.Namespace, svc.ID)
+	existing, found := registry.serviceData[key]
+	if !found {
+		return api.NewNotFoundErr("service", svc.ID)
+	}
+	if err := checkResourceVersion("service", svc.ID, existing.ResourceVersion, svc.ResourceVersion); err != nil {
+		return err
+	}
+	svc.ResourceVersion = registry.nextResourceVersion()
+	registry.serviceData[key] = svc
+	registry.serviceWatchers.Action(watch.Modified, svc)
+	return nil
 }
 
 func (registry *MemoryRegistry) UpdateEndpoints(e api.Endpoints) error {
 	return nil
 }
+
+func (registry *MemoryRegistry) WatchServices(namespace string) (watch.Interface, error) {
+	return watch.Filter(registry.serviceWatchers.Watch(), func(event watch.Event) (watch.Event, bool) {
+		return event, inNamespace(event.Object.(api.Service).Namespace, namespace)
+	}), nil
+}
+
+func (registry *MemoryRegistry) ListQuotas(namespace string) ([]api.ResourceQuota, error) {
+	result := []api.ResourceQuota{}
+	for _, value := range registry.quotaData {
+		if inNamespace(value.Namespace, namespace) {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+func (registry *MemoryRegistry) GetQuota(namespace, quotaID string) (*api.ResourceQuota, error) {
+	quota, found := registry.quotaData[memoryKey(namespace, quotaID)]
+	if !found {
+		return nil, api.NewNotFoundErr("resourceQuota", quotaID)
+	}
+	return &quota, nil
+}
+
+func (registry *MemoryRegistry) CreateQuota(quota api.ResourceQuota) error {
+	key := memoryKey(quota.Namespace, quota.ID)
+	if _, found := registry.quotaData[key]; found {
+		return api.NewAlreadyExistsErr("resourceQuota", quota.ID)
+	}
+	quota.ResourceVersion = registry.nextResourceVersion()
+	quota.Used = nil
+	registry.quotaData[key] = quota
+	return nil
+}
+
+func (registry *MemoryRegistry) UpdateQuota(quota api.ResourceQuota) error {
+	key := memoryKey(quota.Namespace, quota.ID)
+	existing, found := registry.quotaData[key]
+	if !found {
+		return api.NewNotFoundErr("resourceQuota", quota.ID)
+	}
+	if err := checkResourceVersion("resourceQuota", quota.ID, existing.ResourceVersion, quota.ResourceVersion); err != nil {
+		return err
+	}
+	quota.ResourceVersion = registry.nextResourceVersion()
+	quota.Used = nil
+	registry.quotaData[key] = quota
+	return nil
+}
+
+func (registry *MemoryRegistry) DeleteQuota(namespace, quotaID string) error {
+	key := memoryKey(namespace, quotaID)
+	if _, found := registry.quotaData[key]; !found {
+		return api.NewNotFoundErr("resourceQuota", quotaID)
+	}
+	delete(registry.quotaData, key)
+	return nil
+}
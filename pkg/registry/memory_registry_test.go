@@ -4,11 +4,13 @@ import (
 	"testing"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
 func TestListTasksEmpty(t *testing.T) {
 	registry := MakeMemoryRegistry()
-	tasks, err := registry.ListTasks(nil)
+	tasks, err := registry.ListTasks(api.NamespaceAll, nil)
 	expectNoError(t, err)
 	if len(tasks) != 0 {
 		t.Errorf("Unexpected task list: %#v", tasks)
@@ -18,18 +20,56 @@ func TestListTasksEmpty(t *testing.T) {
 func TestMemoryListTasks(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}})
-	tasks, err := registry.ListTasks(nil)
+	tasks, err := registry.ListTasks(api.NamespaceAll, nil)
 	expectNoError(t, err)
 	if len(tasks) != 1 || tasks[0].ID != "foo" {
 		t.Errorf("Unexpected task list: %#v", tasks)
 	}
 }
 
+func TestMemoryListTasksSelector(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}, Labels: map[string]string{"tier": "web"}})
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "bar"}, Labels: map[string]string{"tier": "cache"}})
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "baz"}})
+	selector, err := labels.Parse("tier notin (cache)")
+	expectNoError(t, err)
+	tasks, err := registry.ListTasks(api.NamespaceAll, selector)
+	expectNoError(t, err)
+	ids := map[string]bool{}
+	for _, task := range tasks {
+		ids[task.ID] = true
+	}
+	if len(ids) != 2 || !ids["foo"] || !ids["baz"] {
+		t.Errorf("Unexpected task list: %#v", tasks)
+	}
+}
+
+func TestMemoryTasksInNamespaces(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	expectNoError(t, registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}}))
+	expectNoError(t, registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo", Namespace: "other"}}))
+	tasks, err := registry.ListTasks("other", nil)
+	expectNoError(t, err)
+	if len(tasks) != 1 || tasks[0].Namespace != "other" {
+		t.Errorf("Unexpected task list: %#v", tasks)
+	}
+	tasks, err = registry.ListTasks(api.NamespaceAll, nil)
+	expectNoError(t, err)
+	if len(tasks) != 2 {
+		t.Errorf("Unexpected task list: %#v", tasks)
+	}
+	expectNoError(t, registry.DeleteTask("other", "foo"))
+	if _, err := registry.GetTask(api.NamespaceDefault, "foo"); err != nil {
+		t.Errorf("Expected the task in the default namespace to remain: %v", err)
+	}
+}
+
 func TestMemorySetGetTasks(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	expectedTask := api.Task{JSONBase: api.JSONBase{ID: "foo"}}
 	registry.CreateTask("machine", expectedTask)
-	task, err := registry.GetTask("foo")
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if expectedTask.ID != task.ID {
 		t.Errorf("Unexpected task, expected %#v, actual %#v", expectedTask, task)
@@ -49,7 +89,7 @@ func TestMemorySetUpdateGetTasks(t *testing.T) {
 	}
 	registry.CreateTask("machine", oldTask)
 	registry.UpdateTask(expectedTask)
-	task, err := registry.GetTask("foo")
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if expectedTask.ID != task.ID || task.DesiredState.Host != expectedTask.DesiredState.Host {
 		t.Errorf("Unexpected task, expected %#v, actual %#v", expectedTask, task)
@@ -60,9 +100,11 @@ func TestMemorySetDeleteGetTasks(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	expectedTask := api.Task{JSONBase: api.JSONBase{ID: "foo"}}
 	registry.CreateTask("machine", expectedTask)
-	registry.DeleteTask("foo")
-	task, err := registry.GetTask("foo")
-	expectNoError(t, err)
+	registry.DeleteTask(api.NamespaceDefault, "foo")
+	task, err := registry.GetTask(api.NamespaceDefault, "foo")
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %#v", err)
+	}
 	if task != nil {
 		t.Errorf("Unexpected task: %#v", task)
 	}
@@ -70,7 +112,7 @@ func TestMemorySetDeleteGetTasks(t *testing.T) {
 
 func TestListControllersEmpty(t *testing.T) {
 	registry := MakeMemoryRegistry()
-	tasks, err := registry.ListControllers()
+	tasks, err := registry.ListControllers(api.NamespaceAll)
 	expectNoError(t, err)
 	if len(tasks) != 0 {
 		t.Errorf("Unexpected task list: %#v", tasks)
@@ -80,7 +122,7 @@ func TestListControllersEmpty(t *testing.T) {
 func TestMemoryListControllers(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	registry.CreateController(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}})
-	tasks, err := registry.ListControllers()
+	tasks, err := registry.ListControllers(api.NamespaceAll)
 	expectNoError(t, err)
 	if len(tasks) != 1 || tasks[0].ID != "foo" {
 		t.Errorf("Unexpected task list: %#v", tasks)
@@ -91,7 +133,7 @@ func TestMemorySetGetControllers(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	expectedController := api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}
 	registry.CreateController(expectedController)
-	task, err := registry.GetController("foo")
+	task, err := registry.GetController(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if expectedController.ID != task.ID {
 		t.Errorf("Unexpected task, expected %#v, actual %#v", expectedController, task)
@@ -111,7 +153,7 @@ func TestMemorySetUpdateGetControllers(t *testing.T) {
 	}
 	registry.CreateController(oldController)
 	registry.UpdateController(expectedController)
-	task, err := registry.GetController("foo")
+	task, err := registry.GetController(api.NamespaceDefault, "foo")
 	expectNoError(t, err)
 	if expectedController.ID != task.ID || task.DesiredState.Replicas != expectedController.DesiredState.Replicas {
 		t.Errorf("Unexpected task, expected %#v, actual %#v", expectedController, task)
@@ -122,10 +164,86 @@ func TestMemorySetDeleteGetControllers(t *testing.T) {
 	registry := MakeMemoryRegistry()
 	expectedController := api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}
 	registry.CreateController(expectedController)
-	registry.DeleteController("foo")
-	task, err := registry.GetController("foo")
-	expectNoError(t, err)
+	registry.DeleteController(api.NamespaceDefault, "foo")
+	task, err := registry.GetController(api.NamespaceDefault, "foo")
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %#v", err)
+	}
 	if task != nil {
 		t.Errorf("Unexpected task: %#v", task)
 	}
 }
+
+func TestMemoryCreateTaskAlreadyExisting(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}})
+	err := registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}})
+	if !api.IsAlreadyExists(err) {
+		t.Errorf("Expected already exists error, got %#v", err)
+	}
+}
+
+func TestMemoryUpdateMissingService(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	err := registry.UpdateService(api.Service{JSONBase: api.JSONBase{ID: "foo"}})
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found error, got %#v", err)
+	}
+}
+
+func TestMemoryWatchTasks(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	w, err := registry.WatchTasks(api.NamespaceAll, labels.SelectorFromSet(map[string]string{"name": "foo"}))
+	expectNoError(t, err)
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "bar"}, Labels: map[string]string{"name": "bar"}})
+	registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo"}, Labels: map[string]string{"name": "foo"}})
+	registry.DeleteTask(api.NamespaceDefault, "foo")
+
+	event := <-w.ResultChan()
+	if event.Type != watch.Added || event.Object.(api.Task).ID != "foo" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	event = <-w.ResultChan()
+	if event.Type != watch.Deleted || event.Object.(api.Task).ID != "foo" {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	w.Stop()
+}
+
+func TestMemoryWatchServices(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	w, err := registry.WatchServices(api.NamespaceAll)
+	expectNoError(t, err)
+	registry.CreateService(api.Service{JSONBase: api.JSONBase{ID: "foo"}})
+	registry.UpdateService(api.Service{JSONBase: api.JSONBase{ID: "foo"}, Port: 8080})
+
+	event := <-w.ResultChan()
+	if event.Type != watch.Added {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	event = <-w.ResultChan()
+	if event.Type != watch.Modified || event.Object.(api.Service).Port != 8080 {
+		t.Errorf("Unexpected event: %#v", event)
+	}
+	w.Stop()
+}
+
+func TestMemoryUpdateControllerConflict(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	registry.CreateController(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}})
+	controller, err := registry.GetController(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if controller.ResourceVersion == 0 {
+		t.Errorf("Expected a resource version: %#v", controller)
+	}
+	first, second := *controller, *controller
+	first.DesiredState.Replicas = 1
+	second.DesiredState.Replicas = 3
+	expectNoError(t, registry.UpdateController(first))
+	if err := registry.UpdateController(second); !api.IsConflict(err) {
+		t.Errorf("Expected conflict error, got %#v", err)
+	}
+	// Updates without a version always win.
+	second.ResourceVersion = 0
+	expectNoError(t, registry.UpdateController(second))
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/watch"
 )
 
 type MockServiceRegistry struct {
@@ -10,7 +11,7 @@ type MockServiceRegistry struct {
 	endpoints api.Endpoints
 }
 
-func (m *MockServiceRegistry) ListServices() (api.ServiceList, error) {
+func (m *MockServiceRegistry) ListServices(namespace string) (api.ServiceList, error) {
 	return m.list, m.err
 }
 
@@ -18,11 +19,11 @@ func (m *MockServiceRegistry) CreateService(svc api.Service) error {
 	return m.err
 }
 
-func (m *MockServiceRegistry) GetService(name string) (*api.Service, error) {
+func (m *MockServiceRegistry) GetService(namespace, name string) (*api.Service, error) {
 	return nil, m.err
 }
 
-func (m *MockServiceRegistry) DeleteService(name string) error {
+func (m *MockServiceRegistry) DeleteService(namespace, name string) error {
 	return m.err
 }
 
@@ -34,3 +35,7 @@ func (m *MockServiceRegistry) UpdateEndpoints(e api.Endpoints) error {
 	m.endpoints = e
 	return m.err
 }
+
+func (m *MockServiceRegistry) WatchServices(namespace string) (watch.Interface, error) {
+	return watch.NewFake(), m.err
+}
@@ -0,0 +1,237 @@
+package registry
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s-firstcommit/pkg/api"
+)
+
+// snapshotTTL is how long a paginated read may take between two of its pages before its
+// snapshot is dropped and it has to start over.
+const snapshotTTL = 5 * time.Minute
+
+// maxSnapshots and maxSnapshotItems bound the snapshots a listPager keeps, in number and
+// in items over all of them. The snapshots which would be read last are dropped to make
+// room for new ones, and a list with more items than maxSnapshotItems can't be paged.
+const (
+	maxSnapshots     = 100
+	maxSnapshotItems = 100000
+)
+
+// continueToken is what a continue token carries: the snapshot being read, the etcd index
+// it was read at, and how many of its items were already returned. Snapshot IDs are
+// random, so that tokens can't be guessed.
+type continueToken struct {
+	Index    uint64 `json:"index"`
+	Snapshot string `json:"snapshot"`
+	Offset   int    `json:"offset"`
+}
+
+func (t continueToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.URLEncoding.EncodeToString(data)
+}
+
+func decodeContinueToken(s string) (continueToken, error) {
+	var token continueToken
+	data, err := base64.URLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	if err != nil {
+		return token, fmt.Errorf("invalid continue token %q", s)
+	}
+	return token, nil
+}
+
+// listScope is what a list selects: its namespace and its label and field selectors, as
+// they were given.
+type listScope struct {
+	namespace string
+	labels    string
+	fields    string
+}
+
+// pageRequest is the page of a list asked for by the "limit" and "continue" parameters.
+// A zero limit asks for every remaining item, and a nil token for the start of the list.
+// A token only continues a list of the same scope.
+type pageRequest struct {
+	limit int
+	token *continueToken
+	scope listScope
+}
+
+// pageFromURL returns the page a request for the objects in namespace asks for, or a
+// BadRequest error if its parameters don't parse.
+func pageFromURL(namespace string, url *url.URL) (pageRequest, error) {
+	page := pageRequest{scope: listScope{namespace: namespace}}
+	if url == nil {
+		return page, nil
+	}
+	query := url.Query()
+	page.scope.labels = query.Get("labels")
+	page.scope.fields = query.Get("fields")
+	if limit := query.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return page, api.NewBadRequestErr(fmt.Sprintf("invalid limit %q", limit))
+		}
+		page.limit = n
+	}
+	if s := query.Get("continue"); len(s) > 0 {
+		token, err := decodeContinueToken(s)
+		if err != nil {
+			return page, api.NewBadRequestErr(err.Error())
+		}
+		page.token = &token
+	}
+	return page, nil
+}
+
+type listSnapshot struct {
+	index   uint64
+	scope   listScope
+	items   []interface{}
+	expires time.Time
+}
+
+// listPager splits lists into pages. The first page of a list which doesn't fit in one
+// is cut from a full read of the list, made in one etcd read, which is kept as a snapshot;
+// the following pages are cut from the snapshot, so they show the objects as they were at
+// the etcd index of that read even if they have changed since. Snapshots are kept in the
+// memory of the API server process which read the list, for snapshotTTL after each of
+// their pages is read and within the bounds of maxSnapshots and maxSnapshotItems. Any
+// other API server, or this one once restarted, answers their tokens as expired.
+// The zero value is ready to use.
+type listPager struct {
+	lock      sync.Mutex
+	snapshots map[string]*listSnapshot
+	// items counts the items of all the snapshots.
+	items int
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func (p *listPager) currentTime() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// expire drops the snapshots which haven't been read for snapshotTTL. The caller holds
+// the lock.
+func (p *listPager) expire(now time.Time) {
+	for id, snapshot := range p.snapshots {
+		if now.After(snapshot.expires) {
+			p.drop(id)
+		}
+	}
+}
+
+// drop drops the snapshot id. The caller holds the lock.
+func (p *listPager) drop(id string) {
+	p.items -= len(p.snapshots[id].items)
+	delete(p.snapshots, id)
+}
+
+// makeRoom drops the snapshots which expire first until one of size items fits. The
+// caller holds the lock.
+func (p *listPager) makeRoom(size int) {
+	for len(p.snapshots) > 0 && (len(p.snapshots) >= maxSnapshots || p.items+size > maxSnapshotItems) {
+		oldest := ""
+		for id, snapshot := range p.snapshots {
+			if len(oldest) == 0 || snapshot.expires.Before(p.snapshots[oldest].expires) {
+				oldest = id
+			}
+		}
+		p.drop(oldest)
+	}
+}
+
+// newSnapshotID returns a random snapshot ID.
+func newSnapshotID() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// page returns the items of the page of a list which page asks for, the etcd index the
+// list was read at, and the token continuing it, empty if it has no more items. read is
+// called to read the whole list when page starts a new one; it returns the list with the
+// etcd index it was read at, 0 for registries which don't read from etcd. Continuing a snapshot which is gone returns an
+// Expired error, and continuing one of another scope a BadRequest error.
+func (p *listPager) page(page pageRequest, read func() ([]interface{}, uint64, error)) ([]interface{}, uint64, string, error) {
+	if page.token == nil {
+		items, index, err := read()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if page.limit == 0 || len(items) <= page.limit {
+			return items, index, "", nil
+		}
+		if len(items) > maxSnapshotItems {
+			return nil, 0, "", api.NewBadRequestErr(fmt.Sprintf("the list has more than %d items, too many to be paged; it has to be read without a limit", maxSnapshotItems))
+		}
+		id, err := newSnapshotID()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.expire(p.currentTime())
+		if p.snapshots == nil {
+			p.snapshots = map[string]*listSnapshot{}
+		}
+		p.makeRoom(len(items))
+		token := continueToken{Index: index, Snapshot: id}
+		p.snapshots[id] = &listSnapshot{index: index, scope: page.scope, items: items}
+		p.items += len(items)
+		return p.cut(token, page.limit)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.expire(p.currentTime())
+	token := *page.token
+	snapshot := p.snapshots[token.Snapshot]
+	if snapshot == nil || snapshot.index != token.Index {
+		return nil, 0, "", api.NewExpiredErr("the list being continued has expired, it has to be read again from the start")
+	}
+	if snapshot.scope != page.scope {
+		return nil, 0, "", api.NewBadRequestErr("the continue token is for a list of another namespace or selector")
+	}
+	if token.Offset < 0 || token.Offset > len(snapshot.items) {
+		return nil, 0, "", api.NewBadRequestErr(fmt.Sprintf("invalid continue token offset %d", token.Offset))
+	}
+	return p.cut(token, page.limit)
+}
+
+// cut returns up to limit items of the snapshot named by token, starting at its offset,
+// and the token for the rest. The snapshot is dropped once all of it has been returned.
+// The caller holds the lock.
+func (p *listPager) cut(token continueToken, limit int) ([]interface{}, uint64, string, error) {
+	snapshot := p.snapshots[token.Snapshot]
+	end := len(snapshot.items)
+	if limit > 0 && token.Offset+limit < end {
+		end = token.Offset + limit
+	}
+	items := snapshot.items[token.Offset:end]
+	if end == len(snapshot.items) {
+		p.drop(token.Snapshot)
+		return items, snapshot.index, "", nil
+	}
+	snapshot.expires = p.currentTime().Add(snapshotTTL)
+	token.Offset = end
+	return items, snapshot.index, token.encode(), nil
+}
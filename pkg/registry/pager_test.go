@@ -0,0 +1,237 @@
+package registry
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-etcd/etcd"
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/util"
+)
+
+func pageURL(limit, token string) *url.URL {
+	query := url.Values{}
+	if len(limit) > 0 {
+		query.Set("limit", limit)
+	}
+	if len(token) > 0 {
+		query.Set("continue", token)
+	}
+	return &url.URL{RawQuery: query.Encode()}
+}
+
+func expectPage(t *testing.T, pager *listPager, limit, token string, read func() ([]interface{}, uint64, error), expected []interface{}) string {
+	page, err := pageFromURL(api.NamespaceDefault, pageURL(limit, token))
+	expectNoError(t, err)
+	items, index, next, err := pager.page(page, read)
+	expectNoError(t, err)
+	if index != 7 {
+		t.Errorf("Expected index 7, got %d", index)
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected %v, got %v", expected, items)
+	}
+	return next
+}
+
+func TestListPager(t *testing.T) {
+	list := []interface{}{"a", "b", "c", "d", "e"}
+	reads := 0
+	read := func() ([]interface{}, uint64, error) {
+		reads++
+		return list, 7, nil
+	}
+	pager := &listPager{}
+
+	if next := expectPage(t, pager, "", "", read, list); next != "" {
+		t.Errorf("Expected no continue token, got %q", next)
+	}
+	if next := expectPage(t, pager, "5", "", read, list); next != "" {
+		t.Errorf("Expected no continue token, got %q", next)
+	}
+
+	next := expectPage(t, pager, "2", "", read, list[0:2])
+	// Later pages come from the snapshot, whatever the list is now.
+	list = []interface{}{"x"}
+	next = expectPage(t, pager, "2", next, read, []interface{}{"c", "d"})
+	next = expectPage(t, pager, "2", next, read, []interface{}{"e"})
+	if next != "" {
+		t.Errorf("Expected no continue token, got %q", next)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 reads, got %d", reads)
+	}
+	if len(pager.snapshots) != 0 {
+		t.Errorf("Expected the finished snapshot to be dropped: %#v", pager.snapshots)
+	}
+}
+
+func TestListPagerExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	pager := &listPager{now: func() time.Time { return now }}
+	read := func() ([]interface{}, uint64, error) {
+		return []interface{}{"a", "b", "c"}, 7, nil
+	}
+	next := expectPage(t, pager, "1", "", read, []interface{}{"a"})
+	now = now.Add(snapshotTTL - time.Second)
+	next = expectPage(t, pager, "1", next, read, []interface{}{"b"})
+
+	now = now.Add(snapshotTTL + time.Second)
+	page, err := pageFromURL(api.NamespaceDefault, pageURL("1", next))
+	expectNoError(t, err)
+	if _, _, _, err := pager.page(page, read); !api.IsExpired(err) {
+		t.Errorf("Expected an expired error, got %#v", err)
+	}
+}
+
+func TestListPagerScope(t *testing.T) {
+	pager := &listPager{}
+	read := func() ([]interface{}, uint64, error) {
+		return []interface{}{"a", "b", "c"}, 7, nil
+	}
+	first, err := pageFromURL("teama", pageURL("1", ""))
+	expectNoError(t, err)
+	_, _, next, err := pager.page(first, read)
+	expectNoError(t, err)
+
+	for _, test := range []struct {
+		namespace string
+		query     string
+	}{
+		{"teamb", ""},
+		{"teama", "labels=team%3Db"},
+		{"teama", "fields=currentState.host%3Dmachine"},
+	} {
+		u := pageURL("1", next)
+		if len(test.query) > 0 {
+			u.RawQuery += "&" + test.query
+		}
+		page, err := pageFromURL(test.namespace, u)
+		expectNoError(t, err)
+		if _, _, _, err := pager.page(page, read); !api.IsBadRequest(err) {
+			t.Errorf("Expected a bad request error for %s %v, got %#v", test.namespace, u, err)
+		}
+	}
+	page, err := pageFromURL("teama", pageURL("1", next))
+	expectNoError(t, err)
+	if items, _, _, err := pager.page(page, read); err != nil || !reflect.DeepEqual(items, []interface{}{"b"}) {
+		t.Errorf("Unexpected page %v: %#v", items, err)
+	}
+}
+
+func TestListPagerLimits(t *testing.T) {
+	now := time.Unix(1000, 0)
+	pager := &listPager{now: func() time.Time { return now }}
+	read := func() ([]interface{}, uint64, error) {
+		return []interface{}{"a", "b"}, 7, nil
+	}
+	tokens := []string{}
+	for i := 0; i < maxSnapshots+1; i++ {
+		now = now.Add(time.Second)
+		tokens = append(tokens, expectPage(t, pager, "1", "", read, []interface{}{"a"}))
+	}
+	if len(pager.snapshots) != maxSnapshots || pager.items != 2*maxSnapshots {
+		t.Errorf("Expected %d snapshots, got %d with %d items", maxSnapshots, len(pager.snapshots), pager.items)
+	}
+	first, err := decodeContinueToken(tokens[0])
+	expectNoError(t, err)
+	second, err := decodeContinueToken(tokens[1])
+	expectNoError(t, err)
+	if len(first.Snapshot) != 32 || first.Snapshot == second.Snapshot {
+		t.Errorf("Expected random snapshot IDs, got %q and %q", first.Snapshot, second.Snapshot)
+	}
+	// The snapshot which expires first made room for the last.
+	page, err := pageFromURL(api.NamespaceDefault, pageURL("1", tokens[0]))
+	expectNoError(t, err)
+	if _, _, _, err := pager.page(page, read); !api.IsExpired(err) {
+		t.Errorf("Expected an expired error, got %#v", err)
+	}
+	expectPage(t, pager, "1", tokens[1], read, []interface{}{"b"})
+
+	large := func() ([]interface{}, uint64, error) {
+		return make([]interface{}, maxSnapshotItems+1), 7, nil
+	}
+	page, err = pageFromURL(api.NamespaceDefault, pageURL("1", ""))
+	expectNoError(t, err)
+	if _, _, _, err := pager.page(page, large); !api.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error, got %#v", err)
+	}
+}
+
+func TestPageFromURLErrors(t *testing.T) {
+	for _, u := range []*url.URL{
+		pageURL("-1", ""),
+		pageURL("ten", ""),
+		pageURL("", "not a token"),
+	} {
+		if _, err := pageFromURL(api.NamespaceDefault, u); !api.IsBadRequest(err) {
+			t.Errorf("Expected a bad request error for %v, got %#v", u, err)
+		}
+	}
+}
+
+func TestListTasksPaginated(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	for _, id := range []string{"foo", "bar", "baz"} {
+		expectNoError(t, registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: id}}))
+	}
+	storage := MakeTaskRegistryStorage(registry, nil, nil, nil)
+
+	obj, err := storage.List(api.NamespaceDefault, pageURL("2", ""))
+	expectNoError(t, err)
+	first := obj.(api.TaskList)
+	if len(first.Items) != 2 || len(first.Continue) == 0 {
+		t.Fatalf("Unexpected first page: %#v", first)
+	}
+	// The token only continues lists of the same namespace and selectors.
+	_, err = storage.List("other", pageURL("2", first.Continue))
+	if !api.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error, got %#v", err)
+	}
+	expectNoError(t, registry.DeleteTask(api.NamespaceDefault, "foo"))
+	obj, err = storage.List(api.NamespaceDefault, pageURL("2", first.Continue))
+	expectNoError(t, err)
+	second := obj.(api.TaskList)
+	if len(second.Items) != 1 || len(second.Continue) != 0 {
+		t.Fatalf("Unexpected second page: %#v", second)
+	}
+	seen := map[string]bool{}
+	for _, task := range append(first.Items, second.Items...) {
+		seen[task.ID] = true
+	}
+	if !reflect.DeepEqual(seen, map[string]bool{"foo": true, "bar": true, "baz": true}) {
+		t.Errorf("Expected every task of the snapshot, got %v", seen)
+	}
+}
+
+func TestListControllersPaginatedAtEtcdIndex(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	fakeClient.Data["/registry/controllers/default"] = EtcdResponseWithError{
+		R: &etcd.Response{
+			Node: &etcd.Node{
+				Nodes: []*etcd.Node{
+					{Value: util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo"}}), ModifiedIndex: 3},
+					{Value: util.MakeJSONString(api.ReplicationController{JSONBase: api.JSONBase{ID: "bar"}}), ModifiedIndex: 5},
+				},
+			},
+			EtcdIndex: 42,
+		},
+	}
+	storage := MakeControllerRegistryStorage(MakeTestEtcdRegistry(fakeClient, []string{"machine"}), nil)
+
+	obj, err := storage.List(api.NamespaceDefault, pageURL("1", ""))
+	expectNoError(t, err)
+	first := obj.(api.ReplicationControllerList)
+	token, err := decodeContinueToken(first.Continue)
+	expectNoError(t, err)
+	if first.ResourceVersion != 42 || token.Index != 42 {
+		t.Errorf("Expected the list and its token at index 42, got %d and %d", first.ResourceVersion, token.Index)
+	}
+	obj, err = storage.List(api.NamespaceDefault, pageURL("1", first.Continue))
+	expectNoError(t, err)
+	if second := obj.(api.ReplicationControllerList); second.ResourceVersion != 42 || len(second.Items) != 1 || second.Items[0].ID != "bar" {
+		t.Errorf("Unexpected second page: %#v", second)
+	}
+}
@@ -0,0 +1,363 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/api/validation"
+	"k8s-firstcommit/pkg/apiserver"
+	"k8s-firstcommit/pkg/labels"
+)
+
+// QuotaTracker keeps the objects of each namespace within that namespace's resource
+// quotas. Usage is counted from the registries whenever it is needed, so it always
+// agrees with what they store: a write under a quota lists the namespace's objects once,
+// whatever the number of quotas it falls under, and writes under no quota list nothing.
+// Checks are serialized, per namespace, with the writes they allow so that two requests
+// can't both take the last of a resource. That only holds within one API server process;
+// API servers sharing a cluster can together go over a quota.
+type QuotaTracker struct {
+	quotas      QuotaRegistry
+	tasks       TaskRegistry
+	controllers ControllerRegistry
+	services    ServiceRegistry
+
+	// lock guards namespaceLocks, which serialize the writes to each namespace.
+	lock           sync.Mutex
+	namespaceLocks map[string]*sync.Mutex
+}
+
+func MakeQuotaTracker(quotas QuotaRegistry, tasks TaskRegistry, controllers ControllerRegistry, services ServiceRegistry) *QuotaTracker {
+	return &QuotaTracker{
+		quotas:         quotas,
+		tasks:          tasks,
+		controllers:    controllers,
+		services:       services,
+		namespaceLocks: map[string]*sync.Mutex{},
+	}
+}
+
+// namespaceLock returns the lock serializing the writes to namespace.
+func (t *QuotaTracker) namespaceLock(namespace string) *sync.Mutex {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	lock, ok := t.namespaceLocks[namespace]
+	if !ok {
+		lock = &sync.Mutex{}
+		t.namespaceLocks[namespace] = lock
+	}
+	return lock
+}
+
+// objectUsage returns the namespace and labels of obj, a task, controller or service,
+// and the resources it uses.
+func objectUsage(obj interface{}) (string, map[string]string, api.ResourceList) {
+	switch obj := obj.(type) {
+	case api.Task:
+		usage := api.ResourceList{api.ResourceTasks: 1}
+		for _, container := range obj.DesiredState.Manifest.Containers {
+			usage[api.ResourceMemory] += container.Memory
+			usage[api.ResourceCPU] += container.CPU
+		}
+		return api.NamespaceOrDefault(obj.Namespace), obj.Labels, usage
+	case api.ReplicationController:
+		return api.NamespaceOrDefault(obj.Namespace), obj.Labels, api.ResourceList{api.ResourceReplicationControllers: 1}
+	case api.Service:
+		return api.NamespaceOrDefault(obj.Namespace), obj.Labels, api.ResourceList{api.ResourceServices: 1}
+	}
+	return "", nil, api.ResourceList{}
+}
+
+// listObjects returns the objects in namespace of the kinds which use any of resources.
+func (t *QuotaTracker) listObjects(namespace string, resources map[string]bool) ([]interface{}, error) {
+	objects := []interface{}{}
+	if resources[api.ResourceTasks] || resources[api.ResourceMemory] || resources[api.ResourceCPU] {
+		tasks, err := t.tasks.ListTasks(namespace, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			objects = append(objects, task)
+		}
+	}
+	if resources[api.ResourceReplicationControllers] {
+		controllers, err := t.controllers.ListControllers(namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, controller := range controllers {
+			objects = append(objects, controller)
+		}
+	}
+	if resources[api.ResourceServices] {
+		services, err := t.services.ListServices(namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range services.Items {
+			objects = append(objects, service)
+		}
+	}
+	return objects, nil
+}
+
+// quotaResources returns the resources limited by quotas.
+func quotaResources(quotas []api.ResourceQuota) map[string]bool {
+	resources := map[string]bool{}
+	for _, quota := range quotas {
+		for resource := range quota.Hard {
+			resources[resource] = true
+		}
+	}
+	return resources
+}
+
+// usageOf returns the resources used by the objects which carry every label in set.
+func usageOf(objects []interface{}, set map[string]string) api.ResourceList {
+	selector := labels.SelectorFromSet(set)
+	used := api.ResourceList{}
+	for _, obj := range objects {
+		_, objectLabels, usage := objectUsage(obj)
+		if !selector.Matches(objectLabels) {
+			continue
+		}
+		for resource, amount := range usage {
+			used[resource] += amount
+		}
+	}
+	return used
+}
+
+// Usage returns the resources limited by quotas which are used by the objects in
+// namespace under each of them, in the same order.
+func (t *QuotaTracker) Usage(namespace string, quotas []api.ResourceQuota) ([]api.ResourceList, error) {
+	objects, err := t.listObjects(namespace, quotaResources(quotas))
+	if err != nil {
+		return nil, err
+	}
+	used := []api.ResourceList{}
+	for _, quota := range quotas {
+		used = append(used, usageOf(objects, quota.Selector))
+	}
+	return used, nil
+}
+
+// Admit calls write, which stores obj in place of existing, if that leaves every quota
+// of obj's namespace which obj falls under within its limits. Existing is nil for
+// creates. Writes which don't increase the use of a resource are always allowed, even
+// if the quota has since been lowered below what is in use. A nil QuotaTracker admits
+// everything.
+func (t *QuotaTracker) Admit(obj, existing interface{}, write func() error) error {
+	if t == nil {
+		return write()
+	}
+	namespace, objectLabels, requested := objectUsage(obj)
+	quotas, err := t.quotas.ListQuotas(namespace)
+	if err != nil {
+		return err
+	}
+	matching := []api.ResourceQuota{}
+	for _, quota := range quotas {
+		if labels.SelectorFromSet(quota.Selector).Matches(objectLabels) {
+			matching = append(matching, quota)
+		}
+	}
+	if len(matching) == 0 {
+		return write()
+	}
+
+	lock := t.namespaceLock(namespace)
+	lock.Lock()
+	defer lock.Unlock()
+	used, err := t.Usage(namespace, matching)
+	if err != nil {
+		return err
+	}
+	for i, quota := range matching {
+		released := api.ResourceList{}
+		if existing != nil {
+			if _, existingLabels, usage := objectUsage(existing); labels.SelectorFromSet(quota.Selector).Matches(existingLabels) {
+				released = usage
+			}
+		}
+		if err := checkQuota(quota, used[i], requested, released); err != nil {
+			return err
+		}
+	}
+	return write()
+}
+
+// checkQuota returns a Forbidden error naming the first exhausted resource if using
+// requested in place of released would take used over quota.
+func checkQuota(quota api.ResourceQuota, used, requested, released api.ResourceList) error {
+	resources := make([]string, 0, len(quota.Hard))
+	for resource := range quota.Hard {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		if requested[resource] <= released[resource] {
+			continue
+		}
+		hard := quota.Hard[resource]
+		if total := used[resource] - released[resource] + requested[resource]; total > hard {
+			return api.NewForbiddenErr("resourceQuota", quota.ID, fmt.Errorf("exceeded quota %q in namespace %q: %s is limited to %d, %d is used and %d more was requested", quota.ID, api.NamespaceOrDefault(quota.Namespace), resource, hard, used[resource], requested[resource]-released[resource]))
+		}
+	}
+	return nil
+}
+
+// QuotaRegistryStorage implements the RESTStorage interface for resource quotas. Quotas
+// are returned with what is currently used of each of their resources.
+type QuotaRegistryStorage struct {
+	registry QuotaRegistry
+	tracker  *QuotaTracker
+}
+
+func MakeQuotaRegistryStorage(registry QuotaRegistry, tracker *QuotaTracker) apiserver.RESTStorage {
+	return &QuotaRegistryStorage{
+		registry: registry,
+		tracker:  tracker,
+	}
+}
+
+// withUsage fills in what is used of each resource limited by quotas, which are all in
+// the same namespace.
+func (storage *QuotaRegistryStorage) withUsage(quotas []api.ResourceQuota) ([]api.ResourceQuota, error) {
+	if len(quotas) == 0 {
+		return quotas, nil
+	}
+	used, err := storage.tracker.Usage(api.NamespaceOrDefault(quotas[0].Namespace), quotas)
+	if err != nil {
+		return nil, err
+	}
+	for i := range quotas {
+		quotas[i].Used = api.ResourceList{}
+		for resource := range quotas[i].Hard {
+			quotas[i].Used[resource] = used[i][resource]
+		}
+	}
+	return quotas, nil
+}
+
+// withQuotaUsage fills in what is used of each resource limited by quota.
+func (storage *QuotaRegistryStorage) withQuotaUsage(quota api.ResourceQuota) (api.ResourceQuota, error) {
+	quotas, err := storage.withUsage([]api.ResourceQuota{quota})
+	if err != nil {
+		return quota, err
+	}
+	return quotas[0], nil
+}
+
+func (storage *QuotaRegistryStorage) List(namespace string, url *url.URL) (interface{}, error) {
+	quotas, err := storage.registry.ListQuotas(namespace)
+	if err != nil {
+		return nil, err
+	}
+	// The usage is counted once per namespace.
+	byNamespace := map[string][]int{}
+	for i, quota := range quotas {
+		quotaNamespace := api.NamespaceOrDefault(quota.Namespace)
+		byNamespace[quotaNamespace] = append(byNamespace[quotaNamespace], i)
+	}
+	for _, indexes := range byNamespace {
+		group := []api.ResourceQuota{}
+		for _, i := range indexes {
+			group = append(group, quotas[i])
+		}
+		if group, err = storage.withUsage(group); err != nil {
+			return nil, err
+		}
+		for j, i := range indexes {
+			quotas[i] = group[j]
+		}
+	}
+	return api.ResourceQuotaList{Items: quotas}, nil
+}
+
+func (storage *QuotaRegistryStorage) Get(namespace, id string) (interface{}, error) {
+	quota, err := storage.registry.GetQuota(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return storage.withQuotaUsage(*quota)
+}
+
+func (storage *QuotaRegistryStorage) Delete(namespace, id string) error {
+	return storage.registry.DeleteQuota(namespace, id)
+}
+
+// DryRunDelete fails the way Delete would, without deleting anything.
+func (storage *QuotaRegistryStorage) DryRunDelete(namespace, id string) error {
+	_, err := storage.registry.GetQuota(namespace, id)
+	return err
+}
+
+func (storage *QuotaRegistryStorage) Extract(body string) (interface{}, error) {
+	quota := api.ResourceQuota{}
+	err := api.DecodeInto([]byte(body), &quota)
+	return quota, err
+}
+
+func (storage *QuotaRegistryStorage) Create(obj interface{}) (interface{}, error) {
+	return storage.create(obj, false)
+}
+
+// DryRunCreate does everything Create does but store the quota.
+func (storage *QuotaRegistryStorage) DryRunCreate(obj interface{}) (interface{}, error) {
+	return storage.create(obj, true)
+}
+
+func (storage *QuotaRegistryStorage) create(obj interface{}, dryRun bool) (interface{}, error) {
+	quota := obj.(api.ResourceQuota)
+	quota.CreationTimestamp = creationTimestamp()
+	if errs := validation.ValidateResourceQuota(&quota); len(errs) > 0 {
+		return nil, api.NewInvalidErr("resourceQuota", quota.ID, errs.Causes())
+	}
+	var err error
+	if dryRun {
+		err = checkAbsent("resourceQuota", quota.ID, func() error {
+			_, err := storage.registry.GetQuota(quota.Namespace, quota.ID)
+			return err
+		})
+	} else {
+		err = storage.registry.CreateQuota(quota)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storage.withQuotaUsage(quota)
+}
+
+func (storage *QuotaRegistryStorage) Update(obj interface{}) (interface{}, error) {
+	return storage.update(obj, false)
+}
+
+// DryRunUpdate does everything Update does but store the quota.
+func (storage *QuotaRegistryStorage) DryRunUpdate(obj interface{}) (interface{}, error) {
+	return storage.update(obj, true)
+}
+
+func (storage *QuotaRegistryStorage) update(obj interface{}, dryRun bool) (interface{}, error) {
+	quota := obj.(api.ResourceQuota)
+	if errs := validation.ValidateResourceQuota(&quota); len(errs) > 0 {
+		return nil, api.NewInvalidErr("resourceQuota", quota.ID, errs.Causes())
+	}
+	existing, err := storage.registry.GetQuota(quota.Namespace, quota.ID)
+	if err != nil {
+		return nil, err
+	}
+	quota.CreationTimestamp = existing.CreationTimestamp
+	if dryRun {
+		err = checkResourceVersion("resourceQuota", quota.ID, existing.ResourceVersion, quota.ResourceVersion)
+	} else {
+		err = storage.registry.UpdateQuota(quota)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storage.withQuotaUsage(quota)
+}
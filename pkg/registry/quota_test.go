@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-etcd/etcd"
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/labels"
+)
+
+func makeQuotaTask(id, namespace string, memory int, labels map[string]string) api.Task {
+	return api.Task{
+		JSONBase: api.JSONBase{ID: id, Namespace: namespace},
+		Labels:   labels,
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Version:    "v1beta1",
+				Containers: []api.Container{{Name: "web", Image: "nginx", Memory: memory}},
+			},
+		},
+	}
+}
+
+func expectForbidden(t *testing.T, err error, resource string) {
+	if !api.IsForbidden(err) {
+		t.Errorf("Expected a forbidden error, got %#v", err)
+		return
+	}
+	if !strings.Contains(err.Error(), resource) {
+		t.Errorf("Expected the error to name %s, got %q", resource, err.Error())
+	}
+}
+
+func TestQuotaLimitsTasks(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	tracker := MakeQuotaTracker(registry, registry, registry, registry)
+	expectNoError(t, registry.CreateQuota(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "team", Namespace: "team"},
+		Hard:     api.ResourceList{api.ResourceTasks: 2, api.ResourceMemory: 100},
+	}))
+	storage := MakeTaskRegistryStorage(registry, nil, MakeRoundRobinScheduler([]string{"machine"}), tracker)
+
+	_, err := storage.Create(makeQuotaTask("foo", "team", 60, nil))
+	expectNoError(t, err)
+	_, err = storage.Create(makeQuotaTask("bar", "team", 60, nil))
+	expectForbidden(t, err, api.ResourceMemory)
+	_, err = storage.Create(makeQuotaTask("bar", "team", 40, nil))
+	expectNoError(t, err)
+	_, err = storage.Create(makeQuotaTask("baz", "team", 0, nil))
+	expectForbidden(t, err, api.ResourceTasks)
+
+	// Other namespaces aren't limited.
+	_, err = storage.Create(makeQuotaTask("baz", "other", 1000, nil))
+	expectNoError(t, err)
+
+	// Updates are checked against what they add.
+	_, err = storage.Update(makeQuotaTask("foo", "team", 61, nil))
+	expectForbidden(t, err, api.ResourceMemory)
+	_, err = storage.Update(makeQuotaTask("foo", "team", 50, nil))
+	expectNoError(t, err)
+}
+
+func TestQuotaSelector(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	tracker := MakeQuotaTracker(registry, registry, registry, registry)
+	expectNoError(t, registry.CreateQuota(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "batch", Namespace: api.NamespaceDefault},
+		Selector: map[string]string{"tier": "batch"},
+		Hard:     api.ResourceList{api.ResourceServices: 0},
+	}))
+	storage := MakeServiceRegistryStorage(registry, tracker)
+
+	_, err := storage.Create(api.Service{JSONBase: api.JSONBase{ID: "web"}, Port: 80, Labels: map[string]string{"tier": "frontend"}})
+	expectNoError(t, err)
+	_, err = storage.Create(api.Service{JSONBase: api.JSONBase{ID: "jobs"}, Port: 80, Labels: map[string]string{"tier": "batch"}})
+	expectForbidden(t, err, api.ResourceServices)
+	// Moving an existing service under the quota is refused too.
+	_, err = storage.Update(api.Service{JSONBase: api.JSONBase{ID: "web"}, Port: 80, Labels: map[string]string{"tier": "batch"}})
+	expectForbidden(t, err, api.ResourceServices)
+}
+
+// countingRegistry is a MemoryRegistry which counts the listings of tasks.
+type countingRegistry struct {
+	*MemoryRegistry
+	taskLists int
+}
+
+func (registry *countingRegistry) ListTasks(namespace string, selector labels.Selector) ([]api.Task, error) {
+	registry.taskLists++
+	return registry.MemoryRegistry.ListTasks(namespace, selector)
+}
+
+func TestQuotaListsOncePerWrite(t *testing.T) {
+	registry := &countingRegistry{MemoryRegistry: MakeMemoryRegistry()}
+	tracker := MakeQuotaTracker(registry, registry, registry, registry)
+	expectNoError(t, registry.CreateQuota(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "tasks", Namespace: "team"},
+		Hard:     api.ResourceList{api.ResourceTasks: 2},
+	}))
+	expectNoError(t, registry.CreateQuota(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "memory", Namespace: "team"},
+		Hard:     api.ResourceList{api.ResourceMemory: 100},
+	}))
+	write := func() error { return nil }
+
+	expectNoError(t, tracker.Admit(makeQuotaTask("foo", "team", 10, nil), nil, write))
+	if registry.taskLists != 1 {
+		t.Errorf("Expected 1 listing, got %d", registry.taskLists)
+	}
+	// Writes under no quota list nothing.
+	expectNoError(t, tracker.Admit(makeQuotaTask("foo", "other", 10, nil), nil, write))
+	if registry.taskLists != 1 {
+		t.Errorf("Expected 1 listing, got %d", registry.taskLists)
+	}
+}
+
+func TestQuotaStorageReportsUsage(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	tracker := MakeQuotaTracker(registry, registry, registry, registry)
+	storage := MakeQuotaRegistryStorage(registry, tracker)
+	expectNoError(t, registry.CreateTask("machine", makeQuotaTask("foo", "team", 30, nil)))
+	expectNoError(t, registry.CreateController(api.ReplicationController{JSONBase: api.JSONBase{ID: "foo", Namespace: "team"}}))
+
+	_, err := storage.Create(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "team", Namespace: "team"},
+		Hard:     api.ResourceList{api.ResourceMemory: 100, api.ResourceReplicationControllers: 5},
+	})
+	expectNoError(t, err)
+	obj, err := storage.Get("team", "team")
+	expectNoError(t, err)
+	expected := api.ResourceList{api.ResourceMemory: 30, api.ResourceReplicationControllers: 1}
+	if used := obj.(api.ResourceQuota).Used; !reflect.DeepEqual(used, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, used)
+	}
+
+	_, err = storage.Create(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "bad", Namespace: "team"},
+		Hard:     api.ResourceList{"disks": 1},
+	})
+	if !api.IsInvalid(err) {
+		t.Errorf("Expected an invalid error, got %#v", err)
+	}
+}
+
+func TestEtcdCreateQuota(t *testing.T) {
+	fakeClient := MakeFakeEtcdClient(t)
+	registry := MakeTestEtcdRegistry(fakeClient, []string{"machine"})
+	err := registry.CreateQuota(api.ResourceQuota{
+		JSONBase: api.JSONBase{ID: "foo", Namespace: "team"},
+		Hard:     api.ResourceList{api.ResourceTasks: 1},
+		Used:     api.ResourceList{api.ResourceTasks: 1},
+	})
+	expectNoError(t, err)
+	resp, err := fakeClient.Get("/registry/quotas/team/foo", false, false)
+	expectNoError(t, err)
+	var quota api.ResourceQuota
+	expectNoError(t, json.Unmarshal([]byte(resp.Node.Value), &quota))
+	if quota.ID != "foo" || quota.Hard[api.ResourceTasks] != 1 || quota.Used != nil {
+		t.Errorf("Unexpected quota: %#v %s", quota, resp.Node.Value)
+	}
+
+	got, err := registry.GetQuota("team", "foo")
+	expectNoError(t, err)
+	if got.ID != "foo" {
+		t.Errorf("Unexpected quota: %#v", got)
+	}
+	fakeClient.Data["/registry/quotas/other/foo"] = EtcdResponseWithError{
+		R: &etcd.Response{},
+		E: &etcd.EtcdError{ErrorCode: 100},
+	}
+	if _, err := registry.GetQuota("other", "foo"); !api.IsNotFound(err) {
+		t.Errorf("Expected not found, got %#v", err)
+	}
+}
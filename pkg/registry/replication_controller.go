@@ -12,6 +12,7 @@ import (
 	"github.com/coreos/go-etcd/etcd"
 	"k8s-firstcommit/pkg/api"
 	"k8s-firstcommit/pkg/client"
+	"k8s-firstcommit/pkg/labels"
 	"k8s-firstcommit/pkg/util"
 )
 
@@ -23,13 +24,17 @@ type ReplicationManager struct {
 	kubeClient  client.ClientInterface
 	taskControl TaskControlInterface
 	updateLock  sync.Mutex
+	// The newest resource version of each controller that has been synchronized, keyed
+	// by namespace and ID, so that a stale read in Synchronize can't undo a change
+	// already picked up by the watch.
+	lastVersion map[string]uint64
 }
 
 // An interface that knows how to add or delete tasks
 // created as an interface to allow testing.
 type TaskControlInterface interface {
 	createReplica(controllerSpec api.ReplicationController)
-	deleteTask(taskID string) error
+	deleteTask(namespace, taskID string) error
 }
 
 type RealTaskControl struct {
@@ -41,21 +46,23 @@ func (r RealTaskControl) createReplica(controllerSpec api.ReplicationController)
 	if labels != nil {
 		labels["replicationController"] = controllerSpec.ID
 	}
+	namespace := api.NamespaceOrDefault(controllerSpec.Namespace)
 	task := api.Task{
 		JSONBase: api.JSONBase{
-			ID: fmt.Sprintf("%x", rand.Int()),
+			ID:        fmt.Sprintf("%x", rand.Int()),
+			Namespace: namespace,
 		},
 		DesiredState: controllerSpec.DesiredState.TaskTemplate.DesiredState,
 		Labels:       controllerSpec.DesiredState.TaskTemplate.Labels,
 	}
-	_, err := r.kubeClient.CreateTask(task)
+	_, err := r.kubeClient.InNamespace(namespace).CreateTask(task)
 	if err != nil {
 		log.Printf("%#v\n", err)
 	}
 }
 
-func (r RealTaskControl) deleteTask(taskID string) error {
-	return r.kubeClient.DeleteTask(taskID)
+func (r RealTaskControl) deleteTask(namespace, taskID string) error {
+	return r.kubeClient.InNamespace(namespace).DeleteTask(taskID)
 }
 
 func MakeReplicationManager(etcdClient *etcd.Client, kubeClient client.ClientInterface) *ReplicationManager {
@@ -65,6 +72,7 @@ func MakeReplicationManager(etcdClient *etcd.Client, kubeClient client.ClientInt
 		taskControl: RealTaskControl{
 			kubeClient: kubeClient,
 		},
+		lastVersion: map[string]uint64{},
 	}
 }
 
@@ -95,6 +103,7 @@ func (rm *ReplicationManager) handleWatchResponse(response *etcd.Response) (*api
 			if err != nil {
 				return nil, err
 			}
+			controllerSpec.ResourceVersion = response.Node.ModifiedIndex
 			return &controllerSpec, nil
 		} else {
 			return nil, fmt.Errorf("Response node is null %#v", response)
@@ -115,7 +124,18 @@ func (rm *ReplicationManager) filterActiveTasks(tasks []api.Task) []api.Task {
 
 func (rm *ReplicationManager) syncReplicationController(controllerSpec api.ReplicationController) error {
 	rm.updateLock.Lock()
-	taskList, err := rm.kubeClient.ListTasks(controllerSpec.DesiredState.ReplicasInSet)
+	defer rm.updateLock.Unlock()
+	namespace := api.NamespaceOrDefault(controllerSpec.Namespace)
+	if version := controllerSpec.ResourceVersion; version != 0 {
+		key := namespace + "/" + controllerSpec.ID
+		if version < rm.lastVersion[key] {
+			log.Printf("Skipping stale version %d of %s, already synchronized %d", version, key, rm.lastVersion[key])
+			return nil
+		}
+		rm.lastVersion[key] = version
+	}
+	// A controller only counts, and only creates, tasks in its own namespace.
+	taskList, err := rm.kubeClient.InNamespace(namespace).ListTasks(labels.SelectorFromSet(controllerSpec.DesiredState.ReplicasInSet))
 	if err != nil {
 		return err
 	}
@@ -131,34 +151,41 @@ func (rm *ReplicationManager) syncReplicationController(controllerSpec api.Repli
 	} else if diff > 0 {
 		log.Print("Too many replicas, deleting")
 		for i := 0; i < diff; i++ {
-			rm.taskControl.deleteTask(filteredList[i].ID)
+			rm.taskControl.deleteTask(namespace, filteredList[i].ID)
 		}
 	}
-	rm.updateLock.Unlock()
 	return nil
 }
 
+// controllerNodes returns the controllers in node, the recursive listing of
+// /registry/controllers.
+func controllerNodes(node *etcd.Node) []*etcd.Node {
+	nodes := []*etcd.Node{}
+	for _, namespace := range node.Nodes {
+		nodes = append(nodes, namespace.Nodes...)
+	}
+	return nodes
+}
+
 func (rm *ReplicationManager) Synchronize() {
 	for {
-		response, err := rm.etcdClient.Get("/registry/controllers", false, false)
+		// Controllers are kept in a directory per namespace.
+		response, err := rm.etcdClient.Get("/registry/controllers", false, true)
 		if err != nil {
 			log.Printf("Synchronization error %#v", err)
 		}
-		// TODO(bburns): There is a race here, if we get a version of the controllers, and then it is
-		// updated, its possible that the watch will pick up the change first, and then we will execute
-		// using the old version of the controller.
-		// Probably the correct thing to do is to use the version number in etcd to detect when
-		// we are stale.
-		// Punting on this for now, but this could lead to some nasty bugs, so we should really fix it
-		// sooner rather than later.
-		if response != nil && response.Node != nil && response.Node.Nodes != nil {
-			for _, value := range response.Node.Nodes {
+		// If a controller is updated after this read, the watch may pick up the change first.
+		// syncReplicationController compares resource versions, so the stale copy read here
+		// is skipped rather than undoing the newer one.
+		if response != nil && response.Node != nil {
+			for _, value := range controllerNodes(response.Node) {
 				var controllerSpec api.ReplicationController
 				err := json.Unmarshal([]byte(value.Value), &controllerSpec)
 				if err != nil {
 					log.Printf("Unexpected error: %#v", err)
 					continue
 				}
+				controllerSpec.ResourceVersion = value.ModifiedIndex
 				log.Printf("Synchronizing %s\n", controllerSpec.ID)
 				err = rm.syncReplicationController(controllerSpec)
 				if err != nil {
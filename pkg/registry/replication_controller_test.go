@@ -29,7 +29,7 @@ func (f *FakeTaskControl) createReplica(spec api.ReplicationController) {
 	f.controllerSpec = append(f.controllerSpec, spec)
 }
 
-func (f *FakeTaskControl) deleteTask(taskID string) error {
+func (f *FakeTaskControl) deleteTask(namespace, taskID string) error {
 	f.deleteTaskID = append(f.deleteTaskID, taskID)
 	return nil
 }
@@ -146,6 +146,32 @@ func TestSyncReplicationControllerCreates(t *testing.T) {
 	validateSyncReplication(t, &fakeTaskControl, 2, 0)
 }
 
+func TestSyncReplicationControllerSkipsStaleVersion(t *testing.T) {
+	body := "{ \"items\": [] }"
+	fakeHandler := util.FakeHandler{
+		StatusCode:   200,
+		ResponseBody: body,
+	}
+	testServer := httptest.NewTLSServer(&fakeHandler)
+	client := client.Client{
+		Host: testServer.URL,
+	}
+
+	fakeTaskControl := FakeTaskControl{}
+
+	manager := MakeReplicationManager(nil, &client)
+	manager.taskControl = &fakeTaskControl
+
+	newer := makeReplicationController(0)
+	newer.ResourceVersion = 5
+	stale := makeReplicationController(2)
+	stale.ResourceVersion = 4
+
+	manager.syncReplicationController(newer)
+	manager.syncReplicationController(stale)
+	validateSyncReplication(t, &fakeTaskControl, 0, 0)
+}
+
 func TestCreateReplica(t *testing.T) {
 	body := "{}"
 	fakeHandler := util.FakeHandler{
@@ -162,6 +188,7 @@ func TestCreateReplica(t *testing.T) {
 	}
 
 	controllerSpec := api.ReplicationController{
+		JSONBase: api.JSONBase{Namespace: "other"},
 		DesiredState: api.ReplicationControllerState{
 			TaskTemplate: api.TaskTemplate{
 				DesiredState: api.TaskState{
@@ -188,7 +215,7 @@ func TestCreateReplica(t *testing.T) {
 	//	DesiredState: controllerSpec.DesiredState.TaskTemplate.DesiredState,
 	//}
 	// TODO: fix this so that it validates the body.
-	fakeHandler.ValidateRequest(t, makeUrl("/tasks"), "POST", nil)
+	fakeHandler.ValidateRequest(t, makeUrl("/namespaces/other/tasks"), "POST", nil)
 }
 
 func TestHandleWatchResponseNotSet(t *testing.T) {
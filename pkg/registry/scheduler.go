@@ -12,6 +12,23 @@ type Scheduler interface {
 	Schedule(api.Task) (string, error)
 }
 
+// Previewer is an optional interface for Schedulers which change their state when they
+// schedule a task. Preview returns the machine Schedule would pick for task, leaving the
+// state alone, so that dry runs don't move where later tasks go.
+type Previewer interface {
+	Preview(api.Task) (string, error)
+}
+
+// preview returns the machine scheduler would pick for task. Schedulers which aren't
+// Previewers are asked to Schedule, which for a RandomScheduler is only one of the
+// machines it might pick.
+func preview(scheduler Scheduler, task api.Task) (string, error) {
+	if previewer, ok := scheduler.(Previewer); ok {
+		return previewer.Preview(task)
+	}
+	return scheduler.Schedule(task)
+}
+
 // RandomScheduler choses machines uniformly at random.
 type RandomScheduler struct {
 	machines []string
@@ -48,6 +65,10 @@ func (s *RoundRobinScheduler) Schedule(task api.Task) (string, error) {
 	return result, nil
 }
 
+func (s *RoundRobinScheduler) Preview(task api.Task) (string, error) {
+	return s.machines[s.currentIndex], nil
+}
+
 type FirstFitScheduler struct {
 	machines []string
 	registry TaskRegistry
@@ -73,7 +94,7 @@ func (s *FirstFitScheduler) containsPort(task api.Task, port api.Port) bool {
 
 func (s *FirstFitScheduler) Schedule(task api.Task) (string, error) {
 	machineToTasks := map[string][]api.Task{}
-	tasks, err := s.registry.ListTasks(nil)
+	tasks, err := s.registry.ListTasks(api.NamespaceAll, nil)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"net/url"
+	"strconv"
+
+	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/fields"
+	"k8s-firstcommit/pkg/labels"
+)
+
+// selectorFromURL returns the label selector of a request, or a BadRequest error if it
+// doesn't parse.
+func selectorFromURL(url *url.URL) (labels.Selector, error) {
+	if url == nil {
+		return labels.Everything(), nil
+	}
+	selector, err := labels.Parse(url.Query().Get("labels"))
+	if err != nil {
+		return nil, api.NewBadRequestErr(err.Error())
+	}
+	return selector, nil
+}
+
+// fieldSelectorFromURL returns the field selector of a request for objects with the
+// fields in supported, or a BadRequest error if it doesn't parse or selects on any
+// other field.
+func fieldSelectorFromURL(url *url.URL, supported fields.Set) (fields.Selector, error) {
+	if url == nil {
+		return fields.Everything(), nil
+	}
+	selector, err := fields.Parse(url.Query().Get("fields"))
+	if err == nil {
+		err = selector.Supported(supported)
+	}
+	if err != nil {
+		return nil, api.NewBadRequestErr(err.Error())
+	}
+	return selector, nil
+}
+
+// taskFields returns the fields tasks can be selected by.
+func taskFields(task api.Task) fields.Set {
+	return fields.Set{
+		"id":                  task.ID,
+		"currentState.host":   task.CurrentState.Host,
+		"currentState.status": task.CurrentState.Status,
+	}
+}
+
+// controllerFields returns the fields replication controllers can be selected by.
+func controllerFields(controller api.ReplicationController) fields.Set {
+	return fields.Set{
+		"id":                    controller.ID,
+		"desiredState.replicas": strconv.Itoa(controller.DesiredState.Replicas),
+	}
+}
+
+// serviceFields returns the fields services can be selected by.
+func serviceFields(service api.Service) fields.Set {
+	return fields.Set{
+		"id":   service.ID,
+		"port": strconv.Itoa(service.Port),
+	}
+}
@@ -1,37 +1,46 @@
 package registry
 
 import (
-	"encoding/json"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/api/validation"
 	"k8s-firstcommit/pkg/apiserver"
+	"k8s-firstcommit/pkg/fields"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/watch"
 )
 
+// ServiceRegistry stores services and their endpoints. Services are named within a
+// namespace; api.NamespaceAll lists or watches the services of every namespace.
 type ServiceRegistry interface {
-	ListServices() (api.ServiceList, error)
+	ListServices(namespace string) (api.ServiceList, error)
 	CreateService(svc api.Service) error
-	GetService(name string) (*api.Service, error)
-	DeleteService(name string) error
+	GetService(namespace, name string) (*api.Service, error)
+	DeleteService(namespace, name string) error
 	UpdateService(svc api.Service) error
 	UpdateEndpoints(e api.Endpoints) error
+	WatchServices(namespace string) (watch.Interface, error)
 }
 
 type ServiceRegistryStorage struct {
 	registry ServiceRegistry
+	// quota limits the services of each namespace, nil if there are no quotas.
+	quota *QuotaTracker
+	pager listPager
 }
 
-func MakeServiceRegistryStorage(registry ServiceRegistry) apiserver.RESTStorage {
-	return &ServiceRegistryStorage{registry: registry}
+func MakeServiceRegistryStorage(registry ServiceRegistry, quota *QuotaTracker) apiserver.RESTStorage {
+	return &ServiceRegistryStorage{registry: registry, quota: quota}
 }
 
 // GetServiceEnvironmentVariables populates a list of environment variables that are use
-// in the container environment to get access to services.
-func GetServiceEnvironmentVariables(registry ServiceRegistry, machine string) ([]api.EnvVar, error) {
+// in the container environment to get access to the services in namespace.
+func GetServiceEnvironmentVariables(registry ServiceRegistry, namespace, machine string) ([]api.EnvVar, error) {
 	var result []api.EnvVar
-	services, err := registry.ListServices()
+	services, err := registry.ListServices(namespace)
 	if err != nil {
 		return result, err
 	}
@@ -44,28 +53,152 @@ func GetServiceEnvironmentVariables(registry ServiceRegistry, machine string) ([
 	return result, nil
 }
 
-func (sr *ServiceRegistryStorage) List(*url.URL) (interface{}, error) {
-	return sr.registry.ListServices()
+// selectorsFromURL returns the label and field selectors of a request for services.
+func (sr *ServiceRegistryStorage) selectorsFromURL(url *url.URL) (labels.Selector, fields.Selector, error) {
+	selector, err := selectorFromURL(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldSelector, err := fieldSelectorFromURL(url, serviceFields(api.Service{}))
+	return selector, fieldSelector, err
+}
+
+func (sr *ServiceRegistryStorage) List(namespace string, url *url.URL) (interface{}, error) {
+	selector, fieldSelector, err := sr.selectorsFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	page, err := pageFromURL(namespace, url)
+	if err != nil {
+		return nil, err
+	}
+	items, index, next, err := sr.pager.page(page, func() ([]interface{}, uint64, error) {
+		list, err := sr.registry.ListServices(namespace)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := []interface{}{}
+		for _, service := range list.Items {
+			if selector.Matches(service.Labels) && fieldSelector.Matches(serviceFields(service)) {
+				items = append(items, service)
+			}
+		}
+		return items, list.ResourceVersion, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := api.ServiceList{
+		JSONBase: api.JSONBase{ResourceVersion: index},
+		Items:    []api.Service{},
+		Continue: next,
+	}
+	for _, item := range items {
+		result.Items = append(result.Items, item.(api.Service))
+	}
+	return result, nil
+}
+
+func (sr *ServiceRegistryStorage) Get(namespace, id string) (interface{}, error) {
+	return sr.registry.GetService(namespace, id)
 }
 
-func (sr *ServiceRegistryStorage) Get(id string) (interface{}, error) {
-	return sr.registry.GetService(id)
+func (sr *ServiceRegistryStorage) Delete(namespace, id string) error {
+	return sr.registry.DeleteService(namespace, id)
 }
 
-func (sr *ServiceRegistryStorage) Delete(id string) error {
-	return sr.registry.DeleteService(id)
+// DryRunDelete fails the way Delete would, without deleting anything.
+func (sr *ServiceRegistryStorage) DryRunDelete(namespace, id string) error {
+	_, err := sr.registry.GetService(namespace, id)
+	return err
 }
 
 func (sr *ServiceRegistryStorage) Extract(body string) (interface{}, error) {
 	var svc api.Service
-	err := json.Unmarshal([]byte(body), &svc)
+	err := api.DecodeInto([]byte(body), &svc)
 	return svc, err
 }
 
-func (sr *ServiceRegistryStorage) Create(obj interface{}) error {
-	return sr.registry.CreateService(obj.(api.Service))
+func (sr *ServiceRegistryStorage) Create(obj interface{}) (interface{}, error) {
+	return sr.create(obj, false)
+}
+
+// DryRunCreate does everything Create does but store the service.
+func (sr *ServiceRegistryStorage) DryRunCreate(obj interface{}) (interface{}, error) {
+	return sr.create(obj, true)
+}
+
+func (sr *ServiceRegistryStorage) create(obj interface{}, dryRun bool) (interface{}, error) {
+	service := obj.(api.Service)
+	service.CreationTimestamp = creationTimestamp()
+	if errs := validation.ValidateService(&service); len(errs) > 0 {
+		return nil, api.NewInvalidErr("service", service.ID, errs.Causes())
+	}
+	write := func() error {
+		return sr.registry.CreateService(service)
+	}
+	if dryRun {
+		write = func() error {
+			return checkAbsent("service", service.ID, func() error {
+				_, err := sr.registry.GetService(service.Namespace, service.ID)
+				return err
+			})
+		}
+	}
+	return service, sr.quota.Admit(service, nil, write)
+}
+
+func (sr *ServiceRegistryStorage) Update(obj interface{}) (interface{}, error) {
+	return sr.update(obj, false)
+}
+
+// DryRunUpdate does everything Update does but store the service.
+func (sr *ServiceRegistryStorage) DryRunUpdate(obj interface{}) (interface{}, error) {
+	return sr.update(obj, true)
+}
+
+func (sr *ServiceRegistryStorage) update(obj interface{}, dryRun bool) (interface{}, error) {
+	service := obj.(api.Service)
+	if errs := validation.ValidateService(&service); len(errs) > 0 {
+		return nil, api.NewInvalidErr("service", service.ID, errs.Causes())
+	}
+	existing, err := sr.registry.GetService(service.Namespace, service.ID)
+	if err != nil {
+		return nil, err
+	}
+	service.CreationTimestamp = existing.CreationTimestamp
+	write := func() error {
+		return sr.registry.UpdateService(service)
+	}
+	if dryRun {
+		write = func() error {
+			return checkResourceVersion("service", service.ID, existing.ResourceVersion, service.ResourceVersion)
+		}
+	}
+	return service, sr.quota.Admit(service, *existing, write)
+}
+
+func (sr *ServiceRegistryStorage) WatchAll(namespace string, url *url.URL) (watch.Interface, error) {
+	selector, fieldSelector, err := sr.selectorsFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	w, err := sr.registry.WatchServices(namespace)
+	if err != nil || (selector.Empty() && fieldSelector.Empty()) {
+		return w, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		service := event.Object.(api.Service)
+		return event, selector.Matches(service.Labels) && fieldSelector.Matches(serviceFields(service))
+	}), nil
 }
 
-func (sr *ServiceRegistryStorage) Update(obj interface{}) error {
-	return sr.registry.UpdateService(obj.(api.Service))
+func (sr *ServiceRegistryStorage) WatchSingle(namespace, id string) (watch.Interface, error) {
+	w, err := sr.registry.WatchServices(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		return event, event.Object.(api.Service).ID == id
+	}), nil
 }
@@ -1,13 +1,18 @@
 package registry
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/api/validation"
 	"k8s-firstcommit/pkg/apiserver"
 	"k8s-firstcommit/pkg/client"
+	"k8s-firstcommit/pkg/stream"
+	"k8s-firstcommit/pkg/watch"
 )
 
 // TaskRegistryStorage implements the RESTStorage interface in terms of a TaskRegistry
@@ -15,61 +20,67 @@ type TaskRegistryStorage struct {
 	registry      TaskRegistry
 	containerInfo client.ContainerInfo
 	scheduler     Scheduler
+	// quota limits the tasks of each namespace, nil if there are no quotas.
+	quota *QuotaTracker
+	pager listPager
 }
 
-func MakeTaskRegistryStorage(registry TaskRegistry, containerInfo client.ContainerInfo, scheduler Scheduler) apiserver.RESTStorage {
+func MakeTaskRegistryStorage(registry TaskRegistry, containerInfo client.ContainerInfo, scheduler Scheduler, quota *QuotaTracker) apiserver.RESTStorage {
 	return &TaskRegistryStorage{
 		registry:      registry,
 		containerInfo: containerInfo,
 		scheduler:     scheduler,
+		quota:         quota,
 	}
 }
 
-// LabelMatch tests to see if a Task's labels map contains 'key' mapping to 'value'
-func LabelMatch(task api.Task, queryKey, queryValue string) bool {
-	for key, value := range task.Labels {
-		if queryKey == key && queryValue == value {
-			return true
-		}
+func (storage *TaskRegistryStorage) List(namespace string, url *url.URL) (interface{}, error) {
+	var result api.TaskList
+	selector, err := selectorFromURL(url)
+	if err != nil {
+		return result, err
 	}
-	return false
-}
-
-// LabelMatch tests to see if a Task's labels map contains all key/value pairs in 'labelQuery'
-func LabelsMatch(task api.Task, labelQuery *map[string]string) bool {
-	if labelQuery == nil {
-		return true
+	fieldSelector, err := fieldSelectorFromURL(url, taskFields(api.Task{}))
+	if err != nil {
+		return result, err
 	}
-	for key, value := range *labelQuery {
-		if !LabelMatch(task, key, value) {
-			return false
-		}
+	page, err := pageFromURL(namespace, url)
+	if err != nil {
+		return result, err
 	}
-	return true
-}
-
-func (storage *TaskRegistryStorage) List(url *url.URL) (interface{}, error) {
-	var result api.TaskList
-	var query *map[string]string
-	if url != nil {
-		queryMap := client.DecodeLabelQuery(url.Query().Get("labels"))
-		query = &queryMap
-	}
-	tasks, err := storage.registry.ListTasks(query)
-	if err == nil {
-		result = api.TaskList{
-			Items: tasks,
+	items, index, next, err := storage.pager.page(page, func() ([]interface{}, uint64, error) {
+		tasks, index, err := listTasksAtIndex(storage.registry, namespace, selector)
+		if err != nil {
+			return nil, 0, err
+		}
+		items := []interface{}{}
+		for _, task := range tasks {
+			if fieldSelector.Matches(taskFields(task)) {
+				items = append(items, task)
+			}
 		}
+		return items, index, nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result = api.TaskList{
+		JSONBase: api.JSONBase{ResourceVersion: index},
+		Items:    []api.Task{},
+		Continue: next,
 	}
-	return result, err
+	for _, item := range items {
+		result.Items = append(result.Items, item.(api.Task))
+	}
+	return result, nil
 }
 
-func (storage *TaskRegistryStorage) Get(id string) (interface{}, error) {
-	task, err := storage.registry.GetTask(id)
+func (storage *TaskRegistryStorage) Get(namespace, id string) (interface{}, error) {
+	task, err := storage.registry.GetTask(namespace, id)
 	if err != nil {
 		return task, err
 	}
-	info, err := storage.containerInfo.GetContainerInfo(task.CurrentState.Host, id)
+	info, err := storage.containerInfo.GetContainerInfo(task.CurrentState.Host, manifestID(namespace, id))
 	if err != nil {
 		return task, err
 	}
@@ -77,28 +88,227 @@ func (storage *TaskRegistryStorage) Get(id string) (interface{}, error) {
 	return task, err
 }
 
-func (storage *TaskRegistryStorage) Delete(id string) error {
-	return storage.registry.DeleteTask(id)
+// GetRecord returns the task as it is stored, without asking its kubelet about it.
+func (storage *TaskRegistryStorage) GetRecord(namespace, id string) (interface{}, error) {
+	return storage.registry.GetTask(namespace, id)
+}
+
+// locateContainer returns the machine the task runs on, and the name of the container
+// of it that a request is for. Tasks with a single container needn't name it; otherwise
+// the one container for which pick, if given, is true is taken.
+func (storage *TaskRegistryStorage) locateContainer(namespace, id, container string, pick func(api.Container) bool) (string, string, error) {
+	task, err := storage.registry.GetTask(namespace, id)
+	if err != nil {
+		return "", "", err
+	}
+	if len(task.CurrentState.Host) == 0 {
+		return "", "", api.NewBadRequestErr(fmt.Sprintf("task %s isn't on a machine yet", id))
+	}
+	names, picked := []string{}, []string{}
+	found := false
+	for _, item := range task.DesiredState.Manifest.Containers {
+		names = append(names, item.Name)
+		found = found || item.Name == container
+		if pick != nil && pick(item) {
+			picked = append(picked, item.Name)
+		}
+	}
+	switch {
+	case len(container) == 0 && len(names) == 1:
+		return task.CurrentState.Host, names[0], nil
+	case len(container) == 0 && len(picked) == 1:
+		return task.CurrentState.Host, picked[0], nil
+	case len(container) == 0:
+		return "", "", api.NewBadRequestErr(fmt.Sprintf("task %s has several containers, pick one of %s with ?container=", id, strings.Join(names, ", ")))
+	case !found:
+		return "", "", api.NewBadRequestErr(fmt.Sprintf("task %s has no container %s", id, container))
+	}
+	return task.CurrentState.Host, container, nil
+}
+
+// StreamLog streams the output of one of the task's containers from the kubelet on the
+// machine the task runs on. The container is picked with ?container=, which tasks with a
+// single container may leave out; follow, tail and timestamps are passed to the kubelet.
+func (storage *TaskRegistryStorage) StreamLog(namespace, id string, query url.Values) (io.ReadCloser, error) {
+	host, container, err := storage.locateContainer(namespace, id, query.Get("container"), nil)
+	if err != nil {
+		return nil, err
+	}
+	options := url.Values{}
+	for _, key := range []string{"follow", "tail", "timestamps"} {
+		if value := query.Get(key); len(value) > 0 {
+			options.Set(key, value)
+		}
+	}
+	return storage.containerInfo.GetContainerLogs(host, manifestID(namespace, id), container, options)
+}
+
+// Connect opens a stream to one of the task's containers, through the kubelet on the
+// machine the task runs on. "exec" runs ?command= (given once per argument) in the
+// container, with the stdin and tty args passed on. "portforward" connects to ?port=;
+// the container may be left out if only one of them declares the port.
+func (storage *TaskRegistryStorage) Connect(namespace, id, action string, query url.Values) (*stream.Conn, error) {
+	switch action {
+	case "exec":
+		if len(query["command"]) == 0 {
+			return nil, api.NewBadRequestErr("exec needs a command")
+		}
+		host, container, err := storage.locateContainer(namespace, id, query.Get("container"), nil)
+		if err != nil {
+			return nil, err
+		}
+		options := url.Values{"command": query["command"]}
+		for _, key := range []string{"stdin", "tty"} {
+			if value := query.Get(key); len(value) > 0 {
+				options.Set(key, value)
+			}
+		}
+		return storage.containerInfo.ExecInContainer(host, manifestID(namespace, id), container, options)
+	case "portforward":
+		port, err := strconv.Atoi(query.Get("port"))
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, api.NewBadRequestErr(fmt.Sprintf("invalid port %q", query.Get("port")))
+		}
+		host, container, err := storage.locateContainer(namespace, id, query.Get("container"), func(container api.Container) bool {
+			for _, item := range container.Ports {
+				if item.ContainerPort == port {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+		return storage.containerInfo.PortForward(host, manifestID(namespace, id), container, port)
+	}
+	return nil, api.NewNotFoundErr("task "+action, id)
+}
+
+func (storage *TaskRegistryStorage) Delete(namespace, id string) error {
+	return storage.registry.DeleteTask(namespace, id)
+}
+
+// DryRunDelete fails the way Delete would, without deleting anything.
+func (storage *TaskRegistryStorage) DryRunDelete(namespace, id string) error {
+	_, err := storage.registry.GetTask(namespace, id)
+	return err
 }
 
 func (storage *TaskRegistryStorage) Extract(body string) (interface{}, error) {
 	task := api.Task{}
-	err := json.Unmarshal([]byte(body), &task)
+	err := api.DecodeInto([]byte(body), &task)
 	return task, err
 }
 
-func (storage *TaskRegistryStorage) Create(task interface{}) error {
+func (storage *TaskRegistryStorage) Create(task interface{}) (interface{}, error) {
+	return storage.create(task, false)
+}
+
+// DryRunCreate does everything Create does, including picking the machine the task
+// would run on, but stores nothing. The machine is previewed (see Previewer), so a dry
+// run doesn't change where later tasks go.
+func (storage *TaskRegistryStorage) DryRunCreate(task interface{}) (interface{}, error) {
+	return storage.create(task, true)
+}
+
+func (storage *TaskRegistryStorage) create(task interface{}, dryRun bool) (interface{}, error) {
 	taskObj := task.(api.Task)
 	if len(taskObj.ID) == 0 {
-		return fmt.Errorf("ID is unspecified: %#v", task)
+		taskObj.ID = makeID()
+	}
+	taskObj.CreationTimestamp = creationTimestamp()
+	api.DefaultTask(&taskObj)
+	if errs := validation.ValidateTask(&taskObj); len(errs) > 0 {
+		return nil, api.NewInvalidErr("task", taskObj.ID, errs.Causes())
 	}
-	machine, err := storage.scheduler.Schedule(taskObj)
+	schedule := storage.scheduler.Schedule
+	if dryRun {
+		schedule = func(task api.Task) (string, error) {
+			return preview(storage.scheduler, task)
+		}
+	}
+	machine, err := schedule(taskObj)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	write := func() error {
+		return storage.registry.CreateTask(machine, taskObj)
+	}
+	if dryRun {
+		write = func() error {
+			return checkAbsent("task", taskObj.ID, func() error {
+				_, err := storage.registry.GetTask(taskObj.Namespace, taskObj.ID)
+				return err
+			})
+		}
 	}
-	return storage.registry.CreateTask(machine, taskObj)
+	err = storage.quota.Admit(taskObj, nil, write)
+	taskObj.CurrentState.Host = machine
+	return taskObj, err
+}
+
+func (storage *TaskRegistryStorage) Update(task interface{}) (interface{}, error) {
+	return storage.update(task, false)
+}
+
+// DryRunUpdate does everything Update does but store the task.
+func (storage *TaskRegistryStorage) DryRunUpdate(task interface{}) (interface{}, error) {
+	return storage.update(task, true)
 }
 
-func (storage *TaskRegistryStorage) Update(task interface{}) error {
-	return storage.registry.UpdateTask(task.(api.Task))
+func (storage *TaskRegistryStorage) update(task interface{}, dryRun bool) (interface{}, error) {
+	taskObj := task.(api.Task)
+	api.DefaultTask(&taskObj)
+	if errs := validation.ValidateTask(&taskObj); len(errs) > 0 {
+		return nil, api.NewInvalidErr("task", taskObj.ID, errs.Causes())
+	}
+	existing, err := storage.registry.GetTask(taskObj.Namespace, taskObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	taskObj.CreationTimestamp = existing.CreationTimestamp
+	// The current state is the kubelet's to set, through SetTasksStatus.
+	taskObj.CurrentState.Host = existing.CurrentState.Host
+	taskObj.CurrentState.Ready = existing.CurrentState.Ready
+	taskObj.CurrentState.ContainerStatuses = existing.CurrentState.ContainerStatuses
+	// Info is what Get asks the kubelet for; it's never stored.
+	taskObj.CurrentState.Info = nil
+	write := func() error {
+		return storage.registry.UpdateTask(taskObj)
+	}
+	if dryRun {
+		write = func() error {
+			return checkResourceVersion("task", taskObj.ID, existing.ResourceVersion, taskObj.ResourceVersion)
+		}
+	}
+	return taskObj, storage.quota.Admit(taskObj, *existing, write)
+}
+
+func (storage *TaskRegistryStorage) WatchAll(namespace string, url *url.URL) (watch.Interface, error) {
+	selector, err := selectorFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	fieldSelector, err := fieldSelectorFromURL(url, taskFields(api.Task{}))
+	if err != nil {
+		return nil, err
+	}
+	w, err := storage.registry.WatchTasks(namespace, selector)
+	if err != nil || fieldSelector.Empty() {
+		return w, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		return event, fieldSelector.Matches(taskFields(event.Object.(api.Task)))
+	}), nil
+}
+
+func (storage *TaskRegistryStorage) WatchSingle(namespace, id string) (watch.Interface, error) {
+	w, err := storage.registry.WatchTasks(namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		return event, event.Object.(api.Task).ID == id
+	}), nil
 }
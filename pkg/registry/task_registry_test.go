@@ -3,9 +3,18 @@ package registry
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"k8s-firstcommit/pkg/api"
+	"k8s-firstcommit/pkg/client"
+	"k8s-firstcommit/pkg/labels"
+	"k8s-firstcommit/pkg/stream"
+	"k8s-firstcommit/pkg/watch"
 )
 
 type MockTaskRegistry struct {
@@ -19,11 +28,11 @@ func expectNoError(t *testing.T, err error) {
 	}
 }
 
-func (registry *MockTaskRegistry) ListTasks(*map[string]string) ([]api.Task, error) {
+func (registry *MockTaskRegistry) ListTasks(namespace string, selector labels.Selector) ([]api.Task, error) {
 	return registry.tasks, registry.err
 }
 
-func (registry *MockTaskRegistry) GetTask(taskId string) (*api.Task, error) {
+func (registry *MockTaskRegistry) GetTask(namespace, taskId string) (*api.Task, error) {
 	return &api.Task{}, registry.err
 }
 
@@ -34,9 +43,12 @@ func (registry *MockTaskRegistry) CreateTask(machine string, task api.Task) erro
 func (registry *MockTaskRegistry) UpdateTask(task api.Task) error {
 	return registry.err
 }
-func (registry *MockTaskRegistry) DeleteTask(taskId string) error {
+func (registry *MockTaskRegistry) DeleteTask(namespace, taskId string) error {
 	return registry.err
 }
+func (registry *MockTaskRegistry) WatchTasks(namespace string, selector labels.Selector) (watch.Interface, error) {
+	return watch.NewFake(), registry.err
+}
 
 func TestListTasksError(t *testing.T) {
 	mockRegistry := MockTaskRegistry{
@@ -45,7 +57,7 @@ func TestListTasksError(t *testing.T) {
 	storage := TaskRegistryStorage{
 		registry: &mockRegistry,
 	}
-	tasks, err := storage.List(nil)
+	tasks, err := storage.List(api.NamespaceDefault, nil)
 	if err != mockRegistry.err {
 		t.Errorf("Expected %#v, Got %#v", mockRegistry.err, err)
 	}
@@ -59,7 +71,7 @@ func TestListEmptyTaskList(t *testing.T) {
 	storage := TaskRegistryStorage{
 		registry: &mockRegistry,
 	}
-	tasks, err := storage.List(nil)
+	tasks, err := storage.List(api.NamespaceDefault, nil)
 	expectNoError(t, err)
 	if len(tasks.(api.TaskList).Items) != 0 {
 		t.Errorf("Unexpected non-zero task list: %#v", tasks)
@@ -84,7 +96,7 @@ func TestListTaskList(t *testing.T) {
 	storage := TaskRegistryStorage{
 		registry: &mockRegistry,
 	}
-	tasksObj, err := storage.List(nil)
+	tasksObj, err := storage.List(api.NamespaceDefault, nil)
 	tasks := tasksObj.(api.TaskList)
 	expectNoError(t, err)
 	if len(tasks.Items) != 2 {
@@ -119,71 +131,306 @@ func TestExtractJson(t *testing.T) {
 	}
 }
 
-func expectLabelMatch(t *testing.T, task api.Task, key, value string) {
-	if !LabelMatch(task, key, value) {
-		t.Errorf("Unexpected match failure: %#v %s %s", task, key, value)
+func TestListTasksBadSelector(t *testing.T) {
+	storage := TaskRegistryStorage{
+		registry: &MockTaskRegistry{},
+	}
+	_, err := storage.List(api.NamespaceDefault, &url.URL{RawQuery: "labels=" + url.QueryEscape("name in (foo")})
+	if !api.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error, got %#v", err)
+	}
+}
+
+func TestCreateTaskInvalid(t *testing.T) {
+	mockRegistry := MockTaskRegistry{}
+	storage := TaskRegistryStorage{
+		registry: &mockRegistry,
+	}
+	_, err := storage.Create(api.Task{
+		JSONBase: api.JSONBase{ID: "Not_A_Label"},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "web"}},
+			},
+		},
+	})
+	if !api.IsInvalid(err) {
+		t.Fatalf("Expected invalid error, got %#v", err)
+	}
+	details := err.(*api.StatusError).Status().Details
+	if details == nil || len(details.Causes) != 2 {
+		t.Errorf("Expected causes for id and image, got %#v", details)
 	}
 }
 
-func expectNoLabelMatch(t *testing.T, task api.Task, key, value string) {
-	if LabelMatch(task, key, value) {
-		t.Errorf("Unexpected match success: %#v %s %s", task, key, value)
+func TestCreateTaskDefaults(t *testing.T) {
+	mockRegistry := MockTaskRegistry{}
+	storage := TaskRegistryStorage{
+		registry:  &mockRegistry,
+		scheduler: MakeRoundRobinScheduler([]string{"machine"}),
+	}
+	obj, err := storage.Create(api.Task{
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{
+					{
+						Image: "dockerfile/nginx",
+						Ports: []api.Port{{HostPort: 8080}},
+					},
+				},
+			},
+		},
+	})
+	expectNoError(t, err)
+	task := obj.(api.Task)
+	if len(task.ID) == 0 {
+		t.Error("Expected an ID to be generated")
+	}
+	if len(task.CreationTimestamp) == 0 {
+		t.Error("Expected a creation timestamp")
+	}
+	manifest := task.DesiredState.Manifest
+	if manifest.Version != api.ManifestVersion {
+		t.Errorf("Unexpected manifest version: %s", manifest.Version)
+	}
+	port := manifest.Containers[0].Ports[0]
+	if port.ContainerPort != 8080 || port.Protocol != api.ProtocolTCP {
+		t.Errorf("Unexpected port: %#v", port)
 	}
 }
 
-func expectLabelsMatch(t *testing.T, task api.Task, query *map[string]string) {
-	if !LabelsMatch(task, query) {
-		t.Errorf("Unexpected match failure: %#v %#v", task, *query)
+func TestDryRunCreateTask(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	storage := MakeTaskRegistryStorage(registry, nil, MakeRoundRobinScheduler([]string{"machine", "other"}), nil).(*TaskRegistryStorage)
+	task := api.Task{
+		JSONBase: api.JSONBase{ID: "foo", Namespace: api.NamespaceDefault},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "web", Image: "dockerfile/nginx"}},
+			},
+		},
+	}
+	// Dry runs don't move the scheduler on.
+	for i := 0; i < 2; i++ {
+		obj, err := storage.DryRunCreate(task)
+		expectNoError(t, err)
+		if host := obj.(api.Task).CurrentState.Host; host != "machine" {
+			t.Errorf("Expected the chosen host, got %q", host)
+		}
+	}
+	if tasks, _ := registry.ListTasks(api.NamespaceAll, nil); len(tasks) != 0 {
+		t.Errorf("Expected nothing to be stored, got %#v", tasks)
+	}
+
+	obj, err := storage.Create(task)
+	expectNoError(t, err)
+	if host := obj.(api.Task).CurrentState.Host; host != "machine" {
+		t.Errorf("Expected the previewed host, got %q", host)
+	}
+	if _, err := storage.DryRunCreate(task); !api.IsAlreadyExists(err) {
+		t.Errorf("Expected an already exists error, got %#v", err)
+	}
+	if err := storage.DryRunDelete(api.NamespaceDefault, "bar"); !api.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %#v", err)
+	}
+	expectNoError(t, storage.DryRunDelete(api.NamespaceDefault, "foo"))
+	if _, err := registry.GetTask(api.NamespaceDefault, "foo"); err != nil {
+		t.Errorf("Expected the task to be kept, got %#v", err)
 	}
 }
 
-func expectNoLabelsMatch(t *testing.T, task api.Task, query *map[string]string) {
-	if LabelsMatch(task, query) {
-		t.Errorf("Unexpected match success: %#v %#v", task, *query)
+func TestGetTaskRecord(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	// Without container info, a kubelet call would panic.
+	storage := MakeTaskRegistryStorage(registry, nil, nil, nil).(*TaskRegistryStorage)
+	expectNoError(t, registry.CreateTask("machine", api.Task{JSONBase: api.JSONBase{ID: "foo", Namespace: api.NamespaceDefault}}))
+	obj, err := storage.GetRecord(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if task := obj.(*api.Task); task.ID != "foo" || task.CurrentState.Info != nil {
+		t.Errorf("Unexpected task: %#v", task)
+	}
+	_, err = storage.GetRecord(api.NamespaceDefault, "bar")
+	if !api.IsNotFound(err) {
+		t.Errorf("Expected not found, got %#v", err)
 	}
 }
 
-func TestLabelMatch(t *testing.T) {
+func TestUpdateTaskKeepsStatus(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	storage := MakeTaskRegistryStorage(registry, nil, nil, nil).(*TaskRegistryStorage)
 	task := api.Task{
-		Labels: map[string]string{
-			"foo": "bar",
-			"baz": "blah",
+		JSONBase: api.JSONBase{ID: "foo", Namespace: api.NamespaceDefault},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "web", Image: "dockerfile/nginx"}},
+			},
 		},
 	}
-	expectLabelMatch(t, task, "foo", "bar")
-	expectLabelMatch(t, task, "baz", "blah")
-	expectNoLabelMatch(t, task, "foo", "blah")
-	expectNoLabelMatch(t, task, "baz", "bar")
+	stored := task
+	stored.CurrentState = api.TaskState{Host: "machine"}
+	expectNoError(t, registry.CreateTask("machine", stored))
+
+	// A client can't make a task ready.
+	task.CurrentState.Ready = true
+	_, err := storage.Update(task)
+	expectNoError(t, err)
+	updated, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if updated.CurrentState.Ready || updated.CurrentState.Host != "machine" {
+		t.Errorf("Unexpected current state: %#v", updated.CurrentState)
+	}
+
+	// Nor unready, by leaving the status out.
+	updated.CurrentState.Ready = true
+	expectNoError(t, registry.UpdateTask(*updated))
+	task.CurrentState = api.TaskState{}
+	task.Labels = map[string]string{"name": "web"}
+	_, err = storage.Update(task)
+	expectNoError(t, err)
+	updated, err = registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if !updated.CurrentState.Ready || updated.Labels["name"] != "web" {
+		t.Errorf("Unexpected task: %#v", updated)
+	}
 }
 
-func TestLabelsMatch(t *testing.T) {
+func TestUpdateTaskKeepsContainerStatuses(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	storage := MakeTaskRegistryStorage(registry, nil, nil, nil).(*TaskRegistryStorage)
 	task := api.Task{
-		Labels: map[string]string{
-			"foo": "bar",
-			"baz": "blah",
+		JSONBase: api.JSONBase{ID: "foo", Namespace: api.NamespaceDefault},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "web", Image: "dockerfile/nginx"}},
+			},
 		},
 	}
-	expectLabelsMatch(t, task, &map[string]string{})
-	expectLabelsMatch(t, task, &map[string]string{
-		"foo": "bar",
-	})
-	expectLabelsMatch(t, task, &map[string]string{
-		"baz": "blah",
-	})
-	expectLabelsMatch(t, task, &map[string]string{
-		"foo": "bar",
-		"baz": "blah",
-	})
-	expectNoLabelsMatch(t, task, &map[string]string{
-		"foo": "blah",
-	})
-	expectNoLabelsMatch(t, task, &map[string]string{
-		"baz": "bar",
-	})
-	expectNoLabelsMatch(t, task, &map[string]string{
-		"foo":    "bar",
-		"foobar": "bar",
-		"baz":    "blah",
-	})
+	statuses := []api.ContainerStatus{{
+		Name:            "web",
+		RestartCount:    3,
+		LastTermination: &api.ContainerTermination{ExitCode: 137, Reason: "OOMKilled"},
+	}}
+	stored := task
+	stored.CurrentState = api.TaskState{Host: "machine", ContainerStatuses: statuses}
+	expectNoError(t, registry.CreateTask("machine", stored))
+
+	task.CurrentState.ContainerStatuses = []api.ContainerStatus{{Name: "web"}}
+	// Nor is what Get asked the kubelet stored.
+	task.CurrentState.Info = map[string]interface{}{"web": "running"}
+	_, err := storage.Update(task)
+	expectNoError(t, err)
+	updated, err := registry.GetTask(api.NamespaceDefault, "foo")
+	expectNoError(t, err)
+	if !reflect.DeepEqual(updated.CurrentState.ContainerStatuses, statuses) || updated.CurrentState.Info != nil {
+		t.Errorf("Unexpected current state: %#v", updated.CurrentState)
+	}
+}
+
+// fakeContainerStreams records the streams asked of it.
+type fakeContainerStreams struct {
+	client.FakeContainerInfo
+	action, host, manifestID, container string
+	options                             url.Values
+	port                                int
+}
+
+func (f *fakeContainerStreams) GetContainerLogs(host, manifestID, container string, options url.Values) (io.ReadCloser, error) {
+	f.action, f.host, f.manifestID, f.container, f.options = "log", host, manifestID, container, options
+	return ioutil.NopCloser(strings.NewReader("hello\n")), nil
+}
+
+func (f *fakeContainerStreams) ExecInContainer(host, manifestID, container string, options url.Values) (*stream.Conn, error) {
+	f.action, f.host, f.manifestID, f.container, f.options = "exec", host, manifestID, container, options
+	return nil, nil
+}
+
+func (f *fakeContainerStreams) PortForward(host, manifestID, container string, port int) (*stream.Conn, error) {
+	f.action, f.host, f.manifestID, f.container, f.port = "portforward", host, manifestID, container, port
+	return nil, nil
+}
+
+func TestStreamLog(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	logs := &fakeContainerStreams{}
+	storage := MakeTaskRegistryStorage(registry, logs, nil, nil).(*TaskRegistryStorage)
+	task := api.Task{
+		JSONBase: api.JSONBase{ID: "foo", Namespace: "ops"},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{{Name: "web"}, {Name: "log"}},
+			},
+		},
+		CurrentState: api.TaskState{Host: "machine"},
+	}
+	expectNoError(t, registry.CreateTask("machine", task))
 
+	stream, err := storage.StreamLog("ops", "foo", url.Values{"container": {"log"}, "follow": {"true"}, "labels": {"a=b"}})
+	expectNoError(t, err)
+	data, err := ioutil.ReadAll(stream)
+	expectNoError(t, err)
+	if string(data) != "hello\n" {
+		t.Errorf("Unexpected logs: %s", data)
+	}
+	if logs.host != "machine" || logs.manifestID != "foo.ops" || logs.container != "log" || logs.options.Encode() != "follow=true" {
+		t.Errorf("Unexpected log stream: %#v", logs)
+	}
+
+	for _, query := range []url.Values{{}, {"container": {"db"}}} {
+		if _, err := storage.StreamLog("ops", "foo", query); !api.IsBadRequest(err) {
+			t.Errorf("Expected a bad request error for %v, got %#v", query, err)
+		}
+	}
+	if _, err := storage.StreamLog("ops", "bar", url.Values{}); !api.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %#v", err)
+	}
+}
+
+func TestConnectTask(t *testing.T) {
+	registry := MakeMemoryRegistry()
+	kubelet := &fakeContainerStreams{}
+	storage := MakeTaskRegistryStorage(registry, kubelet, nil, nil).(*TaskRegistryStorage)
+	task := api.Task{
+		JSONBase: api.JSONBase{ID: "foo"},
+		DesiredState: api.TaskState{
+			Manifest: api.ContainerManifest{
+				Containers: []api.Container{
+					{Name: "redis", Ports: []api.Port{{ContainerPort: 6379}}},
+					{Name: "sentinel", Ports: []api.Port{{ContainerPort: 26379}}},
+				},
+			},
+		},
+		CurrentState: api.TaskState{Host: "machine"},
+	}
+	expectNoError(t, registry.CreateTask("machine", task))
+
+	_, err := storage.Connect(api.NamespaceDefault, "foo", "exec", url.Values{"container": {"redis"}, "command": {"redis-cli", "ping"}, "tty": {"true"}, "follow": {"true"}})
+	expectNoError(t, err)
+	if kubelet.action != "exec" || kubelet.host != "machine" || kubelet.manifestID != "foo" || kubelet.container != "redis" || kubelet.options.Encode() != "command=redis-cli&command=ping&tty=true" {
+		t.Errorf("Unexpected stream: %#v", kubelet)
+	}
+	_, err = storage.Connect(api.NamespaceDefault, "foo", "portforward", url.Values{"port": {"26379"}})
+	expectNoError(t, err)
+	if kubelet.action != "portforward" || kubelet.container != "sentinel" || kubelet.port != 26379 {
+		t.Errorf("Unexpected stream: %#v", kubelet)
+	}
+
+	for _, query := range []url.Values{
+		{"container": {"redis"}},
+		{"command": {"ls"}},
+	} {
+		if _, err := storage.Connect(api.NamespaceDefault, "foo", "exec", query); !api.IsBadRequest(err) {
+			t.Errorf("Expected a bad request error for %v, got %#v", query, err)
+		}
+	}
+	for _, query := range []url.Values{
+		{"port": {"http"}},
+		{"port": {"8080"}},
+	} {
+		if _, err := storage.Connect(api.NamespaceDefault, "foo", "portforward", query); !api.IsBadRequest(err) {
+			t.Errorf("Expected a bad request error for %v, got %#v", query, err)
+		}
+	}
+	if _, err := storage.Connect(api.NamespaceDefault, "foo", "attach", url.Values{}); !api.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %#v", err)
+	}
 }
@@ -0,0 +1,233 @@
+// Package stream implements the bidirectional streams that exec and port forwarding
+// run over. A client asks for one by sending an HTTP request with "Upgrade: kube-stream";
+// once the server answers 101 Switching Protocols, both sides exchange frames over the
+// raw connection. A frame is a channel byte, a big-endian uint32 length and that many
+// bytes of data.
+package stream
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol is the name of the protocol in the Upgrade header.
+const Protocol = "kube-stream"
+
+// The channels a frame can be sent on.
+const (
+	// Stdin carries input from the client. An empty frame closes the input.
+	Stdin byte = iota
+	Stdout
+	Stderr
+	// Status carries an ExitStatus, as JSON, and is the last frame the server sends.
+	Status
+	// Resize carries a TerminalSize, as JSON, from the client.
+	Resize
+)
+
+// maxFrameSize bounds the frames read, so a bad peer can't make us allocate at will.
+const maxFrameSize = 1 << 20
+
+// ExitStatus is the outcome of a stream, sent on the Status channel.
+type ExitStatus struct {
+	// ExitCode is the exit code of an exec'd command.
+	ExitCode int `json:"exitCode"`
+	// Error says why the stream failed, and is empty if it didn't.
+	Error string `json:"error,omitempty"`
+}
+
+// TerminalSize is the size of the client's terminal, sent on the Resize channel.
+type TerminalSize struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+// Conn is an upgraded connection. Frames can be written from several goroutines at once,
+// but should be read from one.
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader) *Conn {
+	return &Conn{Conn: conn, reader: reader}
+}
+
+// Read reads the raw connection, including anything buffered during the upgrade.
+func (c *Conn) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+// WriteFrame sends data on channel.
+func (c *Conn) WriteFrame(channel byte, data []byte) error {
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes is too large", len(data))
+	}
+	header := make([]byte, 5)
+	header[0] = channel
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err := c.Conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(data)
+	return err
+}
+
+// WriteJSON sends obj, encoded as JSON, on channel.
+func (c *Conn) WriteJSON(channel byte, obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(channel, data)
+}
+
+// ReadFrame returns the next frame.
+func (c *Conn) ReadFrame() (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+// Writer returns an io.Writer which sends everything written to it on channel.
+func (c *Conn) Writer(channel byte) io.Writer {
+	return channelWriter{c, channel}
+}
+
+type channelWriter struct {
+	conn    *Conn
+	channel byte
+}
+
+func (w channelWriter) Write(data []byte) (int, error) {
+	for written := 0; written < len(data); {
+		end := written + maxFrameSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := w.conn.WriteFrame(w.channel, data[written:end]); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return len(data), nil
+}
+
+// IsUpgradeRequest returns true if req asks for a stream.
+func IsUpgradeRequest(req *http.Request) bool {
+	return strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade") &&
+		strings.EqualFold(req.Header.Get("Upgrade"), Protocol)
+}
+
+// Upgrade answers req with 101 Switching Protocols and takes over its connection. The
+// server's deadlines are cleared, since a stream lasts as long as the client wants.
+func Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	if !IsUpgradeRequest(req) {
+		return nil, fmt.Errorf("the request must upgrade to %s", Protocol)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("the connection can't be upgraded")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", Protocol); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newConn(conn, buffered.Reader), nil
+}
+
+// Dial sends req, which should have no body, and returns the stream it is upgraded to.
+// https URLs are dialed with tlsConfig. If the server doesn't upgrade the connection,
+// the error holds its response.
+func Dial(req *http.Request, tlsConfig *tls.Config) (*Conn, error) {
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", Protocol)
+	host := req.URL.Host
+	var conn net.Conn
+	var err error
+	if req.URL.Scheme == "https" {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "443")
+		}
+		conn, err = tls.Dial("tcp", host, tlsConfig)
+	} else {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "80")
+		}
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		defer conn.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, &UpgradeError{StatusCode: response.StatusCode, ContentType: response.Header.Get("Content-Type"), Body: body}
+	}
+	return newConn(conn, reader), nil
+}
+
+// UpgradeError is the response of a server which didn't upgrade a connection.
+type UpgradeError struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+func (e *UpgradeError) Error() string {
+	return fmt.Sprintf("the server answered %d: %s", e.StatusCode, e.Body)
+}
+
+// Join copies everything read from each connection to the other, until either side
+// closes, and then closes both.
+func Join(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	pump := func(to io.Writer, from io.Reader) {
+		io.Copy(to, from)
+		done <- struct{}{}
+	}
+	go pump(a, b)
+	go pump(b, a)
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
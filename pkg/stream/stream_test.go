@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func expectNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+}
+
+// echoHandler sends every stdin frame back on stdout, and ends with a status once stdin
+// is closed.
+func echoHandler(w http.ResponseWriter, req *http.Request) {
+	if !IsUpgradeRequest(req) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("not a stream"))
+		return
+	}
+	conn, err := Upgrade(w, req)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		channel, data, err := conn.ReadFrame()
+		if err != nil {
+			return
+		}
+		if channel == Stdin && len(data) == 0 {
+			conn.WriteJSON(Status, ExitStatus{ExitCode: 3})
+			return
+		}
+		conn.WriteFrame(Stdout, data)
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(echoHandler))
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/exec", nil)
+	expectNoError(t, err)
+	conn, err := Dial(req, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	large := bytes.Repeat([]byte("x"), maxFrameSize+1)
+	_, err = conn.Writer(Stdin).Write(large)
+	expectNoError(t, err)
+	expectNoError(t, conn.WriteFrame(Stdin, nil))
+
+	received := []byte{}
+	for {
+		channel, data, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if channel == Status {
+			if string(data) != `{"exitCode":3}` {
+				t.Errorf("Unexpected status: %s", data)
+			}
+			break
+		}
+		received = append(received, data...)
+	}
+	if !bytes.Equal(received, large) {
+		t.Errorf("Expected %d bytes back, got %d", len(large), len(received))
+	}
+}
+
+func TestDialNotUpgraded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no such task"))
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/exec", nil)
+	expectNoError(t, err)
+	_, err = Dial(req, nil)
+	upgradeErr, ok := err.(*UpgradeError)
+	if !ok || upgradeErr.StatusCode != http.StatusNotFound || string(upgradeErr.Body) != "no such task" {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(echoHandler))
+	defer backend.Close()
+	// The proxy dials the backend first, so that its failures are still plain responses.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		out, err := http.NewRequest("POST", backend.URL+req.URL.Path, nil)
+		expectNoError(t, err)
+		upstream, err := Dial(out, nil)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, err := Upgrade(w, req)
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		Join(conn, upstream)
+	}))
+	defer proxy.Close()
+
+	req, err := http.NewRequest("POST", proxy.URL+"/exec", nil)
+	expectNoError(t, err)
+	conn, err := Dial(req, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	expectNoError(t, conn.WriteFrame(Stdin, []byte("hello")))
+	channel, data, err := conn.ReadFrame()
+	expectNoError(t, err)
+	if channel != Stdout || string(data) != "hello" {
+		t.Errorf("Unexpected frame %d: %s", channel, data)
+	}
+	expectNoError(t, conn.WriteFrame(Stdin, nil))
+	channel, _, err = conn.ReadFrame()
+	expectNoError(t, err)
+	if channel != Status {
+		t.Errorf("Expected a status, got channel %d", channel)
+	}
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"io"
+	"net/http"
+)
+
+// FlushWriter is an io.Writer which flushes every write through to the client, when the
+// writer underneath is an http.Flusher. Streams which are followed for a long time, like
+// container logs, would otherwise sit in the server's buffers.
+type FlushWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+}
+
+func NewFlushWriter(w io.Writer) *FlushWriter {
+	flusher, _ := w.(http.Flusher)
+	return &FlushWriter{writer: w, flusher: flusher}
+}
+
+func (f *FlushWriter) Write(data []byte) (int, error) {
+	n, err := f.writer.Write(data)
+	if f.flusher != nil {
+		f.flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func expectFile(t *testing.T, path, expected string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("Unexpected error reading %s: %v", path, err)
+		return
+	}
+	if string(data) != expected {
+		t.Errorf("Expected %q in %s, got %q", expected, path, string(data))
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	f, err := NewRotatingFile(path, 8, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{"aaaa\n", "bbb\n", "cccc\n", "dddd\n", "eeeeeeeeee\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	f.Close()
+
+	expectFile(t, path, "eeeeeeeeee\n")
+	expectFile(t, path+".1", "dddd\n")
+	expectFile(t, path+".2", "cccc\n")
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only two backups, got %v", err)
+	}
+
+	// Reopening appends to what is there.
+	f, err = NewRotatingFile(path, 100, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Write([]byte("f\n"))
+	f.Close()
+	expectFile(t, path, "eeeeeeeeee\nf\n")
+}
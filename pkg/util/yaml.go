@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// YAMLToJSON converts a YAML document into the equivalent JSON. Since JSON is a subset
+// of YAML, JSON input comes back unchanged apart from formatting.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	var obj interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	obj, err := jsonCompatible(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// JSONToYAML converts a JSON document into the equivalent YAML.
+func JSONToYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers exact, so large integers such as resource versions don't turn into
+	// floats on the way.
+	decoder.UseNumber()
+	var obj interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(yamlCompatible(obj))
+}
+
+// jsonCompatible replaces the map[interface{}]interface{} values produced by the YAML
+// decoder, which encoding/json can't handle, with map[string]interface{}.
+func jsonCompatible(obj interface{}) (interface{}, error) {
+	switch typed := obj.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, value := range typed {
+			converted, err := jsonCompatible(value)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case string, int, int64, float64, bool:
+				result[fmt.Sprint(key)] = converted
+			default:
+				return nil, fmt.Errorf("unsupported map key %#v", key)
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, value := range typed {
+			converted, err := jsonCompatible(value)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	default:
+		return obj, nil
+	}
+}
+
+// yamlCompatible turns the json.Numbers left by a UseNumber decoder into ints or floats,
+// which the YAML encoder writes without quotes.
+func yamlCompatible(obj interface{}) interface{} {
+	switch typed := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range typed {
+			typed[key] = yamlCompatible(value)
+		}
+		return typed
+	case []interface{}:
+		for i, value := range typed {
+			typed[i] = yamlCompatible(value)
+		}
+		return typed
+	case json.Number:
+		if i, err := typed.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(typed), 10, 64); err == nil {
+			return u
+		}
+		f, _ := typed.Float64()
+		return f
+	default:
+		return obj
+	}
+}
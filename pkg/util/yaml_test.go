@@ -0,0 +1,71 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	data := []byte(`
+id: nginx-controller
+desiredState:
+  replicas: 2
+  replicasInSet:
+    name: nginx
+  taskTemplate:
+    desiredState:
+      manifest:
+        containers:
+          - image: dockerfile/nginx
+            ports:
+              - containerPort: 80
+                hostPort: 8080
+`)
+	out, err := YAMLToJSON(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"desiredState":{"replicas":2,"replicasInSet":{"name":"nginx"},"taskTemplate":{"desiredState":{"manifest":{"containers":[{"image":"dockerfile/nginx","ports":[{"containerPort":80,"hostPort":8080}]}]}}}},"id":"nginx-controller"}`
+	if string(out) != expected {
+		t.Errorf("Unexpected JSON: %s", out)
+	}
+}
+
+func TestYAMLToJSONPassesJSON(t *testing.T) {
+	out, err := YAMLToJSON([]byte(`{"id": "foo", "port": 80, "labels": {"a": "b"}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != `{"id":"foo","labels":{"a":"b"},"port":80}` {
+		t.Errorf("Unexpected JSON: %s", out)
+	}
+}
+
+func TestYAMLToJSONInvalid(t *testing.T) {
+	if _, err := YAMLToJSON([]byte("a: [b")); err == nil {
+		t.Error("Expected an error for invalid YAML")
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	out, err := JSONToYAML([]byte(`{"id": "foo", "resourceVersion": 18446744073709551615, "port": 80, "ratio": 0.5, "items": [{"a": true}]}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(out, &obj); err != nil {
+		t.Fatalf("Unexpected error reading back %s: %v", out, err)
+	}
+	expected := map[string]interface{}{
+		"id":              "foo",
+		"resourceVersion": uint64(18446744073709551615),
+		"port":            80,
+		"ratio":           0.5,
+		"items":           []interface{}{map[interface{}]interface{}{"a": true}},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Unexpected YAML:\n%s", out)
+	}
+}
@@ -0,0 +1,206 @@
+// Package watch contains a generic interface for streaming changes to objects, so
+// that consumers don't need to know whether the changes come from etcd, memory or
+// the API server.
+package watch
+
+import (
+	"sync"
+)
+
+// Interface can be implemented by anything that knows how to watch and report changes.
+type Interface interface {
+	// Stop tells the producer that the consumer is no longer interested. The result
+	// channel will be closed shortly afterwards.
+	Stop()
+
+	// ResultChan returns a channel which receives all the events. It is closed when
+	// the watch ends, either because Stop was called or because the source went away.
+	ResultChan() <-chan Event
+}
+
+// EventType defines the possible types of events.
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+// Event represents a single change to a watched object.
+type Event struct {
+	Type EventType
+
+	// Object is the state of the object after the change, or, for Deleted, the last
+	// known state of the object.
+	Object interface{}
+}
+
+// Broadcaster distributes events to any number of watchers. It is useful for sources
+// which don't have a native watch, such as the in-memory registry.
+type Broadcaster struct {
+	lock     sync.Mutex
+	watchers map[int64]*broadcasterWatcher
+	nextID   int64
+	queueLen int
+}
+
+// NewBroadcaster creates a Broadcaster whose watchers may each buffer up to queueLen
+// undelivered events.
+func NewBroadcaster(queueLen int) *Broadcaster {
+	return &Broadcaster{
+		watchers: map[int64]*broadcasterWatcher{},
+		queueLen: queueLen,
+	}
+}
+
+// Watch adds a new watcher which receives every event sent to Action after this call.
+func (b *Broadcaster) Watch() Interface {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	id := b.nextID
+	b.nextID++
+	w := &broadcasterWatcher{
+		result: make(chan Event, b.queueLen),
+		stop: func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			if w, ok := b.watchers[id]; ok {
+				delete(b.watchers, id)
+				close(w.result)
+			}
+		},
+	}
+	b.watchers[id] = w
+	return w
+}
+
+// Action sends an event to all current watchers. A watcher which has fallen more than
+// queueLen events behind is closed rather than allowed to block everyone else; its
+// consumer is expected to list and watch again.
+func (b *Broadcaster) Action(action EventType, obj interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for id, w := range b.watchers {
+		select {
+		case w.result <- Event{action, obj}:
+		default:
+			delete(b.watchers, id)
+			close(w.result)
+		}
+	}
+}
+
+// Shutdown closes every watcher.
+func (b *Broadcaster) Shutdown() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for id, w := range b.watchers {
+		delete(b.watchers, id)
+		close(w.result)
+	}
+}
+
+type broadcasterWatcher struct {
+	result chan Event
+	stop   func()
+}
+
+func (w *broadcasterWatcher) ResultChan() <-chan Event {
+	return w.result
+}
+
+func (w *broadcasterWatcher) Stop() {
+	w.stop()
+}
+
+// FilterFunc may transform an event, and returns false if the event should be dropped.
+type FilterFunc func(in Event) (out Event, keep bool)
+
+// Filter passes the events from w through f. Stopping the result stops w.
+func Filter(w Interface, f FilterFunc) Interface {
+	fw := &filteredWatch{
+		incoming: w,
+		result:   make(chan Event),
+		stopped:  make(chan struct{}),
+		f:        f,
+	}
+	go fw.loop()
+	return fw
+}
+
+type filteredWatch struct {
+	incoming Interface
+	result   chan Event
+	stopped  chan struct{}
+	stopOnce sync.Once
+	f        FilterFunc
+}
+
+func (fw *filteredWatch) ResultChan() <-chan Event {
+	return fw.result
+}
+
+func (fw *filteredWatch) Stop() {
+	fw.stopOnce.Do(func() {
+		close(fw.stopped)
+		fw.incoming.Stop()
+	})
+}
+
+func (fw *filteredWatch) loop() {
+	defer close(fw.result)
+	for event := range fw.incoming.ResultChan() {
+		filtered, keep := fw.f(event)
+		if !keep {
+			continue
+		}
+		select {
+		case fw.result <- filtered:
+		case <-fw.stopped:
+			return
+		}
+	}
+}
+
+// FakeWatcher lets tests send events by hand.
+type FakeWatcher struct {
+	result  chan Event
+	Stopped bool
+	lock    sync.Mutex
+}
+
+func NewFake() *FakeWatcher {
+	return &FakeWatcher{
+		result: make(chan Event),
+	}
+}
+
+// Stop implements Interface.Stop().
+func (f *FakeWatcher) Stop() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.Stopped {
+		close(f.result)
+		f.Stopped = true
+	}
+}
+
+func (f *FakeWatcher) ResultChan() <-chan Event {
+	return f.result
+}
+
+// Add sends an add event.
+func (f *FakeWatcher) Add(obj interface{}) {
+	f.result <- Event{Added, obj}
+}
+
+// Modify sends a modify event.
+func (f *FakeWatcher) Modify(obj interface{}) {
+	f.result <- Event{Modified, obj}
+}
+
+// Delete sends a delete event.
+func (f *FakeWatcher) Delete(lastValue interface{}) {
+	f.result <- Event{Deleted, lastValue}
+}
@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster(10)
+	w1 := b.Watch()
+	w2 := b.Watch()
+	b.Action(Added, "foo")
+	b.Action(Deleted, "bar")
+	expected := []Event{{Added, "foo"}, {Deleted, "bar"}}
+	for _, w := range []Interface{w1, w2} {
+		for _, e := range expected {
+			got := <-w.ResultChan()
+			if !reflect.DeepEqual(e, got) {
+				t.Errorf("Expected %#v, got %#v", e, got)
+			}
+		}
+	}
+	w1.Stop()
+	if _, ok := <-w1.ResultChan(); ok {
+		t.Errorf("Expected closed channel after stop")
+	}
+	b.Action(Modified, "baz")
+	if got := <-w2.ResultChan(); !reflect.DeepEqual(got, Event{Modified, "baz"}) {
+		t.Errorf("Unexpected event: %#v", got)
+	}
+	b.Shutdown()
+	if _, ok := <-w2.ResultChan(); ok {
+		t.Errorf("Expected closed channel after shutdown")
+	}
+}
+
+func TestBroadcasterDropsSlowWatcher(t *testing.T) {
+	b := NewBroadcaster(1)
+	w := b.Watch()
+	b.Action(Added, "foo")
+	b.Action(Added, "bar")
+	if got := <-w.ResultChan(); !reflect.DeepEqual(got, Event{Added, "foo"}) {
+		t.Errorf("Unexpected event: %#v", got)
+	}
+	if _, ok := <-w.ResultChan(); ok {
+		t.Errorf("Expected slow watcher to be closed")
+	}
+	// Stopping an already dropped watcher is harmless.
+	w.Stop()
+}
+
+func TestFilter(t *testing.T) {
+	source := NewFake()
+	filtered := Filter(source, func(in Event) (Event, bool) {
+		return in, in.Object.(string) != "skip"
+	})
+	go func() {
+		source.Add("foo")
+		source.Modify("skip")
+		source.Delete("bar")
+		source.Stop()
+	}()
+	var got []Event
+	for e := range filtered.ResultChan() {
+		got = append(got, e)
+	}
+	expected := []Event{{Added, "foo"}, {Deleted, "bar"}}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %#v, got %#v", expected, got)
+	}
+}